@@ -0,0 +1,221 @@
+package cmpp
+
+import (
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	codec "github.com/aaronwong1989/gosms/codec/cmpp"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/metrics"
+	"github.com/aaronwong1989/gosms/comm/snowflake"
+	"github.com/aaronwong1989/gosms/comm/sp"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func init() {
+	codec.Conf = yml_config.CreateYamlFactory("cmpp.yaml")
+	dc := codec.Conf.GetInt("datacenter-id")
+	wk := codec.Conf.GetInt("worker-id")
+	codec.Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
+	codec.Seq64 = snowflake.NewSnowflake(int64(dc), int64(wk))
+	codec.ReportSeq = comm.NewCycleSequence(int32(dc), int32(wk))
+}
+
+// 模拟网关：登录成功后，对每条Submit返回应答和状态报告，并在登录后下发一条上行短信
+func fakeServer(t *testing.T, ln net.Listener, conns *int32) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(conns, 1)
+		go func(conn net.Conn) {
+			defer func() { _ = conn.Close() }()
+			ctx := codec.Default()
+			for {
+				header, frame, err := readPdu(conn)
+				if err != nil {
+					return
+				}
+				switch header.CommandId {
+				case codec.CMPP_CONNECT:
+					con := &codec.Connect{}
+					_ = con.Decode(header, frame, ctx)
+					resp := con.ToResponse(0).(*codec.ConnectResp)
+					ctx = ctx.WithVersion(resp.Version())
+					_, _ = conn.Write(resp.Encode())
+					_, _ = conn.Write(ctx.NewDelivery("13800001111", "你好", "", "").Encode())
+				case codec.CMPP_SUBMIT:
+					sub := &codec.Submit{}
+					assert.True(t, sub.Decode(header, frame, ctx) == nil)
+					resp := sub.ToResponse(0).(*codec.SubmitResp)
+					_, _ = conn.Write(resp.Encode())
+					_, _ = conn.Write(sub.ToDeliveryReport(resp.MsgId()).Encode())
+				case codec.CMPP_TERMINATE:
+					_, _ = conn.Write(codec.NewTerminateResp(header.SequenceId).Encode())
+					return
+				case codec.CMPP_ACTIVE_TEST:
+					at := &codec.ActiveTest{MessageHeader: header}
+					_, _ = conn.Write(at.ToResponse(0).(*codec.ActiveTestResp).Encode())
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	defer func() { _ = ln.Close() }()
+	var conns int32
+	go fakeServer(t, ln, &conns)
+
+	reports := make(chan *codec.Report, 16)
+	mos := make(chan *codec.Delivery, 16)
+	m := metrics.New("cmpp", codec.CommandMap)
+	cli, err := Dial(Options{
+		Address:        ln.Addr().String(),
+		WindowSize:     4,
+		ReconnectDelay: 100 * time.Millisecond,
+		OnReport:       func(rpt *codec.Report) { reports <- rpt },
+		OnDelivery:     func(dly *codec.Delivery) { mos <- dly },
+		Metrics:        m,
+	})
+	assert.True(t, err == nil)
+
+	select {
+	case mo := <-mos:
+		assert.Equal(t, "你好", mo.MsgContent())
+		assert.Equal(t, "13800001111", mo.SrcTerminalId())
+	case <-time.After(time.Second):
+		t.Errorf("no delivery received")
+	}
+
+	resps, err := cli.Send([]string{"13800001111"}, "hello world")
+	assert.True(t, err == nil)
+	assert.Equal(t, 1, len(resps))
+	assert.Equal(t, uint32(0), resps[0].Result())
+
+	select {
+	case rpt := <-reports:
+		assert.Equal(t, resps[0].MsgId(), rpt.MsgId())
+		t.Logf("%s", rpt)
+	case <-time.After(time.Second):
+		t.Errorf("no report received")
+	}
+
+	// 断开连接后自动重连
+	cli.connLock.RLock()
+	_ = cli.conn.Close()
+	cli.connLock.RUnlock()
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&conns))
+	resps, err = cli.Send([]string{"13800001111"}, "hello again")
+	assert.True(t, err == nil)
+	assert.Equal(t, 1, len(resps))
+
+	assert.True(t, cli.Close() == nil)
+	_, err = cli.Send([]string{"13800001111"}, "closed")
+	assert.Equal(t, ErrClosed, err)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	text := w.Body.String()
+	assert.Contains(t, text, `gosms_pdus_total{command="CMPP_CONNECT",direction="out",protocol="cmpp"} 2`)
+	assert.Contains(t, text, `gosms_submit_results_total{protocol="cmpp",result="0"} 2`)
+	assert.Contains(t, text, `gosms_report_latency_seconds_count{protocol="cmpp"} 2`)
+}
+
+// 网关仅支持2.0时，以3.0登录的客户端按网关应答的版本收发
+func TestClient_Version(t *testing.T) {
+	accounts, err := sp.Load(codec.Conf, "source-addr")
+	assert.True(t, err == nil)
+	acc, _ := accounts.Get(codec.Conf.GetString("source-addr"))
+	acc.Version = int(codec.V20)
+	version := codec.Conf.GetInt("version")
+	codec.Accounts = accounts
+	codec.Conf.Set("version", int(codec.V30))
+	defer func() {
+		codec.Accounts = nil
+		codec.Conf.Set("version", version)
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	defer func() { _ = ln.Close() }()
+	var conns int32
+	go fakeServer(t, ln, &conns)
+
+	reports := make(chan *codec.Report, 16)
+	cli, err := Dial(Options{
+		Address:  ln.Addr().String(),
+		OnReport: func(rpt *codec.Report) { reports <- rpt },
+	})
+	assert.True(t, err == nil)
+	defer func() { _ = cli.Close() }()
+	assert.Equal(t, codec.V20, cli.Version())
+
+	// 按配置的3.0版本创建的Submit，发送时转换为2.0
+	sub := codec.NewSubmit([]string{"13800001111"}, "hello world")[0]
+	assert.Equal(t, codec.V30, sub.Version())
+	resp, err := cli.Submit(sub)
+	assert.True(t, err == nil)
+	assert.Equal(t, uint32(0), resp.Result())
+	select {
+	case rpt := <-reports:
+		assert.Equal(t, resp.MsgId(), rpt.MsgId())
+		assert.Equal(t, "13800001111", rpt.DestTerminalId())
+	case <-time.After(time.Second):
+		t.Errorf("no report received")
+	}
+}
+
+// 同一进程中的两个客户端使用不同的账号及版本
+func TestClient_Context(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	defer func() { _ = ln.Close() }()
+	var conns int32
+	go fakeServer(t, ln, &conns)
+
+	ctx, err := codec.NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"source-addr": "654321", "shared-secret": "another secret", "version": int(codec.V30),
+	}))
+	assert.True(t, err == nil)
+	reports := make(chan *codec.Report, 16)
+	c1, err := Dial(Options{Address: ln.Addr().String(), OnReport: func(rpt *codec.Report) { reports <- rpt }})
+	assert.True(t, err == nil)
+	defer func() { _ = c1.Close() }()
+	c2, err := Dial(Options{Address: ln.Addr().String(), Context: ctx, OnReport: func(rpt *codec.Report) { reports <- rpt }})
+	assert.True(t, err == nil)
+	defer func() { _ = c2.Close() }()
+	assert.Equal(t, codec.ConfVersion(), c1.Version())
+	assert.Equal(t, codec.V30, c2.Version())
+
+	for _, cli := range []*Client{c1, c2} {
+		resps, err := cli.Send([]string{"13800001111"}, "hello world")
+		assert.True(t, err == nil)
+		assert.Equal(t, uint32(0), resps[0].Result())
+		select {
+		case rpt := <-reports:
+			assert.Equal(t, resps[0].MsgId(), rpt.MsgId())
+		case <-time.After(time.Second):
+			t.Errorf("no report received")
+		}
+	}
+}
+
+func TestDial_Error(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	_, err = Dial(Options{Address: addr, RespTimeout: 100 * time.Millisecond})
+	assert.True(t, err != nil)
+}
@@ -0,0 +1,461 @@
+package smgp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	codec "github.com/aaronwong1989/gosms/codec/smgp"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/metrics"
+)
+
+var log = logging.GetDefaultLogger()
+
+var (
+	ErrClosed    = errors.New("client closed")
+	ErrConnLost  = errors.New("connection lost")
+	ErrTimeout   = errors.New("wait response timeout")
+	ErrBadPacket = errors.New("bad packet")
+)
+
+// Options 客户端参数，登录使用的 client-id、shared-secret、version 读取自 Context 的配置
+type Options struct {
+	Address            string                                    // 网关地址，如 127.0.0.1:9000
+	Context            *codec.Context                            // 编解码上下文，多个客户端可使用不同的配置及序号生成器，默认为 codec.Default()
+	WindowSize         int                                       // 发送窗口大小，即已发送未收到应答的Submit的最大数量，默认16
+	RespTimeout        time.Duration                             // Submit等待应答的超时时间，默认5s
+	ReportTimeout      time.Duration                             // 等待状态报告的最长时间，超时后不再关联原Submit，默认2h
+	ActiveTestDuration time.Duration                             // 链路检测间隔，默认读取配置 active-test-duration
+	ReassembleTimeout  time.Duration                             // 长短信分片的最长等待时间，超时未收齐的分片将被丢弃，默认5m
+	ReconnectDelay     time.Duration                             // 断线重连的间隔，默认3s
+	OnDeliver          func(dlv *codec.Deliver)                  // 收到上行短信时的回调，在读协程中执行
+	OnReport           func(rpt *codec.Report, mt *codec.Submit) // 收到状态报告时的回调，mt为MsgID对应的原Submit，未匹配到时为nil
+	Metrics            *metrics.Metrics                          // 可选，统计收发的报文、Submit结果、状态报告及其耗时
+}
+
+// Client SMGP客户端（SP侧），负责登录、链路检测、滑动窗口发送、应答及状态报告匹配、断线重连
+type Client struct {
+	opts      Options
+	conn      net.Conn
+	connLock  sync.RWMutex      // 保护 conn
+	writeLock sync.Mutex        // 保证报文写入不交错
+	window    chan struct{}     // 用通道控制发送窗口
+	pending   sync.Map          // SequenceId -> *waiting，等待应答的Submit
+	submitted sync.Map          // MsgID(hex) -> *outstanding，等待状态报告的Submit
+	assembler *comm.Reassembler // 长短信上行分片组装
+	lastRecv  int64             // 最后一次收到报文的时间，UnixNano
+	version   uint32            // 与网关协商的版本，重连后可能变化
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// 已发送、等待应答的Submit
+type waiting struct {
+	mt *codec.Submit
+	ch chan *codec.SubmitResp
+}
+
+// 已收到应答、等待状态报告的Submit
+type outstanding struct {
+	mt       *codec.Submit
+	submitAt time.Time
+}
+
+// Dial 连接网关并完成登录，登录成功后在后台维持链路，断线后自动重连
+func Dial(opts Options) (*Client, error) {
+	if opts.Context == nil {
+		opts.Context = codec.Default()
+	}
+	if opts.WindowSize <= 0 {
+		opts.WindowSize = 16
+	}
+	if opts.RespTimeout <= 0 {
+		opts.RespTimeout = 5 * time.Second
+	}
+	if opts.ReportTimeout <= 0 {
+		opts.ReportTimeout = 2 * time.Hour
+	}
+	if opts.ActiveTestDuration <= 0 {
+		opts.ActiveTestDuration = opts.Context.Config().ActiveTestDuration
+	}
+	if opts.ActiveTestDuration <= 0 {
+		opts.ActiveTestDuration = time.Minute
+	}
+	if opts.ReassembleTimeout <= 0 {
+		opts.ReassembleTimeout = 5 * time.Minute
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = 3 * time.Second
+	}
+
+	c := &Client{
+		opts:      opts,
+		window:    make(chan struct{}, opts.WindowSize),
+		assembler: comm.NewReassembler(opts.ReassembleTimeout),
+		closed:    make(chan struct{}),
+	}
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	go c.serve(conn)
+	go c.keepalive()
+	return c, nil
+}
+
+// Submit 发送一条Submit报文并等待应答，发送窗口满时阻塞。报文的版本与协商的版本不同时转换为协商的版本，
+// 3.0以下版本去掉可选参数
+func (c *Client) Submit(mt *codec.Submit) (*codec.SubmitResp, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	if v := c.Version(); mt.Version() != v {
+		mt.SetVersion(v)
+	}
+	select {
+	case c.window <- struct{}{}:
+	case <-c.closed:
+		return nil, ErrClosed
+	}
+	defer func() {
+		<-c.window
+	}()
+
+	ch := make(chan *codec.SubmitResp, 1)
+	c.pending.Store(mt.SequenceId, &waiting{mt: mt, ch: ch})
+	defer c.pending.Delete(mt.SequenceId)
+
+	err := c.write(mt.Encode())
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("[%-9s] >>> %s", "Client", mt)
+
+	timer := time.NewTimer(c.opts.RespTimeout)
+	defer timer.Stop()
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, ErrConnLost
+		}
+		return resp, nil
+	case <-timer.C:
+		return nil, ErrTimeout
+	case <-c.closed:
+		return nil, ErrClosed
+	}
+}
+
+// Send 按内容拆分为一条或多条(长短信)Submit并依次发送，返回每一条的应答；未指定版本时按协商的版本
+func (c *Client) Send(phones []string, content string, options codec.MtOptions) ([]*codec.SubmitResp, error) {
+	mts := c.Context().NewSubmit(phones, content, options)
+	resps := make([]*codec.SubmitResp, 0, len(mts))
+	for _, mt := range mts {
+		resp, err := c.Submit(mt)
+		if err != nil {
+			return resps, err
+		}
+		resps = append(resps, resp)
+	}
+	return resps, nil
+}
+
+// Close 发送Exit后关闭连接，不再重连
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		exit := c.opts.Context.NewExit()
+		_ = c.write(exit.Encode())
+		log.Infof("[%-9s] >>> %s", "Client", exit)
+		// 等待网关应答后再关闭连接
+		time.Sleep(100 * time.Millisecond)
+		c.connLock.Lock()
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
+		c.connLock.Unlock()
+	})
+	return nil
+}
+
+// Context 按协商的版本编解码的上下文
+func (c *Client) Context() *codec.Context {
+	return c.opts.Context.WithVersion(c.Version())
+}
+
+// Version 与网关协商的版本
+func (c *Client) Version() codec.Version {
+	return codec.Version(atomic.LoadUint32(&c.version))
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// 建立连接并登录
+func (c *Client) connect() (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", c.opts.Address, c.opts.RespTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	lo := c.opts.Context.NewLogin()
+	data := lo.Encode()
+	c.opts.Metrics.Out(data)
+	_, err = conn.Write(data)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	log.Infof("[%-9s] >>> %s", "Client", lo)
+
+	_ = conn.SetReadDeadline(time.Now().Add(c.opts.RespTimeout))
+	header, frame, err := readPdu(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	c.opts.Metrics.In(header.RequestId)
+	resp := &codec.LoginResp{}
+	err = resp.Decode(header, frame, c.opts.Context)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	log.Infof("[%-9s] <<< %s", "Client", resp)
+	if resp.Status() != 0 {
+		c.opts.Metrics.ConnectFailure(resp.Status())
+		_ = conn.Close()
+		return nil, fmt.Errorf("login failed, status=(%d,%s)", resp.Status(), codec.ConnectStatusMap[resp.Status()])
+	}
+	// 网关可能应答较低的版本，此后按网关应答的版本收发
+	if _, ok := codec.Negotiate(resp.Version(), codec.MaxVersion); !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unsupported version %s", resp.Version())
+	}
+	atomic.StoreUint32(&c.version, uint32(resp.Version()))
+
+	c.connLock.Lock()
+	c.conn = conn
+	c.connLock.Unlock()
+	atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
+	return conn, nil
+}
+
+// 读取报文直到连接断开，断开后重连
+func (c *Client) serve(conn net.Conn) {
+	for {
+		err := c.readLoop(conn)
+		_ = conn.Close()
+		c.failPending()
+		if c.isClosed() {
+			return
+		}
+		log.Warnf("[%-9s] connection to %s lost: %v, reconnecting...", "Client", c.opts.Address, err)
+		conn = c.reconnect()
+		if conn == nil {
+			return
+		}
+	}
+}
+
+func (c *Client) reconnect() net.Conn {
+	for {
+		select {
+		case <-c.closed:
+			return nil
+		case <-time.After(c.opts.ReconnectDelay):
+		}
+		conn, err := c.connect()
+		if err == nil {
+			return conn
+		}
+		log.Errorf("[%-9s] reconnect to %s error: %v", "Client", c.opts.Address, err)
+	}
+}
+
+func (c *Client) readLoop(conn net.Conn) error {
+	for {
+		header, frame, err := readPdu(conn)
+		if err != nil {
+			return err
+		}
+		atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
+		c.opts.Metrics.In(header.RequestId)
+
+		switch header.RequestId {
+		case codec.CmdSubmitResp:
+			c.handleSubmitResp(header, frame)
+		case codec.CmdDeliver:
+			err = c.handleDeliver(header, frame)
+		case codec.CmdActiveTest:
+			err = c.write(codec.NewActiveTestResp(header.SequenceId).Encode())
+		case codec.CmdActiveTestResp:
+			log.Debugf("[%-9s] <<< %s", "Client", header)
+		case codec.CmdExit:
+			log.Infof("[%-9s] <<< %s", "Client", header)
+			_ = c.write(codec.NewExitResp(header.SequenceId).Encode())
+			return io.EOF
+		case codec.CmdExitResp:
+			log.Infof("[%-9s] <<< %s", "Client", header)
+			return io.EOF
+		default:
+			log.Warnf("[%-9s] <<< unexpected command: %s", "Client", header)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) handleSubmitResp(header *codec.MessageHeader, frame []byte) {
+	resp := &codec.SubmitResp{}
+	err := resp.Decode(header, frame, c.Context())
+	if err != nil {
+		log.Errorf("[%-9s] Submit_Resp ERROR: %v", "Client", err)
+		return
+	}
+	log.Debugf("[%-9s] <<< %s", "Client", resp)
+	c.opts.Metrics.SubmitResult(resp.Status())
+	if v, ok := c.pending.LoadAndDelete(header.SequenceId); ok {
+		w := v.(*waiting)
+		// 在读协程中记录MsgID，保证紧随应答到达的状态报告能够匹配到原Submit
+		if resp.Status() == 0 {
+			c.submitted.Store(fmt.Sprintf("%x", resp.MsgId()), &outstanding{mt: w.mt, submitAt: time.Now()})
+		}
+		w.ch <- resp
+	}
+}
+
+func (c *Client) handleDeliver(header *codec.MessageHeader, frame []byte) error {
+	dlv := &codec.Deliver{}
+	err := dlv.Decode(header, frame, c.Context())
+	if err != nil {
+		log.Errorf("[%-9s] Deliver ERROR: %v", "Client", err)
+		return err
+	}
+	log.Debugf("[%-9s] <<< %s", "Client", dlv)
+	resp := dlv.ToResponse(0).(*codec.DeliverResp)
+	err = c.write(resp.Encode())
+	if err != nil {
+		return err
+	}
+
+	if dlv.IsReport() {
+		rpt := dlv.Report()
+		var mt *codec.Submit
+		latency := time.Duration(-1)
+		if v, ok := c.submitted.LoadAndDelete(fmt.Sprintf("%x", rpt.Id())); ok {
+			mt = v.(*outstanding).mt
+			latency = time.Since(v.(*outstanding).submitAt)
+		}
+		c.opts.Metrics.Report(rpt.Stat(), latency)
+		if c.opts.OnReport != nil {
+			c.opts.OnReport(rpt, mt)
+		}
+	} else if !dlv.Reassemble(c.assembler) {
+		// 长短信分片未收齐
+		return nil
+	} else if c.opts.OnDeliver != nil {
+		c.opts.OnDeliver(dlv)
+	}
+	return nil
+}
+
+// 定时发送链路检测报文，超过3个周期未收到任何报文时断开连接触发重连；
+// 同时清理超过 ReportTimeout 仍未收到状态报告的Submit
+func (c *Client) keepalive() {
+	ticker := time.NewTicker(c.opts.ActiveTestDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+		c.expireSubmitted()
+		last := time.Unix(0, atomic.LoadInt64(&c.lastRecv))
+		if time.Since(last) > 3*c.opts.ActiveTestDuration {
+			log.Warnf("[%-9s] no packet received since %s, closing connection...", "Client", last.Format(time.RFC3339))
+			c.connLock.RLock()
+			_ = c.conn.Close()
+			c.connLock.RUnlock()
+			continue
+		}
+		at := c.opts.Context.NewActiveTest()
+		err := c.write(at.Encode())
+		if err != nil {
+			log.Errorf("[%-9s] Active_Test ERROR: %v", "Client", err)
+		}
+	}
+}
+
+func (c *Client) expireSubmitted() {
+	c.submitted.Range(func(key, value interface{}) bool {
+		if time.Since(value.(*outstanding).submitAt) > c.opts.ReportTimeout {
+			c.submitted.Delete(key)
+		}
+		return true
+	})
+}
+
+// 连接断开时，所有等待应答的Submit立即返回
+func (c *Client) failPending() {
+	c.pending.Range(func(key, value interface{}) bool {
+		c.pending.Delete(key)
+		close(value.(*waiting).ch)
+		return true
+	})
+}
+
+func (c *Client) write(frame []byte) error {
+	c.connLock.RLock()
+	conn := c.conn
+	c.connLock.RUnlock()
+	if conn == nil {
+		return ErrConnLost
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.opts.Metrics.Out(frame)
+	_, err := conn.Write(frame)
+	return err
+}
+
+// 读取一个完整的报文
+func readPdu(r io.Reader) (*codec.MessageHeader, []byte, error) {
+	data := make([]byte, codec.HeadLength)
+	_, err := io.ReadFull(r, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := &codec.MessageHeader{}
+	err = header.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.PacketLength < codec.HeadLength || header.PacketLength > 10240 {
+		return nil, nil, ErrBadPacket
+	}
+	if header.PacketLength == codec.HeadLength {
+		return header, nil, nil
+	}
+	frame := make([]byte, header.PacketLength-codec.HeadLength)
+	_, err = io.ReadFull(r, frame)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, frame, nil
+}
@@ -0,0 +1,214 @@
+package smgp
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	codec "github.com/aaronwong1989/gosms/codec/smgp"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/sp"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func init() {
+	codec.Conf = yml_config.CreateYamlFactory("smgp.yaml")
+	dc := codec.Conf.GetInt("datacenter-id")
+	wk := codec.Conf.GetInt("worker-id")
+	smgwId := codec.Conf.GetString("smgw-id")
+	codec.Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
+	codec.Seq80 = comm.NewBcdSequence(smgwId)
+}
+
+// 模拟网关：登录成功后，对每条Submit返回应答和状态报告，并在登录后下发一条上行短信
+func fakeServer(t *testing.T, ln net.Listener, conns *int32) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(conns, 1)
+		go func(conn net.Conn) {
+			defer func() { _ = conn.Close() }()
+			ctx := codec.Default()
+			for {
+				header, frame, err := readPdu(conn)
+				if err != nil {
+					return
+				}
+				switch header.RequestId {
+				case codec.CmdLogin:
+					lo := &codec.Login{}
+					_ = lo.Decode(header, frame, ctx)
+					resp := lo.ToResponse(0).(*codec.LoginResp)
+					ctx = ctx.WithVersion(resp.Version())
+					_, _ = conn.Write(resp.Encode())
+					_, _ = conn.Write(ctx.NewDeliver("13300001111", "10690", "你好").Encode())
+				case codec.CmdSubmit:
+					mt := &codec.Submit{}
+					assert.True(t, mt.Decode(header, frame, ctx) == nil)
+					resp := mt.ToResponse(0).(*codec.SubmitResp)
+					_, _ = conn.Write(resp.Encode())
+					_, _ = conn.Write(ctx.NewDeliveryReport(mt, resp.MsgId()).Encode())
+				case codec.CmdExit:
+					_, _ = conn.Write(codec.NewExitResp(header.SequenceId).Encode())
+					return
+				case codec.CmdActiveTest:
+					_, _ = conn.Write(codec.NewActiveTestResp(header.SequenceId).Encode())
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	defer func() { _ = ln.Close() }()
+	var conns int32
+	go fakeServer(t, ln, &conns)
+
+	reports := make(chan *codec.Report, 16)
+	mts := make(chan *codec.Submit, 16)
+	mos := make(chan *codec.Deliver, 16)
+	cli, err := Dial(Options{
+		Address:        ln.Addr().String(),
+		WindowSize:     4,
+		ReconnectDelay: 100 * time.Millisecond,
+		OnReport: func(rpt *codec.Report, mt *codec.Submit) {
+			reports <- rpt
+			mts <- mt
+		},
+		OnDeliver: func(dlv *codec.Deliver) { mos <- dlv },
+	})
+	assert.True(t, err == nil)
+
+	select {
+	case mo := <-mos:
+		assert.Equal(t, "你好", mo.MsgContent())
+		assert.Equal(t, "13300001111", mo.SrcTermID())
+	case <-time.After(time.Second):
+		t.Errorf("no delivery received")
+	}
+
+	resps, err := cli.Send([]string{"13300001111"}, "hello world", codec.MtOptions{})
+	assert.True(t, err == nil)
+	assert.Equal(t, 1, len(resps))
+	assert.Equal(t, uint32(0), resps[0].Status())
+
+	select {
+	case rpt := <-reports:
+		assert.Equal(t, resps[0].MsgId(), rpt.Id())
+		// 状态报告关联到原Submit
+		mt := <-mts
+		assert.True(t, mt != nil)
+		t.Logf("%s", rpt)
+	case <-time.After(time.Second):
+		t.Errorf("no report received")
+	}
+
+	// 断开连接后自动重连
+	cli.connLock.RLock()
+	_ = cli.conn.Close()
+	cli.connLock.RUnlock()
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&conns))
+	resps, err = cli.Send([]string{"13300001111"}, "hello again", codec.MtOptions{})
+	assert.True(t, err == nil)
+	assert.Equal(t, 1, len(resps))
+
+	assert.True(t, cli.Close() == nil)
+	_, err = cli.Send([]string{"13300001111"}, "closed", codec.MtOptions{})
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestClient_Version(t *testing.T) {
+	accounts, err := sp.Load(codec.Conf, "client-id")
+	assert.True(t, err == nil)
+	acc, _ := accounts.Get(codec.Conf.GetString("client-id"))
+	acc.Version = int(codec.V20)
+	codec.Accounts = accounts
+	defer func() { codec.Accounts = nil }()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	defer func() { _ = ln.Close() }()
+	var conns int32
+	go fakeServer(t, ln, &conns)
+
+	reports := make(chan *codec.Report, 16)
+	cli, err := Dial(Options{
+		Address:  ln.Addr().String(),
+		OnReport: func(rpt *codec.Report, _ *codec.Submit) { reports <- rpt },
+	})
+	assert.True(t, err == nil)
+	defer func() { _ = cli.Close() }()
+	assert.Equal(t, codec.V20, cli.Version())
+
+	// 按3.0创建的长短信分片携带可选参数，发送时按2.0去掉
+	mt := codec.NewSubmit([]string{"13300001111"}, strings.Repeat("你好", 100), codec.MtOptions{Version: codec.V30})[0]
+	assert.True(t, mt.TlvList() != nil)
+	resp, err := cli.Submit(mt)
+	assert.True(t, err == nil)
+	assert.Equal(t, uint32(0), resp.Status())
+	assert.Equal(t, codec.V20, mt.Version())
+	assert.True(t, mt.TlvList() == nil)
+	assert.Equal(t, int(mt.PacketLength), len(mt.Encode()))
+	select {
+	case rpt := <-reports:
+		assert.Equal(t, resp.MsgId(), rpt.Id())
+	case <-time.After(time.Second):
+		t.Errorf("no report received")
+	}
+}
+
+// 同一进程中的两个客户端使用不同的账号及版本
+func TestClient_Context(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	defer func() { _ = ln.Close() }()
+	var conns int32
+	go fakeServer(t, ln, &conns)
+
+	ctx, err := codec.NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"client-id": "87654321", "shared-secret": "another secret", "version": int(codec.V20), "smgw-id": "100002",
+	}))
+	assert.True(t, err == nil)
+	reports := make(chan []byte, 16)
+	onReport := func(rpt *codec.Report, _ *codec.Submit) { reports <- rpt.Id() }
+	c1, err := Dial(Options{Address: ln.Addr().String(), OnReport: onReport})
+	assert.True(t, err == nil)
+	defer func() { _ = c1.Close() }()
+	c2, err := Dial(Options{Address: ln.Addr().String(), Context: ctx, OnReport: onReport})
+	assert.True(t, err == nil)
+	defer func() { _ = c2.Close() }()
+	assert.Equal(t, codec.ConfVersion(), c1.Version())
+	assert.Equal(t, codec.V20, c2.Version())
+
+	for _, cli := range []*Client{c1, c2} {
+		resps, err := cli.Send([]string{"13300001111"}, strings.Repeat("你好", 100), codec.MtOptions{})
+		assert.True(t, err == nil)
+		assert.True(t, len(resps) > 1)
+		for range resps {
+			select {
+			case <-reports:
+			case <-time.After(time.Second):
+				t.Errorf("no report received")
+			}
+		}
+	}
+}
+
+func TestDial_Error(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	_, err = Dial(Options{Address: addr, RespTimeout: 100 * time.Millisecond})
+	assert.True(t, err != nil)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/aaronwong1989/gosms/comm/admin"
+)
+
+// 管理接口，见 admin.Register
+
+func (s *Server) Sessions() []admin.Session {
+	list := make([]admin.Session, 0)
+	s.conMap.Range(func(key, value interface{}) bool {
+		if ss, ok := value.(*session); ok {
+			list = append(list, admin.Session{
+				Account: ss.account,
+				Version: ss.ctx.Version.String(),
+				Remote:  ss.remote,
+				LoginAt: ss.loginAt,
+				Submits: atomic.LoadUint64(&ss.submits),
+				Acks:    atomic.LoadUint64(&ss.acks),
+			})
+		}
+		return true
+	})
+	return list
+}
+
+func (s *Server) Kick(remote string) bool {
+	value, ok := s.conMap.Load(remote)
+	if !ok {
+		return false
+	}
+	_ = value.(*session).conn.Close()
+	return true
+}
+
+func (s *Server) InjectMo(mo *admin.Mo) (string, error) {
+	mo.Account = s.defaultAccount(mo.Account)
+	if _, ok := s.ctx.Accounts.Get(mo.Account); !ok {
+		return "", admin.ErrUnknownAccount
+	}
+	// 发送时按接收连接协商的版本编码
+	dly := s.ctx.WithVersion(s.ctx.AccountVersion(mo.Account)).NewDelivery(mo.Src, mo.Content, mo.Dest, mo.ServiceId)
+	if mo.Format != "" {
+		if err := dly.SetMsgFmt(admin.Formats[mo.Format]); err != nil {
+			return "", err
+		}
+	}
+	msgId := formatMsgId(dly.MsgId())
+	// 与状态报告相同，发送给该账号任一在线连接，未收到应答时重发
+	s.outbox.Push(mo.Account, msgId, s.encoder(dly))
+	s.mos.Add(msgId, mo)
+	log.Debugf("[%-9s] >>> %s", "Admin", dly)
+	return msgId, nil
+}
+
+func (s *Server) Submits(n int) []admin.Mt {
+	return s.recent.List(n)
+}
+
+func (s *Server) Mos(n int) []admin.MoRecord {
+	return s.mos.List(n)
+}
+
+func (s *Server) Online(account string) bool {
+	s.loginLock.Lock()
+	defer s.loginLock.Unlock()
+	return s.logins[s.defaultAccount(account)] > 0
+}
+
+func (s *Server) ReloadConfig() error {
+	return s.ctx.Reload()
+}
+
+// 未指定账号时取配置的默认账号
+func (s *Server) defaultAccount(account string) string {
+	if account == "" {
+		return s.ctx.Config().SourceAddr
+	}
+	return account
+}
+
+// 启动配置的上行短信生成器，配置文件变化时重新加载
+func startGenerators(s *Server) *admin.Generators {
+	gens, err := admin.StartGenerators(s.ctx.Conf, s)
+	if err != nil {
+		log.Fatalf("load mo generators error: %v", err)
+	}
+	s.ctx.Conf.OnChange(func() {
+		if err := gens.Reload(s.ctx.Conf); err != nil {
+			log.Errorf("reload mo generators error: %v", err)
+		}
+	})
+	return gens
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/ants/v2"
@@ -15,11 +15,19 @@ import (
 
 	"github.com/aaronwong1989/gosms/codec/cmpp"
 	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/admin"
+	"github.com/aaronwong1989/gosms/comm/capture"
 	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/metrics"
+	"github.com/aaronwong1989/gosms/comm/outbox"
+	"github.com/aaronwong1989/gosms/comm/scenario"
+	"github.com/aaronwong1989/gosms/comm/store"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
 type Server struct {
 	gnet.BuiltinEventEngine
+	ctx       *cmpp.Context // 网关的编解码上下文，登录后各连接按协商的版本复制
 	engine    gnet.Engine
 	protocol  string
 	address   string
@@ -27,6 +35,41 @@ type Server struct {
 	pool      *goroutine.Pool
 	conMap    sync.Map
 	window    chan struct{}
+	stats     *Statistics
+	scheduled sync.Map // msgId -> *scheduledMt，尚未下发的定时短信，可被CMPP_CANCEL删除
+	store     store.Store
+	outbox    *outbox.Outbox // 按SP账号排队待应答的状态报告
+	recovered sync.Map       // msgId -> *store.Record，进程重启前尚未产生状态报告的MT，SP重新登录后继续处理
+	logins    map[string]int // account -> 已登录的连接数
+	loginLock sync.Mutex
+	scenarios *scenario.Engine // 场景规则，用于指定MT的应答结果与状态报告
+	recent    *admin.Recent    // 最近收到的MT，供管理接口查询
+	mos       *admin.MoLog     // 最近注入的上行短信及应答结果
+	metrics   *metrics.Metrics // Prometheus指标
+	capture   *capture.Writer  // 报文抓包，未配置capture-file时为nil
+}
+
+// 等待产生状态报告的MT
+type scheduledMt struct {
+	sub       *cmpp.Submit
+	account   string         // 提交MT的SP账号
+	day       string         // 收到MT的日期，用于统计
+	held      bool           // 是否为尚未到定时发送时间的短信
+	expired   bool           // 是否在下发前超过了有效期
+	recovered bool           // 是否为进程重启前收到的MT，不计入统计
+	received  time.Time      // 收到MT的时间，用于统计状态报告的耗时
+	rule      *scenario.Rule // 匹配的场景规则，可能为nil
+}
+
+// 连接的会话信息，登录成功后保存在连接的上下文及conMap中
+type session struct {
+	account string        // SP登录账号，即Source_Addr
+	ctx     *cmpp.Context // 按登录时协商的协议版本编解码的上下文，该连接上的报文均按此版本编解码
+	conn    gnet.Conn
+	remote  string
+	loginAt time.Time
+	submits uint64 // 收到的MT数
+	acks    uint64 // 收到的CMPP_DELIVER_RESP数
 }
 
 var (
@@ -34,16 +77,11 @@ var (
 	windowSize int
 )
 
-func StartServer() {
-	var port int
-	var multicore bool
-	flag.IntVar(&port, "port", 9000, "--port 9000")
-	flag.BoolVar(&multicore, "multicore", true, "--multicore=true")
-	flag.Parse()
-
+func StartServer(ctx *cmpp.Context, port int, multicore bool) {
 	// 获取配置信息
-	poolSize = cmpp.Conf.GetInt("max-pool-size")
-	windowSize = cmpp.Conf.GetInt("receive-window-size")
+	conf := ctx.Config()
+	poolSize = conf.MaxPoolSize
+	windowSize = conf.ReceiveWindowSize
 
 	// 定义异步工作Go程池
 	options := ants.Options{
@@ -59,13 +97,37 @@ func StartServer() {
 	defer pool.Release()
 
 	ss := &Server{
+		ctx:       ctx,
 		protocol:  "tcp",
 		address:   fmt.Sprintf(":%d", port),
 		multicore: multicore,
 		pool:      pool,
 		window:    make(chan struct{}, windowSize), // 用通道控制消息接收窗口
+		stats:     NewStatistics(),
+		store:     openStore(conf),
+		outbox:    outbox.New(conf.ReportRetryInterval, conf.ReportMaxRetry),
+		logins:    make(map[string]int),
+		scenarios: loadScenarios(ctx.Conf),
+		recent:    admin.NewRecent(100),
+		mos:       admin.NewMoLog(100),
+		metrics:   metrics.New("cmpp", cmpp.CommandMap),
+		capture:   openCapture(conf),
 	}
-
+	defer func(w *capture.Writer) {
+		_ = w.Close()
+	}(ss.capture)
+	ss.outbox.OnSend(ss.sent)
+	ss.outbox.Start()
+	defer ss.outbox.Stop()
+	defer func(st store.Store) {
+		_ = st.Close()
+	}(ss.store)
+	ss.recover()
+
+	admin.Register(ctx.Conf, ss)
+	registerMetrics(ss)
+	gens := startGenerators(ss)
+	defer gens.Stop()
 	startMonitor(port)
 	log.Infof("current pid is %s.", comm.SavePid("cmpp.pid"))
 
@@ -73,6 +135,83 @@ func StartServer() {
 	log.Errorf("server(%s://%s) exits with error: %v", ss.protocol, ss.address, err)
 }
 
+// 加载场景规则，配置文件变化时重新加载
+func loadScenarios(conf yml_config.YmlConfig) *scenario.Engine {
+	engine, err := scenario.Load(conf)
+	if err != nil {
+		log.Fatalf("load scenarios error: %v", err)
+	}
+	conf.OnChange(func() {
+		if err := engine.Reload(conf); err != nil {
+			log.Errorf("reload scenarios error: %v", err)
+		}
+	})
+	return engine
+}
+
+// 注册Prometheus指标，与pprof共用监听端口
+func registerMetrics(s *Server) {
+	s.metrics.Gauge("receive_window_used", "Messages being processed in the receive window.", func() float64 {
+		return float64(len(s.window))
+	})
+	s.metrics.Gauge("receive_window_size", "Size of the receive window.", func() float64 {
+		return float64(windowSize)
+	})
+	s.metrics.Gauge("pool_running_workers", "Running workers of the goroutine pool.", func() float64 {
+		return float64(s.pool.Running())
+	})
+	s.metrics.Gauge("pool_waiting_tasks", "Tasks waiting for a worker of the goroutine pool.", func() float64 {
+		return float64(s.pool.Waiting())
+	})
+	s.metrics.Gauge("sessions", "Logged in connections.", func() float64 {
+		return float64(s.countConn())
+	})
+	s.metrics.Register()
+}
+
+// 打开报文抓包文件，未配置时不抓包
+func openCapture(conf *cmpp.Config) *capture.Writer {
+	path := conf.CaptureFile
+	if path == "" {
+		return nil
+	}
+	w, err := capture.Create(path, "cmpp")
+	if err != nil {
+		log.Errorf("create capture file %s error: %v, pdus will not be captured", path, err)
+		return nil
+	}
+	return w
+}
+
+// 打开消息存储，未配置存储文件时仅保存在内存中
+func openStore(conf *cmpp.Config) store.Store {
+	path := conf.StoreFile
+	if path == "" {
+		return store.NewMemoryStore(conf.StoreRetention)
+	}
+	st, err := store.Open(path, conf.StoreRetention)
+	if err != nil {
+		log.Errorf("open message store %s error: %v, messages will be kept in memory only", path, err)
+		return store.NewMemoryStore(conf.StoreRetention)
+	}
+	return st
+}
+
+// 收集进程重启前尚未产生状态报告的MT，待SP重新登录后继续处理
+func (s *Server) recover() {
+	count := 0
+	s.store.Range(func(rec *store.Record) bool {
+		if rec.Pending() {
+			s.recovered.Store(rec.MsgId, rec)
+			count++
+		}
+		return true
+	})
+	if count > 0 {
+		log.Infof("%d pending messages recovered from store", count)
+	}
+}
+
 // 开启pprof，监听请求
 func startMonitor(port int) {
 	go func() {
@@ -100,7 +239,7 @@ func (s *Server) OnShutdown(eng gnet.Engine) {
 }
 
 func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
-	if s.countConn() >= cmpp.Conf.GetInt("max-cons") {
+	if s.countConn() >= s.ctx.Config().MaxCons {
 		log.Warnf("[%-9s] [%v<->%v] FLOW CONTROL：connections threshold reached, closing new connection...", "OnOpen", c.RemoteAddr(), c.LocalAddr())
 		return nil, gnet.Close
 	} else if len(s.window) == windowSize {
@@ -109,6 +248,7 @@ func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 		return nil, gnet.Close
 	} else {
 		log.Infof("[%-9s] [%v<->%v] activeCons=%d.", "OnOpen", c.RemoteAddr(), c.LocalAddr(), s.activeCons())
+		s.capture.Opened(c)
 		return
 	}
 }
@@ -116,16 +256,30 @@ func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 func (s *Server) OnClose(c gnet.Conn, e error) (action gnet.Action) {
 	log.Warnf("[%-9s] [%v<->%v] activeCons=%d, reason=%v.", "OnClose", c.RemoteAddr(), c.LocalAddr(), s.activeCons(), e)
 	s.conMap.Delete(c.RemoteAddr().String())
+	s.outbox.Unbind(c)
+	s.logout(c)
+	s.capture.Closed(c)
 	return
 }
 
+// OnTraffic 一次读事件可能收到多个报文(如客户端在发送窗口内连续发送的Submit)，
+// 需逐个处理，直至缓冲区中不足一个完整报文，否则剩余报文要等到下次读事件才会处理
 func (s *Server) OnTraffic(c gnet.Conn) (action gnet.Action) {
+	for action == gnet.None && comm.FrameReady(c) {
+		s.capture.In(c, comm.PeekFrame(c))
+		action = s.handleFrame(c)
+	}
+	return
+}
+
+func (s *Server) handleFrame(c gnet.Conn) (action gnet.Action) {
 	header := getHeader(c)
 	// 防止粘包检测，不合法包，关闭连接
-	if header == nil || header.TotalLength < 12 || header.TotalLength > 10240 {
+	if header == nil || header.TotalLength < 12 || header.TotalLength > comm.MaxFrameLength {
 		log.Warnf("[%-9s] [%v<->%v] decode error, header: %s, close session...", "OnTraffic", c.RemoteAddr(), c.LocalAddr(), header)
 		return gnet.Close
 	}
+	s.metrics.In(header.CommandId)
 	action = checkReceiveWindow(s, c, header)
 	if action == gnet.Close {
 		return action
@@ -154,6 +308,10 @@ func (s *Server) OnTraffic(c gnet.Conn) (action gnet.Action) {
 		return handleTerminate(s, c, header)
 	case cmpp.CMPP_TERMINATE_RESP:
 		return handleTerminateResp(s, c, header)
+	case cmpp.CMPP_QUERY:
+		return handleQuery(s, c, header)
+	case cmpp.CMPP_CANCEL:
+		return handleCancel(s, c, header)
 	default:
 		// 不合法包，关闭连接
 		return gnet.Close
@@ -164,11 +322,12 @@ func (s *Server) OnTick() (delay time.Duration, action gnet.Action) {
 	log.Infof("[%-9s] %d active connections.", "OnTick", s.activeCons())
 	s.conMap.Range(func(key, value interface{}) bool {
 		addr := key.(string)
-		con, ok := value.(gnet.Conn)
+		ss, ok := value.(*session)
 		if ok {
+			con := ss.conn
 			_ = s.pool.Submit(func() {
-				at := cmpp.NewActiveTest()
-				err := con.AsyncWrite(at.Encode(), nil)
+				at := s.ctx.NewActiveTest()
+				err := s.write(con, at.Encode(), nil)
 				if err == nil {
 					log.Infof("[%-9s] >>> %s to %s", "OnTick", at, addr)
 				} else {
@@ -178,7 +337,7 @@ func (s *Server) OnTick() (delay time.Duration, action gnet.Action) {
 		}
 		return true
 	})
-	return cmpp.Conf.GetDuration("active-test-duration"), gnet.None
+	return s.ctx.Config().ActiveTestDuration, gnet.None
 }
 
 func (s *Server) countConn() int {
@@ -199,24 +358,38 @@ func handleConnect(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Acti
 	comm.LogHex(logging.DebugLevel, "Connect", frame)
 
 	connect := &cmpp.Connect{}
-	err := connect.Decode(header, frame)
+	err := connect.Decode(header, frame, s.ctx)
 	if err != nil {
 		log.Errorf("[%-9s] CMPP_CONNECT ERROR: %v", "OnTraffic", err)
 		return gnet.Close
 	}
 
 	log.Infof("[%-9s] <<< %s", "OnTraffic", connect)
-	resp := connect.ToResponse(0).(*cmpp.ConnectResp)
+	var resp *cmpp.ConnectResp
+	if !s.ctx.Accounts.AllowAddr(connect.SourceAddr(), c.RemoteAddr()) {
+		log.Warnf("[%-9s] %s login from %v not allowed, denied=%d", "OnTraffic", connect.SourceAddr(), c.RemoteAddr(), s.ctx.Accounts.Denied()[connect.SourceAddr()])
+		resp = connect.ToResponse(2).(*cmpp.ConnectResp)
+	} else {
+		resp = connect.ToResponse(0).(*cmpp.ConnectResp)
+	}
+	if resp.Status() == 0 && !s.login(c, connect.SourceAddr(), resp.Version()) {
+		log.Warnf("[%-9s] %s max connections reached", "OnTraffic", connect.SourceAddr())
+		resp = connect.ToResponse(5).(*cmpp.ConnectResp)
+	}
 	if resp.Status() != 0 {
+		s.metrics.ConnectFailure(resp.Status())
 		log.Errorf("[%-9s] CMPP_CONNECT ERROR: Auth Error, status=(%d,%s)", "OnTraffic", resp.Status(), cmpp.ConnectStatusMap[resp.Status()])
 	}
 
 	// send cmpp_connect_resp async
 	_ = s.pool.Submit(func() {
-		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err = s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
 			if resp.Status() == 0 {
-				s.conMap.Store(c.RemoteAddr().String(), c)
+				s.conMap.Store(c.RemoteAddr().String(), c.Context())
+				s.outbox.Bind(account(c), c)
+				// 补发未确认的状态报告
+				_ = s.pool.Submit(replayReports(s, connect.SourceAddr()))
 			} else {
 				// 客户端登录失败，关闭连接
 				_ = c.Close()
@@ -230,12 +403,37 @@ func handleConnect(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Acti
 	return gnet.None
 }
 
+// login 账号连接数未超过限制时记录会话，需在事件循环中调用
+func (s *Server) login(c gnet.Conn, id string, v cmpp.Version) bool {
+	s.loginLock.Lock()
+	defer s.loginLock.Unlock()
+	if acc, ok := s.ctx.Accounts.Get(id); ok && acc.MaxConns > 0 && s.logins[id] >= acc.MaxConns {
+		return false
+	}
+	s.logins[id]++
+	c.SetContext(&session{account: id, ctx: s.ctx.WithVersion(v), conn: c, remote: c.RemoteAddr().String(), loginAt: time.Now()})
+	return true
+}
+
+// logout 连接关闭，释放账号的连接数
+func (s *Server) logout(c gnet.Conn) {
+	ss, ok := c.Context().(*session)
+	if !ok {
+		return
+	}
+	s.loginLock.Lock()
+	defer s.loginLock.Unlock()
+	if s.logins[ss.account]--; s.logins[ss.account] <= 0 {
+		delete(s.logins, ss.account)
+	}
+}
+
 func handleTerminate(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Action {
 	log.Infof("[%-9s] <<< %s", "OnTraffic", header)
 	resp := cmpp.NewTerminateResp(header.SequenceId)
 	// send cmpp_connect_resp async
 	_ = s.pool.Submit(func() {
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
 			s.conMap.Delete(c.RemoteAddr().String())
 			_ = c.Close()
@@ -269,7 +467,7 @@ func handleDelivery(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Act
 	frame := comm.TakeBytes(c, int(header.TotalLength-cmpp.HeadLength))
 	comm.LogHex(logging.DebugLevel, "Delivery", frame)
 	dly := &cmpp.Delivery{}
-	err := dly.Decode(header, frame)
+	err := dly.Decode(header, frame, s.context(c))
 	if err != nil {
 		log.Errorf("[%-9s] CMPP_DELIVERY ERROR: %v", "OnTraffic", err)
 		return gnet.Close
@@ -278,16 +476,19 @@ func handleDelivery(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Act
 	// handle message async
 	_ = s.pool.Submit(func() {
 		// 模拟消息处理耗时
-		_ = processTime()
+		_ = processTime(s)
 
 		rtCode := uint32(0)
-		if comm.DiceCheck(cmpp.Conf.GetFloat64("success-rate")) {
+		if simulateFailure(s) {
 			// 失败消息的返回码
 			rtCode = 9
 		}
+		if !dly.IsReport() {
+			s.stats.MoDelivered(dly.ServiceId(), rtCode == 0)
+		}
 		resp := dly.ToResponse(rtCode).(*cmpp.DeliveryResp)
 		// 发送响应
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
@@ -301,49 +502,64 @@ func handleDelivery(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Act
 // 处理上行消息Resp
 func handleDeliveryResp(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Action {
 	// check connect
-	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	ss, ok := s.conMap.Load(c.RemoteAddr().String())
 	if !ok {
 		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
 		return gnet.Close
 	}
+	atomic.AddUint64(&ss.(*session).acks, 1)
 	frame := comm.TakeBytes(c, int(header.TotalLength-cmpp.HeadLength))
 	comm.LogHex(logging.DebugLevel, "Deliver", frame)
 
 	resp := &cmpp.DeliveryResp{}
-	err := resp.Decode(header, frame)
+	err := resp.Decode(header, frame, s.context(c))
 	if err != nil {
 		log.Errorf("[%-9s] DELIVER_RESP ERROR: %v", "OnTraffic", err)
 		return gnet.Close
 	}
 	log.Debugf("[%-9s] <<< %s", "OnTraffic", resp)
+	msgId := formatMsgId(resp.MsgId())
+	s.outbox.Ack(msgId)
+	if s.mos.Ack(msgId, resp.Result()) && resp.Result() != 0 {
+		log.Warnf("[%-9s] mo %s rejected, result=%d", "OnTraffic", msgId, resp.Result())
+	}
+	if err = s.store.Ack(msgId); err != nil {
+		log.Errorf("[%-9s] save report ack error: %v", "OnTraffic", err)
+	}
 
 	return gnet.None
 }
 
 func handleSubmit(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Action {
 	// check connect
-	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	ss, ok := s.conMap.Load(c.RemoteAddr().String())
 	if !ok {
 		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
 		return gnet.Close
 	}
+	atomic.AddUint64(&ss.(*session).submits, 1)
 
 	frame := comm.TakeBytes(c, int(header.TotalLength-cmpp.HeadLength))
 	comm.LogHex(logging.DebugLevel, "Submit", frame)
 	sub := &cmpp.Submit{}
-	err := sub.Decode(header, frame)
+	err := sub.Decode(header, frame, s.context(c))
 	if err != nil {
 		log.Errorf("[%-9s] CMPP_SUBMIT ERROR: %v", "OnTraffic", err)
 		return gnet.Close
 	}
 	log.Debugf("[%-9s] <<< %s", "OnTraffic", sub)
+	// 保存原始报文，用于消息存储
+	raw := header.Encode()
+	copy(raw[cmpp.HeadLength:], frame)
 	// handle message async
-	_ = s.pool.Submit(mtAsyncHandler(s, c, sub))
+	_ = s.pool.Submit(mtAsyncHandler(s, c, account(c), sub, raw))
 	return gnet.None
 }
 
-func mtAsyncHandler(s *Server, c gnet.Conn, sub *cmpp.Submit) func() {
+// account为提交MT的SP账号，需在事件循环中获取，连接关闭后无法再从上下文中取得
+func mtAsyncHandler(s *Server, c gnet.Conn, account string, sub *cmpp.Submit, raw []byte) func() {
 	return func() {
+		received := time.Now()
 		// 采用通道控制消息收发速度,向通道发送信号
 		s.window <- struct{}{}
 		defer func() {
@@ -351,17 +567,38 @@ func mtAsyncHandler(s *Server, c gnet.Conn, sub *cmpp.Submit) func() {
 			<-s.window
 		}()
 
-		// 模拟消息处理耗时
-		processTime := processTime()
+		rule := matchScenario(s, sub)
+		// 模拟消息处理耗时，场景规则指定了应答延迟时以规则为准
+		wait := time.Duration(0)
+		if rule != nil && rule.SubmitDelay > 0 {
+			time.Sleep(rule.SubmitDelay)
+		} else {
+			wait = processTime(s)
+		}
 
-		rtCode := uint32(0)
-		if comm.DiceCheck(cmpp.Conf.GetFloat64("success-rate")) {
+		rtCode := checkAccount(s, account, sub)
+		if rtCode == 0 && rule != nil && rule.Result != nil {
+			rtCode = *rule.Result
+		} else if rtCode == 0 && rule == nil && simulateFailure(s) {
 			// 失败消息的返回码
 			rtCode = 13
 		}
 		resp := sub.ToResponse(rtCode).(*cmpp.SubmitResp)
+		s.metrics.SubmitResult(rtCode)
+		day := Today()
+		s.stats.MtReceived(day, sub.ServiceId(), int(sub.DestUsrTl()), rtCode == 0)
+		mt := &scheduledMt{sub: sub, account: account, day: day, rule: rule, received: received}
+		s.recent.Add(admin.Mt{Time: time.Now(), Account: account, MsgId: formatMsgId(resp.MsgId()), Result: rtCode,
+			Dest: sub.DestTerminalIds(), SrcId: sub.SrcId(), ServiceId: sub.ServiceId(), Content: sub.MsgContent()})
+		// 提交失败的应答中没有MsgId，不做保存
+		if resp.Result() == 0 {
+			rec := &store.Record{MsgId: formatMsgId(resp.MsgId()), Account: mt.account, Version: uint8(sub.Version()), Submit: raw, SubmitAt: time.Now()}
+			if err := s.store.SaveSubmit(rec); err != nil {
+				log.Errorf("[%-9s] save message %d error: %v", "OnTraffic", resp.MsgId(), err)
+			}
+		}
 		// 发送响应
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
@@ -371,45 +608,341 @@ func mtAsyncHandler(s *Server, c gnet.Conn, sub *cmpp.Submit) func() {
 
 		// 发送状态报告
 		if resp.Result() == 0 {
-			_ = s.pool.Submit(reportAsyncSender(c, sub, resp.MsgId(), processTime))
+			scheduleReport(s, resp.MsgId(), wait, mt)
 		}
 	}
 }
 
-func processTime() time.Duration {
+// matchScenario 匹配MT的场景规则
+func matchScenario(s *Server, sub *cmpp.Submit) *scenario.Rule {
+	rule := s.scenarios.Match(&scenario.Message{
+		Dest:      sub.DestTerminalIds(),
+		Content:   sub.MsgContent(),
+		ServiceId: sub.ServiceId(),
+		SrcId:     sub.SrcId(),
+	})
+	if rule != nil {
+		log.Debugf("[%-9s] message to %v matches scenario %s", "OnTraffic", sub.DestTerminalIds(), rule.Name)
+	}
+	return rule
+}
+
+// checkAccount 校验SP账号是否允许使用MT中的业务代码与源号码，以及是否超过流量限制
+func checkAccount(s *Server, id string, sub *cmpp.Submit) uint32 {
+	acc, ok := s.ctx.Accounts.Get(id)
+	if !ok {
+		return 0
+	}
+	if !acc.AllowServiceId(sub.ServiceId()) {
+		log.Warnf("[%-9s] %s service id %s not allowed", "OnTraffic", id, sub.ServiceId())
+		return 7
+	}
+	if !acc.AllowSrcId(sub.SrcId()) {
+		log.Warnf("[%-9s] %s src id %s not allowed", "OnTraffic", id, sub.SrcId())
+		return 10
+	}
+	if err := s.ctx.Accounts.Take(id); err != nil {
+		log.Warnf("[%-9s] FLOW CONTROL：%s %v", "OnTraffic", id, err)
+		return 8
+	}
+	return 0
+}
+
+// 定时短信等待至定时发送时间，有效期先到达的则等待至有效期截止，然后产生状态报告
+func scheduleReport(s *Server, msgId uint64, wait time.Duration, mt *scheduledMt) {
+	delay, expired := comm.DeliverDelay(mt.sub.AtTime(), mt.sub.ValidTime())
+	mt.held, mt.expired = delay > 0, expired
+	sender := reportAsyncSender(s, msgId, wait, mt)
+	if mt.held {
+		// 定时短信在下发前可以被删除
+		s.scheduled.Store(msgId, mt)
+		log.Debugf("[%-9s] message %d is scheduled, report after %v", "OnTraffic", msgId, delay)
+		time.AfterFunc(delay, func() { _ = s.pool.Submit(sender) })
+	} else {
+		_ = s.pool.Submit(sender)
+	}
+}
+
+// SP登录后补发未确认的状态报告，并继续处理进程重启前尚未产生状态报告的MT
+func replayReports(s *Server, account string) func() {
+	return func() {
+		replayed, resumed := 0, 0
+		s.store.RangeUnfinished(account, func(rec *store.Record) bool {
+			if rec.Unacked() {
+				dly, err := decodeDelivery(rec.Report, s.ctx.WithVersion(s.recordVersion(rec)))
+				if err != nil {
+					log.Errorf("[%-9s] decode stored report %s error: %v", "OnTraffic", rec.ReportId, err)
+					return true
+				}
+				s.outbox.Push(account, rec.ReportId, s.encoder(dly))
+				replayed++
+			} else if _, ok := s.recovered.LoadAndDelete(rec.MsgId); ok {
+				sub, err := decodeSubmit(rec.Submit, s.ctx.WithVersion(s.recordVersion(rec)))
+				if err != nil {
+					log.Errorf("[%-9s] decode stored message %s error: %v", "OnTraffic", rec.MsgId, err)
+					return true
+				}
+				msgId, _ := strconv.ParseUint(rec.MsgId, 10, 64)
+				scheduleReport(s, msgId, 0, &scheduledMt{sub: sub, account: account, recovered: true, rule: matchScenario(s, sub)})
+				resumed++
+			}
+			return true
+		})
+		if replayed > 0 || resumed > 0 {
+			log.Infof("[%-9s] %d reports resent and %d messages resumed for %s", "OnTraffic", replayed, resumed, account)
+		}
+	}
+}
+
+func decodeSubmit(raw []byte, ctx *cmpp.Context) (*cmpp.Submit, error) {
+	if len(raw) < cmpp.HeadLength {
+		return nil, cmpp.ErrorPacket
+	}
+	header := &cmpp.MessageHeader{}
+	if err := header.Decode(raw[:cmpp.HeadLength]); err != nil {
+		return nil, err
+	}
+	sub := &cmpp.Submit{}
+	return sub, sub.Decode(header, raw[cmpp.HeadLength:], ctx)
+}
+
+func decodeDelivery(raw []byte, ctx *cmpp.Context) (*cmpp.Delivery, error) {
+	if len(raw) < cmpp.HeadLength {
+		return nil, cmpp.ErrorPacket
+	}
+	header := &cmpp.MessageHeader{}
+	if err := header.Decode(raw[:cmpp.HeadLength]); err != nil {
+		return nil, err
+	}
+	dly := &cmpp.Delivery{}
+	return dly, dly.Decode(header, raw[cmpp.HeadLength:], ctx)
+}
+
+// recordVersion 消息提交时连接的协议版本，未记录版本的旧数据按配置的版本处理
+func (s *Server) recordVersion(rec *store.Record) cmpp.Version {
+	if rec.Version == 0 {
+		return s.ctx.ConfVersion()
+	}
+	return cmpp.Version(rec.Version)
+}
+
+func formatMsgId(msgId uint64) string {
+	return strconv.FormatUint(msgId, 10)
+}
+
+// write 发送报文并计入指标
+func (s *Server) write(c gnet.Conn, data []byte, callback gnet.AsyncCallback) error {
+	s.sent(c, data)
+	return c.AsyncWrite(data, callback)
+}
+
+// sent 发出报文时统计指标、记录抓包
+func (s *Server) sent(c gnet.Conn, data []byte) {
+	s.metrics.Out(data)
+	s.capture.Out(c, data)
+}
+
+// 连接登录的SP账号
+func account(c gnet.Conn) string {
+	if ss, ok := c.Context().(*session); ok {
+		return ss.account
+	}
+	return ""
+}
+
+// 连接的编解码上下文，登录后按协商的版本，未登录时按配置的版本
+func (s *Server) context(c gnet.Conn) *cmpp.Context {
+	if ss, ok := c.Context().(*session); ok {
+		return ss.ctx
+	}
+	return s.ctx
+}
+
+// encoder 状态报告及上行短信按接收连接协商的版本编码，同一账号的2.0与3.0连接共用一个发送队列
+func (s *Server) encoder(dly *cmpp.Delivery) outbox.Encoder {
+	return func(c gnet.Conn) []byte {
+		if v := s.context(c).Version; v != 0 && v != dly.Version() {
+			return dly.ToVersion(v).Encode()
+		}
+		return dly.Encode()
+	}
+}
+
+// 按 success-rate 模拟处理失败，success-rate为成功的概率
+func simulateFailure(s *Server) bool {
+	return !comm.DiceCheck(s.ctx.Config().SuccessRate)
+}
+
+func processTime(s *Server) time.Duration {
 	// 模拟消息处理耗时，可配置
 	processTime := time.Duration(0)
-	if cmpp.Conf.GetInt("min-submit-resp-ms") > 0 && cmpp.Conf.GetInt("max-submit-resp-ms") > cmpp.Conf.GetInt("min-submit-resp-ms") {
-		processTime := time.Duration(comm.RandNum(
-			int32(cmpp.Conf.GetInt("min-submit-resp-ms")),
-			int32(cmpp.Conf.GetInt("max-submit-resp-ms")),
+	conf := s.ctx.Config()
+	if conf.MinSubmitRespMs > 0 && conf.MaxSubmitRespMs > conf.MinSubmitRespMs {
+		processTime = time.Duration(comm.RandNum(
+			int32(conf.MinSubmitRespMs),
+			int32(conf.MaxSubmitRespMs),
 		))
 		time.Sleep(processTime * time.Millisecond)
 	}
 	return processTime
 }
 
-func reportAsyncSender(c gnet.Conn, sub *cmpp.Submit, msgId uint64, wait time.Duration) func() {
+func reportAsyncSender(s *Server, msgId uint64, wait time.Duration, mt *scheduledMt) func() {
 	return func() {
-		if comm.DiceCheck(cmpp.Conf.GetFloat64("success-rate")) {
+		rule := mt.rule
+		if !mt.expired && (rule != nil && rule.NoReport || rule == nil && simulateFailure(s)) {
+			// 模拟状态报告丢失
+			s.scheduled.Delete(msgId)
+			_ = s.store.Drop(formatMsgId(msgId))
 			return
 		}
-		dly := sub.ToDeliveryReport(msgId)
-		// 模拟状态报告发送前的耗时
-		ms := cmpp.Conf.GetInt("fix-report-resp-ms")
-		if ms > 0 {
-			processTime := wait + time.Duration(ms)
-			time.Sleep(processTime * time.Millisecond)
+		dly := mt.sub.ToDeliveryReport(msgId)
+		if mt.expired {
+			dly.Report().SetStat("EXPIRED")
+		} else {
+			if rule != nil {
+				// 匹配场景规则的MT不再随机产生状态
+				stat := "DELIVRD"
+				if rule.Stat != "" {
+					stat = rule.Stat
+				}
+				dly.Report().SetStat(stat)
+			}
+			// 模拟状态报告发送前的耗时
+			ms := s.ctx.Config().FixReportRespMs
+			if rule != nil && rule.ReportDelay > 0 {
+				time.Sleep(rule.ReportDelay)
+			} else if ms > 0 {
+				processTime := wait + time.Duration(ms)
+				time.Sleep(processTime * time.Millisecond)
+			}
 		}
-		// 发送状态报告
-		err := c.AsyncWrite(dly.Encode(), func(c gnet.Conn) error {
-			log.Debugf("[%-9s] >>> %s", "OnTraffic", dly)
+		if mt.held {
+			if _, ok := s.scheduled.LoadAndDelete(msgId); !ok {
+				log.Infof("[%-9s] message %d has been canceled, skip report", "OnTraffic", msgId)
+				return
+			}
+		}
+		if !mt.recovered {
+			s.stats.MtDone(mt.day, mt.sub.ServiceId(), dly.Report().Stat() == "DELIVRD")
+		}
+		if mt.recovered {
+			s.metrics.Report(dly.Report().Stat(), -1)
+		} else {
+			s.metrics.Report(dly.Report().Stat(), time.Since(mt.received))
+		}
+		data := dly.Encode()
+		if err := s.store.SaveReport(formatMsgId(msgId), formatMsgId(dly.MsgId()), data); err != nil {
+			log.Errorf("[%-9s] save report of message %d error: %v", "OnTraffic", msgId, err)
+		}
+		// 发送给该账号任一在线连接，未收到应答时重发
+		s.outbox.Push(mt.account, formatMsgId(dly.MsgId()), s.encoder(dly))
+		log.Debugf("[%-9s] >>> %s", "OnTraffic", dly)
+	}
+}
+
+// 查询统计数据
+func handleQuery(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+
+	frame := comm.TakeBytes(c, int(header.TotalLength-cmpp.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Query", frame)
+	query := &cmpp.Query{}
+	err := query.Decode(header, frame, s.context(c))
+	if err != nil {
+		log.Errorf("[%-9s] CMPP_QUERY ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+	log.Infof("[%-9s] <<< %s", "OnTraffic", query)
+
+	serviceId := ""
+	if query.QueryType() == 1 {
+		serviceId = query.QueryCode()
+	}
+	resp := query.ToResponse(0).(*cmpp.QueryResp)
+	resp.SetCounters(s.stats.Query(query.Time(), serviceId))
+	_ = s.pool.Submit(func() {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] CMPP_QUERY_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+// 删除尚未产生状态报告的定时短信
+func handleCancel(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+
+	frame := comm.TakeBytes(c, int(header.TotalLength-cmpp.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Cancel", frame)
+	cancel := &cmpp.Cancel{}
+	err := cancel.Decode(header, frame, s.context(c))
+	if err != nil {
+		log.Errorf("[%-9s] CMPP_CANCEL ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+	log.Infof("[%-9s] <<< %s", "OnTraffic", cancel)
+
+	code := uint32(1)
+	if s.cancel(account(c), cancel.MsgId()) {
+		code = 0
+	}
+	resp := cancel.ToResponse(code).(*cmpp.CancelResp)
+	_ = s.pool.Submit(func() {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
 		if err != nil {
-			log.Errorf("[%-9s] CMPP_DELIVERY_REPORT ERROR: %v", "OnTraffic", err)
+			log.Errorf("[%-9s] CMPP_CANCEL_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+// cancel 删除尚未产生状态报告的MT，只能删除本账号提交的MT，返回是否删除成功
+func (s *Server) cancel(account string, msgId uint64) bool {
+	id := formatMsgId(msgId)
+	if v, ok := s.scheduled.Load(msgId); ok {
+		mt := v.(*scheduledMt)
+		if mt.account != account {
+			log.Warnf("[%-9s] %s can not cancel message %s of %s", "OnTraffic", account, id, mt.account)
+			return false
 		}
+		if _, ok = s.scheduled.LoadAndDelete(msgId); !ok {
+			return false
+		}
+		if !mt.recovered {
+			s.stats.MtDone(mt.day, mt.sub.ServiceId(), false)
+		}
+	} else if v, ok := s.recovered.Load(id); ok {
+		rec := v.(*store.Record)
+		if rec.Account != account {
+			log.Warnf("[%-9s] %s can not cancel message %s of %s", "OnTraffic", account, id, rec.Account)
+			return false
+		}
+		if _, ok = s.recovered.LoadAndDelete(id); !ok {
+			return false
+		}
+	} else {
+		return false
 	}
+	_ = s.store.Drop(id)
+	return true
 }
 
 func handActive(s *Server, c gnet.Conn, header *cmpp.MessageHeader) (action gnet.Action) {
@@ -417,7 +950,7 @@ func handActive(s *Server, c gnet.Conn, header *cmpp.MessageHeader) (action gnet
 	resp := &cmpp.ActiveTestResp{MessageHeader: respHeader}
 	// send cmpp_active_resp async
 	_ = s.pool.Submit(func() {
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
@@ -460,11 +993,11 @@ func checkReceiveWindow(s *Server, c gnet.Conn, header *cmpp.MessageHeader) gnet
 		if err != nil || discard != l {
 			return gnet.Close
 		}
-		sub := &cmpp.Submit{}
-		sub.MessageHeader = header
-		resp := sub.ToResponse(8).(*cmpp.SubmitResp)
+		// 按连接协商的版本应答，3.0的Result为4字节
+		resp := s.context(c).NewSubmitResp(header, 8)
+		s.metrics.SubmitResult(8)
 		// 发送响应
-		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err = s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
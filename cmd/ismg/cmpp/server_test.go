@@ -11,19 +11,21 @@ import (
 	"testing"
 	"time"
 
+	"github.com/panjf2000/gnet/v2"
 	"github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/aaronwong1989/gosms/codec/cmpp"
 	"github.com/aaronwong1989/gosms/comm"
 	"github.com/aaronwong1989/gosms/comm/snowflake"
+	"github.com/aaronwong1989/gosms/comm/store"
 	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
 func init() {
 	rand.Seed(time.Now().Unix()) // 随机种子
 	cmpp.Conf = yml_config.CreateYamlFactory("cmpp.yaml")
-	dc := cmpp.Conf.GetInt("data-center-id")
+	dc := cmpp.Conf.GetInt("datacenter-id")
 	wk := cmpp.Conf.GetInt("worker-id")
 	cmpp.Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
 	cmpp.Seq64 = snowflake.NewSnowflake(int64(dc), int64(wk))
@@ -107,6 +109,93 @@ func TestTerminate(t *testing.T) {
 	terminate(t, c)
 }
 
+func TestServer_Cancel(t *testing.T) {
+	s := &Server{store: store.NewMemoryStore(0), stats: NewStatistics()}
+	sub := cmpp.NewSubmit([]string{"17011112222"}, "hi")[0]
+	s.scheduled.Store(uint64(1), &scheduledMt{sub: sub, account: "B", day: Today()})
+	s.recovered.Store(formatMsgId(2), &store.Record{MsgId: formatMsgId(2), Account: "B"})
+
+	// 账号A不能取消账号B的MT
+	assert.False(t, s.cancel("A", 1))
+	assert.False(t, s.cancel("A", 2))
+	_, ok := s.scheduled.Load(uint64(1))
+	assert.True(t, ok)
+	_, ok = s.recovered.Load(formatMsgId(2))
+	assert.True(t, ok)
+
+	assert.True(t, s.cancel("B", 1))
+	assert.True(t, s.cancel("B", 2))
+	assert.False(t, s.cancel("B", 1))
+	assert.False(t, s.cancel("B", 3))
+}
+
+// 仅实现流量控制用到的方法
+type fakeConn struct {
+	gnet.Conn
+	ctx interface{}
+	out [][]byte
+}
+
+func (c *fakeConn) Context() interface{} { return c.ctx }
+
+func (c *fakeConn) Discard(n int) (int, error) { return n, nil }
+
+func (c *fakeConn) AsyncWrite(buf []byte, _ gnet.AsyncCallback) error {
+	c.out = append(c.out, buf)
+	return nil
+}
+
+func TestCheckReceiveWindow(t *testing.T) {
+	windowSize = 1
+	s := &Server{ctx: cmpp.Default(), window: make(chan struct{}, windowSize)}
+	s.window <- struct{}{}
+	// 接收窗口已满时按连接协商的版本应答，3.0的Result为4字节
+	for v, l := range map[cmpp.Version]int{cmpp.V30: 24, cmpp.V20: 21} {
+		c := &fakeConn{ctx: &session{account: "A", ctx: s.ctx.WithVersion(v)}}
+		header := &cmpp.MessageHeader{TotalLength: 200, CommandId: cmpp.CMPP_SUBMIT, SequenceId: 7}
+		checkReceiveWindow(s, c, header)
+		assert.Equal(t, uint32(0), header.CommandId)
+		if assert.Equal(t, 1, len(c.out)) {
+			assert.Equal(t, l, len(c.out[0]))
+			h := &cmpp.MessageHeader{}
+			assert.Nil(t, h.Decode(c.out[0]))
+			resp := &cmpp.SubmitResp{}
+			assert.Nil(t, resp.Decode(h, c.out[0][cmpp.HeadLength:], s.ctx.WithVersion(v)))
+			assert.Equal(t, uint32(7), h.SequenceId)
+			assert.Equal(t, uint32(8), resp.Result())
+		}
+	}
+}
+
+func TestSimulateFailure(t *testing.T) {
+	// success-rate为成功的概率，1时不失败，0时总是失败
+	for rate, want := range map[float64]bool{1: false, 0: true} {
+		ctx, err := cmpp.NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{"version": 0x30, "success-rate": rate}))
+		assert.Nil(t, err)
+		s := &Server{ctx: ctx}
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, want, simulateFailure(s))
+		}
+	}
+}
+
+func TestProcessTime(t *testing.T) {
+	ctx, err := cmpp.NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"version": 0x30, "min-submit-resp-ms": 2, "max-submit-resp-ms": 5}))
+	assert.Nil(t, err)
+	s := &Server{ctx: ctx}
+	// 返回模拟的处理耗时(毫秒)，用于计算状态报告的发送时间
+	for i := 0; i < 10; i++ {
+		pt := processTime(s)
+		assert.True(t, pt >= 2 && pt < 5, "%d", pt)
+	}
+
+	ctx.Conf.Set("max-submit-resp-ms", 0)
+	ctx.Conf.Set("min-submit-resp-ms", 0)
+	assert.Nil(t, ctx.Reload())
+	assert.Equal(t, time.Duration(0), processTime(s))
+}
+
 func runClient(t *testing.T) {
 	go func(t *testing.T) {
 		c, err := net.Dial("tcp", addr)
@@ -175,7 +264,7 @@ func login(t *testing.T, c net.Conn) bool {
 	assert.True(t, uint32(i) == con.TotalLength)
 
 	pl := 30
-	if cmpp.V3() {
+	if cmpp.ConfVersion().V3() {
 		pl = 33
 	}
 	resp := make([]byte, pl)
@@ -188,7 +277,7 @@ func login(t *testing.T, c net.Conn) bool {
 		return false
 	}
 	rep := &cmpp.ConnectResp{}
-	err = rep.Decode(header, resp[cmpp.HeadLength:])
+	err = rep.Decode(header, resp[cmpp.HeadLength:], nil)
 	if err != nil {
 		return false
 	}
@@ -226,7 +315,7 @@ func readResp(t *testing.T, c net.Conn) bool {
 	}
 	if header.CommandId == cmpp.CMPP_SUBMIT_RESP {
 		csr := &cmpp.SubmitResp{}
-		err := csr.Decode(header, bytes)
+		err := csr.Decode(header, bytes, nil)
 		if err != nil {
 			t.Errorf("%v", err)
 			return false
@@ -236,7 +325,7 @@ func readResp(t *testing.T, c net.Conn) bool {
 		}
 	} else if header.CommandId == cmpp.CMPP_DELIVER {
 		dly := &cmpp.Delivery{}
-		err := dly.Decode(header, bytes)
+		err := dly.Decode(header, bytes, nil)
 		if err != nil {
 			t.Errorf("%v", err)
 			return false
@@ -266,7 +355,7 @@ func readResp(t *testing.T, c net.Conn) bool {
 }
 
 func sendDelivery(t *testing.T, c net.Conn) bool {
-	dly := cmpp.NewDelivery("13700001111", "hello word 中国", "", "")
+	dly := cmpp.NewDelivery("13700001111", "hello word 中国", "", "", cmpp.ConfVersion())
 	_, err := c.Write(dly.Encode())
 	if err != nil {
 		t.Errorf("%v", err)
@@ -311,3 +400,19 @@ func terminate(t *testing.T, c net.Conn) {
 	}
 	t.Logf("<<< %s", term)
 }
+
+func TestServer_Encoder(t *testing.T) {
+	s := &Server{ctx: cmpp.Default()}
+	sub := s.ctx.WithVersion(cmpp.V20).NewSubmit([]string{"17011110000"}, "hi")[0]
+	dly := sub.ToDeliveryReport(1)
+	encode := s.encoder(dly)
+	// 同一报告按接收连接协商的版本编码
+	for v, l := range map[cmpp.Version]uint32{cmpp.V20: dly.TotalLength, cmpp.V30: dly.TotalLength + 24} {
+		c := &fakeConn{ctx: &session{account: "A", ctx: s.ctx.WithVersion(v)}}
+		data := encode(c)
+		h := &cmpp.MessageHeader{}
+		assert.Nil(t, h.Decode(data))
+		assert.Equal(t, l, h.TotalLength)
+		assert.Equal(t, int(l), len(data))
+	}
+}
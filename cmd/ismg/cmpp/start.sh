@@ -8,6 +8,8 @@ export GNET_LOGGING_LEVEL=0
 export GNET_LOGGING_FILE="/Users/huangzhonghui/logs/cmpp.log"
 mkdir -p /Users/huangzhonghui/logs
 
+# 各配置项均可由同名的命令行参数或环境变量覆盖，如 --success-rate=1、GOSMS_CMPP_SHARED_SECRET=xxx，见 ./cmpp.ismg --help
+# --config 指定配置文件，默认为 ./config/cmpp.yaml
 # optional args --port 1234 --multicore=false
 # default  args --port 9000 --multicore=true
 nohup ./cmpp.ismg --port 9000 --multicore=true >panic.log 2>&1 &
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aaronwong1989/gosms/codec/cmpp"
+)
+
+// Statistics 模拟网关按天、按业务代码统计的MT/MO数量，用于应答CMPP_QUERY
+type Statistics struct {
+	counters sync.Map // "YYYYMMDD|serviceId" -> *counters
+}
+
+type counters struct {
+	mtTlMsg uint32
+	mtTlUsr uint32
+	mtScs   uint32
+	mtWt    uint32
+	mtFl    uint32
+	moScs   uint32
+	moWt    uint32
+	moFl    uint32
+}
+
+func NewStatistics() *Statistics {
+	return &Statistics{}
+}
+
+// Today 统计使用的日期格式
+func Today() string {
+	return time.Now().Format("20060102")
+}
+
+func (st *Statistics) get(day string, serviceId string) *counters {
+	key := day + "|" + serviceId
+	v, _ := st.counters.LoadOrStore(key, &counters{})
+	return v.(*counters)
+}
+
+// MtReceived 收到MT，users为接收用户数，ok为应答是否成功；成功的MT在产生状态报告前为待转发状态
+func (st *Statistics) MtReceived(day string, serviceId string, users int, ok bool) {
+	c := st.get(day, serviceId)
+	atomic.AddUint32(&c.mtTlMsg, 1)
+	atomic.AddUint32(&c.mtTlUsr, uint32(users))
+	if ok {
+		atomic.AddUint32(&c.mtWt, 1)
+	} else {
+		atomic.AddUint32(&c.mtFl, 1)
+	}
+}
+
+// MtDone 待转发的MT产生了最终结果(状态报告或被删除)，day为收到MT的日期
+func (st *Statistics) MtDone(day string, serviceId string, ok bool) {
+	c := st.get(day, serviceId)
+	atomic.AddUint32(&c.mtWt, ^uint32(0))
+	if ok {
+		atomic.AddUint32(&c.mtScs, 1)
+	} else {
+		atomic.AddUint32(&c.mtFl, 1)
+	}
+}
+
+// MoDelivered 上行短信的送达结果
+func (st *Statistics) MoDelivered(serviceId string, ok bool) {
+	c := st.get(Today(), serviceId)
+	if ok {
+		atomic.AddUint32(&c.moScs, 1)
+	} else {
+		atomic.AddUint32(&c.moFl, 1)
+	}
+}
+
+// Query 查询某天的统计数据，serviceId为空时返回当天所有业务代码的合计
+func (st *Statistics) Query(day string, serviceId string) cmpp.QueryCounters {
+	var qc cmpp.QueryCounters
+	st.counters.Range(func(key, value interface{}) bool {
+		k := key.(string)
+		if !strings.HasPrefix(k, day+"|") {
+			return true
+		}
+		if serviceId != "" && k != day+"|"+serviceId {
+			return true
+		}
+		c := value.(*counters)
+		qc.MtTlMsg += atomic.LoadUint32(&c.mtTlMsg)
+		qc.MtTlUsr += atomic.LoadUint32(&c.mtTlUsr)
+		qc.MtScs += atomic.LoadUint32(&c.mtScs)
+		qc.MtWt += atomic.LoadUint32(&c.mtWt)
+		qc.MtFl += atomic.LoadUint32(&c.mtFl)
+		qc.MoScs += atomic.LoadUint32(&c.moScs)
+		qc.MoWt += atomic.LoadUint32(&c.moWt)
+		qc.MoFl += atomic.LoadUint32(&c.moFl)
+		return true
+	})
+	return qc
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatistics(t *testing.T) {
+	st := NewStatistics()
+	day := Today()
+	st.MtReceived(day, "MI0001", 2, true)
+	st.MtReceived(day, "MI0001", 1, true)
+	st.MtReceived(day, "MI0002", 1, false)
+	st.MtDone(day, "MI0001", true)
+	st.MoDelivered("MI0002", true)
+
+	qc := st.Query(day, "MI0001")
+	assert.Equal(t, uint32(2), qc.MtTlMsg)
+	assert.Equal(t, uint32(3), qc.MtTlUsr)
+	assert.Equal(t, uint32(1), qc.MtScs)
+	assert.Equal(t, uint32(1), qc.MtWt)
+	assert.Equal(t, uint32(0), qc.MtFl)
+
+	qc = st.Query(day, "")
+	assert.Equal(t, uint32(3), qc.MtTlMsg)
+	assert.Equal(t, uint32(1), qc.MtFl)
+	assert.Equal(t, uint32(1), qc.MoScs)
+
+	qc = st.Query("20000101", "")
+	assert.Equal(t, uint32(0), qc.MtTlMsg)
+}
@@ -0,0 +1,13 @@
+#!/bin/sh
+
+go clean
+go mod tidy
+# 编译
+go build -trimpath -o sgip.ismg
+go test -v server_test.go -test.run TestClient -c
+
+mkdir -p ~/sgip
+mv sgip.ismg ~/sgip/
+mv main.test ~/sgip/
+cp start.sh ~/sgip/
+cp -rf ../../../config ~/sgip/
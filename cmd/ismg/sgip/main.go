@@ -1,5 +1,31 @@
 package main
 
-func main() {
+import (
+	"flag"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/aaronwong1989/gosms/codec/sgip"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
 
+var log = logging.GetDefaultLogger()
+
+func main() {
+	rand.Seed(time.Now().Unix()) // 随机种子
+	var port int
+	var multicore bool
+	flag.IntVar(&port, "port", 8801, "监听端口，pprof监听 port+1")
+	flag.BoolVar(&multicore, "multicore", true, "是否使用多核处理连接")
+	// 各配置项均可由同名的命令行参数或 GOSMS_SGIP_ 开头的环境变量覆盖，见 --help
+	overrides := yml_config.NewOverrides(flag.CommandLine, "GOSMS_SGIP", "sgip.yaml", &sgip.Config{})
+	if err := overrides.Parse(os.Args[1:]); err != nil {
+		log.Fatalf("parse args error: %v", err)
+	}
+	sgip.Conf = overrides.Load()
+	sgip.Seq96 = comm.NewNodeSequence(uint32(sgip.Conf.GetInt64("node-id")))
+	StartServer(port, multicore)
 }
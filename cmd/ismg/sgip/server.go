@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	_ "net/http/pprof"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/ants/v2"
+	"github.com/panjf2000/gnet/v2"
+	"github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
+
+	"github.com/aaronwong1989/gosms/codec/sgip"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/logging"
+)
+
+type Server struct {
+	gnet.BuiltinEventEngine
+	engine    gnet.Engine
+	protocol  string
+	address   string
+	multicore bool
+	pool      *goroutine.Pool
+	conMap    sync.Map
+	window    chan struct{}
+}
+
+var (
+	poolSize   int
+	windowSize int
+)
+
+func StartServer(port int, multicore bool) {
+	poolSize = sgip.Conf.GetInt("max-pool-size")
+	windowSize = sgip.Conf.GetInt("receive-window-size")
+
+	// 定义异步工作Go程池
+	options := ants.Options{
+		ExpiryDuration:   time.Minute, // 1 分钟内不被使用的worker会被清除
+		Nonblocking:      false,       // 如果为true,worker池满了后提交任务会直接返回nil
+		MaxBlockingTasks: poolSize,    // blocking模式有效，否则worker池满了后提交任务会直接返回nil
+		PreAlloc:         false,
+		PanicHandler: func(e interface{}) {
+			log.Errorf("%v", e)
+		},
+	}
+	pool, _ := ants.NewPool(poolSize, ants.WithOptions(options))
+	defer pool.Release()
+
+	ss := &Server{
+		protocol:  "tcp",
+		address:   fmt.Sprintf(":%d", port),
+		multicore: multicore,
+		pool:      pool,
+		window:    make(chan struct{}, windowSize), // 用通道控制消息接收窗口
+	}
+
+	comm.StartMonitor(port)
+	log.Infof("current pid is %s.", comm.SavePid("sgip.pid"))
+
+	err := gnet.Run(ss, ss.protocol+"://"+ss.address, gnet.WithMulticore(multicore), gnet.WithTicker(true))
+	log.Errorf("server(%s://%s) exits with error: %v", ss.protocol, ss.address, err)
+}
+
+func (s *Server) OnBoot(eng gnet.Engine) (action gnet.Action) {
+	log.Infof("[%-9s] running server on %s with multi-core=%t", "OnBoot", fmt.Sprintf("%s://%s", s.protocol, s.address), s.multicore)
+	s.engine = eng
+	return
+}
+
+func (s *Server) OnShutdown(eng gnet.Engine) {
+	log.Warnf("[%-9s] shutdown server %s ...", "OnShutdown", fmt.Sprintf("%s://%s", s.protocol, s.address))
+	for eng.CountConnections() > 0 {
+		log.Warnf("[%-9s] active connections is %d, waiting...", "OnShutdown", eng.CountConnections())
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Warnf("[%-9s] shutdown server %s completed!", "OnShutdown", fmt.Sprintf("%s://%s", s.protocol, s.address))
+}
+
+func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
+	if s.countConn() >= sgip.Conf.GetInt("max-cons") {
+		log.Warnf("[%-9s] [%v<->%v] FLOW CONTROL：connections threshold reached, closing new connection...", "OnOpen", c.RemoteAddr(), c.LocalAddr())
+		return nil, gnet.Close
+	} else if len(s.window) == windowSize {
+		log.Warnf("[%-9s] [%v<->%v] FLOW CONTROL：receive window threshold reached, closing new connection...", "OnOpen", c.RemoteAddr(), c.LocalAddr())
+		// 已达到窗口时，拒绝新的连接
+		return nil, gnet.Close
+	} else {
+		log.Infof("[%-9s] [%v<->%v] activeCons=%d.", "OnOpen", c.RemoteAddr(), c.LocalAddr(), s.activeCons())
+		return
+	}
+}
+
+func (s *Server) OnClose(c gnet.Conn, e error) (action gnet.Action) {
+	log.Warnf("[%-9s] [%v<->%v] activeCons=%d, reason=%v.", "OnClose", c.RemoteAddr(), c.LocalAddr(), s.activeCons(), e)
+	s.conMap.Delete(c.RemoteAddr().String())
+	return
+}
+
+// OnTraffic 一次读事件可能收到多个报文(如客户端在发送窗口内连续发送的Submit)，
+// 需逐个处理，直至缓冲区中不足一个完整报文；报文体未完整到达时等待下次读事件，不提前取走报文头
+func (s *Server) OnTraffic(c gnet.Conn) (action gnet.Action) {
+	for action == gnet.None && comm.FrameReady(c) {
+		action = s.handleFrame(c)
+	}
+	return
+}
+
+func (s *Server) handleFrame(c gnet.Conn) (action gnet.Action) {
+	header := getHeader(c)
+	// 防止粘包检测，不合法包，关闭连接
+	if header == nil || header.MessageLength < sgip.HeadLength || header.MessageLength > comm.MaxFrameLength {
+		log.Warnf("[%-9s] [%v<->%v] decode error, header: %s, close session...", "OnTraffic", c.RemoteAddr(), c.LocalAddr(), header)
+		return gnet.Close
+	}
+	action = checkReceiveWindow(s, c, header)
+	if action == gnet.Close {
+		return action
+	}
+
+	switch header.CommandId {
+	case 0: // 触发限速
+		return gnet.None
+	case sgip.SGIP_BIND:
+		return handleBind(s, c, header)
+	case sgip.SGIP_BIND_RESP:
+		return discardResp(c, header)
+	case sgip.SGIP_SUBMIT:
+		return handleSubmit(s, c, header)
+	case sgip.SGIP_SUBMIT_RESP:
+		return discardResp(c, header)
+	case sgip.SGIP_DELIVER:
+		return handleDeliver(s, c, header)
+	case sgip.SGIP_DELIVER_RESP:
+		return discardResp(c, header)
+	case sgip.SGIP_REPORT:
+		return handleReport(s, c, header)
+	case sgip.SGIP_REPORT_RESP:
+		return handleReportResp(s, c, header)
+	case sgip.SGIP_UNBIND:
+		return handleUnbind(s, c, header)
+	case sgip.SGIP_UNBIND_RESP:
+		return handleUnbindResp(s, c, header)
+	default:
+		// 不合法包，关闭连接
+		return gnet.Close
+	}
+}
+
+// OnTick SGIP协议没有链路检测报文，仅定时输出连接情况
+func (s *Server) OnTick() (delay time.Duration, action gnet.Action) {
+	log.Infof("[%-9s] %d active connections.", "OnTick", s.activeCons())
+	return time.Minute, gnet.None
+}
+
+func (s *Server) countConn() int {
+	counter := 0
+	s.conMap.Range(func(key, value interface{}) bool {
+		counter++
+		return true
+	})
+	return counter
+}
+
+func (s *Server) activeCons() int {
+	return s.engine.CountConnections()
+}
+
+func handleBind(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	frame := comm.TakeBytes(c, sgip.BindLen-sgip.HeadLength)
+	comm.LogHex(logging.DebugLevel, "Bind", frame)
+
+	bind := &sgip.Bind{}
+	err := bind.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] SGIP_BIND ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+
+	log.Infof("[%-9s] <<< %s", "OnTraffic", bind)
+	var resp *sgip.Resp
+	if _, ok := s.conMap.Load(c.RemoteAddr().String()); ok {
+		// 同一连接重复登录
+		resp = bind.ToResponse(2).(*sgip.Resp)
+	} else {
+		resp = bind.ToResponse(0).(*sgip.Resp)
+	}
+	if resp.Result() != 0 {
+		log.Errorf("[%-9s] SGIP_BIND ERROR: Auth Error, result=(%d,%s)", "OnTraffic", resp.Result(), sgip.ResultMap[resp.Result()])
+	}
+
+	// send sgip_bind_resp async
+	_ = s.pool.Submit(func() {
+		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
+			if resp.Result() == 0 {
+				s.conMap.Store(c.RemoteAddr().String(), c)
+			} else if resp.Result() != 2 {
+				// 客户端登录失败，关闭连接
+				_ = c.Close()
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SGIP_BIND_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+func handleUnbind(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	log.Infof("[%-9s] <<< %s", "OnTraffic", header)
+	resp := sgip.NewUnbindResp(header.SequenceNumber)
+	// send sgip_unbind_resp async
+	_ = s.pool.Submit(func() {
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
+			s.conMap.Delete(c.RemoteAddr().String())
+			_ = c.Close()
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SGIP_UNBIND_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+func handleUnbindResp(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	log.Infof("[%-9s] <<< %s", "OnTraffic", header)
+	log.Infof("[%-9s] closing connection [%v<-->%v]", "OnTraffic", c.RemoteAddr(), c.LocalAddr())
+	s.conMap.Delete(c.RemoteAddr().String())
+	_ = c.Flush()
+	_ = c.Close()
+	return gnet.Close
+}
+
+// 处理上行消息
+func handleDeliver(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+
+	frame := comm.TakeBytes(c, int(header.MessageLength-sgip.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Deliver", frame)
+	dlv := &sgip.Deliver{}
+	err := dlv.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] SGIP_DELIVER ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+	log.Debugf("[%-9s] <<< %s", "OnTraffic", dlv)
+	// handle message async
+	_ = s.pool.Submit(func() {
+		// 模拟消息处理耗时
+		_ = processTime()
+
+		rtCode := uint32(0)
+		if !comm.DiceCheck(sgip.Conf.GetFloat64("success-rate")) {
+			// 失败消息的返回码
+			rtCode = 99
+		}
+		resp := dlv.ToResponse(rtCode).(*sgip.Resp)
+		// 发送响应
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SGIP_DELIVER_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+// 处理客户端发送的状态报告
+func handleReport(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+
+	frame := comm.TakeBytes(c, int(header.MessageLength-sgip.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Report", frame)
+	rpt := &sgip.Report{}
+	err := rpt.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] SGIP_REPORT ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+	log.Debugf("[%-9s] <<< %s", "OnTraffic", rpt)
+	resp := rpt.ToResponse(0).(*sgip.Resp)
+	_ = s.pool.Submit(func() {
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SGIP_REPORT_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+// 处理状态报告的Resp
+func handleReportResp(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+	return discardResp(c, header)
+}
+
+// 消费并打印应答报文
+func discardResp(c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	frame := comm.TakeBytes(c, int(header.MessageLength-sgip.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Resp", frame)
+
+	resp := &sgip.Resp{}
+	err := resp.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] %s ERROR: %v", "OnTraffic", sgip.CommandMap[header.CommandId], err)
+		return gnet.Close
+	}
+	log.Debugf("[%-9s] <<< %s", "OnTraffic", resp)
+	return gnet.None
+}
+
+func handleSubmit(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+
+	frame := comm.TakeBytes(c, int(header.MessageLength-sgip.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Submit", frame)
+	sub := &sgip.Submit{}
+	err := sub.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] SGIP_SUBMIT ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+	log.Debugf("[%-9s] <<< %s", "OnTraffic", sub)
+	// handle message async
+	_ = s.pool.Submit(mtAsyncHandler(s, c, sub))
+	return gnet.None
+}
+
+func mtAsyncHandler(s *Server, c gnet.Conn, sub *sgip.Submit) func() {
+	return func() {
+		// 采用通道控制消息收发速度,向通道发送信号
+		s.window <- struct{}{}
+		defer func() {
+			// defer函数消费信号，确保每个消息的信号最终都会被消费
+			<-s.window
+		}()
+
+		// 模拟消息处理耗时
+		processTime := processTime()
+
+		rtCode := uint32(0)
+		if !comm.DiceCheck(sgip.Conf.GetFloat64("success-rate")) {
+			// 失败消息的返回码
+			rtCode = 6
+		}
+		resp := sub.ToResponse(rtCode).(*sgip.Resp)
+		// 发送响应
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SGIP_SUBMIT_RESP ERROR: %v", "OnTraffic", err)
+		}
+
+		// 发送状态报告
+		if resp.Result() == 0 && sub.ReportFlag() != 2 {
+			_ = s.pool.Submit(reportAsyncSender(c, sub, processTime))
+		}
+	}
+}
+
+func processTime() time.Duration {
+	// 模拟消息处理耗时，可配置
+	processTime := time.Duration(0)
+	if sgip.Conf.GetInt("min-submit-resp-ms") > 0 && sgip.Conf.GetInt("max-submit-resp-ms") > sgip.Conf.GetInt("min-submit-resp-ms") {
+		processTime = time.Duration(comm.RandNum(
+			int32(sgip.Conf.GetInt("min-submit-resp-ms")),
+			int32(sgip.Conf.GetInt("max-submit-resp-ms")),
+		))
+		time.Sleep(processTime * time.Millisecond)
+	}
+	return processTime
+}
+
+func reportAsyncSender(c gnet.Conn, sub *sgip.Submit, wait time.Duration) func() {
+	return func() {
+		// 按成功率模拟状态报告丢失
+		if !comm.DiceCheck(sgip.Conf.GetFloat64("success-rate")) {
+			return
+		}
+		// 模拟状态报告发送前的耗时
+		ms := sgip.Conf.GetInt("fix-report-resp-ms")
+		if ms > 0 {
+			processTime := wait + time.Duration(ms)
+			time.Sleep(processTime * time.Millisecond)
+		}
+		// 每个接收号码一个状态报告
+		for _, phone := range sub.UserNumber() {
+			rpt := sub.ToReport(phone)
+			// ReportFlag为0时仅在出错时返回状态报告
+			if sub.ReportFlag() == 0 && rpt.State() == 0 {
+				continue
+			}
+			err := c.AsyncWrite(rpt.Encode(), func(c gnet.Conn) error {
+				log.Debugf("[%-9s] >>> %s", "OnTraffic", rpt)
+				return nil
+			})
+			if err != nil {
+				log.Errorf("[%-9s] SGIP_REPORT ERROR: %v", "OnTraffic", err)
+			}
+		}
+	}
+}
+
+func getHeader(c gnet.Conn) *sgip.MessageHeader {
+	frame := comm.TakeBytes(c, sgip.HeadLength)
+	if frame == nil {
+		return nil
+	}
+	comm.LogHex(logging.DebugLevel, "Header", frame)
+
+	header := sgip.MessageHeader{}
+	err := header.Decode(frame)
+	if err != nil {
+		log.Errorf("[%-9s] decode error: %v", "OnTraffic", err)
+		return nil
+	}
+	return &header
+}
+
+func checkReceiveWindow(s *Server, c gnet.Conn, header *sgip.MessageHeader) gnet.Action {
+	if len(s.window) == windowSize && header.CommandId == sgip.SGIP_SUBMIT {
+		log.Warnf("[%-9s] FLOW CONTROL：receive window threshold reached.", "OnTraffic")
+		l := int(header.MessageLength - sgip.HeadLength)
+		discard, err := c.Discard(l)
+		if err != nil || discard != l {
+			return gnet.Close
+		}
+		sub := &sgip.Submit{}
+		sub.MessageHeader = header
+		resp := sub.ToResponse(11).(*sgip.Resp)
+		// 发送响应
+		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SGIP_SUBMIT_RESP ERROR: %v", "OnTraffic", err)
+			return gnet.Close
+		}
+		header.CommandId = 0
+	}
+	return gnet.None
+}
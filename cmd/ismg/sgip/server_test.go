@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+	"github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/codec/sgip"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func init() {
+	rand.Seed(time.Now().Unix()) // 随机种子
+	sgip.Conf = yml_config.CreateYamlFactory("sgip.yaml")
+	sgip.Seq96 = comm.NewNodeSequence(uint32(sgip.Conf.GetInt64("node-id")))
+}
+
+var (
+	pool      = goroutine.Default()
+	counterMt int64
+	counterRt int64
+	wg        sync.WaitGroup
+	mtChan    = make(chan struct{}, 1)
+	dlyChan   = make(chan struct{}, 1)
+	readChan  = make(chan struct{}, 1)
+	termChan  = make(chan struct{})
+
+	clients  = 1
+	duration = time.Second * 30
+	// addr = "10.211.55.13:8801"
+	addr = ":8801"
+)
+
+func TestClient(t *testing.T) {
+	wg.Add(1)
+	defer func() {
+		pool.Release()
+		logResult(t)
+	}()
+
+	for i := 0; i < clients; i++ {
+		runClient(t)
+	}
+	time.Sleep(duration)
+
+	// 停掉发送
+	dlyChan <- struct{}{}
+	mtChan <- struct{}{}
+	// 停掉接收
+	time.Sleep(100 * time.Millisecond)
+	readChan <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	// 发送断开连接报文
+	wg.Done()
+	<-termChan
+}
+
+func TestLogin(t *testing.T) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer func(c net.Conn) {
+		err := c.Close()
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+	}(c)
+
+	login(t, c)
+}
+
+func TestUnbind(t *testing.T) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer func(c net.Conn) {
+		err := c.Close()
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+	}(c)
+
+	if !login(t, c) {
+		return
+	}
+
+	terminate(t, c)
+}
+
+func runClient(t *testing.T) {
+	go func(t *testing.T) {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Errorf("%v", err)
+			return
+		}
+		defer func(c net.Conn) {
+			err := c.Close()
+			if err != nil {
+				t.Errorf("%v", err)
+			}
+		}(c)
+
+		if !login(t, c) {
+			panic("登录失败，程序退出!")
+		}
+
+		_ = pool.Submit(func() {
+			for s := true; s; {
+				select {
+				case <-mtChan:
+					s = false
+					t.Logf("接收到 mtChan 的停止信号")
+				default:
+					s = sendMt(t, c)
+				}
+			}
+		})
+
+		_ = pool.Submit(func() {
+			for s := true; s; {
+				select {
+				case <-dlyChan:
+					s = false
+					t.Logf("接收到 dlyChan 的停止信号")
+				default:
+					s = sendDelivery(t, c)
+					time.Sleep(time.Millisecond * 50)
+				}
+			}
+		})
+
+		_ = pool.Submit(func() {
+			for s := true; s; {
+				select {
+				case <-readChan:
+					s = false
+					t.Logf("接收到 readChan 的停止信号")
+				default:
+					s = readResp(t, c)
+				}
+			}
+		})
+
+		wg.Wait()
+		terminate(t, c)
+		termChan <- struct{}{}
+	}(t)
+}
+
+func login(t *testing.T, c net.Conn) bool {
+	bind := sgip.NewBind(1)
+	t.Logf(">>>: %s", bind)
+	i, _ := c.Write(bind.Encode())
+	assert.True(t, uint32(i) == bind.MessageLength)
+
+	resp := make([]byte, sgip.RespLen)
+	i, _ = c.Read(resp)
+	assert.True(t, i == sgip.RespLen)
+
+	header := &sgip.MessageHeader{}
+	err := header.Decode(resp)
+	if err != nil {
+		return false
+	}
+	rep := &sgip.Resp{}
+	err = rep.Decode(header, resp[sgip.HeadLength:])
+	if err != nil {
+		return false
+	}
+	t.Logf("<<<: %s", rep)
+	return 0 == rep.Result()
+}
+
+func sendMt(t *testing.T, c net.Conn) bool {
+	mts := sgip.NewSubmit([]string{"8613100001111"}, fmt.Sprintf("hello world! %d", rand.Uint64()))
+	mt := mts[0]
+	_, err := c.Write(mt.Encode())
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	t.Logf(">>> %s", mt)
+	return true
+}
+
+func readResp(t *testing.T, c net.Conn) bool {
+	bytes := make([]byte, sgip.HeadLength)
+	_, err := c.Read(bytes)
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	header := &sgip.MessageHeader{}
+	_ = header.Decode(bytes)
+	l := int(header.MessageLength - sgip.HeadLength)
+	bytes = make([]byte, l)
+	l, err = c.Read(bytes)
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	if header.CommandId == sgip.SGIP_SUBMIT_RESP {
+		csr := &sgip.Resp{}
+		err := csr.Decode(header, bytes)
+		if err != nil {
+			t.Errorf("%v", err)
+			return false
+		} else {
+			atomic.AddInt64(&counterMt, 1)
+			t.Logf("<<< %s", csr)
+		}
+	} else if header.CommandId == sgip.SGIP_REPORT {
+		rpt := &sgip.Report{}
+		err := rpt.Decode(header, bytes)
+		if err != nil {
+			t.Errorf("%v", err)
+			return false
+		} else {
+			// 状态报告计数
+			atomic.AddInt64(&counterRt, 1)
+			t.Logf("<<< %s", rpt)
+			resp := rpt.ToResponse(0).(*sgip.Resp)
+			_, err = c.Write(resp.Encode())
+			if err != nil {
+				t.Errorf("%v", err)
+				return false
+			}
+		}
+	} else {
+		t.Logf("<<< %s:%x", header, bytes)
+	}
+	return true
+}
+
+func sendDelivery(t *testing.T, c net.Conn) bool {
+	dly := sgip.NewDeliver("8613700001111", "hello word 中国", "")
+	_, err := c.Write(dly.Encode())
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	t.Logf(">>> %s", dly)
+	return true
+}
+
+func logResult(t *testing.T) {
+	result := fmt.Sprintf("%s CounterMt=%d, CounterRt=%d\n", time.Now().Format("2006-01-02T15:04:05.000"), counterMt, counterRt)
+	t.Logf(result)
+	file, err := os.OpenFile("./test.result.txt", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	writer := bufio.NewWriter(file)
+	_, _ = writer.WriteString(result)
+	defer func(file *os.File, writer *bufio.Writer) {
+		_ = writer.Flush()
+		_ = file.Close()
+	}(file, writer)
+}
+
+func terminate(t *testing.T, c net.Conn) {
+	term := sgip.NewUnbind()
+	_, err := c.Write(term.Encode())
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	t.Logf(">>> %s", term)
+
+	bytes := make([]byte, sgip.HeadLength)
+	l, err := c.Read(bytes)
+	if err != nil || l != sgip.HeadLength {
+		t.Errorf("%v", err)
+	}
+	h := &sgip.MessageHeader{}
+	err = h.Decode(bytes)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	t.Logf("<<< %s", h)
+}
+
+// bufConn 模拟连接的读缓冲区，只实现处理报文用到的方法
+type bufConn struct {
+	gnet.Conn
+	buf []byte
+}
+
+func (c *bufConn) Peek(n int) ([]byte, error) {
+	if n > len(c.buf) {
+		return c.buf, io.ErrShortBuffer
+	}
+	return c.buf[:n], nil
+}
+
+func (c *bufConn) Discard(n int) (int, error) {
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *bufConn) InboundBuffered() int { return len(c.buf) }
+
+func (c *bufConn) RemoteAddr() net.Addr { return nil }
+
+func (c *bufConn) LocalAddr() net.Addr { return nil }
+
+func TestServer_OnTraffic(t *testing.T) {
+	s := &Server{}
+	resp := func() []byte {
+		h := &sgip.MessageHeader{MessageLength: sgip.RespLen, CommandId: sgip.SGIP_SUBMIT_RESP}
+		return h.Encode()
+	}
+	// 报文体未到达时不取走报文头
+	c := &bufConn{buf: resp()[:sgip.HeadLength]}
+	assert.Equal(t, gnet.None, s.OnTraffic(c))
+	assert.Equal(t, sgip.HeadLength, c.InboundBuffered())
+
+	// 报文体分段到达后，与其后连续发送的报文一次处理完
+	c.buf = append(append(resp(), resp()...), resp()[:5]...)
+	assert.Equal(t, gnet.None, s.OnTraffic(c))
+	assert.Equal(t, 5, c.InboundBuffered())
+
+	// 报文长度超过上限时关闭连接，不等待报文体
+	h := &sgip.MessageHeader{MessageLength: sgip.HeadLength, CommandId: sgip.SGIP_SUBMIT}
+	frame := h.Encode()
+	binary.BigEndian.PutUint32(frame, comm.MaxFrameLength+1)
+	assert.Equal(t, gnet.Close, s.OnTraffic(&bufConn{buf: frame}))
+}
@@ -0,0 +1,20 @@
+#!/bin/sh
+
+pkill sgip.ismg
+pkill sgip.ismg
+
+# -1=debug, 0=info, 1=warn..., default to info
+export GNET_LOGGING_LEVEL=0
+export GNET_LOGGING_FILE="/Users/huangzhonghui/logs/sgip.log"
+mkdir -p /Users/huangzhonghui/logs
+
+# 各配置项均可由同名的命令行参数或环境变量覆盖，如 --success-rate=1、GOSMS_SGIP_AUTH_CHECK=true，见 ./sgip.ismg --help
+# --config 指定配置文件，默认为 ./config/sgip.yaml
+# optional args --port 1234 --multicore=false
+# default  args --port 8801 --multicore=true
+nohup ./sgip.ismg --port 8801 --multicore=true >panic.log 2>&1 &
+
+sleep 3
+tail -10 /Users/huangzhonghui/logs/sgip.log
+sleep 7
+top -pid "$(cat sgip.pid)"
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"flag"
 	"math/rand"
+	"os"
 	"time"
 
 	"github.com/aaronwong1989/gosms/codec/smgp"
-	"github.com/aaronwong1989/gosms/comm"
 	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/sp"
 	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
@@ -14,11 +16,33 @@ var log = logging.GetDefaultLogger()
 
 func main() {
 	rand.Seed(time.Now().Unix()) // 随机种子
-	smgp.Conf = yml_config.CreateYamlFactory("smgp.yaml")
-	dc := smgp.Conf.GetInt("data-center-id")
-	wk := smgp.Conf.GetInt("worker-id")
-	smgwId := smgp.Conf.GetString("smgw-id")
-	smgp.Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
-	smgp.Seq80 = comm.NewBcdSequence(smgwId)
-	StartServer()
+	var port int
+	var multicore bool
+	flag.IntVar(&port, "port", 9100, "监听端口，pprof及管理接口监听 port+1")
+	flag.BoolVar(&multicore, "multicore", true, "是否使用多核处理连接")
+	// 各配置项均可由同名的命令行参数或 GOSMS_SMGP_ 开头的环境变量覆盖，见 --help
+	overrides := yml_config.NewOverrides(flag.CommandLine, "GOSMS_SMGP", "smgp.yaml", &smgp.Config{})
+	overrides.AddNote("运行时通过管理接口 PUT /admin/settings 修改的配置项优先于以上各项")
+	if err := overrides.Parse(os.Args[1:]); err != nil {
+		log.Fatalf("parse args error: %v", err)
+	}
+	ctx, err := smgp.NewContext(overrides.Load())
+	if err != nil {
+		log.Fatalf("load config error: %v", err)
+	}
+	accounts, err := sp.Load(ctx.Conf, "client-id")
+	if err != nil {
+		log.Fatalf("load accounts error: %v", err)
+	}
+	ctx.Accounts = accounts
+	// 配置文件变化时重新加载配置及SP账号，流量限制等随之生效
+	ctx.Conf.OnChange(func() {
+		if err := ctx.Reload(); err != nil {
+			log.Errorf("reload config error: %v, keep the previous config", err)
+		}
+		if err := accounts.Reload(ctx.Conf, "client-id"); err != nil {
+			log.Errorf("reload accounts error: %v", err)
+		}
+	})
+	StartServer(ctx, port, multicore)
 }
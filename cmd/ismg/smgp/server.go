@@ -1,10 +1,11 @@
 package main
 
 import (
-	"flag"
+	"encoding/hex"
 	"fmt"
 	_ "net/http/pprof"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/ants/v2"
@@ -13,11 +14,20 @@ import (
 
 	"github.com/aaronwong1989/gosms/codec/smgp"
 	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/admin"
+	"github.com/aaronwong1989/gosms/comm/capture"
 	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/metrics"
+	"github.com/aaronwong1989/gosms/comm/outbox"
+	"github.com/aaronwong1989/gosms/comm/scenario"
+	"github.com/aaronwong1989/gosms/comm/sp"
+	"github.com/aaronwong1989/gosms/comm/store"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
 type Server struct {
 	gnet.BuiltinEventEngine
+	ctx       *smgp.Context // 网关的编解码上下文，登录后各连接按协商的版本复制
 	engine    gnet.Engine
 	protocol  string
 	address   string
@@ -25,6 +35,27 @@ type Server struct {
 	pool      *goroutine.Pool
 	conMap    sync.Map
 	window    chan struct{}
+	store     store.Store
+	outbox    *outbox.Outbox // 按SP账号排队待应答的状态报告
+	recovered sync.Map       // msgId -> *store.Record，进程重启前尚未产生状态报告的MT，SP重新登录后继续处理
+	logins    map[string]int // account -> 已登录的连接数
+	loginLock sync.Mutex
+	scenarios *scenario.Engine // 场景规则，用于指定MT的应答结果与状态报告
+	recent    *admin.Recent    // 最近收到的MT，供管理接口查询
+	mos       *admin.MoLog     // 最近注入的上行短信及应答结果
+	metrics   *metrics.Metrics // Prometheus指标
+	capture   *capture.Writer  // 报文抓包，未配置capture-file时为nil
+}
+
+// 连接的会话信息，登录成功后保存在连接的上下文及conMap中
+type session struct {
+	account string        // SP登录账号，即ClientID
+	ctx     *smgp.Context // 按登录时协商的协议版本编解码的上下文，3.0以下版本不解析可选参数
+	conn    gnet.Conn
+	remote  string
+	loginAt time.Time
+	submits uint64 // 收到的Submit数
+	acks    uint64 // 收到的Deliver_Resp数
 }
 
 var (
@@ -32,15 +63,10 @@ var (
 	windowSize int
 )
 
-func StartServer() {
-	var port int
-	var multicore bool
-	flag.IntVar(&port, "port", 9100, "--port 9100")
-	flag.BoolVar(&multicore, "multicore", true, "--multicore=true")
-	flag.Parse()
-
-	poolSize = smgp.Conf.GetInt("max-pool-size")
-	windowSize = smgp.Conf.GetInt("receive-window-size")
+func StartServer(ctx *smgp.Context, port int, multicore bool) {
+	conf := ctx.Config()
+	poolSize = conf.MaxPoolSize
+	windowSize = conf.ReceiveWindowSize
 
 	// 定义异步工作Go程池
 	options := ants.Options{
@@ -56,13 +82,36 @@ func StartServer() {
 	defer pool.Release()
 
 	ss := &Server{
+		ctx:       ctx,
 		protocol:  "tcp",
 		address:   fmt.Sprintf(":%d", port),
 		multicore: multicore,
 		pool:      pool,
 		window:    make(chan struct{}, windowSize), // 用通道控制消息接收窗口
+		store:     openStore(conf),
+		outbox:    outbox.New(conf.ReportRetryInterval, conf.ReportMaxRetry),
+		logins:    make(map[string]int),
+		scenarios: loadScenarios(ctx.Conf),
+		recent:    admin.NewRecent(100),
+		mos:       admin.NewMoLog(100),
+		metrics:   metrics.New("smgp", smgp.CommandMap),
+		capture:   openCapture(conf),
 	}
-
+	defer func(w *capture.Writer) {
+		_ = w.Close()
+	}(ss.capture)
+	ss.outbox.OnSend(ss.sent)
+	ss.outbox.Start()
+	defer ss.outbox.Stop()
+	defer func(st store.Store) {
+		_ = st.Close()
+	}(ss.store)
+	ss.recover()
+
+	admin.Register(ctx.Conf, ss)
+	registerMetrics(ss)
+	gens := startGenerators(ss)
+	defer gens.Stop()
 	comm.StartMonitor(port)
 	log.Infof("current pid is %s.", comm.SavePid("smgp.pid"))
 
@@ -70,6 +119,83 @@ func StartServer() {
 	log.Errorf("server(%s://%s) exits with error: %v", ss.protocol, ss.address, err)
 }
 
+// 加载场景规则，配置文件变化时重新加载
+func loadScenarios(conf yml_config.YmlConfig) *scenario.Engine {
+	engine, err := scenario.Load(conf)
+	if err != nil {
+		log.Fatalf("load scenarios error: %v", err)
+	}
+	conf.OnChange(func() {
+		if err := engine.Reload(conf); err != nil {
+			log.Errorf("reload scenarios error: %v", err)
+		}
+	})
+	return engine
+}
+
+// 注册Prometheus指标，与pprof共用监听端口
+func registerMetrics(s *Server) {
+	s.metrics.Gauge("receive_window_used", "Messages being processed in the receive window.", func() float64 {
+		return float64(len(s.window))
+	})
+	s.metrics.Gauge("receive_window_size", "Size of the receive window.", func() float64 {
+		return float64(windowSize)
+	})
+	s.metrics.Gauge("pool_running_workers", "Running workers of the goroutine pool.", func() float64 {
+		return float64(s.pool.Running())
+	})
+	s.metrics.Gauge("pool_waiting_tasks", "Tasks waiting for a worker of the goroutine pool.", func() float64 {
+		return float64(s.pool.Waiting())
+	})
+	s.metrics.Gauge("sessions", "Logged in connections.", func() float64 {
+		return float64(s.countConn())
+	})
+	s.metrics.Register()
+}
+
+// 打开报文抓包文件，未配置时不抓包
+func openCapture(conf *smgp.Config) *capture.Writer {
+	path := conf.CaptureFile
+	if path == "" {
+		return nil
+	}
+	w, err := capture.Create(path, "smgp")
+	if err != nil {
+		log.Errorf("create capture file %s error: %v, pdus will not be captured", path, err)
+		return nil
+	}
+	return w
+}
+
+// 打开消息存储，未配置存储文件时仅保存在内存中
+func openStore(conf *smgp.Config) store.Store {
+	path := conf.StoreFile
+	if path == "" {
+		return store.NewMemoryStore(conf.StoreRetention)
+	}
+	st, err := store.Open(path, conf.StoreRetention)
+	if err != nil {
+		log.Errorf("open message store %s error: %v, messages will be kept in memory only", path, err)
+		return store.NewMemoryStore(conf.StoreRetention)
+	}
+	return st
+}
+
+// 收集进程重启前尚未产生状态报告的MT，待SP重新登录后继续处理
+func (s *Server) recover() {
+	count := 0
+	s.store.Range(func(rec *store.Record) bool {
+		if rec.Pending() {
+			s.recovered.Store(rec.MsgId, rec)
+			count++
+		}
+		return true
+	})
+	if count > 0 {
+		log.Infof("%d pending messages recovered from store", count)
+	}
+}
+
 func (s *Server) OnBoot(eng gnet.Engine) (action gnet.Action) {
 	log.Infof("[%-9s] running server on %s with multi-core=%t", "OnBoot", fmt.Sprintf("%s://%s", s.protocol, s.address), s.multicore)
 	s.engine = eng
@@ -86,7 +212,7 @@ func (s *Server) OnShutdown(eng gnet.Engine) {
 }
 
 func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
-	if s.countConn() >= smgp.Conf.GetInt("max-cons") {
+	if s.countConn() >= s.ctx.Config().MaxCons {
 		log.Warnf("[%-9s] [%v<->%v] FLOW CONTROL：connections threshold reached, closing new connection...", "OnOpen", c.RemoteAddr(), c.LocalAddr())
 		return nil, gnet.Close
 	} else if len(s.window) == windowSize {
@@ -95,6 +221,7 @@ func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 		return nil, gnet.Close
 	} else {
 		log.Infof("[%-9s] [%v<->%v] activeCons=%d.", "OnOpen", c.RemoteAddr(), c.LocalAddr(), s.activeCons())
+		s.capture.Opened(c)
 		return
 	}
 }
@@ -102,15 +229,29 @@ func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 func (s *Server) OnClose(c gnet.Conn, e error) (action gnet.Action) {
 	log.Warnf("[%-9s] [%v<->%v] activeCons=%d, reason=%v.", "OnClose", c.RemoteAddr(), c.LocalAddr(), s.activeCons(), e)
 	s.conMap.Delete(c.RemoteAddr().String())
+	s.outbox.Unbind(c)
+	s.logout(c)
+	s.capture.Closed(c)
 	return
 }
 
+// OnTraffic 一次读事件可能收到多个报文(如客户端在发送窗口内连续发送的Submit)，
+// 需逐个处理，直至缓冲区中不足一个完整报文，否则剩余报文要等到下次读事件才会处理
 func (s *Server) OnTraffic(c gnet.Conn) (action gnet.Action) {
+	for action == gnet.None && comm.FrameReady(c) {
+		s.capture.In(c, comm.PeekFrame(c))
+		action = s.handleFrame(c)
+	}
+	return
+}
+
+func (s *Server) handleFrame(c gnet.Conn) (action gnet.Action) {
 	header := getHeader(c)
-	if header == nil || header.PacketLength < 12 || header.PacketLength > 10240 {
+	if header == nil || header.PacketLength < 12 || header.PacketLength > comm.MaxFrameLength {
 		log.Warnf("[%-9s] [%v<->%v] decode error, header: %s, close session...", "OnTraffic", c.RemoteAddr(), c.LocalAddr(), header)
 		return gnet.Close
 	}
+	s.metrics.In(header.RequestId)
 	action = checkReceiveWindow(s, c, header)
 	if action == gnet.Close {
 		return action
@@ -149,11 +290,12 @@ func (s *Server) OnTick() (delay time.Duration, action gnet.Action) {
 	log.Infof("[%-9s] %d active connections.", "OnTick", s.activeCons())
 	s.conMap.Range(func(key, value interface{}) bool {
 		addr := key.(string)
-		con, ok := value.(gnet.Conn)
+		ss, ok := value.(*session)
 		if ok {
+			con := ss.conn
 			_ = s.pool.Submit(func() {
-				at := smgp.NewActiveTest()
-				err := con.AsyncWrite(at.Encode(), nil)
+				at := s.ctx.NewActiveTest()
+				err := s.write(con, at.Encode(), nil)
 				if err == nil {
 					log.Infof("[%-9s] >>> %s to %s", "OnTick", at, addr)
 				} else {
@@ -163,7 +305,7 @@ func (s *Server) OnTick() (delay time.Duration, action gnet.Action) {
 		}
 		return true
 	})
-	return smgp.Conf.GetDuration("active-test-duration"), gnet.None
+	return s.ctx.Config().ActiveTestDuration, gnet.None
 }
 
 func (s *Server) countConn() int {
@@ -184,24 +326,38 @@ func handleLogin(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Action
 	comm.LogHex(logging.DebugLevel, "Login", frame)
 
 	connect := &smgp.Login{}
-	err := connect.Decode(header, frame)
+	err := connect.Decode(header, frame, s.ctx)
 	if err != nil {
 		log.Errorf("[%-9s] LOGIN ERROR: %v", "OnTraffic", err)
 		return gnet.Close
 	}
 
 	log.Infof("[%-9s] <<< %s", "OnTraffic", connect)
-	resp := connect.ToResponse(0).(*smgp.LoginResp)
+	var resp *smgp.LoginResp
+	if !s.ctx.Accounts.AllowAddr(connect.ClientID(), c.RemoteAddr()) {
+		log.Warnf("[%-9s] %s login from %v not allowed, denied=%d", "OnTraffic", connect.ClientID(), c.RemoteAddr(), s.ctx.Accounts.Denied()[connect.ClientID()])
+		resp = connect.ToResponse(20).(*smgp.LoginResp)
+	} else {
+		resp = connect.ToResponse(0).(*smgp.LoginResp)
+	}
+	if resp.Status() == 0 && !s.login(c, connect.ClientID(), resp.Version()) {
+		log.Warnf("[%-9s] %s max connections reached", "OnTraffic", connect.ClientID())
+		resp = connect.ToResponse(2).(*smgp.LoginResp)
+	}
 	if resp.Status() != 0 {
+		s.metrics.ConnectFailure(resp.Status())
 		log.Errorf("[%-9s] LOGIN ERROR: Auth Error, status=(%d,%s)", "OnTraffic", resp.Status(), smgp.ConnectStatusMap[resp.Status()])
 	}
 
 	// send smgp_connect_resp async
 	_ = s.pool.Submit(func() {
-		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err = s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
 			if resp.Status() == 0 {
-				s.conMap.Store(c.RemoteAddr().String(), c)
+				s.conMap.Store(c.RemoteAddr().String(), c.Context())
+				s.outbox.Bind(account(c), c)
+				// 补发未确认的状态报告
+				_ = s.pool.Submit(replayReports(s, connect.ClientID()))
 			} else {
 				// 客户端登录失败，关闭连接
 				_ = c.Close()
@@ -215,12 +371,37 @@ func handleLogin(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Action
 	return gnet.None
 }
 
+// login 账号连接数未超过限制时记录会话，需在事件循环中调用
+func (s *Server) login(c gnet.Conn, id string, v smgp.Version) bool {
+	s.loginLock.Lock()
+	defer s.loginLock.Unlock()
+	if acc, ok := s.ctx.Accounts.Get(id); ok && acc.MaxConns > 0 && s.logins[id] >= acc.MaxConns {
+		return false
+	}
+	s.logins[id]++
+	c.SetContext(&session{account: id, ctx: s.ctx.WithVersion(v), conn: c, remote: c.RemoteAddr().String(), loginAt: time.Now()})
+	return true
+}
+
+// logout 连接关闭，释放账号的连接数
+func (s *Server) logout(c gnet.Conn) {
+	ss, ok := c.Context().(*session)
+	if !ok {
+		return
+	}
+	s.loginLock.Lock()
+	defer s.loginLock.Unlock()
+	if s.logins[ss.account]--; s.logins[ss.account] <= 0 {
+		delete(s.logins, ss.account)
+	}
+}
+
 func handleExit(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Action {
 	log.Infof("[%-9s] <<< %s", "OnTraffic", header)
 	resp := smgp.NewExitResp(header.SequenceId)
 	// send smgp_connect_resp async
 	_ = s.pool.Submit(func() {
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
 			s.conMap.Delete(c.RemoteAddr().String())
 			_ = c.Close()
@@ -254,7 +435,7 @@ func handleDelivery(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Act
 	frame := comm.TakeBytes(c, int(header.PacketLength-smgp.HeadLength))
 	comm.LogHex(logging.DebugLevel, "Deliver", frame)
 	dly := &smgp.Deliver{}
-	err := dly.Decode(header, frame)
+	err := dly.Decode(header, frame, s.context(c))
 	if err != nil {
 		log.Errorf("[%-9s] DELIVER ERROR: %v", "OnTraffic", err)
 		return gnet.Close
@@ -263,16 +444,16 @@ func handleDelivery(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Act
 	// handle message async
 	_ = s.pool.Submit(func() {
 		// 模拟消息处理耗时
-		_ = processTime()
+		_ = processTime(s)
 
 		rtCode := uint32(0)
-		if comm.DiceCheck(smgp.Conf.GetFloat64("success-rate")) {
+		if simulateFailure(s) {
 			// 失败消息的返回码
 			rtCode = 39
 		}
 		resp := dly.ToResponse(rtCode).(*smgp.DeliverResp)
 		// 发送响应
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
@@ -286,49 +467,63 @@ func handleDelivery(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Act
 // 处理上行消息Resp
 func handleDeliveryResp(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Action {
 	// check connect
-	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	ss, ok := s.conMap.Load(c.RemoteAddr().String())
 	if !ok {
 		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
 		return gnet.Close
 	}
+	atomic.AddUint64(&ss.(*session).acks, 1)
 	frame := comm.TakeBytes(c, int(header.PacketLength-smgp.HeadLength))
 	comm.LogHex(logging.DebugLevel, "Deliver", frame)
 
 	resp := &smgp.DeliverResp{}
-	err := resp.Decode(header, frame)
+	err := resp.Decode(header, frame, s.context(c))
 	if err != nil {
 		log.Errorf("[%-9s] DELIVER_RESP ERROR: %v", "OnTraffic", err)
 		return gnet.Close
 	}
 	log.Debugf("[%-9s] <<< %s", "OnTraffic", resp)
+	s.outbox.Ack(resp.MsgId())
+	if s.mos.Ack(resp.MsgId(), resp.Status()) && resp.Status() != 0 {
+		log.Warnf("[%-9s] mo %s rejected, status=%d", "OnTraffic", resp.MsgId(), resp.Status())
+	}
+	if err = s.store.Ack(resp.MsgId()); err != nil {
+		log.Errorf("[%-9s] save report ack error: %v", "OnTraffic", err)
+	}
 
 	return gnet.None
 }
 
 func handleSubmit(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet.Action {
 	// check connect
-	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	ss, ok := s.conMap.Load(c.RemoteAddr().String())
 	if !ok {
 		log.Warnf("[%-9s] unLogin connection: %s, closing...", "OnTraffic", c.RemoteAddr())
 		return gnet.Close
 	}
+	atomic.AddUint64(&ss.(*session).submits, 1)
 
 	frame := comm.TakeBytes(c, int(header.PacketLength-smgp.HeadLength))
 	comm.LogHex(logging.DebugLevel, "Submit", frame)
 	sub := &smgp.Submit{}
-	err := sub.Decode(header, frame)
+	err := sub.Decode(header, frame, s.context(c))
 	if err != nil {
 		log.Errorf("[%-9s] SUBMIT ERROR: %v", "OnTraffic", err)
 		return gnet.Close
 	}
 	log.Debugf("[%-9s] <<< %s", "OnTraffic", sub)
+	// 保存原始报文，用于消息存储
+	raw := header.Encode()
+	copy(raw[smgp.HeadLength:], frame)
 	// handle message async
-	_ = s.pool.Submit(mtAsyncHandler(s, c, sub))
+	_ = s.pool.Submit(mtAsyncHandler(s, c, account(c), sub, raw))
 	return gnet.None
 }
 
-func mtAsyncHandler(s *Server, c gnet.Conn, sub *smgp.Submit) func() {
+// account为提交MT的SP账号，需在事件循环中获取，连接关闭后无法再从上下文中取得
+func mtAsyncHandler(s *Server, c gnet.Conn, account string, sub *smgp.Submit, raw []byte) func() {
 	return func() {
+		received := time.Now()
 		// 采用通道控制消息收发速度,向通道发送信号
 		s.window <- struct{}{}
 		defer func() {
@@ -336,17 +531,32 @@ func mtAsyncHandler(s *Server, c gnet.Conn, sub *smgp.Submit) func() {
 			<-s.window
 		}()
 
-		// 模拟消息处理耗时，可配置
-		processTime := processTime()
+		rule := matchScenario(s, sub)
+		// 模拟消息处理耗时，可配置，场景规则指定了应答延迟时以规则为准
+		wait := time.Duration(0)
+		if rule != nil && rule.SubmitDelay > 0 {
+			time.Sleep(rule.SubmitDelay)
+		} else {
+			wait = processTime(s)
+		}
 
-		rtCode := uint32(0)
-		if comm.DiceCheck(smgp.Conf.GetFloat64("success-rate")) {
+		rtCode := checkAccount(s, account, sub)
+		if rtCode == 0 && rule != nil && rule.Result != nil {
+			rtCode = *rule.Result
+		} else if rtCode == 0 && rule == nil && simulateFailure(s) {
 			// 失败消息的返回码
 			rtCode = 39
 		}
 		resp := sub.ToResponse(rtCode).(*smgp.SubmitResp)
+		s.metrics.SubmitResult(rtCode)
+		s.recent.Add(admin.Mt{Time: time.Now(), Account: account, MsgId: formatMsgId(resp.MsgId()), Result: rtCode,
+			Dest: sub.DestTermID(), SrcId: sub.SrcTermID(), ServiceId: sub.ServiceID(), Content: sub.MsgContent()})
+		rec := &store.Record{MsgId: formatMsgId(resp.MsgId()), Account: account, Version: uint8(sub.Version()), Submit: raw, Result: rtCode, SubmitAt: time.Now()}
+		if err := s.store.SaveSubmit(rec); err != nil {
+			log.Errorf("[%-9s] save message %x error: %v", "OnTraffic", resp.MsgId(), err)
+		}
 		// 发送响应
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
@@ -356,39 +566,192 @@ func mtAsyncHandler(s *Server, c gnet.Conn, sub *smgp.Submit) func() {
 
 		// 发送状态报告
 		if resp.Status() == 0 {
-			_ = s.pool.Submit(reportAsyncSender(c, sub, resp.MsgId(), processTime))
+			scheduleReport(s, account, sub, resp.MsgId(), wait, rule, received)
 		}
 	}
 }
 
-func reportAsyncSender(c gnet.Conn, sub *smgp.Submit, msgId []byte, wait time.Duration) func() {
+// matchScenario 匹配MT的场景规则
+func matchScenario(s *Server, sub *smgp.Submit) *scenario.Rule {
+	rule := s.scenarios.Match(&scenario.Message{
+		Dest:      sub.DestTermID(),
+		Content:   sub.MsgContent(),
+		ServiceId: sub.ServiceID(),
+		SrcId:     sub.SrcTermID(),
+	})
+	if rule != nil {
+		log.Debugf("[%-9s] message to %v matches scenario %s", "OnTraffic", sub.DestTermID(), rule.Name)
+	}
+	return rule
+}
+
+// checkAccount 校验SP账号是否允许使用MT中的业务代码与发送号码，以及是否超过流量限制
+func checkAccount(s *Server, id string, sub *smgp.Submit) uint32 {
+	acc, ok := s.ctx.Accounts.Get(id)
+	if !ok {
+		return 0
+	}
+	if !acc.AllowServiceId(sub.ServiceID()) {
+		log.Warnf("[%-9s] %s service id %s not allowed", "OnTraffic", id, sub.ServiceID())
+		return 43
+	}
+	if !acc.AllowSrcId(sub.SrcTermID()) {
+		log.Warnf("[%-9s] %s src term id %s not allowed", "OnTraffic", id, sub.SrcTermID())
+		return 46
+	}
+	switch err := s.ctx.Accounts.Take(id); err {
+	case sp.ErrDailyLimit:
+		log.Warnf("[%-9s] FLOW CONTROL：%s %v", "OnTraffic", id, err)
+		return 75
+	case sp.ErrRateLimit:
+		log.Warnf("[%-9s] FLOW CONTROL：%s %v", "OnTraffic", id, err)
+		return 1
+	}
+	return 0
+}
+
+// 定时短信等待至定时发送时间，有效期先到达的则等待至有效期截止，然后产生状态报告
+// received为收到MT的时间，进程重启前收到的MT为零值
+func scheduleReport(s *Server, account string, sub *smgp.Submit, msgId []byte, wait time.Duration, rule *scenario.Rule, received time.Time) {
+	delay, expired := comm.DeliverDelay(sub.AtTime(), sub.ValidTime())
+	sender := reportAsyncSender(s, account, sub, msgId, wait, expired, rule, received)
+	if delay > 0 {
+		log.Debugf("[%-9s] message %x is scheduled, report after %v", "OnTraffic", msgId, delay)
+		time.AfterFunc(delay, func() { _ = s.pool.Submit(sender) })
+	} else {
+		_ = s.pool.Submit(sender)
+	}
+}
+
+// rule为MT匹配的场景规则，可能为nil
+func reportAsyncSender(s *Server, account string, sub *smgp.Submit, msgId []byte, wait time.Duration, expired bool, rule *scenario.Rule, received time.Time) func() {
 	return func() {
-		if comm.DiceCheck(smgp.Conf.GetFloat64("success-rate")) {
+		if !expired && (rule != nil && rule.NoReport || rule == nil && simulateFailure(s)) {
+			// 模拟状态报告丢失
+			_ = s.store.Drop(formatMsgId(msgId))
 			return
 		}
-		dly := smgp.NewDeliveryReport(sub, msgId)
-		// 模拟状态报告发送前的耗时
-		ms := smgp.Conf.GetInt("fix-report-resp-ms")
-		if ms > 0 {
-			processTime := wait + time.Duration(ms)
-			time.Sleep(processTime * time.Millisecond)
+		dly := s.ctx.NewDeliveryReport(sub, msgId)
+		if expired {
+			dly.Report().SetErr("001")
+		} else {
+			if rule != nil {
+				// 匹配场景规则的MT不再随机产生状态
+				dly.Report().SetErr("000")
+				if rule.Err != "" {
+					dly.Report().SetErr(rule.Err)
+				}
+				if rule.Stat != "" {
+					dly.Report().SetStat(rule.Stat)
+				}
+			}
+			// 模拟状态报告发送前的耗时
+			ms := s.ctx.Config().FixReportRespMs
+			if rule != nil && rule.ReportDelay > 0 {
+				time.Sleep(rule.ReportDelay)
+			} else if ms > 0 {
+				processTime := wait + time.Duration(ms)
+				time.Sleep(processTime * time.Millisecond)
+			}
+		}
+		if received.IsZero() {
+			s.metrics.Report(dly.Report().Stat(), -1)
+		} else {
+			s.metrics.Report(dly.Report().Stat(), time.Since(received))
 		}
-		// 发送状态报告
-		err := c.AsyncWrite(dly.Encode(), func(c gnet.Conn) error {
-			log.Debugf("[%-9s] >>> %s", "OnTraffic", dly)
-			return nil
+		data := dly.Encode()
+		if err := s.store.SaveReport(formatMsgId(msgId), formatMsgId(dly.MsgId()), data); err != nil {
+			log.Errorf("[%-9s] save report of message %x error: %v", "OnTraffic", msgId, err)
+		}
+		// 发送给该账号任一在线连接，未收到应答时重发
+		s.outbox.Push(account, formatMsgId(dly.MsgId()), outbox.Bytes(data))
+		log.Debugf("[%-9s] >>> %s", "OnTraffic", dly)
+	}
+}
+
+// SP登录后补发未确认的状态报告，并继续处理进程重启前尚未产生状态报告的MT
+func replayReports(s *Server, account string) func() {
+	return func() {
+		replayed, resumed := 0, 0
+		s.store.RangeUnfinished(account, func(rec *store.Record) bool {
+			if rec.Unacked() {
+				s.outbox.Push(account, rec.ReportId, outbox.Bytes(rec.Report))
+				replayed++
+			} else if _, ok := s.recovered.LoadAndDelete(rec.MsgId); ok {
+				sub, err := decodeSubmit(rec.Submit, s.ctx.WithVersion(s.recordVersion(rec)))
+				if err != nil {
+					log.Errorf("[%-9s] decode stored message %s error: %v", "OnTraffic", rec.MsgId, err)
+					return true
+				}
+				msgId, _ := hex.DecodeString(rec.MsgId)
+				scheduleReport(s, account, sub, msgId, 0, matchScenario(s, sub), time.Time{})
+				resumed++
+			}
+			return true
 		})
-		if err != nil {
-			log.Errorf("[%-9s] DELIVERY_REPORT ERROR: %v", "OnTraffic", err)
+		if replayed > 0 || resumed > 0 {
+			log.Infof("[%-9s] %d reports resent and %d messages resumed for %s", "OnTraffic", replayed, resumed, account)
 		}
 	}
 }
 
+func decodeSubmit(raw []byte, ctx *smgp.Context) (*smgp.Submit, error) {
+	if len(raw) < smgp.HeadLength {
+		return nil, smgp.ErrorPacket
+	}
+	header := &smgp.MessageHeader{}
+	if err := header.Decode(raw[:smgp.HeadLength]); err != nil {
+		return nil, err
+	}
+	sub := &smgp.Submit{}
+	return sub, sub.Decode(header, raw[smgp.HeadLength:], ctx)
+}
+
+// recordVersion 消息提交时连接的协议版本，未记录版本的旧数据按配置的版本处理
+func (s *Server) recordVersion(rec *store.Record) smgp.Version {
+	if rec.Version == 0 {
+		return s.ctx.ConfVersion()
+	}
+	return smgp.Version(rec.Version)
+}
+
+func formatMsgId(msgId []byte) string {
+	return hex.EncodeToString(msgId)
+}
+
+// write 发送报文并计入指标
+func (s *Server) write(c gnet.Conn, data []byte, callback gnet.AsyncCallback) error {
+	s.sent(c, data)
+	return c.AsyncWrite(data, callback)
+}
+
+// sent 发出报文时统计指标、记录抓包
+func (s *Server) sent(c gnet.Conn, data []byte) {
+	s.metrics.Out(data)
+	s.capture.Out(c, data)
+}
+
+// 连接登录的SP账号
+func account(c gnet.Conn) string {
+	if ss, ok := c.Context().(*session); ok {
+		return ss.account
+	}
+	return ""
+}
+
+// 连接的编解码上下文，登录后按协商的版本，未登录时按配置的版本
+func (s *Server) context(c gnet.Conn) *smgp.Context {
+	if ss, ok := c.Context().(*session); ok {
+		return ss.ctx
+	}
+	return s.ctx
+}
+
 func handActive(s *Server, c gnet.Conn, header *smgp.MessageHeader) (action gnet.Action) {
 	resp := smgp.NewActiveTestResp(header.SequenceId)
 	// send active_resp async
 	_ = s.pool.Submit(func() {
-		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err := s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
@@ -428,11 +791,11 @@ func checkReceiveWindow(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet
 		if err != nil || discard != l {
 			return gnet.Close
 		}
-		sub := &smgp.Submit{}
-		sub.MessageHeader = header
-		resp := sub.ToResponse(1).(*smgp.SubmitResp)
+		// 使用连接的上下文应答，MsgID取自网关配置的smgw-id
+		resp := s.context(c).NewSubmitResp(header, 1)
+		s.metrics.SubmitResult(1)
 		// 发送响应
-		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+		err = s.write(c, resp.Encode(), func(c gnet.Conn) error {
 			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
 			return nil
 		})
@@ -445,13 +808,19 @@ func checkReceiveWindow(s *Server, c gnet.Conn, header *smgp.MessageHeader) gnet
 	return gnet.None
 }
 
-func processTime() time.Duration {
+// 按 success-rate 模拟处理失败，success-rate为成功的概率
+func simulateFailure(s *Server) bool {
+	return !comm.DiceCheck(s.ctx.Config().SuccessRate)
+}
+
+func processTime(s *Server) time.Duration {
 	// 模拟消息处理耗时，可配置
 	processTime := time.Duration(0)
-	if smgp.Conf.GetInt("min-submit-resp-ms") > 0 && smgp.Conf.GetInt("max-submit-resp-ms") > smgp.Conf.GetInt("min-submit-resp-ms") {
-		processTime := time.Duration(comm.RandNum(
-			int32(smgp.Conf.GetInt("min-submit-resp-ms")),
-			int32(smgp.Conf.GetInt("max-submit-resp-ms")),
+	conf := s.ctx.Config()
+	if conf.MinSubmitRespMs > 0 && conf.MaxSubmitRespMs > conf.MinSubmitRespMs {
+		processTime = time.Duration(comm.RandNum(
+			int32(conf.MinSubmitRespMs),
+			int32(conf.MaxSubmitRespMs),
 		))
 		time.Sleep(processTime * time.Millisecond)
 	}
@@ -22,7 +22,7 @@ import (
 func init() {
 	rand.Seed(time.Now().Unix()) // 随机种子
 	smgp.Conf = yml_config.CreateYamlFactory("smgp.yaml")
-	dc := smgp.Conf.GetInt("data-center-id")
+	dc := smgp.Conf.GetInt("datacenter-id")
 	wk := smgp.Conf.GetInt("worker-id")
 	smgwId := smgp.Conf.GetString("smgw-id")
 	smgp.Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
@@ -106,6 +106,35 @@ func TestTerminate(t *testing.T) {
 	terminate(t, c)
 }
 
+func TestSimulateFailure(t *testing.T) {
+	// success-rate为成功的概率，1时不失败，0时总是失败
+	for rate, want := range map[float64]bool{1: false, 0: true} {
+		ctx, err := smgp.NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{"version": 0x30, "success-rate": rate}))
+		assert.Nil(t, err)
+		s := &Server{ctx: ctx}
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, want, simulateFailure(s))
+		}
+	}
+}
+
+func TestProcessTime(t *testing.T) {
+	ctx, err := smgp.NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"version": 0x30, "min-submit-resp-ms": 2, "max-submit-resp-ms": 5}))
+	assert.Nil(t, err)
+	s := &Server{ctx: ctx}
+	// 返回模拟的处理耗时(毫秒)，用于计算状态报告的发送时间
+	for i := 0; i < 10; i++ {
+		pt := processTime(s)
+		assert.True(t, pt >= 2 && pt < 5, "%d", pt)
+	}
+
+	ctx.Conf.Set("max-submit-resp-ms", 0)
+	ctx.Conf.Set("min-submit-resp-ms", 0)
+	assert.Nil(t, ctx.Reload())
+	assert.Equal(t, time.Duration(0), processTime(s))
+}
+
 func runClient(t *testing.T) {
 	go func(t *testing.T) {
 		c, err := net.Dial("tcp", addr)
@@ -184,7 +213,7 @@ func login(t *testing.T, c net.Conn) bool {
 		return false
 	}
 	rep := &smgp.LoginResp{}
-	err = rep.Decode(header, resp[smgp.HeadLength:])
+	err = rep.Decode(header, resp[smgp.HeadLength:], nil)
 	if err != nil {
 		return false
 	}
@@ -222,7 +251,7 @@ func readResp(t *testing.T, c net.Conn) bool {
 	}
 	if header.RequestId == smgp.CmdSubmitResp {
 		csr := &smgp.SubmitResp{}
-		err := csr.Decode(header, bytes)
+		err := csr.Decode(header, bytes, nil)
 		if err != nil {
 			t.Errorf("%v", err)
 			return false
@@ -232,7 +261,7 @@ func readResp(t *testing.T, c net.Conn) bool {
 		}
 	} else if header.RequestId == smgp.CmdDeliver {
 		dly := &smgp.Deliver{}
-		err := dly.Decode(header, bytes)
+		err := dly.Decode(header, bytes, nil)
 		if err != nil {
 			t.Errorf("%v", err)
 			return false
@@ -262,7 +291,7 @@ func readResp(t *testing.T, c net.Conn) bool {
 }
 
 func sendDelivery(t *testing.T, c net.Conn) bool {
-	dly := smgp.NewDeliver("13700001111", "123", "hello word 中国")
+	dly := smgp.NewDeliver("13700001111", "123", "hello word 中国", smgp.ConfVersion())
 	_, err := c.Write(dly.Encode())
 	if err != nil {
 		t.Errorf("%v", err)
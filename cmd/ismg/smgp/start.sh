@@ -9,6 +9,8 @@ export GNET_LOGGING_FILE="/Users/huangzhonghui/logs/smgp.log"
 
 mkdir -p /Users/huangzhonghui/logs
 
+# 各配置项均可由同名的命令行参数或环境变量覆盖，如 --success-rate=1、GOSMS_SMGP_SHARED_SECRET=xxx，见 ./smgp.ismg --help
+# --config 指定配置文件，默认为 ./config/smgp.yaml
 # optional args --port 1234 --multicore=false
 # default  args --port 9100 --multicore=true
 nohup ./smgp.ismg --port 9100 --multicore=true >panic.log 2>&1 &
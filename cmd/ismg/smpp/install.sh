@@ -0,0 +1,13 @@
+#!/bin/sh
+
+go clean
+go mod tidy
+# 编译
+go build -trimpath -o smpp.ismg
+go test -v server_test.go -test.run TestClient -c
+
+mkdir -p ~/smpp
+mv smpp.ismg ~/smpp/
+mv main.test ~/smpp/
+cp start.sh ~/smpp/
+cp -rf ../../../config ~/smpp/
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/aaronwong1989/gosms/codec/smpp"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/snowflake"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+var log = logging.GetDefaultLogger()
+
+func main() {
+	rand.Seed(time.Now().Unix()) // 随机种子
+	var port int
+	var multicore bool
+	flag.IntVar(&port, "port", 2775, "监听端口，pprof监听 port+1")
+	flag.BoolVar(&multicore, "multicore", true, "是否使用多核处理连接")
+	// 各配置项均可由同名的命令行参数或 GOSMS_SMPP_ 开头的环境变量覆盖，见 --help
+	overrides := yml_config.NewOverrides(flag.CommandLine, "GOSMS_SMPP", "smpp.yaml", &smpp.Config{})
+	if err := overrides.Parse(os.Args[1:]); err != nil {
+		log.Fatalf("parse args error: %v", err)
+	}
+	smpp.Conf = overrides.Load()
+	dc := smpp.Conf.GetInt("datacenter-id")
+	wk := smpp.Conf.GetInt("worker-id")
+	smpp.Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
+	smpp.Seq64 = snowflake.NewSnowflake(int64(dc), int64(wk))
+	StartServer(port, multicore)
+}
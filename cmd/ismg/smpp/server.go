@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	_ "net/http/pprof"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/ants/v2"
+	"github.com/panjf2000/gnet/v2"
+	"github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
+
+	"github.com/aaronwong1989/gosms/codec/smpp"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/logging"
+)
+
+type Server struct {
+	gnet.BuiltinEventEngine
+	engine    gnet.Engine
+	protocol  string
+	address   string
+	multicore bool
+	pool      *goroutine.Pool
+	conMap    sync.Map
+	window    chan struct{}
+}
+
+var (
+	poolSize   int
+	windowSize int
+)
+
+func StartServer(port int, multicore bool) {
+	poolSize = smpp.Conf.GetInt("max-pool-size")
+	windowSize = smpp.Conf.GetInt("receive-window-size")
+
+	// 定义异步工作Go程池
+	options := ants.Options{
+		ExpiryDuration:   time.Minute, // 1 分钟内不被使用的worker会被清除
+		Nonblocking:      false,       // 如果为true,worker池满了后提交任务会直接返回nil
+		MaxBlockingTasks: poolSize,    // blocking模式有效，否则worker池满了后提交任务会直接返回nil
+		PreAlloc:         false,
+		PanicHandler: func(e interface{}) {
+			log.Errorf("%v", e)
+		},
+	}
+	pool, _ := ants.NewPool(poolSize, ants.WithOptions(options))
+	defer pool.Release()
+
+	ss := &Server{
+		protocol:  "tcp",
+		address:   fmt.Sprintf(":%d", port),
+		multicore: multicore,
+		pool:      pool,
+		window:    make(chan struct{}, windowSize), // 用通道控制消息接收窗口
+	}
+
+	comm.StartMonitor(port)
+	log.Infof("current pid is %s.", comm.SavePid("smpp.pid"))
+
+	err := gnet.Run(ss, ss.protocol+"://"+ss.address, gnet.WithMulticore(multicore), gnet.WithTicker(true))
+	log.Errorf("server(%s://%s) exits with error: %v", ss.protocol, ss.address, err)
+}
+
+func (s *Server) OnBoot(eng gnet.Engine) (action gnet.Action) {
+	log.Infof("[%-9s] running server on %s with multi-core=%t", "OnBoot", fmt.Sprintf("%s://%s", s.protocol, s.address), s.multicore)
+	s.engine = eng
+	return
+}
+
+func (s *Server) OnShutdown(eng gnet.Engine) {
+	log.Warnf("[%-9s] shutdown server %s ...", "OnShutdown", fmt.Sprintf("%s://%s", s.protocol, s.address))
+	for eng.CountConnections() > 0 {
+		log.Warnf("[%-9s] active connections is %d, waiting...", "OnShutdown", eng.CountConnections())
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Warnf("[%-9s] shutdown server %s completed!", "OnShutdown", fmt.Sprintf("%s://%s", s.protocol, s.address))
+}
+
+func (s *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
+	if s.countConn() >= smpp.Conf.GetInt("max-cons") {
+		log.Warnf("[%-9s] [%v<->%v] FLOW CONTROL：connections threshold reached, closing new connection...", "OnOpen", c.RemoteAddr(), c.LocalAddr())
+		return nil, gnet.Close
+	} else if len(s.window) == windowSize {
+		log.Warnf("[%-9s] [%v<->%v] FLOW CONTROL：receive window threshold reached, closing new connection...", "OnOpen", c.RemoteAddr(), c.LocalAddr())
+		// 已达到窗口时，拒绝新的连接
+		return nil, gnet.Close
+	} else {
+		log.Infof("[%-9s] [%v<->%v] activeCons=%d.", "OnOpen", c.RemoteAddr(), c.LocalAddr(), s.activeCons())
+		return
+	}
+}
+
+func (s *Server) OnClose(c gnet.Conn, e error) (action gnet.Action) {
+	log.Warnf("[%-9s] [%v<->%v] activeCons=%d, reason=%v.", "OnClose", c.RemoteAddr(), c.LocalAddr(), s.activeCons(), e)
+	s.conMap.Delete(c.RemoteAddr().String())
+	return
+}
+
+// OnTraffic 一次读事件可能收到多个报文(如客户端在发送窗口内连续发送的Submit)，
+// 需逐个处理，直至缓冲区中不足一个完整报文；报文体未完整到达时等待下次读事件，不提前取走报文头
+func (s *Server) OnTraffic(c gnet.Conn) (action gnet.Action) {
+	for action == gnet.None && comm.FrameReady(c) {
+		action = s.handleFrame(c)
+	}
+	return
+}
+
+func (s *Server) handleFrame(c gnet.Conn) (action gnet.Action) {
+	header := getHeader(c)
+	// 防止粘包检测，不合法包，关闭连接
+	if header == nil || header.CommandLength < smpp.HeadLength || header.CommandLength > comm.MaxFrameLength {
+		log.Warnf("[%-9s] [%v<->%v] decode error, header: %s, close session...", "OnTraffic", c.RemoteAddr(), c.LocalAddr(), header)
+		return gnet.Close
+	}
+	action = checkReceiveWindow(s, c, header)
+	if action == gnet.Close {
+		return action
+	}
+
+	switch header.CommandId {
+	case 0: // 触发限速
+		return gnet.None
+	case smpp.SMPP_BIND_TRANSMITTER, smpp.SMPP_BIND_RECEIVER, smpp.SMPP_BIND_TRANSCEIVER:
+		return handleBind(s, c, header)
+	case smpp.SMPP_SUBMIT_SM:
+		return handleSubmit(s, c, header)
+	case smpp.SMPP_DELIVER_SM:
+		return handleDeliver(s, c, header)
+	case smpp.SMPP_DELIVER_SM_RESP, smpp.SMPP_SUBMIT_SM_RESP:
+		return discardResp(c, header)
+	case smpp.SMPP_ENQUIRE_LINK:
+		return handleEnquireLink(s, c, header)
+	case smpp.SMPP_ENQUIRE_LINK_RESP:
+		return handleEnquireLinkResp(c, header)
+	case smpp.SMPP_UNBIND:
+		return handleUnbind(s, c, header)
+	case smpp.SMPP_UNBIND_RESP:
+		return handleUnbindResp(s, c, header)
+	case smpp.SMPP_GENERIC_NACK:
+		log.Warnf("[%-9s] <<< %s", "OnTraffic", header)
+		return gnet.None
+	default:
+		// 无法识别的命令，返回generic_nack
+		return handleUnknown(s, c, header)
+	}
+}
+
+func (s *Server) OnTick() (delay time.Duration, action gnet.Action) {
+	log.Infof("[%-9s] %d active connections.", "OnTick", s.activeCons())
+	s.conMap.Range(func(key, value interface{}) bool {
+		addr := key.(string)
+		con, ok := value.(gnet.Conn)
+		if ok {
+			_ = s.pool.Submit(func() {
+				el := smpp.NewEnquireLink()
+				err := con.AsyncWrite(el.Encode(), nil)
+				if err == nil {
+					log.Infof("[%-9s] >>> %s to %s", "OnTick", el, addr)
+				} else {
+					log.Errorf("[%-9s] >>> ENQUIRE_LINK to %s, error: %v", "OnTick", addr, err)
+				}
+			})
+		}
+		return true
+	})
+	return smpp.Conf.GetDuration("enquire-link-duration"), gnet.None
+}
+
+func (s *Server) countConn() int {
+	counter := 0
+	s.conMap.Range(func(key, value interface{}) bool {
+		counter++
+		return true
+	})
+	return counter
+}
+
+func (s *Server) activeCons() int {
+	return s.engine.CountConnections()
+}
+
+func handleBind(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	frame := comm.TakeBytes(c, int(header.CommandLength-smpp.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Bind", frame)
+
+	bind := &smpp.Bind{}
+	err := bind.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] %s ERROR: %v", "OnTraffic", smpp.CommandMap[header.CommandId], err)
+		return gnet.Close
+	}
+
+	log.Infof("[%-9s] <<< %s", "OnTraffic", bind)
+	var resp *smpp.BindResp
+	if _, ok := s.conMap.Load(c.RemoteAddr().String()); ok {
+		// 同一连接重复绑定
+		resp = bind.ToResponse(smpp.ESME_RALYBND).(*smpp.BindResp)
+	} else {
+		resp = bind.ToResponse(0).(*smpp.BindResp)
+	}
+	if resp.Status() != smpp.ESME_ROK {
+		log.Errorf("[%-9s] %s ERROR: Auth Error, status=(%d,%s)", "OnTraffic", smpp.CommandMap[header.CommandId], resp.Status(), smpp.StatusMap[resp.Status()])
+	}
+
+	// send bind_resp async
+	_ = s.pool.Submit(func() {
+		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
+			if resp.Status() == smpp.ESME_ROK {
+				// 记录绑定类型，用于判断是否允许提交短信
+				c.SetContext(bind)
+				s.conMap.Store(c.RemoteAddr().String(), c)
+			} else if resp.Status() != smpp.ESME_RALYBND {
+				// 客户端绑定失败，关闭连接
+				_ = c.Close()
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] %s ERROR: %v", "OnTraffic", smpp.CommandMap[resp.CommandId], err)
+		}
+	})
+	return gnet.None
+}
+
+func handleEnquireLink(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	resp := smpp.NewEnquireLinkResp(header.SequenceNumber)
+	// send enquire_link_resp async
+	_ = s.pool.Submit(func() {
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] ENQUIRE_LINK_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+func handleEnquireLinkResp(c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	log.Infof("[%-9s] <<< %s from %s", "OnTraffic", header, c.RemoteAddr())
+	return gnet.None
+}
+
+func handleUnbind(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	log.Infof("[%-9s] <<< %s", "OnTraffic", header)
+	resp := smpp.NewUnbindResp(header.SequenceNumber)
+	// send unbind_resp async
+	_ = s.pool.Submit(func() {
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", resp)
+			s.conMap.Delete(c.RemoteAddr().String())
+			_ = c.Close()
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] UNBIND_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+func handleUnbindResp(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	log.Infof("[%-9s] <<< %s", "OnTraffic", header)
+	log.Infof("[%-9s] closing connection [%v<-->%v]", "OnTraffic", c.RemoteAddr(), c.LocalAddr())
+	s.conMap.Delete(c.RemoteAddr().String())
+	_ = c.Flush()
+	_ = c.Close()
+	return gnet.Close
+}
+
+// 丢弃无法识别的报文，并返回generic_nack
+func handleUnknown(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	l := int(header.CommandLength - smpp.HeadLength)
+	discard, err := c.Discard(l)
+	if err != nil || discard != l {
+		return gnet.Close
+	}
+	log.Warnf("[%-9s] unknown command: %s", "OnTraffic", header)
+	nack := smpp.NewGenericNack(header.SequenceNumber, smpp.ESME_RINVCMDID)
+	_ = s.pool.Submit(func() {
+		err := c.AsyncWrite(nack.Encode(), func(c gnet.Conn) error {
+			log.Infof("[%-9s] >>> %s", "OnTraffic", nack)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] GENERIC_NACK ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+// 处理上行消息
+func handleDeliver(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unBind connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+
+	frame := comm.TakeBytes(c, int(header.CommandLength-smpp.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Deliver", frame)
+	dlv := &smpp.Deliver{}
+	err := dlv.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] DELIVER_SM ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+	log.Debugf("[%-9s] <<< %s", "OnTraffic", dlv)
+	// handle message async
+	_ = s.pool.Submit(func() {
+		// 模拟消息处理耗时
+		_ = processTime()
+
+		rtCode := smpp.ESME_ROK
+		if !comm.DiceCheck(smpp.Conf.GetFloat64("success-rate")) {
+			// 失败消息的返回码
+			rtCode = smpp.ESME_RX_T_APPN
+		}
+		resp := dlv.ToResponse(rtCode).(*smpp.SmResp)
+		// 发送响应
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] DELIVER_SM_RESP ERROR: %v", "OnTraffic", err)
+		}
+	})
+	return gnet.None
+}
+
+// 消费并打印应答报文
+func discardResp(c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	frame := comm.TakeBytes(c, int(header.CommandLength-smpp.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Resp", frame)
+
+	resp := &smpp.SmResp{}
+	err := resp.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] %s ERROR: %v", "OnTraffic", smpp.CommandMap[header.CommandId], err)
+		return gnet.Close
+	}
+	log.Debugf("[%-9s] <<< %s", "OnTraffic", resp)
+	return gnet.None
+}
+
+func handleSubmit(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	// check connect
+	_, ok := s.conMap.Load(c.RemoteAddr().String())
+	if !ok {
+		log.Warnf("[%-9s] unBind connection: %s, closing...", "OnTraffic", c.RemoteAddr())
+		return gnet.Close
+	}
+
+	frame := comm.TakeBytes(c, int(header.CommandLength-smpp.HeadLength))
+	comm.LogHex(logging.DebugLevel, "Submit", frame)
+	sub := &smpp.Submit{}
+	err := sub.Decode(header, frame)
+	if err != nil {
+		log.Errorf("[%-9s] SUBMIT_SM ERROR: %v", "OnTraffic", err)
+		return gnet.Close
+	}
+	log.Debugf("[%-9s] <<< %s", "OnTraffic", sub)
+	// handle message async
+	_ = s.pool.Submit(mtAsyncHandler(s, c, sub))
+	return gnet.None
+}
+
+func mtAsyncHandler(s *Server, c gnet.Conn, sub *smpp.Submit) func() {
+	return func() {
+		// 采用通道控制消息收发速度,向通道发送信号
+		s.window <- struct{}{}
+		defer func() {
+			// defer函数消费信号，确保每个消息的信号最终都会被消费
+			<-s.window
+		}()
+
+		// 模拟消息处理耗时
+		processTime := processTime()
+
+		rtCode := smpp.ESME_ROK
+		if bind, ok := c.Context().(*smpp.Bind); ok && !bind.IsTransmitter() {
+			// 以接收者身份绑定的连接不允许提交短信
+			rtCode = smpp.ESME_RINVBNDSTS
+		} else if !comm.DiceCheck(smpp.Conf.GetFloat64("success-rate")) {
+			// 失败消息的返回码
+			rtCode = smpp.ESME_RSUBMITFAIL
+		}
+		resp := sub.ToResponse(rtCode).(*smpp.SmResp)
+		// 发送响应
+		err := c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SUBMIT_SM_RESP ERROR: %v", "OnTraffic", err)
+		}
+
+		// 发送状态报告
+		if resp.Status() == smpp.ESME_ROK && sub.RegisteredDelivery()&0x03 != 0 {
+			_ = s.pool.Submit(reportAsyncSender(c, sub, resp.MessageId(), processTime))
+		}
+	}
+}
+
+func processTime() time.Duration {
+	// 模拟消息处理耗时，可配置
+	processTime := time.Duration(0)
+	if smpp.Conf.GetInt("min-submit-resp-ms") > 0 && smpp.Conf.GetInt("max-submit-resp-ms") > smpp.Conf.GetInt("min-submit-resp-ms") {
+		processTime = time.Duration(comm.RandNum(
+			int32(smpp.Conf.GetInt("min-submit-resp-ms")),
+			int32(smpp.Conf.GetInt("max-submit-resp-ms")),
+		))
+		time.Sleep(processTime * time.Millisecond)
+	}
+	return processTime
+}
+
+func reportAsyncSender(c gnet.Conn, sub *smpp.Submit, msgId string, wait time.Duration) func() {
+	return func() {
+		// 按成功率模拟状态报告丢失
+		if !comm.DiceCheck(smpp.Conf.GetFloat64("success-rate")) {
+			return
+		}
+		// 模拟状态报告发送前的耗时
+		ms := smpp.Conf.GetInt("fix-report-resp-ms")
+		if ms > 0 {
+			processTime := wait + time.Duration(ms)
+			time.Sleep(processTime * time.Millisecond)
+		}
+		dly := sub.ToDeliveryReceipt(msgId)
+		// registered_delivery为2时仅在出错时返回状态报告
+		if sub.RegisteredDelivery()&0x03 == 2 && dly.MessageState() == smpp.StateDelivered {
+			return
+		}
+		err := c.AsyncWrite(dly.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", dly)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] DELIVER_SM(RECEIPT) ERROR: %v", "OnTraffic", err)
+		}
+	}
+}
+
+func getHeader(c gnet.Conn) *smpp.MessageHeader {
+	frame := comm.TakeBytes(c, smpp.HeadLength)
+	if frame == nil {
+		return nil
+	}
+	comm.LogHex(logging.DebugLevel, "Header", frame)
+
+	header := smpp.MessageHeader{}
+	err := header.Decode(frame)
+	if err != nil {
+		log.Errorf("[%-9s] decode error: %v", "OnTraffic", err)
+		return nil
+	}
+	return &header
+}
+
+func checkReceiveWindow(s *Server, c gnet.Conn, header *smpp.MessageHeader) gnet.Action {
+	if len(s.window) == windowSize && header.CommandId == smpp.SMPP_SUBMIT_SM {
+		log.Warnf("[%-9s] FLOW CONTROL：receive window threshold reached.", "OnTraffic")
+		l := int(header.CommandLength - smpp.HeadLength)
+		discard, err := c.Discard(l)
+		if err != nil || discard != l {
+			return gnet.Close
+		}
+		sub := &smpp.Submit{}
+		sub.MessageHeader = header
+		resp := sub.ToResponse(smpp.ESME_RTHROTTLED).(*smpp.SmResp)
+		// 发送响应
+		err = c.AsyncWrite(resp.Encode(), func(c gnet.Conn) error {
+			log.Debugf("[%-9s] >>> %s", "OnTraffic", resp)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("[%-9s] SUBMIT_SM_RESP ERROR: %v", "OnTraffic", err)
+			return gnet.Close
+		}
+		header.CommandId = 0
+	}
+	return gnet.None
+}
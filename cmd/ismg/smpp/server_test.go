@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+	"github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/codec/smpp"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/snowflake"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func init() {
+	rand.Seed(time.Now().Unix()) // 随机种子
+	smpp.Conf = yml_config.CreateYamlFactory("smpp.yaml")
+	dc := smpp.Conf.GetInt("datacenter-id")
+	wk := smpp.Conf.GetInt("worker-id")
+	smpp.Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
+	smpp.Seq64 = snowflake.NewSnowflake(int64(dc), int64(wk))
+}
+
+var (
+	pool      = goroutine.Default()
+	counterMt int64
+	counterRt int64
+	wg        sync.WaitGroup
+	mtChan    = make(chan struct{}, 1)
+	dlyChan   = make(chan struct{}, 1)
+	readChan  = make(chan struct{}, 1)
+	termChan  = make(chan struct{})
+
+	clients  = 1
+	duration = time.Second * 30
+	// addr = "10.211.55.13:2775"
+	addr = ":2775"
+)
+
+func TestClient(t *testing.T) {
+	wg.Add(1)
+	defer func() {
+		pool.Release()
+		logResult(t)
+	}()
+
+	for i := 0; i < clients; i++ {
+		runClient(t)
+	}
+	time.Sleep(duration)
+
+	// 停掉发送
+	dlyChan <- struct{}{}
+	mtChan <- struct{}{}
+	// 停掉接收
+	time.Sleep(100 * time.Millisecond)
+	readChan <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	// 发送断开连接报文
+	wg.Done()
+	<-termChan
+}
+
+func TestLogin(t *testing.T) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer func(c net.Conn) {
+		err := c.Close()
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+	}(c)
+
+	login(t, c)
+}
+
+func TestUnbind(t *testing.T) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	defer func(c net.Conn) {
+		err := c.Close()
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+	}(c)
+
+	if !login(t, c) {
+		return
+	}
+
+	terminate(t, c)
+}
+
+func runClient(t *testing.T) {
+	go func(t *testing.T) {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Errorf("%v", err)
+			return
+		}
+		defer func(c net.Conn) {
+			err := c.Close()
+			if err != nil {
+				t.Errorf("%v", err)
+			}
+		}(c)
+
+		if !login(t, c) {
+			panic("登录失败，程序退出!")
+		}
+
+		_ = pool.Submit(func() {
+			for s := true; s; {
+				select {
+				case <-mtChan:
+					s = false
+					t.Logf("接收到 mtChan 的停止信号")
+				default:
+					s = sendMt(t, c)
+				}
+			}
+		})
+
+		_ = pool.Submit(func() {
+			for s := true; s; {
+				select {
+				case <-dlyChan:
+					s = false
+					t.Logf("接收到 dlyChan 的停止信号")
+				default:
+					s = sendDelivery(t, c)
+					time.Sleep(time.Millisecond * 50)
+				}
+			}
+		})
+
+		_ = pool.Submit(func() {
+			for s := true; s; {
+				select {
+				case <-readChan:
+					s = false
+					t.Logf("接收到 readChan 的停止信号")
+				default:
+					s = readResp(t, c)
+				}
+			}
+		})
+
+		wg.Wait()
+		terminate(t, c)
+		termChan <- struct{}{}
+	}(t)
+}
+
+func login(t *testing.T, c net.Conn) bool {
+	bind := smpp.NewBind(smpp.SMPP_BIND_TRANSCEIVER)
+	t.Logf(">>>: %s", bind)
+	data := bind.Encode()
+	i, _ := c.Write(data)
+	assert.True(t, i == len(data))
+
+	header, body := readPdu(t, c)
+	if header == nil {
+		return false
+	}
+	resp := &smpp.BindResp{}
+	err := resp.Decode(header, body)
+	if err != nil {
+		return false
+	}
+	t.Logf("<<<: %s", resp)
+	return smpp.ESME_ROK == resp.Status()
+}
+
+// 读取一个完整的报文
+func readPdu(t *testing.T, c net.Conn) (*smpp.MessageHeader, []byte) {
+	bytes := make([]byte, smpp.HeadLength)
+	_, err := io.ReadFull(c, bytes)
+	if err != nil {
+		t.Errorf("%v", err)
+		return nil, nil
+	}
+	header := &smpp.MessageHeader{}
+	_ = header.Decode(bytes)
+	bytes = make([]byte, header.CommandLength-smpp.HeadLength)
+	_, err = io.ReadFull(c, bytes)
+	if err != nil {
+		t.Errorf("%v", err)
+		return nil, nil
+	}
+	return header, bytes
+}
+
+func sendMt(t *testing.T, c net.Conn) bool {
+	mts := smpp.NewSubmit("8613100001111", fmt.Sprintf("hello world! %d", rand.Uint64()))
+	mt := mts[0]
+	_, err := c.Write(mt.Encode())
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	t.Logf(">>> %s", mt)
+	return true
+}
+
+func readResp(t *testing.T, c net.Conn) bool {
+	header, bytes := readPdu(t, c)
+	if header == nil {
+		return false
+	}
+	if header.CommandId == smpp.SMPP_SUBMIT_SM_RESP {
+		csr := &smpp.SmResp{}
+		err := csr.Decode(header, bytes)
+		if err != nil {
+			t.Errorf("%v", err)
+			return false
+		} else {
+			atomic.AddInt64(&counterMt, 1)
+			t.Logf("<<< %s", csr)
+		}
+	} else if header.CommandId == smpp.SMPP_DELIVER_SM {
+		dly := &smpp.Deliver{}
+		err := dly.Decode(header, bytes)
+		if err != nil {
+			t.Errorf("%v", err)
+			return false
+		} else {
+			if dly.IsReceipt() {
+				// 状态报告计数
+				atomic.AddInt64(&counterRt, 1)
+			}
+			t.Logf("<<< %s", dly)
+			resp := dly.ToResponse(0).(*smpp.SmResp)
+			_, err = c.Write(resp.Encode())
+			if err != nil {
+				t.Errorf("%v", err)
+				return false
+			}
+		}
+	} else {
+		t.Logf("<<< %s:%x", header, bytes)
+	}
+	return true
+}
+
+func sendDelivery(t *testing.T, c net.Conn) bool {
+	dly := smpp.NewDeliver("8613700001111", "hello word 中国", "")
+	_, err := c.Write(dly.Encode())
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	t.Logf(">>> %s", dly)
+	return true
+}
+
+func logResult(t *testing.T) {
+	result := fmt.Sprintf("%s CounterMt=%d, CounterRt=%d\n", time.Now().Format("2006-01-02T15:04:05.000"), counterMt, counterRt)
+	t.Logf(result)
+	file, err := os.OpenFile("./test.result.txt", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	writer := bufio.NewWriter(file)
+	_, _ = writer.WriteString(result)
+	defer func(file *os.File, writer *bufio.Writer) {
+		_ = writer.Flush()
+		_ = file.Close()
+	}(file, writer)
+}
+
+func terminate(t *testing.T, c net.Conn) {
+	term := smpp.NewUnbind()
+	_, err := c.Write(term.Encode())
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	t.Logf(">>> %s", term)
+
+	bytes := make([]byte, smpp.HeadLength)
+	l, err := c.Read(bytes)
+	if err != nil || l != smpp.HeadLength {
+		t.Errorf("%v", err)
+	}
+	h := &smpp.MessageHeader{}
+	err = h.Decode(bytes)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	t.Logf("<<< %s", h)
+}
+
+// bufConn 模拟连接的读缓冲区，只实现处理报文用到的方法
+type bufConn struct {
+	gnet.Conn
+	buf []byte
+}
+
+func (c *bufConn) Peek(n int) ([]byte, error) {
+	if n > len(c.buf) {
+		return c.buf, io.ErrShortBuffer
+	}
+	return c.buf[:n], nil
+}
+
+func (c *bufConn) Discard(n int) (int, error) {
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *bufConn) InboundBuffered() int { return len(c.buf) }
+
+func (c *bufConn) RemoteAddr() net.Addr { return nil }
+
+func (c *bufConn) LocalAddr() net.Addr { return nil }
+
+func TestServer_OnTraffic(t *testing.T) {
+	s := &Server{}
+	resp := func() []byte {
+		h := &smpp.MessageHeader{CommandLength: smpp.HeadLength + 4, CommandId: smpp.SMPP_SUBMIT_SM_RESP}
+		frame := h.Encode()
+		copy(frame[smpp.HeadLength:], "abc")
+		return frame
+	}
+	// 报文体未到达时不取走报文头
+	c := &bufConn{buf: resp()[:smpp.HeadLength]}
+	assert.Equal(t, gnet.None, s.OnTraffic(c))
+	assert.Equal(t, smpp.HeadLength, c.InboundBuffered())
+
+	// 报文体分段到达后，与其后连续发送的报文一次处理完
+	c.buf = append(append(resp(), resp()...), resp()[:5]...)
+	assert.Equal(t, gnet.None, s.OnTraffic(c))
+	assert.Equal(t, 5, c.InboundBuffered())
+
+	// 报文长度超过上限时关闭连接，不等待报文体
+	h := &smpp.MessageHeader{CommandLength: smpp.HeadLength, CommandId: smpp.SMPP_SUBMIT_SM}
+	frame := h.Encode()
+	binary.BigEndian.PutUint32(frame, comm.MaxFrameLength+1)
+	assert.Equal(t, gnet.Close, s.OnTraffic(&bufConn{buf: frame}))
+}
@@ -0,0 +1,20 @@
+#!/bin/sh
+
+pkill smpp.ismg
+pkill smpp.ismg
+
+# -1=debug, 0=info, 1=warn..., default to info
+export GNET_LOGGING_LEVEL=0
+export GNET_LOGGING_FILE="/Users/huangzhonghui/logs/smpp.log"
+mkdir -p /Users/huangzhonghui/logs
+
+# 各配置项均可由同名的命令行参数或环境变量覆盖，如 --success-rate=1、GOSMS_SMPP_AUTH_CHECK=true，见 ./smpp.ismg --help
+# --config 指定配置文件，默认为 ./config/smpp.yaml
+# optional args --port 1234 --multicore=false
+# default  args --port 2775 --multicore=true
+nohup ./smpp.ismg --port 2775 --multicore=true >panic.log 2>&1 &
+
+sleep 3
+tail -10 /Users/huangzhonghui/logs/smpp.log
+sleep 7
+top -pid "$(cat smpp.pid)"
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aaronwong1989/gosms/codec/cmpp"
+	"github.com/aaronwong1989/gosms/codec/smgp"
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+// 解码后的报文，均可重新编码
+type encoder interface {
+	Encode() []byte
+}
+
+// Decoded 一个报文的解码结果
+type Decoded struct {
+	Protocol string  // cmpp、smgp
+	Version  string  // 协议版本，无法从报文确定时为空或列出所有可能的版本，如 2.0/3.0
+	Command  string  // 命令名称
+	Exact    bool    // 重新编码后与原报文一致
+	Note     string  // 识别结果的说明，如同时可按其他协议解析
+	Pdu      encoder // 解码后的报文
+	Fields   fields  // 报文的各字段
+	same     int     // 重新编码后与原报文相同的字节数，均不一致时取最接近的解码结果
+}
+
+// candidate 按某一协议版本解码，version为CMPP的版本号，SMGP的解码与版本无关
+type candidate struct {
+	protocol string
+	version  byte
+}
+
+var candidates = []candidate{{"cmpp", 0x30}, {"cmpp", 0x20}, {"smgp", 0}}
+
+// decode 自动识别协议及版本并解码，protocol不为空时仅按该协议解码
+// 依次按CMPP 3.0、CMPP 2.0、SMGP解码，重新编码后与原报文一致的优先，均不一致时取相同字节最多的
+func decode(frame []byte, protocol string) (*Decoded, error) {
+	if len(frame) < 12 {
+		return nil, fmt.Errorf("pdu too short: %d bytes", len(frame))
+	}
+	if length := binary.BigEndian.Uint32(frame); int(length) != len(frame) {
+		return nil, fmt.Errorf("pdu length %d in header does not match %d bytes", length, len(frame))
+	}
+	var decoded []*Decoded
+	for _, c := range candidates {
+		if protocol != "" && c.protocol != protocol {
+			continue
+		}
+		d, err := c.decode(frame)
+		if err == nil {
+			decoded = append(decoded, d)
+		}
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("unknown pdu, command id 0x%08x", binary.BigEndian.Uint32(frame[4:8]))
+	}
+
+	best := decoded[:0:0]
+	for _, d := range decoded {
+		if d.Exact {
+			best = append(best, d)
+		}
+	}
+	if len(best) == 0 {
+		for _, d := range decoded {
+			if len(best) == 0 || d.same > best[0].same {
+				best = append(best[:0], d)
+			}
+		}
+	}
+	d := best[0]
+	var versions, others []string
+	for _, o := range best {
+		if o.Protocol == d.Protocol {
+			versions = append(versions, o.Version)
+		} else {
+			others = append(others, o.Protocol+" "+o.Command)
+		}
+	}
+	sort.Strings(versions)
+	d.Version = strings.Join(versions, "/")
+	if !d.Exact {
+		d.Note = "re-encoded pdu differs from input, the pdu may be malformed"
+	} else if len(others) > 0 {
+		d.Note = "also decodes as " + strings.Join(others, ", ") + ", use --protocol to choose"
+	}
+	if d.Protocol == "smgp" {
+		d.Version = smgpVersion(d)
+	}
+	return d, nil
+}
+
+func (c candidate) decode(frame []byte) (d *Decoded, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("decode %s error: %v", c.protocol, e)
+		}
+	}()
+	var pdu encoder
+	var commands map[uint32]string
+	if c.protocol == "cmpp" {
+		pdu, err = decodeCmpp(frame, c.version)
+		commands = cmpp.CommandMap
+	} else {
+		pdu, err = decodeSmgp(frame)
+		commands = smgp.CommandMap
+	}
+	if err != nil {
+		return nil, err
+	}
+	encoded := pdu.Encode()
+	d = &Decoded{
+		Protocol: c.protocol,
+		Command:  commands[binary.BigEndian.Uint32(frame[4:8])],
+		Exact:    bytes.Equal(encoded, frame),
+		Pdu:      pdu,
+		Fields:   structFields(reflect.ValueOf(pdu), commands),
+		same:     sameBytes(encoded, frame),
+	}
+	if !wireVersion(pdu) {
+		d.Fields = d.Fields.without("version")
+	}
+	if c.protocol == "cmpp" {
+		d.Version = versionString(c.version)
+	}
+	if tl, ok := pdu.(interface{ TlvList() *comm.TlvList }); ok && tl.TlvList() != nil && len(tl.TlvList().Objects()) > 0 {
+		d.Fields = append(d.Fields, field{"tlvList", tlvFields(tl.TlvList())})
+	}
+	return d, nil
+}
+
+// wireVersion 报文中是否有版本号字段，仅登录及其应答携带，其他报文的version为解码时使用的版本
+func wireVersion(pdu encoder) bool {
+	switch pdu.(type) {
+	case *cmpp.Connect, *cmpp.ConnectResp, *smgp.Login, *smgp.LoginResp:
+		return true
+	}
+	return false
+}
+
+// sameBytes 相同位置上相等的字节数
+func sameBytes(a, b []byte) int {
+	n := 0
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// 报文体为空时按nil解码，与网关收到仅有消息头的报文时一致
+func body(frame []byte, headLen int) []byte {
+	if len(frame) == headLen {
+		return nil
+	}
+	return frame[headLen:]
+}
+
+// CMPP 2.0与3.0的报文格式不同，按候选版本解码
+func decodeCmpp(frame []byte, version byte) (encoder, error) {
+	header := &cmpp.MessageHeader{}
+	if err := header.Decode(frame); err != nil {
+		return nil, err
+	}
+	var pdu cmpp.Codec
+	switch header.CommandId {
+	case cmpp.CMPP_CONNECT:
+		pdu = &cmpp.Connect{}
+	case cmpp.CMPP_CONNECT_RESP:
+		pdu = &cmpp.ConnectResp{}
+	case cmpp.CMPP_TERMINATE, cmpp.CMPP_TERMINATE_RESP:
+		if len(frame) != cmpp.HeadLength {
+			return nil, cmpp.ErrorPacket
+		}
+		return header, nil
+	case cmpp.CMPP_SUBMIT:
+		pdu = &cmpp.Submit{}
+	case cmpp.CMPP_SUBMIT_RESP:
+		pdu = &cmpp.SubmitResp{}
+	case cmpp.CMPP_DELIVER:
+		pdu = &cmpp.Delivery{}
+	case cmpp.CMPP_DELIVER_RESP:
+		pdu = &cmpp.DeliveryResp{}
+	case cmpp.CMPP_ACTIVE_TEST:
+		pdu = &cmpp.ActiveTest{}
+	case cmpp.CMPP_ACTIVE_TEST_RESP:
+		pdu = &cmpp.ActiveTestResp{}
+	case cmpp.CMPP_QUERY:
+		pdu = &cmpp.Query{}
+	case cmpp.CMPP_QUERY_RESP:
+		pdu = &cmpp.QueryResp{}
+	case cmpp.CMPP_CANCEL:
+		pdu = &cmpp.Cancel{}
+	case cmpp.CMPP_CANCEL_RESP:
+		pdu = &cmpp.CancelResp{}
+	default:
+		return nil, cmpp.ErrorPacket
+	}
+	if err := pdu.Decode(header, body(frame, cmpp.HeadLength), cmpp.Default().WithVersion(cmpp.Version(version))); err != nil {
+		return nil, err
+	}
+	return pdu, nil
+}
+
+func decodeSmgp(frame []byte) (encoder, error) {
+	header := &smgp.MessageHeader{}
+	if err := header.Decode(frame); err != nil {
+		return nil, err
+	}
+	var pdu smgp.Codec
+	switch header.RequestId {
+	case smgp.CmdLogin:
+		pdu = &smgp.Login{}
+	case smgp.CmdLoginResp:
+		pdu = &smgp.LoginResp{}
+	case smgp.CmdSubmit:
+		pdu = &smgp.Submit{}
+	case smgp.CmdSubmitResp:
+		pdu = &smgp.SubmitResp{}
+	case smgp.CmdDeliver:
+		pdu = &smgp.Deliver{}
+	case smgp.CmdDeliverResp:
+		pdu = &smgp.DeliverResp{}
+	case smgp.CmdActiveTest:
+		pdu = &smgp.ActiveTest{}
+	case smgp.CmdActiveTestResp:
+		pdu = &smgp.ActiveTestResp{}
+	case smgp.CmdExit:
+		pdu = &smgp.Exit{}
+	case smgp.CmdExitResp:
+		pdu = &smgp.ExitResp{}
+	default:
+		return nil, smgp.ErrorPacket
+	}
+	// 各版本仅可选参数不同，按最高版本解码，未携带可选参数时即为3.0以下的报文
+	if err := pdu.Decode(header, body(frame, smgp.HeadLength), smgp.Default().WithVersion(smgp.MaxVersion)); err != nil {
+		return nil, err
+	}
+	return pdu, nil
+}
+
+// smgpVersion 登录报文携带版本号；其他报文携带可选参数时为3.0，否则无法确定
+func smgpVersion(d *Decoded) string {
+	if v, ok := d.Fields.get("version").(uint64); ok {
+		return versionString(byte(v))
+	}
+	if d.Fields.get("tlvList") != nil {
+		return "3.0"
+	}
+	return ""
+}
+
+// 版本号高4位为主版本号，低4位为次版本号
+func versionString(v byte) string {
+	return fmt.Sprintf("%d.%d", v>>4, v&0x0f)
+}
+
+// field 报文的一个字段，Value为数字、字符串、字符串列表或嵌套的字段(如消息头、状态报告)
+type field struct {
+	Name  string
+	Value interface{}
+}
+
+// command 命令名称，输出字段列表时不加引号
+type command string
+
+// fields 按报文中的顺序输出为JSON对象
+type fields []field
+
+func (fs fields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.Name)
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// without 去掉指定名称的字段
+func (fs fields) without(name string) fields {
+	out := fs[:0]
+	for _, f := range fs {
+		if f.Name != name {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (fs fields) get(name string) interface{} {
+	for _, f := range fs {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// structFields 按声明顺序读取报文结构体的字段(含未导出字段)，嵌入的消息头命名为header
+func structFields(v reflect.Value, commands map[uint32]string) fields {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var fs fields
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Name
+		if sf.Anonymous {
+			name = "header"
+		}
+		if value := fieldValue(name, v.Field(i), commands); value != nil {
+			fs = append(fs, field{name, value})
+		}
+	}
+	return fs
+}
+
+var tlvListType = reflect.TypeOf(&comm.TlvList{})
+
+func fieldValue(name string, v reflect.Value, commands map[uint32]string) interface{} {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if name == "CommandId" || name == "RequestId" {
+			return command(fmt.Sprintf("%s(0x%08x)", commands[uint32(v.Uint())], v.Uint()))
+		}
+		return v.Uint()
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return v.Int()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Array, reflect.Slice:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			bts := make([]byte, v.Len())
+			for i := range bts {
+				bts[i] = byte(v.Index(i).Uint())
+			}
+			return hex.EncodeToString(bts)
+		}
+		if v.Type().Elem().Kind() == reflect.String {
+			ss := make([]string, v.Len())
+			for i := range ss {
+				ss[i] = v.Index(i).String()
+			}
+			return ss
+		}
+	case reflect.Ptr, reflect.Struct:
+		// 可选参数经 TlvList() 读取
+		if v.Type() == tlvListType {
+			return nil
+		}
+		if fs := structFields(v, commands); fs != nil {
+			return fs
+		}
+	}
+	return nil
+}
+
+func tlvFields(tl *comm.TlvList) fields {
+	var fs fields
+	for _, tlv := range tl.Objects() {
+		name, ok := smgp.TlvMap[tlv.Type()]
+		if !ok {
+			name = fmt.Sprintf("0x%04x", tlv.Type())
+		}
+		fs = append(fs, field{name, hex.EncodeToString(tlv.Value())})
+	}
+	return fs
+}
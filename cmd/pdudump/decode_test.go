@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/codec/cmpp"
+	"github.com/aaronwong1989/gosms/codec/smgp"
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/snowflake"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func init() {
+	cmpp.Conf = yml_config.CreateYamlFactory("cmpp.yaml")
+	cmpp.Seq32 = comm.NewCycleSequence(1, 1)
+	cmpp.Seq64 = snowflake.NewSnowflake(1, 1)
+	cmpp.ReportSeq = comm.NewCycleSequence(1, 1)
+	smgp.Conf = yml_config.CreateYamlFactory("smgp.yaml")
+	smgp.Seq32 = comm.NewCycleSequence(1, 1)
+	smgp.Seq80 = comm.NewBcdSequence(smgp.Conf.GetString("smgw-id"))
+}
+
+func cmppSubmit(version byte, content string) []byte {
+	return cmpp.NewSubmit([]string{"17011112222"}, content, cmpp.MtVersion(cmpp.Version(version)))[0].Encode()
+}
+
+func TestDecode_cmpp(t *testing.T) {
+	for _, v := range []byte{0x20, 0x30} {
+		d, err := decode(cmppSubmit(v, "hello world"), "")
+		assert.NoError(t, err)
+		assert.Equal(t, "cmpp", d.Protocol)
+		assert.Equal(t, versionString(v), d.Version)
+		assert.Equal(t, "CMPP_SUBMIT", d.Command)
+		assert.True(t, d.Exact)
+		assert.Equal(t, "17011112222", d.Fields.get("destTerminalId"))
+		assert.Equal(t, "hello world", d.Fields.get("msgContent"))
+	}
+
+	// 状态报告
+	mt := cmpp.NewSubmit([]string{"17011112222"}, "hello world", cmpp.MtVersion(cmpp.V30))[0]
+	d, err := decode(mt.ToDeliveryReport(1).Encode(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "CMPP_DELIVER", d.Command)
+	assert.True(t, d.Exact)
+	report, ok := d.Fields.get("report").(fields)
+	assert.True(t, ok)
+	assert.NotEmpty(t, report.get("stat"))
+
+	// 仅有消息头的报文无法区分版本
+	d, err = decode(cmpp.NewActiveTest().Encode(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "2.0/3.0", d.Version)
+	assert.Equal(t, "CMPP_ACTIVE_TEST", d.Command)
+}
+
+func TestDecode_smgp(t *testing.T) {
+	d, err := decode(smgp.NewLogin().Encode(), "smgp")
+	assert.NoError(t, err)
+	assert.Equal(t, "smgp", d.Protocol)
+	assert.Equal(t, "Login", d.Command)
+	assert.Equal(t, versionString(byte(smgp.Conf.GetInt("version"))), d.Version)
+
+	// 长短信携带可选参数，为3.0版本
+	subs := smgp.NewSubmit([]string{"17011112222"}, strings.Repeat("你好", 100), smgp.MtOptions{Version: smgp.V30})
+	assert.True(t, len(subs) > 1)
+	d, err = decode(subs[0].Encode(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "smgp", d.Protocol)
+	assert.Equal(t, "3.0", d.Version)
+	assert.True(t, d.Exact)
+	tlvs, ok := d.Fields.get("tlvList").(fields)
+	assert.True(t, ok)
+	assert.Equal(t, fmt.Sprintf("%02x", len(subs)), tlvs.get("PkTotal"))
+
+	d, err = decode(smgp.NewDeliveryReport(subs[0], smgp.Seq80.NextVal()).Encode(), "smgp")
+	assert.NoError(t, err)
+	assert.Equal(t, "Deliver", d.Command)
+	report, ok := d.Fields.get("report").(fields)
+	assert.True(t, ok)
+	assert.NotNil(t, report.get("stat"))
+}
+
+func TestDecode_error(t *testing.T) {
+	_, err := decode([]byte{0, 0, 0, 12, 0, 0, 0, 8}, "")
+	assert.Error(t, err)
+	_, err = decode([]byte{0, 0, 0, 13, 0, 0, 0, 8, 0, 0, 0, 1}, "")
+	assert.Error(t, err)
+	_, err = decode([]byte{0, 0, 0, 12, 0, 0, 0x10, 0x10, 0, 0, 0, 1}, "")
+	assert.Error(t, err)
+}
+
+func TestParseHex(t *testing.T) {
+	bts, err := parseHex("2022-09-01 12:00:00 [INFO] Hex Submit: 0x00 00 00 0c:00-00-00-08,00000001")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 12, 0, 0, 0, 8, 0, 0, 0, 1}, bts)
+	_, err = parseHex("zz")
+	assert.Error(t, err)
+}
+
+func TestDumper_json(t *testing.T) {
+	var out bytes.Buffer
+	d := &dumper{out: &out, json: true}
+	assert.NoError(t, d.dumpFrames(append(cmppSubmit(0x30, "hi"), cmpp.NewActiveTest().Encode()...)))
+	assert.Equal(t, 0, d.failed)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &m))
+	assert.Equal(t, "CMPP_SUBMIT", m["command"])
+	assert.Equal(t, "hi", m["fields"].(map[string]interface{})["msgContent"])
+}
+
+func TestDecode_version(t *testing.T) {
+	// 仅登录报文输出版本号字段
+	d, err := decode(cmppSubmit(0x30, "hi"), "cmpp")
+	assert.NoError(t, err)
+	assert.Nil(t, d.Fields.get("version"))
+	d, err = decode(cmpp.NewConnect().Encode(), "cmpp")
+	assert.NoError(t, err)
+	assert.NotNil(t, d.Fields.get("version"))
+
+	// 不携带可选参数的SMGP报文无法区分版本
+	sub := smgp.NewSubmit([]string{"17011112222"}, "hi", smgp.MtOptions{Version: smgp.V20})[0]
+	d, err = decode(sub.Encode(), "smgp")
+	assert.NoError(t, err)
+	assert.Nil(t, d.Fields.get("version"))
+	assert.Equal(t, "", d.Version)
+}
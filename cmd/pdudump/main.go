@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aaronwong1989/gosms/comm/capture"
+)
+
+// pdudump 解码CMPP、SMGP报文，自动识别协议及版本，输出字段列表或JSON
+//
+//	./pdudump 0000000c0000000800000001
+//	grep "Hex Submit" ismg.log | ./pdudump --protocol cmpp
+//	./pdudump --file ./data/cmpp.cap --json
+//
+// 十六进制可来自命令行参数或标准输入，需包含消息头，多个报文可直接拼接；
+// 文件可以是抓包文件(capture-file)或直接拼接的二进制报文
+func main() {
+	var (
+		file     string
+		protocol string
+		asJson   bool
+	)
+	flag.StringVar(&file, "file", "", "二进制报文文件或抓包文件，不指定时解码参数或标准输入中的十六进制")
+	flag.StringVar(&protocol, "protocol", "", "仅按该协议解码：cmpp、smgp，默认自动识别")
+	flag.BoolVar(&asJson, "json", false, "按行输出JSON")
+	flag.Parse()
+	if protocol != "" && protocol != "cmpp" && protocol != "smgp" {
+		fmt.Fprintf(os.Stderr, "unsupported protocol: %s\n", protocol)
+		os.Exit(2)
+	}
+	d := &dumper{out: os.Stdout, protocol: protocol, json: asJson}
+	var err error
+	if file != "" {
+		err = d.dumpFile(file)
+	} else if flag.NArg() > 0 {
+		err = d.dumpHex(strings.NewReader(strings.Join(flag.Args(), " ")))
+	} else {
+		err = d.dumpHex(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if d.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+type dumper struct {
+	out      io.Writer
+	protocol string
+	json     bool
+	failed   int // 解码失败的报文数
+}
+
+// dumpHex 读取十六进制，兼容日志中 comm.LogHex 输出的行
+func (d *dumper) dumpHex(r io.Reader) error {
+	var data []byte
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		bts, err := parseHex(scanner.Text())
+		if err != nil {
+			return err
+		}
+		data = append(data, bts...)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return d.dumpFrames(data)
+}
+
+// parseHex 解析一行十六进制，忽略空白、0x前缀及常见分隔符；日志行取 "Hex xxx: " 之后的内容
+func parseHex(line string) ([]byte, error) {
+	if i := strings.Index(line, " Hex "); i >= 0 {
+		if j := strings.Index(line[i:], ": "); j >= 0 {
+			line = line[i+j+2:]
+		}
+	}
+	line = strings.ReplaceAll(line, "0x", "")
+	line = strings.ReplaceAll(line, "0X", "")
+	line = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', ':', '-', ',':
+			return -1
+		}
+		return r
+	}, line)
+	bts, err := hex.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %v", err)
+	}
+	return bts, nil
+}
+
+func (d *dumper) dumpFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r, err := capture.NewReader(bytes.NewReader(data))
+	if errors.Is(err, capture.ErrFormat) {
+		return d.dumpFrames(data)
+	} else if err != nil {
+		return err
+	}
+	protocol := d.protocol
+	if protocol == "" {
+		protocol = r.Protocol()
+	}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if rec.Event != capture.In && rec.Event != capture.Out {
+			if !d.json {
+				_, _ = fmt.Fprintf(d.out, "%s %s %s\n\n", rec.Time.Format("2006-01-02 15:04:05.000"), rec.Conn, rec.Event)
+			}
+			continue
+		}
+		d.dump(rec.Frame, protocol, rec)
+	}
+}
+
+// dumpFrames 按消息头中的长度拆分报文
+func (d *dumper) dumpFrames(data []byte) error {
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return fmt.Errorf("incomplete pdu: %x", data)
+		}
+		n := binary.BigEndian.Uint32(data)
+		if n < 12 || int(n) > len(data) {
+			return fmt.Errorf("invalid pdu length %d with %d bytes left, the hex must start with the pdu header", n, len(data))
+		}
+		d.dump(data[:n], d.protocol, nil)
+		data = data[n:]
+	}
+	return nil
+}
+
+// dump 输出一个报文，rec为抓包记录，非抓包文件时为nil
+func (d *dumper) dump(frame []byte, protocol string, rec *capture.Record) {
+	dec, err := decode(frame, protocol)
+	if err != nil {
+		d.failed++
+	}
+	if d.json {
+		d.printJson(frame, dec, err, rec)
+	} else {
+		d.printTable(frame, dec, err, rec)
+	}
+}
+
+func (d *dumper) printJson(frame []byte, dec *Decoded, err error, rec *capture.Record) {
+	var fs fields
+	if rec != nil {
+		fs = append(fs, field{"time", rec.Time}, field{"conn", rec.Conn}, field{"event", rec.Event.String()})
+	}
+	if err != nil {
+		fs = append(fs, field{"error", err.Error()}, field{"hex", hex.EncodeToString(frame)})
+	} else {
+		fs = append(fs, field{"protocol", dec.Protocol}, field{"version", dec.Version}, field{"command", dec.Command},
+			field{"length", len(frame)}, field{"exact", dec.Exact})
+		if dec.Note != "" {
+			fs = append(fs, field{"note", dec.Note})
+		}
+		fs = append(fs, field{"fields", dec.Fields})
+	}
+	line, _ := json.Marshal(fs)
+	_, _ = fmt.Fprintf(d.out, "%s\n", line)
+}
+
+func (d *dumper) printTable(frame []byte, dec *Decoded, err error, rec *capture.Record) {
+	if rec != nil {
+		_, _ = fmt.Fprintf(d.out, "%s %s %s ", rec.Time.Format("2006-01-02 15:04:05.000"), rec.Conn, rec.Event)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(d.out, "error: %v\n  %x\n\n", err, frame)
+		return
+	}
+	version := dec.Version
+	if version == "" {
+		version = "?"
+	}
+	_, _ = fmt.Fprintf(d.out, "%s %s %s (%d bytes)\n", dec.Protocol, version, dec.Command, len(frame))
+	rows := flatten("", dec.Fields)
+	width := 0
+	for _, r := range rows {
+		if len(r[0]) > width {
+			width = len(r[0])
+		}
+	}
+	for _, r := range rows {
+		_, _ = fmt.Fprintf(d.out, "  %-*s  %s\n", width, r[0], r[1])
+	}
+	if dec.Note != "" {
+		_, _ = fmt.Fprintf(d.out, "  note: %s\n", dec.Note)
+	}
+	_, _ = fmt.Fprintln(d.out)
+}
+
+// flatten 嵌套字段以点号连接，如 report.stat
+func flatten(prefix string, fs fields) [][2]string {
+	var rows [][2]string
+	for _, f := range fs {
+		name := prefix + f.Name
+		switch v := f.Value.(type) {
+		case fields:
+			rows = append(rows, flatten(name+".", v)...)
+		case []string:
+			rows = append(rows, [2]string{name, strings.Join(v, ",")})
+		case string:
+			rows = append(rows, [2]string{name, fmt.Sprintf("%q", v)})
+		default:
+			rows = append(rows, [2]string{name, fmt.Sprint(v)})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aaronwong1989/gosms/codec/cmpp"
+	"github.com/aaronwong1989/gosms/codec/smgp"
+	"github.com/aaronwong1989/gosms/comm/capture"
+	"github.com/aaronwong1989/gosms/comm/logging"
+)
+
+var log = logging.GetDefaultLogger()
+
+// CMPP_CONNECT与SMGP Login的命令ID相同，其应答亦然
+const (
+	login     = 0x00000001
+	loginResp = 0x80000001
+)
+
+// pdureplay 重放网关的抓包文件：按原有时间间隔，将每个连接收到的报文重新发往指定网关，
+// 并对比网关的应答与抓包时发出的报文
+//
+//	./pdureplay --file ./data/cmpp.cap --addr 127.0.0.1:9000 --speed 2
+//
+// 登录报文原样重放，目标网关需使用相同的账号密码，或关闭鉴权(auth-check: false)
+func main() {
+	var (
+		file  string
+		addr  string
+		conn  string
+		speed float64
+		wait  time.Duration
+		list  bool
+	)
+	flag.StringVar(&file, "file", "", "抓包文件")
+	flag.StringVar(&addr, "addr", "127.0.0.1:9000", "重放的目标网关地址")
+	flag.StringVar(&conn, "conn", "", "仅重放该连接，默认重放所有连接，连接标识可通过 --list 查看")
+	flag.Float64Var(&speed, "speed", 1, "重放速度倍数，0为不等待，尽快发送(此时网关可能先处理了Exit等报文，未应答的请求随连接关闭而丢失)")
+	flag.DurationVar(&wait, "wait", 2*time.Second, "发送结束后等待网关应答的时间")
+	flag.BoolVar(&list, "list", false, "列出抓包文件中的连接")
+	flag.Parse()
+	if file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	protocol, records, err := capture.ReadFile(file)
+	if err != nil && len(records) == 0 {
+		log.Fatalf("read capture file %s error: %v", file, err)
+	} else if err != nil {
+		log.Warnf("[%-9s] capture file %s is truncated: %v", "Replay", file, err)
+	}
+	var commands map[uint32]string
+	switch protocol {
+	case "cmpp":
+		commands = cmpp.CommandMap
+	case "smgp":
+		commands = smgp.CommandMap
+	default:
+		log.Fatalf("unsupported protocol: %s", protocol)
+	}
+
+	sessions := split(records)
+	if list {
+		for _, s := range sessions {
+			_, _ = fmt.Fprintf(os.Stdout, "%-24s %s  in=%d out=%d\n", s.id, s.start.Format("2006-01-02 15:04:05.000"), len(s.in), s.out.total())
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, s := range sessions {
+		if conn != "" && s.id != conn {
+			continue
+		}
+		wg.Add(1)
+		go func(s *session) {
+			defer wg.Done()
+			s.replay(addr, records[0].Time, start, speed, wait)
+		}(s)
+	}
+	wg.Wait()
+
+	for _, s := range sessions {
+		if conn == "" || s.id == conn {
+			s.print(os.Stdout, commands)
+		}
+	}
+}
+
+// session 抓包中的一个连接
+type session struct {
+	id    string
+	start time.Time
+	in    []*capture.Record // 网关收到的报文，即需重放的报文
+	out   counter           // 抓包时网关发出的报文
+	recv  counter           // 重放时网关发出的报文
+	sent  int
+	err   error
+}
+
+// 按命令统计的报文数
+type counter map[uint32]int
+
+func (c counter) total() int {
+	n := 0
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// 按连接拆分记录，同一客户端地址先后建立的连接视为不同的连接
+func split(records []*capture.Record) []*session {
+	var sessions []*session
+	open := make(map[string]*session)
+	get := func(rec *capture.Record) *session {
+		s, ok := open[rec.Conn]
+		if !ok {
+			id := rec.Conn
+			for n := 2; contains(sessions, id); n++ {
+				id = rec.Conn + "#" + strconv.Itoa(n)
+			}
+			s = &session{id: id, start: rec.Time, out: counter{}, recv: counter{}}
+			open[rec.Conn] = s
+			sessions = append(sessions, s)
+		}
+		return s
+	}
+	for _, rec := range records {
+		switch rec.Event {
+		case capture.Open:
+			delete(open, rec.Conn)
+			get(rec)
+		case capture.Close:
+			delete(open, rec.Conn)
+		case capture.In:
+			s := get(rec)
+			s.in = append(s.in, rec)
+		case capture.Out:
+			if len(rec.Frame) >= 8 {
+				get(rec).out[binary.BigEndian.Uint32(rec.Frame[4:8])]++
+			}
+		}
+	}
+	return sessions
+}
+
+func contains(sessions []*session, id string) bool {
+	for _, s := range sessions {
+		if s.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// replay 按报文在抓包中的时间(相对于抓包开始的时间begin)发送，speed为0时不等待
+func (s *session) replay(addr string, begin time.Time, start time.Time, speed float64, wait time.Duration) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		s.err = err
+		return
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	done := make(chan struct{})
+	loggedIn := make(chan struct{}, 1)
+	go func() {
+		defer close(done)
+		for {
+			cmd, err := readPdu(conn)
+			if err != nil {
+				return
+			}
+			if cmd == loginResp {
+				select {
+				case loggedIn <- struct{}{}:
+				default:
+				}
+			}
+			s.recv[cmd]++
+		}
+	}()
+
+	for _, rec := range s.in {
+		if speed > 0 {
+			at := start.Add(time.Duration(float64(rec.Time.Sub(begin)) / speed))
+			time.Sleep(time.Until(at))
+		}
+		if _, err = conn.Write(rec.Frame); err != nil {
+			s.err = err
+			break
+		}
+		s.sent++
+		// 网关在登录应答后才接受其他报文，登录报文需等待应答，不能仅按抓包的时间间隔发送
+		if binary.BigEndian.Uint32(rec.Frame[4:8]) == login {
+			select {
+			case <-loggedIn:
+			case <-done:
+			case <-time.After(5 * time.Second):
+				log.Warnf("[%-9s] %s: wait login response timeout", "Replay", s.id)
+			}
+		}
+	}
+	log.Infof("[%-9s] %s: %d pdus sent", "Replay", s.id, s.sent)
+
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+	_ = conn.Close()
+	<-done
+}
+
+// 读取一个完整的报文，返回命令ID；CMPP与SMGP的报文头均为 长度、命令ID、序号
+func readPdu(r io.Reader) (uint32, error) {
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, err
+	}
+	length := binary.BigEndian.Uint32(head)
+	if length < 12 || length > 10240 {
+		return 0, fmt.Errorf("invalid pdu length %d", length)
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(length-12)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(head[4:8]), nil
+}
+
+// print 打印重放结果，对比每种命令在抓包时与重放时网关发出的报文数
+func (s *session) print(w io.Writer, commands map[uint32]string) {
+	_, _ = fmt.Fprintf(w, "%s: sent %d/%d pdus", s.id, s.sent, len(s.in))
+	if s.err != nil {
+		_, _ = fmt.Fprintf(w, ", error: %v", s.err)
+	}
+	_, _ = fmt.Fprintln(w)
+	var cmds []uint32
+	for cmd := range s.out {
+		cmds = append(cmds, cmd)
+	}
+	for cmd := range s.recv {
+		if _, ok := s.out[cmd]; !ok {
+			cmds = append(cmds, cmd)
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i] < cmds[j] })
+	_, _ = fmt.Fprintf(w, "  %-24s %10s %10s\n", "command", "captured", "replayed")
+	for _, cmd := range cmds {
+		name, ok := commands[cmd]
+		if !ok {
+			name = fmt.Sprintf("0x%08x", cmd)
+		}
+		mark := ""
+		if s.out[cmd] != s.recv[cmd] {
+			mark = " *"
+		}
+		_, _ = fmt.Fprintf(w, "  %-24s %10d %10d%s\n", name, s.out[cmd], s.recv[cmd], mark)
+	}
+}
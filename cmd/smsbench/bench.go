@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 发送一条Submit并等待应答，返回应答的结果码
+type submitFunc func() (uint32, error)
+
+// sender 协议相关的客户端
+type sender interface {
+	// split 按内容拆分为一条或多条(长短信)Submit
+	split(phone string, content string) []submitFunc
+	Close() error
+}
+
+// Bench 压测参数
+type Bench struct {
+	Senders    []sender      // 每个连接一个客户端
+	Window     int           // 每个连接的并发发送数，即发送窗口大小
+	Tps        float64       // 所有连接合计的目标TPS(每秒Submit数，长短信每个分片计一条)，0为不限速
+	Duration   time.Duration // 压测时长
+	Total      int64         // 最多发送的Submit数，0为不限
+	Templates  []string      // 短信内容模板，{seq}替换为序号，{rand}替换为6位随机数
+	LongRatio  float64       // 长短信的比例 [0,1]
+	PhonePfx   string        // 接收号码前缀，其余位随机补足11位
+	ReportWait time.Duration // 发送结束后等待状态报告的时间
+
+	lock  sync.Mutex
+	seq   int64 // 消息序号，用于模板
+	slots int64 // 已分配的发送时间片，用于限速
+	start time.Time
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Result 压测结果
+type Result struct {
+	lock      sync.Mutex
+	elapsed   time.Duration
+	submits   int64
+	latencies []time.Duration  // Submit至收到应答的耗时
+	results   map[uint32]int64 // 结果码 -> Submit数
+	errors    map[string]int64 // 发送错误 -> Submit数
+	reports   map[string]int64 // 状态报告的stat -> 数量
+}
+
+func NewResult() *Result {
+	return &Result{
+		results: make(map[uint32]int64),
+		errors:  make(map[string]int64),
+		reports: make(map[string]int64),
+	}
+}
+
+func (r *Result) record(result uint32, latency time.Duration, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.submits++
+	if err != nil {
+		r.errors[err.Error()]++
+		return
+	}
+	r.results[result]++
+	r.latencies = append(r.latencies, latency)
+}
+
+// Report 收到状态报告，在客户端的读协程中调用
+func (r *Result) Report(stat string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reports[stat]++
+}
+
+// Stop 提前结束发送，如收到中断信号
+func (b *Bench) Stop() {
+	b.once.Do(func() { close(b.done) })
+}
+
+// Run 按参数发送，直到达到压测时长、最大发送数或被 Stop
+func (b *Bench) Run(result *Result) {
+	b.done = make(chan struct{})
+	b.start = time.Now()
+	timer := time.AfterFunc(b.Duration, b.Stop)
+	defer timer.Stop()
+
+	var wg sync.WaitGroup
+	for _, s := range b.Senders {
+		for i := 0; i < b.Window; i++ {
+			wg.Add(1)
+			go func(s sender) {
+				defer wg.Done()
+				b.work(s, result)
+			}(s)
+		}
+	}
+	wg.Wait()
+	result.elapsed = time.Since(b.start)
+
+	if b.ReportWait > 0 {
+		time.Sleep(b.ReportWait)
+	}
+	for _, s := range b.Senders {
+		_ = s.Close()
+	}
+}
+
+func (b *Bench) work(s sender, result *Result) {
+	for {
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+		submits := s.split(b.phone(), b.content())
+		// 达到最大发送数时仅结束本协程，其他协程已分配的Submit仍需发送
+		at, ok := b.reserve(len(submits))
+		if !ok {
+			return
+		}
+		if wait := time.Until(at); wait > 0 {
+			select {
+			case <-b.done:
+				return
+			case <-time.After(wait):
+			}
+		}
+		for _, submit := range submits {
+			begin := time.Now()
+			code, err := submit()
+			result.record(code, time.Since(begin), err)
+		}
+	}
+}
+
+// reserve 为n条Submit分配发送时间，超过最大发送数时返回false
+func (b *Bench) reserve(n int) (time.Time, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.Total > 0 && b.slots >= b.Total {
+		return time.Time{}, false
+	}
+	at := b.start
+	if b.Tps > 0 {
+		at = b.start.Add(time.Duration(float64(b.slots) * float64(time.Second) / b.Tps))
+	}
+	b.slots += int64(n)
+	return at, true
+}
+
+func (b *Bench) phone() string {
+	var sb strings.Builder
+	sb.WriteString(b.PhonePfx)
+	for sb.Len() < 11 {
+		sb.WriteByte(byte('0' + rand.Intn(10)))
+	}
+	return sb.String()
+}
+
+func (b *Bench) content() string {
+	b.lock.Lock()
+	b.seq++
+	seq := b.seq
+	b.lock.Unlock()
+
+	tpl := b.Templates[rand.Intn(len(b.Templates))]
+	txt := strings.ReplaceAll(tpl, "{seq}", strconv.FormatInt(seq, 10))
+	txt = strings.ReplaceAll(txt, "{rand}", fmt.Sprintf("%06d", rand.Intn(1000000)))
+	if b.LongRatio > 0 && rand.Float64() < b.LongRatio {
+		txt = longContent(txt)
+	}
+	return txt
+}
+
+// 长短信按内容重复至200字以上，ASCII与UCS2编码均需拆分
+func longContent(txt string) string {
+	if txt == "" {
+		txt = "long message"
+	}
+	var sb strings.Builder
+	for n := 0; n < 200; n += len([]rune(txt)) + 1 {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(txt)
+	}
+	return sb.String()
+}
+
+// Print 打印吞吐量、应答耗时分位数及结果码分布
+func (r *Result) Print(w io.Writer, codes map[uint32]string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var ok int64
+	for code, n := range r.results {
+		if code == 0 {
+			ok += n
+		}
+	}
+	secs := r.elapsed.Seconds()
+	if secs <= 0 {
+		secs = 1
+	}
+	_, _ = fmt.Fprintf(w, "duration:   %v\n", r.elapsed.Round(time.Millisecond))
+	_, _ = fmt.Fprintf(w, "submits:    %d, success: %d, throughput: %.1f/s\n", r.submits, ok, float64(r.submits)/secs)
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	_, _ = fmt.Fprintf(w, "latency:    p50=%v p90=%v p99=%v max=%v\n",
+		percentile(r.latencies, 50), percentile(r.latencies, 90), percentile(r.latencies, 99), percentile(r.latencies, 100))
+
+	_, _ = fmt.Fprintln(w, "results:")
+	keys := make([]uint32, 0, len(r.results))
+	for code := range r.results {
+		keys = append(keys, code)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, code := range keys {
+		_, _ = fmt.Fprintf(w, "  %4d %-24s %d\n", code, codes[code], r.results[code])
+	}
+	for _, e := range sortedKeys(r.errors) {
+		_, _ = fmt.Fprintf(w, "  error: %-24s %d\n", e, r.errors[e])
+	}
+	if len(r.reports) > 0 {
+		_, _ = fmt.Fprintln(w, "reports:")
+		for _, stat := range sortedKeys(r.reports) {
+			_, _ = fmt.Fprintf(w, "  %-29s %d\n", stat, r.reports[stat])
+		}
+	}
+}
+
+// percentile 已排序耗时的p分位数
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBench_reserve(t *testing.T) {
+	b := &Bench{Tps: 100, Total: 5, start: time.Now()}
+	at, ok := b.reserve(1)
+	assert.True(t, ok)
+	assert.Equal(t, b.start, at)
+	// 长短信的分片各占一个时间片
+	at, ok = b.reserve(3)
+	assert.True(t, ok)
+	assert.Equal(t, b.start.Add(10*time.Millisecond), at)
+	at, ok = b.reserve(1)
+	assert.True(t, ok)
+	assert.Equal(t, b.start.Add(40*time.Millisecond), at)
+	_, ok = b.reserve(1)
+	assert.False(t, ok)
+}
+
+func TestBench_content(t *testing.T) {
+	b := &Bench{Templates: []string{"code {rand} no.{seq}"}, PhonePfx: "139"}
+	txt := b.content()
+	assert.True(t, strings.HasPrefix(txt, "code "))
+	assert.True(t, strings.HasSuffix(txt, " no.1"))
+	assert.Equal(t, len("code 123456 no.1"), len(txt))
+
+	phone := b.phone()
+	assert.Equal(t, 11, len(phone))
+	assert.True(t, strings.HasPrefix(phone, "139"))
+
+	b.LongRatio = 1
+	assert.True(t, utf8.RuneCountInString(b.content()) >= 200)
+}
+
+func TestResult_Print(t *testing.T) {
+	r := NewResult()
+	for i := 1; i <= 100; i++ {
+		r.record(0, time.Duration(i)*time.Millisecond, nil)
+	}
+	r.record(13, time.Millisecond, nil)
+	r.record(0, 0, errors.New("test"))
+	r.Report("DELIVRD")
+	r.elapsed = time.Second
+
+	var buf bytes.Buffer
+	r.Print(&buf, map[uint32]string{0: "正确", 13: "Dest_terminal_Id 错误"})
+	out := buf.String()
+	t.Log("\n" + out)
+	assert.Contains(t, out, "submits:    102, success: 100, throughput: 102.0/s")
+	assert.Contains(t, out, "p50=50ms p90=90ms p99=99ms max=100ms")
+	assert.Contains(t, out, "Dest_terminal_Id 错误")
+	assert.Contains(t, out, "error: test")
+	assert.Contains(t, out, "DELIVRD")
+}
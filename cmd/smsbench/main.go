@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	cmppcli "github.com/aaronwong1989/gosms/client/cmpp"
+	smgpcli "github.com/aaronwong1989/gosms/client/smgp"
+	"github.com/aaronwong1989/gosms/codec/cmpp"
+	"github.com/aaronwong1989/gosms/codec/smgp"
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/metrics"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+var log = logging.GetDefaultLogger()
+
+// 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// smsbench 短信网关压测工具，支持CMPP、SMGP，可用于压测真实网关或本项目的模拟网关
+//
+//	./smsbench --protocol cmpp --addr 127.0.0.1:9000 --conns 4 --tps 1000 --duration 1m
+func main() {
+	var (
+		protocol    string
+		addr        string
+		account     string
+		secret      string
+		conns       int
+		window      int
+		tps         float64
+		duration    time.Duration
+		total       int64
+		templates   stringList
+		tplFile     string
+		longRatio   float64
+		phonePfx    string
+		reportWait  time.Duration
+		metricsPort int
+	)
+	flag.StringVar(&protocol, "protocol", "cmpp", "协议：cmpp、smgp")
+	flag.StringVar(&addr, "addr", "127.0.0.1:9000", "网关地址")
+	flag.StringVar(&account, "account", "", "登录账号，默认读取配置文件的source-addr(cmpp)或client-id(smgp)")
+	flag.StringVar(&secret, "secret", "", "登录密码，默认读取配置文件的shared-secret")
+	flag.IntVar(&conns, "conns", 1, "连接数")
+	flag.IntVar(&window, "window", 16, "每个连接的发送窗口大小")
+	flag.Float64Var(&tps, "tps", 0, "所有连接合计的目标TPS，长短信每个分片计一条，0为不限速")
+	flag.DurationVar(&duration, "duration", 30*time.Second, "压测时长")
+	flag.Int64Var(&total, "total", 0, "最多发送的Submit数，0为不限")
+	flag.Var(&templates, "template", "短信内容模板，可指定多个，{seq}替换为序号，{rand}替换为6位随机数")
+	flag.StringVar(&tplFile, "template-file", "", "短信内容模板文件，每行一个模板")
+	flag.Float64Var(&longRatio, "long-ratio", 0, "长短信的比例 [0,1]")
+	flag.StringVar(&phonePfx, "phone-prefix", "138", "接收号码前缀，其余位随机补足11位")
+	flag.DurationVar(&reportWait, "report-wait", 3*time.Second, "发送结束后等待状态报告的时间")
+	flag.IntVar(&metricsPort, "metrics-port", 0, "Prometheus指标的监听端口，0为不开启")
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixNano())
+	if tplFile != "" {
+		lines, err := readLines(tplFile)
+		if err != nil {
+			log.Fatalf("read template file error: %v", err)
+		}
+		templates = append(templates, lines...)
+	}
+	if len(templates) == 0 {
+		templates = stringList{"您的验证码是{rand}，5分钟内有效。", "hello world {seq}"}
+	}
+
+	var dial func(addr string, window int, m *metrics.Metrics, result *Result) (sender, error)
+	var codes, commands map[uint32]string
+	switch protocol {
+	case "cmpp":
+		dial, codes, commands = dialCmpp(initCmpp(account, secret)), cmpp.SubmitResultMap, cmpp.CommandMap
+	case "smgp":
+		dial, codes, commands = dialSmgp(initSmgp(account, secret)), smgp.StatMap, smgp.CommandMap
+	default:
+		log.Fatalf("unsupported protocol: %s", protocol)
+	}
+
+	var m *metrics.Metrics
+	if metricsPort > 0 {
+		m = metrics.New(protocol, commands)
+		m.Register()
+		go func() {
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", metricsPort), nil); err != nil {
+				log.Errorf("metrics server error: %v", err)
+			}
+		}()
+	}
+
+	result := NewResult()
+	var senders []sender
+	for i := 0; i < conns; i++ {
+		s, err := dial(addr, window, m, result)
+		if err != nil {
+			log.Fatalf("connect to %s error: %v", addr, err)
+		}
+		senders = append(senders, s)
+	}
+
+	bench := &Bench{
+		Senders:    senders,
+		Window:     window,
+		Tps:        tps,
+		Duration:   duration,
+		Total:      total,
+		Templates:  templates,
+		LongRatio:  longRatio,
+		PhonePfx:   phonePfx,
+		ReportWait: reportWait,
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		bench.Stop()
+	}()
+
+	bench.Run(result)
+	result.Print(os.Stdout, codes)
+}
+
+// 读取配置文件，账号、密码以命令行参数为准
+func initCmpp(account string, secret string) *cmpp.Context {
+	conf := yml_config.CreateYamlFactory("cmpp.yaml")
+	if account != "" {
+		conf.Set("source-addr", account)
+	}
+	if secret != "" {
+		conf.Set("shared-secret", secret)
+	}
+	ctx, err := cmpp.NewContext(conf)
+	if err != nil {
+		log.Fatalf("load config error: %v", err)
+	}
+	return ctx
+}
+
+func initSmgp(account string, secret string) *smgp.Context {
+	conf := yml_config.CreateYamlFactory("smgp.yaml")
+	if account != "" {
+		conf.Set("client-id", account)
+	}
+	if secret != "" {
+		conf.Set("shared-secret", secret)
+	}
+	ctx, err := smgp.NewContext(conf)
+	if err != nil {
+		log.Fatalf("load config error: %v", err)
+	}
+	return ctx
+}
+
+// 各连接共用同一上下文，序号在所有连接间不重复
+func dialCmpp(ctx *cmpp.Context) func(addr string, window int, m *metrics.Metrics, result *Result) (sender, error) {
+	return func(addr string, window int, m *metrics.Metrics, result *Result) (sender, error) {
+		cli, err := cmppcli.Dial(cmppcli.Options{
+			Address:    addr,
+			WindowSize: window,
+			Metrics:    m,
+			Context:    ctx,
+			OnReport:   func(rpt *cmpp.Report) { result.Report(rpt.Stat()) },
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &cmppSender{cli}, nil
+	}
+}
+
+func dialSmgp(ctx *smgp.Context) func(addr string, window int, m *metrics.Metrics, result *Result) (sender, error) {
+	return func(addr string, window int, m *metrics.Metrics, result *Result) (sender, error) {
+		cli, err := smgpcli.Dial(smgpcli.Options{
+			Address:    addr,
+			WindowSize: window,
+			Metrics:    m,
+			Context:    ctx,
+			OnReport:   func(rpt *smgp.Report, _ *smgp.Submit) { result.Report(rpt.Stat()) },
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &smgpSender{cli}, nil
+	}
+}
+
+type cmppSender struct {
+	*cmppcli.Client
+}
+
+func (s *cmppSender) split(phone string, content string) []submitFunc {
+	subs := s.Context().NewSubmit([]string{phone}, content)
+	fns := make([]submitFunc, 0, len(subs))
+	for _, sub := range subs {
+		sub := sub
+		fns = append(fns, func() (uint32, error) {
+			resp, err := s.Submit(sub)
+			if err != nil {
+				return 0, err
+			}
+			return resp.Result(), nil
+		})
+	}
+	return fns
+}
+
+type smgpSender struct {
+	*smgpcli.Client
+}
+
+func (s *smgpSender) split(phone string, content string) []submitFunc {
+	subs := s.Context().NewSubmit([]string{phone}, content, smgp.MtOptions{})
+	fns := make([]submitFunc, 0, len(subs))
+	for _, sub := range subs {
+		sub := sub
+		fns = append(fns, func() (uint32, error) {
+			resp, err := s.Submit(sub)
+			if err != nil {
+				return 0, err
+			}
+			return resp.Status(), nil
+		})
+	}
+	return fns
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,16 @@
+#!/bin/sh
+
+go clean
+go mod tidy
+
+# 如果你想在Linux 64位系统下运行
+# CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -trimpath -o smsbench
+
+# 如果你想在 本机环境 运行
+go build -trimpath -o smsbench
+
+# 制作软件发布包，压测时在解压目录下执行，读取 config 下的协议配置
+chmod +x smsbench
+cp -rf ../../config ./
+tar -zcvf smsbench.tar.gz smsbench config
+rm -rf ./config
@@ -9,7 +9,11 @@ type ActiveTest struct {
 }
 
 func NewActiveTest() *ActiveTest {
-	header := &MessageHeader{TotalLength: HeadLength, CommandId: CMPP_ACTIVE_TEST, SequenceId: uint32(Seq32.NextVal())}
+	return Default().NewActiveTest()
+}
+
+func (ctx *Context) NewActiveTest() *ActiveTest {
+	header := &MessageHeader{TotalLength: HeadLength, CommandId: CMPP_ACTIVE_TEST, SequenceId: uint32(ctx.Seq32.NextVal())}
 	return &ActiveTest{header}
 }
 
@@ -17,7 +21,7 @@ func (at *ActiveTest) Encode() []byte {
 	return at.MessageHeader.Encode()
 }
 
-func (at *ActiveTest) Decode(header *MessageHeader, frame []byte) error {
+func (at *ActiveTest) Decode(header *MessageHeader, frame []byte, _ *Context) error {
 	if header == nil || header.CommandId != CMPP_ACTIVE_TEST || frame != nil {
 		return ErrorPacket
 	}
@@ -44,7 +48,7 @@ func (at *ActiveTestResp) Encode() []byte {
 	return at.MessageHeader.Encode()
 }
 
-func (at *ActiveTestResp) Decode(header *MessageHeader, frame []byte) error {
+func (at *ActiveTestResp) Decode(header *MessageHeader, frame []byte, _ *Context) error {
 	if header == nil || header.CommandId != CMPP_ACTIVE_TEST_RESP || len(frame) < (13-HeadLength) {
 		return ErrorPacket
 	}
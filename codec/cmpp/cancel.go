@@ -0,0 +1,104 @@
+package cmpp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Cancel SP删除已经提交到ISMG但还未下发的短信
+type Cancel struct {
+	*MessageHeader         // 消息头，【12字节】
+	msgId          uint64  // 信息标识，即CMPP_SUBMIT_RESP中的Msg_Id【8字节】
+	version        Version // 连接协商的版本，决定应答的格式
+}
+
+// CancelResp 2.0版 Success_Id 为1字节，3.0版为4字节
+type CancelResp struct {
+	*MessageHeader         // 消息头，【12字节】
+	successId      uint32  // 成功标识，0：成功；1：失败【4字节】
+	version        Version // 连接协商的版本
+}
+
+const CancelLen = HeadLength + 8
+
+func NewCancel(msgId uint64) *Cancel {
+	return Default().NewCancel(msgId)
+}
+
+func (ctx *Context) NewCancel(msgId uint64) *Cancel {
+	header := &MessageHeader{TotalLength: CancelLen, CommandId: CMPP_CANCEL, SequenceId: uint32(ctx.Seq32.NextVal())}
+	return &Cancel{MessageHeader: header, msgId: msgId}
+}
+
+func (c *Cancel) Encode() []byte {
+	frame := c.MessageHeader.Encode()
+	binary.BigEndian.PutUint64(frame[12:20], c.msgId)
+	return frame
+}
+
+func (c *Cancel) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
+	if header == nil || header.CommandId != CMPP_CANCEL || len(frame) < CancelLen-HeadLength {
+		return ErrorPacket
+	}
+	c.MessageHeader = header
+	c.version = orDefault(ctx).version()
+	c.msgId = binary.BigEndian.Uint64(frame[0:8])
+	return nil
+}
+
+// ToResponse code为0表示删除成功，否则为失败
+func (c *Cancel) ToResponse(code uint32) interface{} {
+	header := &MessageHeader{TotalLength: HeadLength + 1, CommandId: CMPP_CANCEL_RESP, SequenceId: c.SequenceId}
+	if c.version.V3() {
+		header.TotalLength = HeadLength + 4
+	}
+	resp := &CancelResp{MessageHeader: header, version: c.version}
+	if code != 0 {
+		resp.successId = 1
+	}
+	return resp
+}
+
+func (c *Cancel) String() string {
+	return fmt.Sprintf("{ header: %s, msgId: %d }", c.MessageHeader, c.msgId)
+}
+
+func (c *Cancel) MsgId() uint64 {
+	return c.msgId
+}
+
+func (r *CancelResp) Encode() []byte {
+	frame := r.MessageHeader.Encode()
+	if r.version.V3() {
+		binary.BigEndian.PutUint32(frame[12:16], r.successId)
+	} else {
+		frame[12] = byte(r.successId)
+	}
+	return frame
+}
+
+func (r *CancelResp) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
+	v := orDefault(ctx).version()
+	if header == nil || header.CommandId != CMPP_CANCEL_RESP || len(frame) < 1 {
+		return ErrorPacket
+	}
+	r.MessageHeader = header
+	r.version = v
+	if v.V3() {
+		if len(frame) < 4 {
+			return ErrorPacket
+		}
+		r.successId = binary.BigEndian.Uint32(frame[0:4])
+	} else {
+		r.successId = uint32(frame[0])
+	}
+	return nil
+}
+
+func (r *CancelResp) String() string {
+	return fmt.Sprintf("{ header: %s, successId: %d }", r.MessageHeader, r.successId)
+}
+
+func (r *CancelResp) SuccessId() uint32 {
+	return r.successId
+}
@@ -2,46 +2,142 @@ package cmpp
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/sp"
 	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
 var log = logging.GetDefaultLogger()
 var ErrorPacket = errors.New("error packet")
+
+// Conf、Seq32、Seq64、ReportSeq、Accounts 组成默认的编解码上下文，见 Default
 var Conf yml_config.YmlConfig
 var Seq32 Sequence32
 var Seq64 Sequence64
+var ReportSeq Sequence32
+
+// Accounts SP账号注册表，为nil时仅支持source-addr与shared-secret配置的单一账号
+var Accounts *sp.Registry
+
+// Config 配置文件中的参数，由 LoadConfig 解析并校验，各参数的含义见 config/cmpp.yaml
+type Config struct {
+	// 公共参数
+	SourceAddr         string        `mapstructure:"source-addr"`
+	SharedSecret       string        `mapstructure:"shared-secret"`
+	AuthCheck          bool          `mapstructure:"auth-check"`
+	Version            int           `mapstructure:"version"`
+	MaxCons            int           `mapstructure:"max-cons"`
+	ActiveTestDuration time.Duration `mapstructure:"active-test-duration"`
+	DatacenterId       int           `mapstructure:"datacenter-id"`
+	WorkerId           int           `mapstructure:"worker-id"`
+	ReceiveWindowSize  int           `mapstructure:"receive-window-size"`
+	MaxPoolSize        int           `mapstructure:"max-pool-size"`
+
+	// MT消息相关
+	RegisteredDel   int           `mapstructure:"need-report"`
+	MsgLevel        int           `mapstructure:"default-msg-level"`
+	FeeUserType     int           `mapstructure:"fee-user-type"`
+	FeeTerminalType int           `mapstructure:"fee-terminal-type"`
+	SrcId           string        `mapstructure:"sms-display-no"`
+	ServiceId       string        `mapstructure:"service-id"`
+	FeeTerminalId   string        `mapstructure:"fee-terminal-id"`
+	FeeType         string        `mapstructure:"fee-type"`
+	FeeCode         string        `mapstructure:"fee-code"`
+	LinkID          string        `mapstructure:"link-id"`
+	ValidDuration   time.Duration `mapstructure:"default-valid-duration"`
+	Gsm7MsgFmt      int           `mapstructure:"gsm7-msg-fmt"`
+
+	// 模拟网关相关参数
+	SuccessRate         float64       `mapstructure:"success-rate"`
+	MinSubmitRespMs     int           `mapstructure:"min-submit-resp-ms"`
+	MaxSubmitRespMs     int           `mapstructure:"max-submit-resp-ms"`
+	FixReportRespMs     int           `mapstructure:"fix-report-resp-ms"`
+	ReportRetryInterval time.Duration `mapstructure:"report-retry-interval"`
+	ReportMaxRetry      int           `mapstructure:"report-max-retry"`
+	StoreFile           string        `mapstructure:"store-file"`
+	StoreRetention      time.Duration `mapstructure:"store-retention"`
+	CaptureFile         string        `mapstructure:"capture-file"`
+}
+
+// LoadConfig 解析配置并校验取值范围
+func LoadConfig(conf yml_config.YmlConfig) (*Config, error) {
+	c := &Config{}
+	if err := conf.Unmarshal(c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// 默认上下文兼容只设置包级变量的用法，不校验配置，未设置Conf时各参数为零值
+func decodeConfig(conf yml_config.YmlConfig) *Config {
+	c := &Config{}
+	if conf != nil {
+		_ = conf.Unmarshal(c)
+	}
+	return c
+}
+
+// Validate 校验各参数的取值范围，返回的错误包含配置项名称
+func (c *Config) Validate() error {
+	if v := Version(c.Version); v != V20 && v != V30 {
+		return fmt.Errorf("version: %d not supported, should be 32(2.0) or 48(3.0)", c.Version)
+	}
+	if c.SuccessRate < 0 || c.SuccessRate > 1 {
+		return fmt.Errorf("success-rate: %v out of range [0,1]", c.SuccessRate)
+	}
+	if c.MinSubmitRespMs > c.MaxSubmitRespMs {
+		return fmt.Errorf("min-submit-resp-ms: %d greater than max-submit-resp-ms %d", c.MinSubmitRespMs, c.MaxSubmitRespMs)
+	}
+	for _, err := range []error{
+		checkRange("datacenter-id", c.DatacenterId, 0, 1),
+		checkRange("worker-id", c.WorkerId, 0, 7),
+		checkRange("need-report", c.RegisteredDel, 0, 1),
+		checkRange("default-msg-level", c.MsgLevel, 0, 9),
+		checkRange("fee-user-type", c.FeeUserType, 0, 3),
+		checkRange("fee-terminal-type", c.FeeTerminalType, 0, 1),
+		checkGsm7MsgFmt(c.Gsm7MsgFmt),
+		checkMin("max-cons", c.MaxCons, 0),
+		checkMin("receive-window-size", c.ReceiveWindowSize, 0),
+		checkMin("max-pool-size", c.MaxPoolSize, 0),
+		checkMin("min-submit-resp-ms", c.MinSubmitRespMs, 0),
+		checkMin("fix-report-resp-ms", c.FixReportRespMs, 0),
+		checkMin("report-max-retry", c.ReportMaxRetry, 0),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkRange(key string, v int, min int, max int) error {
+	if v < min || v > max {
+		return fmt.Errorf("%s: %d out of range [%d,%d]", key, v, min, max)
+	}
+	return nil
+}
+
+// gsm7-msg-fmt 为0时不启用，不能与协议定义的Msg_Fmt取值相同
+func checkGsm7MsgFmt(v int) error {
+	if err := checkRange("gsm7-msg-fmt", v, 0, 255); err != nil {
+		return err
+	}
+	switch v {
+	case 3, 4, 8, 15:
+		return fmt.Errorf("gsm7-msg-fmt: %d conflicts with the standard msg_fmt", v)
+	}
+	return nil
+}
 
-// type Config struct {
-// 	// 公共参数
-// 	SourceAddr         string        `yaml:"source-addr"`
-// 	SharedSecret       string        `yaml:"shared-secret"`
-// 	AuthCheck          bool          `yaml:"auth-check"`
-// 	Version            uint8         `yaml:"version"`
-// 	MaxCons            int           `yaml:"max-cons"`
-// 	ActiveTestDuration time.Duration `yaml:"active-test-duration"`
-// 	DataCenterId       int32         `yaml:"datacenter-id"`
-// 	WorkerId           int32         `yaml:"worker-id"`
-// 	ReceiveWindowSize  int           `yaml:"receive-window-size"`
-// 	MaxPoolSize        int           `yaml:"max-pool-size"`
-//
-// 	// MT消息相关
-// 	RegisteredDel   uint8         `yaml:"need-report"`
-// 	MsgLevel        uint8         `yaml:"default-msg-level"`
-// 	FeeUsertype     uint8         `yaml:"fee-user-type"`
-// 	FeeTerminalType uint8         `yaml:"c"`
-// 	SrcId           string        `yaml:"sms-display-no"`
-// 	ServiceId       string        `yaml:"service-id"`
-// 	FeeTerminalId   string        `yaml:"fee-terminal-id"`
-// 	FeeType         string        `yaml:"fee-type"`
-// 	FeeCode         string        `yaml:"fee-code"`
-// 	LinkID          string        `yaml:"link-id"`
-// 	ValidDuration   time.Duration `yaml:"default-valid-duration"`
-//
-// 	// 模拟网关相关参数
-// 	SuccessRate     int32 `yaml:"success-rate"`
-// 	MinSubmitRespMs int32 `yaml:"min-submit-resp-ms"`
-// 	MaxSubmitRespMs int32 `yaml:"max-submit-resp-ms"`
-// 	FixReportRespMs int32 `yaml:"fix-report-resp-ms"`
-// }
+func checkMin(key string, v int, min int) error {
+	if v < min {
+		return fmt.Errorf("%s: %d should not be less than %d", key, v, min)
+	}
+	return nil
+}
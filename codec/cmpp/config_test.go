@@ -0,0 +1,62 @@
+package cmpp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func TestLoadConfig(t *testing.T) {
+	c, err := LoadConfig(yml_config.CreateYamlFactory("cmpp.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, Conf.GetString("source-addr"), c.SourceAddr)
+	assert.Equal(t, Conf.GetInt("version"), c.Version)
+	assert.Equal(t, Conf.GetInt("datacenter-id"), c.DatacenterId)
+	assert.Equal(t, Conf.GetDuration("active-test-duration"), c.ActiveTestDuration)
+	assert.Equal(t, Conf.GetFloat64("success-rate"), c.SuccessRate)
+	assert.Equal(t, Conf.GetString("sms-display-no"), c.SrcId)
+
+	for want, values := range map[string]map[string]interface{}{
+		"version: 21 not supported":                               {"version": 21},
+		"datacenter-id: 2 out of range [0,1]":                     {"datacenter-id": 2},
+		"worker-id: 8 out of range [0,7]":                         {"worker-id": 8},
+		"success-rate: 95 out of range [0,1]":                     {"success-rate": 95},
+		"min-submit-resp-ms: 5 greater than max-submit-resp-ms 3": {"min-submit-resp-ms": 5, "max-submit-resp-ms": 3},
+		"max-cons: -1 should not be less than 0":                  {"max-cons": -1},
+		"gsm7-msg-fmt: 8 conflicts with the standard msg_fmt":     {"gsm7-msg-fmt": 8},
+		"active-test-duration":                                    {"active-test-duration": "1x"},
+	} {
+		if _, ok := values["version"]; !ok {
+			values["version"] = 0x30
+		}
+		_, err := LoadConfig(yml_config.CreateMemoryFactory(values))
+		if assert.NotNil(t, err, want) {
+			assert.Contains(t, err.Error(), want)
+		}
+	}
+}
+
+func TestContext_Reload(t *testing.T) {
+	conf := yml_config.CreateMemoryFactory(map[string]interface{}{"version": 0x30, "success-rate": 0.5, "active-test-duration": "10s"})
+	ctx, err := NewContext(conf)
+	assert.Nil(t, err)
+	session := ctx.WithVersion(V20)
+	assert.Equal(t, 10*time.Second, ctx.Config().ActiveTestDuration)
+
+	// 校验失败时保留原有配置
+	conf.Set("success-rate", 2)
+	assert.NotNil(t, ctx.Reload())
+	assert.Equal(t, 0.5, ctx.Config().SuccessRate)
+
+	// 重新加载后复制的上下文同时生效
+	conf.Set("success-rate", 0.1)
+	assert.Nil(t, ctx.Reload())
+	assert.Equal(t, 0.1, ctx.Config().SuccessRate)
+	assert.Equal(t, 0.1, session.Config().SuccessRate)
+
+	_, err = NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{"version": 0x30, "worker-id": 9}))
+	assert.NotNil(t, err)
+}
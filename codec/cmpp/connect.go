@@ -7,37 +7,47 @@ import (
 	"fmt"
 	"strconv"
 	"time"
+
+	"github.com/aaronwong1989/gosms/comm/sp"
 )
 
 type Connect struct {
-	*MessageHeader             // +12 = 12：消息头
-	sourceAddr          string // +6 = 18：源地址，此处为 SP_Id
-	authenticatorSource []byte // +16 = 34： 用于鉴别源地址。其值通过单向 MD5 hash 计算得出，表示如下: authenticatorSource = MD5(Source_Addr+9 字节的 0 +shared secret+timestamp) Shared secret 由中国移动与源地址实 体事先商定，timestamp 格式为: MMDDHHMMSS，即月日时分秒，10 位。
-	version             uint8  // +1 = 35：双方协商的版本号(高位 4bit 表示主 版本号,低位 4bit 表示次版本号)，对 于3.0的版本，高4bit为3，低4位为 0
-	timestamp           uint32 // +4 = 39：时间戳的明文,由客户端产生,格式为 MMDDHHMMSS，即月日时分秒，10 位数字的整型，右对齐。
+	*MessageHeader               // +12 = 12：消息头
+	sourceAddr          string   // +6 = 18：源地址，此处为 SP_Id
+	authenticatorSource []byte   // +16 = 34： 用于鉴别源地址。其值通过单向 MD5 hash 计算得出，表示如下: authenticatorSource = MD5(Source_Addr+9 字节的 0 +shared secret+timestamp) Shared secret 由中国移动与源地址实 体事先商定，timestamp 格式为: MMDDHHMMSS，即月日时分秒，10 位。
+	version             Version  // +1 = 35：双方协商的版本号(高位 4bit 表示主 版本号,低位 4bit 表示次版本号)，对 于3.0的版本，高4bit为3，低4位为 0
+	timestamp           uint32   // +4 = 39：时间戳的明文,由客户端产生,格式为 MMDDHHMMSS，即月日时分秒，10 位数字的整型，右对齐。
+	ctx                 *Context // 校验账号及生成应答使用的上下文
 }
 
+// ConnectResp 3.0版Status为4字节，报文长度33；2.0版为1字节，报文长度30，解码时按报文长度区分
 type ConnectResp struct {
-	*MessageHeader           // 协议头, 12字节
-	status            uint32 // 状态码，3.0版本4字节，2.0版本1字节
-	authenticatorISMG []byte // 认证串，16字节
-	version           uint8  // 版本，1字节
+	*MessageHeader            // 协议头, 12字节
+	status            uint32  // 状态码，3.0版本4字节，2.0版本1字节
+	authenticatorISMG []byte  // 认证串，16字节
+	version           Version // 网关与SP协商的版本，1字节
 }
 
 func NewConnect() *Connect {
-	con := &Connect{}
+	return Default().NewConnect()
+}
+
+// NewConnect 使用上下文配置的 source-addr、shared-secret、version 登录
+func (ctx *Context) NewConnect() *Connect {
+	con := &Connect{ctx: ctx}
 	header := &MessageHeader{}
 	header.TotalLength = 39
 	header.CommandId = CMPP_CONNECT
-	header.SequenceId = uint32(Seq32.NextVal())
+	header.SequenceId = uint32(ctx.Seq32.NextVal())
 	con.MessageHeader = header
-	con.version = byte(Conf.GetInt("version"))
-	con.sourceAddr = Conf.GetString("source-addr")
+	con.version = ctx.ConfVersion()
+	conf := ctx.Config()
+	con.sourceAddr = conf.SourceAddr
 	ts, _ := strconv.ParseUint(time.Now().Format("0102150405"), 10, 32)
 	con.timestamp = uint32(ts)
 	// TODO TEST ONLY
 	// con.timestamp = uint32(705192634)
-	ss := reqAuthMd5(con)
+	ss := reqAuthMd5(con.sourceAddr, conf.SharedSecret, con.timestamp)
 	con.authenticatorSource = ss[:]
 	return con
 }
@@ -47,52 +57,103 @@ func (connect *Connect) Encode() []byte {
 	if len(frame) == 39 && connect.TotalLength == 39 {
 		copy(frame[12:18], connect.sourceAddr)
 		copy(frame[18:34], connect.authenticatorSource)
-		frame[34] = connect.version
+		frame[34] = byte(connect.version)
 		binary.BigEndian.PutUint32(frame[35:39], connect.timestamp)
 	}
 	return frame
 }
 
-func (connect *Connect) Decode(header *MessageHeader, frame []byte) error {
+// Decode 登录报文的格式与版本无关，版本取自报文中的Version字段
+func (connect *Connect) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
 	// check
 	if header == nil || header.CommandId != CMPP_CONNECT || len(frame) < (39-HeadLength) {
 		return ErrorPacket
 	}
 	connect.MessageHeader = header
+	connect.ctx = ctx
 	connect.sourceAddr = string(frame[0:6])
 	connect.authenticatorSource = frame[6:22]
-	connect.version = frame[22]
+	connect.version = Version(frame[22])
 	connect.timestamp = binary.BigEndian.Uint32(frame[23:27])
 	return nil
 }
 
 func (connect *Connect) String() string {
 	return fmt.Sprintf("{ Header: %s, sourceAddr: %s, authenticatorSource: %x, version: %#x, timestamp: %010d }",
-		connect.MessageHeader, connect.sourceAddr, connect.authenticatorSource, connect.version, connect.timestamp)
+		connect.MessageHeader, connect.sourceAddr, connect.authenticatorSource, uint8(connect.version), connect.timestamp)
 }
 
+// Version 客户端请求的版本
+func (connect *Connect) Version() Version {
+	return connect.version
+}
+
+// SourceAddr SP的企业代码，即登录账号
+func (connect *Connect) SourceAddr() string {
+	return TrimStr([]byte(connect.sourceAddr))
+}
+
+// Check 校验登录请求，返回 ConnectStatusMap 中的状态。
+// 高于支持的版本时按协商的版本应答，仅低于2.0时不支持；协议的4(版本太高)不适用，返回5(其他错误)
 func (connect *Connect) Check() uint32 {
-	if connect.version&0xf0 != byte(Conf.GetInt("version"))&0xf0 {
-		return 4
+	ctx := orDefault(connect.ctx)
+	acc := ctx.lookupAccount(connect.SourceAddr())
+	if _, ok := Negotiate(connect.version, accountVersion(acc)); !ok {
+		log.Warnf("[AuthCheck] unsupported version %s from %s, lower than %s", connect.version, connect.SourceAddr(), V20)
+		return 5
+	}
+	// 配置不做校验时返回0
+	if !ctx.Config().AuthCheck {
+		return 0
+	}
+	if acc == nil {
+		log.Warnf("[AuthCheck] unknown source addr: %s", connect.SourceAddr())
+		return 2
 	}
 
 	authSource := connect.authenticatorSource
-	authMd5 := reqAuthMd5(connect)
+	authMd5 := reqAuthMd5(acc.Id, acc.Secret, connect.timestamp)
 	log.Debugf("[AuthCheck] input  : %x", authSource)
 	log.Debugf("[AuthCheck] compute: %x", authMd5)
-	i := bytes.Compare(authSource, authMd5[:])
-	// 配置不做校验或校验通过时返回0
-	if !Conf.GetBool("auth-check") || i == 0 {
+	if bytes.Equal(authSource, authMd5[:]) {
 		return 0
 	}
 	return 3
 }
 
+// accountVersion 账号支持的最高版本，未配置时不限制
+func accountVersion(acc *sp.Account) Version {
+	if acc != nil && acc.Version != 0 {
+		return Version(acc.Version)
+	}
+	return MaxVersion
+}
+
+// AccountVersion 账号支持的最高版本，网关向无在线连接的账号下发报文时使用
+func AccountVersion(id string) Version {
+	return Default().AccountVersion(id)
+}
+
+// accountSecret 账号的shared secret，未知账号使用全局配置
+func (ctx *Context) accountSecret(acc *sp.Account) string {
+	if acc != nil {
+		return acc.Secret
+	}
+	return ctx.Config().SharedSecret
+}
+
+// ToResponse 应答双方支持的最高版本，报文按该版本的格式编码；不支持客户端的版本时按客户端的版本编码
 func (connect *Connect) ToResponse(code uint32) interface{} {
+	ctx := orDefault(connect.ctx)
 	response := &ConnectResp{}
 	header := &MessageHeader{}
+	acc := ctx.lookupAccount(connect.SourceAddr())
+	version, ok := Negotiate(connect.version, accountVersion(acc))
+	if !ok {
+		version = connect.version
+	}
 	// 3.x 与 2.x Status长度不同
-	if V3() {
+	if version.V3() {
 		header.TotalLength = 33
 	} else {
 		header.TotalLength = 30
@@ -109,21 +170,21 @@ func (connect *Connect) ToResponse(code uint32) interface{} {
 	authDt := make([]byte, 0, 64)
 	authDt = append(authDt, fmt.Sprintf("%d", response.status)...)
 	authDt = append(authDt, connect.authenticatorSource...)
-	authDt = append(authDt, Conf.GetString("shared-secret")...)
+	authDt = append(authDt, ctx.accountSecret(acc)...)
 	auth := md5.Sum(authDt)
 	response.authenticatorISMG = auth[:]
-	response.version = byte(Conf.GetInt("version"))
+	response.version = version
 	return response
 }
 
-func reqAuthMd5(connect *Connect) [16]byte {
+func reqAuthMd5(sourceAddr string, secret string, timestamp uint32) [16]byte {
 	// authenticatorSource = MD5(Source_Addr+9 字节的 0 +shared secret+timestamp)
 	// timestamp 格式为: MMDDHHMMSS，即月日时分秒，10 位。
 	authDt := make([]byte, 0, 64)
-	authDt = append(authDt, Conf.GetString("source-addr")...)
+	authDt = append(authDt, sourceAddr...)
 	authDt = append(authDt, 0, 0, 0, 0, 0, 0, 0, 0, 0)
-	authDt = append(authDt, Conf.GetString("shared-secret")...)
-	authDt = append(authDt, fmt.Sprintf("%010d", connect.timestamp)...)
+	authDt = append(authDt, secret...)
+	authDt = append(authDt, fmt.Sprintf("%010d", timestamp)...)
 	log.Debugf("[AuthCheck] auth data: %x", authDt)
 	authMd5 := md5.Sum(authDt)
 	return authMd5
@@ -134,7 +195,7 @@ func (resp *ConnectResp) Encode() []byte {
 	var index int
 	if len(frame) == int(resp.TotalLength) {
 		index = 12
-		if V3() {
+		if resp.TotalLength == 33 {
 			binary.BigEndian.PutUint32(frame[index:index+4], resp.status)
 			index += 4
 		} else {
@@ -143,23 +204,21 @@ func (resp *ConnectResp) Encode() []byte {
 		}
 		copy(frame[index:index+16], resp.authenticatorISMG)
 		index += 16
-		frame[index] = resp.version
+		frame[index] = byte(resp.version)
 	}
 	return frame
 }
 
-func (resp *ConnectResp) Decode(header *MessageHeader, frame []byte) error {
-	bodyLen := 30
-	if V3() {
-		bodyLen = 33
-	}
+// Decode 网关可能应答低于请求的版本，报文格式按报文长度区分，不依赖请求的版本
+func (resp *ConnectResp) Decode(header *MessageHeader, frame []byte, _ *Context) error {
 	// check
-	if header == nil || header.CommandId != CMPP_CONNECT_RESP || len(frame) < (bodyLen-HeadLength) {
+	if header == nil || header.CommandId != CMPP_CONNECT_RESP || (header.TotalLength != 30 && header.TotalLength != 33) ||
+		len(frame) < int(header.TotalLength-HeadLength) {
 		return ErrorPacket
 	}
 	var index int
 	resp.MessageHeader = header
-	if V3() {
+	if header.TotalLength == 33 {
 		resp.status = binary.BigEndian.Uint32(frame[0 : index+4])
 		index = 4
 	} else {
@@ -168,19 +227,24 @@ func (resp *ConnectResp) Decode(header *MessageHeader, frame []byte) error {
 	}
 	resp.authenticatorISMG = frame[index : index+16]
 	index += 16
-	resp.version = frame[index]
+	resp.version = Version(frame[index])
 	return nil
 }
 
 func (resp *ConnectResp) String() string {
 	return fmt.Sprintf("{ Header: %s, status: {%d: %s}, authenticatorISMG: %x, version: %#x }",
-		resp.MessageHeader, resp.status, ConnectStatusMap[resp.status], resp.authenticatorISMG, resp.version)
+		resp.MessageHeader, resp.status, ConnectStatusMap[resp.status], resp.authenticatorISMG, uint8(resp.version))
 }
 
 func (resp *ConnectResp) Status() uint32 {
 	return resp.status
 }
 
+// Version 网关应答的协商版本，登录成功后双方按此版本编解码
+func (resp *ConnectResp) Version() Version {
+	return resp.version
+}
+
 var ConnectStatusMap = map[uint32]string{
 	0: "成功",
 	1: "消息结构错",
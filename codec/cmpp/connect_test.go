@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/sp"
 )
 
 func TestCmppConnect_Encode(t *testing.T) {
@@ -21,7 +23,7 @@ func TestCmppConnect_Encode(t *testing.T) {
 	connect.sourceAddr = "123456"
 	connect.version = 0x20
 	connect.timestamp = uint32(1001235010)
-	md5str := reqAuthMd5(connect)
+	md5str := reqAuthMd5(connect.sourceAddr, Conf.GetString("shared-secret"), connect.timestamp)
 	connect.authenticatorSource = md5str[:]
 	t.Logf("%s", connect)
 
@@ -59,3 +61,89 @@ func TestAuthStr(t *testing.T) {
 
 	t.Logf("%x", authMd5)
 }
+
+func TestConnect_Check(t *testing.T) {
+	accounts, err := sp.Load(Conf, "source-addr")
+	assert.Nil(t, err)
+	// 开启登录校验
+	authCheck := Conf.GetBool("auth-check")
+	Conf.Set("auth-check", true)
+	Accounts = accounts
+	defer func() {
+		Conf.Set("auth-check", authCheck)
+		Accounts = nil
+	}()
+
+	connect := NewConnect()
+	assert.Equal(t, uint32(0), connect.Check())
+
+	connect.sourceAddr = "654321"
+	assert.Equal(t, uint32(3), connect.Check())
+	md5str := reqAuthMd5(connect.sourceAddr, "another secret", connect.timestamp)
+	connect.authenticatorSource = md5str[:]
+	assert.Equal(t, uint32(0), connect.Check())
+
+	// 应答的认证码使用账号的shared secret
+	resp := connect.ToResponse(0).(*ConnectResp)
+	authDt := append([]byte("0"), connect.authenticatorSource...)
+	authDt = append(authDt, "another secret"...)
+	auth := md5.Sum(authDt)
+	assert.Equal(t, auth[:], resp.authenticatorISMG)
+
+	// 不支持2.0以下的版本，版本过低不是"版本太高"，返回其他错误
+	connect.version = 0x10
+	assert.Equal(t, uint32(5), connect.Check())
+	resp = connect.ToResponse(connect.Check()).(*ConnectResp)
+	assert.Equal(t, uint32(5), resp.Status())
+	assert.Equal(t, Version(0x10), resp.Version())
+
+	// 未知账号
+	connect = NewConnect()
+	connect.sourceAddr = "000000"
+	assert.Equal(t, uint32(2), connect.Check())
+}
+
+func TestConnect_Negotiate(t *testing.T) {
+	accounts, err := sp.Load(Conf, "source-addr")
+	assert.Nil(t, err)
+	Accounts = accounts
+	defer func() { Accounts = nil }()
+
+	// 未限制版本的账号，按客户端请求的版本应答
+	for _, v := range []Version{V20, V30} {
+		connect := NewConnect()
+		connect.version = v
+		resp := connectResp(t, connect)
+		assert.Equal(t, uint32(0), resp.Status())
+		assert.Equal(t, v, resp.Version())
+		assert.Equal(t, v.V3(), resp.TotalLength == 33)
+	}
+
+	// 账号仅支持2.0，3.0的客户端按2.0应答
+	acc, _ := accounts.Get("654321")
+	acc.Version = int(V20)
+	connect := NewConnect()
+	connect.sourceAddr = "654321"
+	connect.version = V30
+	resp := connectResp(t, connect)
+	assert.Equal(t, uint32(0), resp.Status())
+	assert.Equal(t, V20, resp.Version())
+	assert.Equal(t, uint32(30), resp.TotalLength)
+
+	// 高于支持的最高版本时按最高版本应答
+	v, ok := Negotiate(0x40, MaxVersion)
+	assert.True(t, ok)
+	assert.Equal(t, V30, v)
+	_, ok = Negotiate(0x13, MaxVersion)
+	assert.False(t, ok)
+}
+
+// 编码后再解码应答，ConnectResp按报文长度区分版本
+func connectResp(t *testing.T, connect *Connect) *ConnectResp {
+	data := connect.ToResponse(0).(*ConnectResp).Encode()
+	h := &MessageHeader{}
+	assert.Nil(t, h.Decode(data))
+	resp := &ConnectResp{}
+	assert.Nil(t, resp.Decode(h, data[HeadLength:], Default().WithVersion(V30)))
+	return resp
+}
@@ -0,0 +1,138 @@
+package cmpp
+
+import (
+	"sync/atomic"
+
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/snowflake"
+	"github.com/aaronwong1989/gosms/comm/sp"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+// Context 编解码上下文，包含报文使用的配置、序号生成器、SP账号及连接协商的版本。
+// 同一进程中的客户端与网关、或不同账号的客户端可各自创建上下文互不影响；
+// 包级的 NewSubmit、NewConnect 等函数使用 Default 返回的上下文
+type Context struct {
+	Conf      yml_config.YmlConfig
+	Seq32     Sequence32    // 报文的SequenceId
+	Seq64     Sequence64    // Submit应答及上行短信的Msg_Id
+	ReportSeq Sequence32    // 状态报告的SMSC_sequence
+	Accounts  *sp.Registry  // SP账号注册表，为nil时仅支持source-addr与shared-secret配置的单一账号
+	Version   Version       // 连接协商的版本，为0时使用配置的version
+	config    *atomic.Value // 解析校验后的 *Config，WithVersion 复制的上下文共用，见 Reload
+}
+
+// NewContext 使用配置创建上下文，配置校验失败时返回错误，序号生成器按 datacenter-id、worker-id 生成
+func NewContext(conf yml_config.YmlConfig) (*Context, error) {
+	c, err := LoadConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	dc, wk := c.DatacenterId, c.WorkerId
+	ctx := &Context{
+		Conf:      conf,
+		Seq32:     comm.NewCycleSequence(int32(dc), int32(wk)),
+		Seq64:     snowflake.NewSnowflake(int64(dc), int64(wk)),
+		ReportSeq: comm.NewCycleSequence(int32(dc), int32(wk)),
+		config:    new(atomic.Value),
+	}
+	ctx.config.Store(c)
+	return ctx, nil
+}
+
+// Default 由包级变量 Conf、Seq32、Seq64、ReportSeq、Accounts 组成的上下文，兼容只设置包级变量的用法。
+// 上下文解析一次后缓存，包级变量被重新赋值或 Conf 修改、重新加载后重建
+func Default() *Context {
+	if d, ok := defaultCtx.Load().(*defaultContext); ok && d.current() {
+		return d.ctx
+	}
+	// 先取修订号再解析配置，解析期间配置发生变化时下次调用会重建
+	d := &defaultContext{revision: revision(Conf)}
+	d.ctx = &Context{Conf: Conf, Seq32: Seq32, Seq64: Seq64, ReportSeq: ReportSeq, Accounts: Accounts, config: new(atomic.Value)}
+	d.ctx.config.Store(decodeConfig(Conf))
+	defaultCtx.Store(d)
+	return d.ctx
+}
+
+// 缓存的默认上下文
+var defaultCtx atomic.Value
+
+type defaultContext struct {
+	ctx      *Context
+	revision uint64 // 创建时 Conf 的修订号
+}
+
+// 包级变量未被重新赋值且配置未修改时缓存有效
+func (d *defaultContext) current() bool {
+	c := d.ctx
+	return c.Conf == Conf && c.Seq32 == Seq32 && c.Seq64 == Seq64 && c.ReportSeq == ReportSeq && c.Accounts == Accounts && d.revision == revision(Conf)
+}
+
+func revision(conf yml_config.YmlConfig) uint64 {
+	if conf == nil {
+		return 0
+	}
+	return conf.Revision()
+}
+
+// 未指定上下文时使用默认上下文
+func orDefault(ctx *Context) *Context {
+	if ctx == nil {
+		return Default()
+	}
+	return ctx
+}
+
+// WithVersion 复制上下文并设置连接协商的版本，配置、序号生成器及账号与原上下文共用
+func (ctx *Context) WithVersion(v Version) *Context {
+	c := *orDefault(ctx)
+	c.Version = v
+	return &c
+}
+
+// Config 当前生效的配置，配置重新加载后整体替换，调用方不应修改返回的配置
+func (ctx *Context) Config() *Config {
+	if ctx.config == nil {
+		return decodeConfig(ctx.Conf)
+	}
+	return ctx.config.Load().(*Config)
+}
+
+// Reload 重新解析配置，校验失败时保留原有配置；Conf 变化(如配置文件修改)后调用
+func (ctx *Context) Reload() error {
+	c, err := LoadConfig(ctx.Conf)
+	// 未通过 NewContext、Default 创建的上下文每次使用时解析配置，无需替换
+	if err == nil && ctx.config != nil {
+		ctx.config.Store(c)
+	}
+	return err
+}
+
+// ConfVersion 配置的版本号，客户端登录时使用
+func (ctx *Context) ConfVersion() Version {
+	return Version(ctx.Config().Version)
+}
+
+// 报文编解码使用的版本，未协商时使用配置的版本
+func (ctx *Context) version() Version {
+	if ctx.Version != 0 {
+		return ctx.Version
+	}
+	return ctx.ConfVersion()
+}
+
+func (ctx *Context) lookupAccount(id string) *sp.Account {
+	if ctx.Accounts != nil {
+		a, _ := ctx.Accounts.Get(id)
+		return a
+	}
+	if a := sp.Default(ctx.Conf, "source-addr"); a.Id == id {
+		return a
+	}
+	return nil
+}
+
+// AccountVersion 账号支持的最高版本，网关向无在线连接的账号下发报文时使用
+func (ctx *Context) AccountVersion(id string) Version {
+	return accountVersion(ctx.lookupAccount(id))
+}
@@ -0,0 +1,76 @@
+package cmpp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func TestContext(t *testing.T) {
+	// 同一进程中两个配置不同的上下文互不影响
+	c1, err := NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"source-addr": "111111", "shared-secret": "s1", "version": 0x20, "service-id": "svc1",
+	}))
+	assert.Nil(t, err)
+	c2, err := NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"source-addr": "222222", "shared-secret": "s2", "version": 0x30, "service-id": "svc2", "worker-id": 2,
+	}))
+	assert.Nil(t, err)
+
+	con1, con2 := c1.NewConnect(), c2.NewConnect()
+	assert.Equal(t, "111111", con1.SourceAddr())
+	assert.Equal(t, V20, con1.Version())
+	assert.Equal(t, "222222", con2.SourceAddr())
+	assert.Equal(t, V30, con2.Version())
+	// 各自的序号生成器
+	assert.Equal(t, c1.NewActiveTest().SequenceId+1, c1.NewActiveTest().SequenceId)
+	assert.NotEqual(t, c1.NewActiveTest().SequenceId>>28, c2.NewActiveTest().SequenceId>>28)
+
+	sub1 := c1.NewSubmit([]string{"17011112222"}, "hi")[0]
+	sub2 := c2.NewSubmit([]string{"17011112222"}, "hi")[0]
+	assert.Equal(t, V20, sub1.Version())
+	assert.Equal(t, "svc1", sub1.ServiceId())
+	assert.Equal(t, V30, sub2.Version())
+	assert.Equal(t, "svc2", sub2.ServiceId())
+
+	// 协商的版本优先于配置的版本
+	v3 := c1.WithVersion(V30)
+	assert.Equal(t, V30, v3.NewSubmit([]string{"17011112222"}, "hi")[0].Version())
+	assert.Equal(t, V30, v3.NewDelivery("17011112222", "hi", "", "").Version())
+	assert.Equal(t, V20, c1.NewDelivery("17011112222", "hi", "", "").Version())
+
+	// 解码后的登录报文按上下文的账号校验
+	server := c2.WithVersion(0)
+	frame := con1.Encode()
+	h := &MessageHeader{}
+	assert.Nil(t, h.Decode(frame))
+	dec := &Connect{}
+	assert.Nil(t, dec.Decode(h, frame[HeadLength:], server))
+	dec.sourceAddr = "222222"
+	resp := dec.ToResponse(0).(*ConnectResp)
+	assert.Equal(t, V20, resp.Version())
+}
+
+func TestDefault(t *testing.T) {
+	// 默认上下文只解析一次配置
+	d := Default()
+	assert.Same(t, d, Default())
+	assert.Same(t, d.Config(), orDefault(nil).Config())
+
+	// 配置修改后重建
+	old := Conf.GetString("service-id")
+	defer Conf.Set("service-id", old)
+	Conf.Set("service-id", "svc-default")
+	assert.NotSame(t, d, Default())
+	assert.Equal(t, "svc-default", Default().Config().ServiceId)
+
+	// 包级变量重新赋值后重建
+	d = Default()
+	conf := Conf
+	defer func() { Conf = conf }()
+	Conf = yml_config.CreateMemoryFactory(map[string]interface{}{"source-addr": "333333", "service-id": "svc3"})
+	assert.NotSame(t, d, Default())
+	assert.Equal(t, "svc3", Default().Config().ServiceId)
+}
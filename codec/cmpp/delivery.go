@@ -4,9 +4,11 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strings"
+
+	"github.com/aaronwong1989/gosms/comm"
 )
 
-// Delivery 上行短信或状态报告，不支持长短信
+// Delivery 上行短信或状态报告，下发时不支持长短信，接收到的长短信分片可通过 Reassemble 组装
 type Delivery struct {
 	*MessageHeader
 
@@ -21,12 +23,23 @@ type Delivery struct {
 	registeredDelivery uint8   // 是否为状态报告
 	msgLength          uint8   // 消息长度
 	msgContent         string  // 非状态报告的消息内容
+	msgBytes           []byte  // 非状态报告的原始消息内容，长短信时含UDH
 	report             *Report // 状态报告的消息内容
 	linkID             string  // 点播业务使用的LinkID，非点播类业务的MT流程不使用该字段
+	version            Version
+	ctx                *Context // 选择及解码消息内容编码格式使用的上下文，见 Context.MsgFmt
+}
+
+// NewDelivery 上行短信，v为接收连接协商的版本
+func NewDelivery(phone string, msg string, dest string, serviceId string, v Version) *Delivery {
+	return Default().WithVersion(v).NewDelivery(phone, msg, dest, serviceId)
 }
 
-func NewDelivery(phone string, msg string, dest string, serviceId string) *Delivery {
-	dly := &Delivery{}
+// NewDelivery 上行短信，按上下文中接收连接协商的版本编码
+func (ctx *Context) NewDelivery(phone string, msg string, dest string, serviceId string) *Delivery {
+	v := ctx.version()
+	dly := &Delivery{version: v, ctx: ctx}
+	dly.msgId = uint64(ctx.Seq64.NextVal())
 	dly.srcTerminalId = phone
 	dly.srcTerminalType = 0
 	setMsgContent(dly, msg)
@@ -34,21 +47,17 @@ func NewDelivery(phone string, msg string, dest string, serviceId string) *Deliv
 	if dest != "" {
 		dly.destId = dest
 	} else {
-		dly.destId = Conf.GetString("sms-display-no")
+		dly.destId = ctx.Config().SrcId
 	}
 	if serviceId != "" {
 		dly.serviceId = serviceId
 	} else {
-		dly.serviceId = Conf.GetString("service-id")
-	}
-	baseLen := uint32(85)
-	if V3() {
-		baseLen = 109
+		dly.serviceId = ctx.Config().ServiceId
 	}
 	header := MessageHeader{
-		TotalLength: baseLen + uint32(dly.msgLength),
+		TotalLength: deliveryBaseLen(v) + uint32(dly.msgLength),
 		CommandId:   CMPP_DELIVER,
-		SequenceId:  uint32(Seq32.NextVal())}
+		SequenceId:  uint32(ctx.Seq32.NextVal())}
 	dly.MessageHeader = &header
 	return dly
 }
@@ -62,7 +71,7 @@ func (d *Delivery) Encode() []byte {
 	frame[52] = d.tpUdhi
 	frame[53] = d.msgFmt
 	index := 54
-	if V3() {
+	if d.version.V3() {
 		copy(frame[index:index+32], d.srcTerminalId)
 		index += 32
 		frame[index] = d.srcTerminalType
@@ -80,33 +89,38 @@ func (d *Delivery) Encode() []byte {
 		// 状态报告
 		copy(frame[index:index+l], d.report.Encode())
 	} else {
-		// 上行短信，不支持长短信，固定选用第一片 （New时需处理）
-		slices := MsgSlices(d.msgFmt, d.msgContent)
-		// 不支持长短信，固定选用第一片
-		content := slices[0]
+		// 解码得到的上行短信按原始内容编码，长短信分片含UDH
+		content := d.msgBytes
+		if content == nil {
+			// 上行短信，不支持长短信，固定选用第一片 （New时需处理）
+			content = orDefault(d.ctx).MsgSlices(d.msgFmt, d.msgContent)[0]
+		}
 		copy(frame[index:index+l], content)
 	}
 	index += l
-	if V3() {
+	if d.version.V3() {
 		copy(frame[index:index+20], d.linkID)
 	}
 
 	return frame
 }
 
-func (d *Delivery) Decode(header *MessageHeader, frame []byte) error {
+func (d *Delivery) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
+	v := orDefault(ctx).version()
 	if header == nil || header.CommandId != CMPP_DELIVER || uint32(len(frame)) < (header.TotalLength-HeadLength) {
 		return ErrorPacket
 	}
 	d.MessageHeader = header
+	d.version = v
+	d.ctx = ctx
 	d.msgId = binary.BigEndian.Uint64(frame[0:8])
 	d.destId = TrimStr(frame[8:29])
-	d.destId = TrimStr(frame[29:39])
+	d.serviceId = TrimStr(frame[29:39])
 	d.tpPid = frame[39]
 	d.tpUdhi = frame[40]
 	d.msgFmt = frame[41]
 	index := 42
-	if V3() {
+	if v.V3() {
 		d.srcTerminalId = TrimStr(frame[index : index+32])
 		index += 32
 		d.srcTerminalType = frame[index]
@@ -128,10 +142,11 @@ func (d *Delivery) Decode(header *MessageHeader, frame []byte) error {
 		}
 		d.report = rpt
 	} else {
-		d.msgContent = TrimStr(frame[index : index+l])
+		d.msgBytes = frame[index : index+l]
+		d.msgContent = orDefault(ctx).decodeUserData(d.msgFmt, d.tpUdhi, d.msgBytes)
 	}
 	index += l
-	if V3() {
+	if v.V3() {
 		d.linkID = TrimStr(frame[index : index+20])
 	}
 	return nil
@@ -142,9 +157,10 @@ func (d *Delivery) ToResponse(code uint32) interface{} {
 	dr := &DeliveryResp{}
 	dr.MessageHeader = &header
 	dr.TotalLength = HeadLength + 9
-	if V3() {
+	if d.version.V3() {
 		dr.TotalLength = HeadLength + 12
 	}
+	dr.version = d.version
 	dr.CommandId = CMPP_DELIVER_RESP
 	dr.msgId = d.msgId
 	dr.result = code
@@ -170,7 +186,27 @@ func (d *Delivery) String() string {
 }
 
 func setMsgContent(dly *Delivery, msg string) {
-	dly.msgFmt = MsgFmt(msg)
+	dly.msgFmt = orDefault(dly.ctx).MsgFmt(msg)
+	setMsgBytes(dly, msg)
+}
+
+// SetMsgFmt 指定上行短信的编码格式，0：ASCII，8：UCS2，未指定时按内容自动选择
+func (d *Delivery) SetMsgFmt(msgFmt uint8) error {
+	if msgFmt != 0 && msgFmt != 8 {
+		return fmt.Errorf("unsupported msg_fmt %d", msgFmt)
+	}
+	if msgFmt == 0 && MsgFmt(d.msgContent) != 0 {
+		return fmt.Errorf("content can not be encoded in ASCII")
+	}
+	old := uint32(d.msgLength)
+	d.msgFmt = msgFmt
+	d.msgBytes = nil
+	setMsgBytes(d, d.msgContent)
+	d.TotalLength = d.TotalLength - old + uint32(d.msgLength)
+	return nil
+}
+
+func setMsgBytes(dly *Delivery, msg string) {
 	var l int
 	if dly.msgFmt == 8 {
 		l = 2 * len([]rune(msg))
@@ -180,6 +216,18 @@ func setMsgContent(dly *Delivery, msg string) {
 			msg = string(rs[:70])
 			l = 140
 		}
+	} else if orDefault(dly.ctx).isGsm7(dly.msgFmt) {
+		// 只取前160个septet，转义符不与扩展字符分开
+		septets, _ := comm.Gsm7Encode(msg)
+		if len(septets) > 160 {
+			n := 160
+			if septets[n-1] == 0x1B {
+				n--
+			}
+			septets = septets[:n]
+			msg = comm.Gsm7Decode(septets)
+		}
+		l = len(comm.Gsm7Pack(septets))
 	} else {
 		l = len(msg)
 		if l > 160 {
@@ -196,16 +244,114 @@ func (d *Delivery) RegisteredDelivery() uint8 {
 	return d.registeredDelivery
 }
 
+// IsReport 是否为状态报告
+func (d *Delivery) IsReport() bool {
+	return d.registeredDelivery == 1
+}
+
+// Report 状态报告的内容，非状态报告时为nil
+func (d *Delivery) Report() *Report {
+	return d.report
+}
+
+// Version 报文的协议版本
+func (d *Delivery) Version() Version {
+	return d.version
+}
+
+// ToVersion 复制报文并按版本v编码，MsgId、SequenceId及消息内容不变，用于发送给协商版本不同的连接
+func (d *Delivery) ToVersion(v Version) *Delivery {
+	dly := *d
+	header := *d.MessageHeader
+	dly.MessageHeader = &header
+	dly.version = v
+	dly.TotalLength = deliveryBaseLen(v) + uint32(d.msgLength)
+	return &dly
+}
+
+// 不含消息内容的报文长度，3.0的源终端号码为32字节并增加了号码类型及LinkID
+func deliveryBaseLen(v Version) uint32 {
+	if v.V3() {
+		return 109
+	}
+	return 85
+}
+
+func (d *Delivery) MsgId() uint64 {
+	return d.msgId
+}
+
+func (d *Delivery) DestId() string {
+	return d.destId
+}
+
+func (d *Delivery) ServiceId() string {
+	return d.serviceId
+}
+
+func (d *Delivery) SrcTerminalId() string {
+	return d.srcTerminalId
+}
+
+func (d *Delivery) MsgContent() string {
+	return d.msgContent
+}
+
+// Reassemble 将长短信分片交给组装器，全部分片到达后将消息内容置为完整内容并返回true，
+// 分片未收齐时返回false，非长短信直接返回true
+func (d *Delivery) Reassemble(r *comm.Reassembler) bool {
+	if d.IsReport() || d.tpUdhi != 1 {
+		return true
+	}
+	ud := d.msgBytes
+	gsm7 := orDefault(d.ctx).isGsm7(d.msgFmt)
+	if gsm7 && len(ud) > 0 && int(ud[0]) < len(ud) {
+		// 压缩的GSM 7-bit在UDH之后有填充位，各分片先解压为septet再组装
+		udhLen := int(ud[0]) + 1
+		ud = append(append([]byte(nil), ud[:udhLen]...), comm.Gsm7UnpackUserData(ud, udhLen)...)
+	}
+	data, ok := r.Add(d.srcTerminalId, d.destId, ud)
+	if ok {
+		if gsm7 {
+			d.msgContent = comm.Gsm7Decode(data)
+		} else {
+			d.msgContent = decodeContent(d.msgFmt, data)
+		}
+	}
+	return ok
+}
+
+func (d *Delivery) TpUdhi() uint8 {
+	return d.tpUdhi
+}
+
+func (d *Delivery) MsgFmt() uint8 {
+	return d.msgFmt
+}
+
+func (d *Delivery) MsgBytes() []byte {
+	return d.msgBytes
+}
+
+func decodeContent(msgFmt uint8, content []byte) string {
+	if msgFmt == 8 {
+		return comm.Ucs2Decode(content)
+	}
+	return TrimStr(content)
+}
+
+// DeliveryResp 3.0版Result为4字节，2.0版为1字节
 type DeliveryResp struct {
 	*MessageHeader
-	msgId  uint64 // 消息标识,来自CMPP_DELIVERY
-	result uint32 // 结果
+	msgId   uint64 // 消息标识,来自CMPP_DELIVERY
+	result  uint32 // 结果
+	version Version
 }
 
 func (r *DeliveryResp) Encode() []byte {
 	frame := r.MessageHeader.Encode()
 	binary.BigEndian.PutUint64(frame[12:20], r.msgId)
-	if V3() {
+	if r.version.V3() {
 		binary.BigEndian.PutUint32(frame[20:24], r.result)
 	} else {
 		frame[20] = byte(r.result)
@@ -213,12 +359,15 @@ func (r *DeliveryResp) Encode() []byte {
 	return frame
 }
 
-func (r *DeliveryResp) Decode(header *MessageHeader, frame []byte) error {
+func (r *DeliveryResp) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
+	v := orDefault(ctx).version()
 	if header == nil || header.CommandId != CMPP_DELIVER_RESP || uint32(len(frame)) < (header.TotalLength-HeadLength) {
 		return ErrorPacket
 	}
+	r.MessageHeader = header
+	r.version = v
 	r.msgId = binary.BigEndian.Uint64(frame[0:8])
-	if V3() {
+	if v.V3() {
 		r.result = binary.BigEndian.Uint32(frame[8:12])
 	} else {
 		r.result = uint32(frame[8])
@@ -234,6 +383,14 @@ func (r *DeliveryResp) SetResult(result uint32) {
 	r.result = result
 }
 
+func (r *DeliveryResp) Result() uint32 {
+	return r.result
+}
+
+func (r *DeliveryResp) MsgId() uint64 {
+	return r.msgId
+}
+
 var DeliveryResultMap = map[uint32]string{
 	0: "正确",
 	1: "消息结构错",
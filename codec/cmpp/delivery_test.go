@@ -1,9 +1,14 @@
 package cmpp
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
 func TestNewDelivery(t *testing.T) {
@@ -21,7 +26,7 @@ func TestNewDelivery(t *testing.T) {
 }
 
 func testcase(t *testing.T, msg string) {
-	d := NewDelivery("17011110000", msg, "", "")
+	d := NewDelivery("17011110000", msg, "", "", ConfVersion())
 	t.Logf("%v", d)
 	bts := d.Encode()
 	t.Logf("len: %d, data: %x", len(bts), bts)
@@ -43,6 +48,55 @@ func testcase(t *testing.T, msg string) {
 	assert.Equal(t, d.msgLength, uint8(l))
 	assert.Equal(t, d.destId, Conf.GetString("sms-display-no"))
 	assert.Equal(t, d.serviceId, Conf.GetString("service-id"))
+
+	h := &MessageHeader{}
+	_ = h.Decode(bts)
+	dec := &Delivery{}
+	err := dec.Decode(h, bts[HeadLength:], Default().WithVersion(d.Version()))
+	assert.True(t, err == nil)
+	assert.Equal(t, d.msgContent, dec.MsgContent())
+	assert.Equal(t, Conf.GetString("sms-display-no"), dec.DestId())
+	assert.Equal(t, Conf.GetString("service-id"), dec.ServiceId())
+	assert.Equal(t, "17011110000", dec.SrcTerminalId())
+	assert.False(t, dec.IsReport())
+}
+
+func TestDelivery_SetMsgFmt(t *testing.T) {
+	d := NewDelivery("17011110000", "hello world", "", "", ConfVersion())
+	assert.Equal(t, uint8(0), d.msgFmt)
+	assert.Nil(t, d.SetMsgFmt(8))
+	assert.Equal(t, uint8(22), d.msgLength)
+	bts := d.Encode()
+	assert.Equal(t, uint32(len(bts)), d.TotalLength)
+
+	h := &MessageHeader{}
+	_ = h.Decode(bts)
+	dec := &Delivery{}
+	assert.Nil(t, dec.Decode(h, bts[HeadLength:], Default().WithVersion(d.Version())))
+	assert.Equal(t, uint8(8), dec.msgFmt)
+	assert.Equal(t, "hello world", dec.MsgContent())
+
+	d = NewDelivery("17011110000", "你好", "", "", ConfVersion())
+	assert.NotNil(t, d.SetMsgFmt(0))
+	assert.NotNil(t, d.SetMsgFmt(15))
+	d = NewDelivery("17011110000", "5€", "", "", ConfVersion())
+	assert.Equal(t, uint8(8), d.msgFmt)
+	assert.NotNil(t, d.SetMsgFmt(0))
+}
+
+func TestDelivery_Ascii(t *testing.T) {
+	// Msg_Fmt为0的内容按ASCII原样收发，网关发来的@(0x40)不按GSM 7-bit解码
+	content := "TD @shop_01 $5 {ok}"
+	d := NewDelivery("17011110000", content, "", "", ConfVersion())
+	assert.Equal(t, uint8(0), d.msgFmt)
+	bts := d.Encode()
+	assert.Contains(t, string(bts), content)
+
+	h := &MessageHeader{}
+	_ = h.Decode(bts)
+	dec := &Delivery{}
+	assert.Nil(t, dec.Decode(h, bts[HeadLength:], Default().WithVersion(d.Version())))
+	assert.Equal(t, content, dec.MsgContent())
 }
 
 const Poem2 = "Will drink\n" +
@@ -58,3 +112,79 @@ const Poem2 = "Will drink\n" +
 	"The king of Chen used to enjoy banquets and drink ten thousand wine.\n" +
 	"Why does the master say less money? He must sell and drink to you.\n" +
 	"Five flower horses, thousands of gold fur, hu er will exchange wine, and sell eternal sorrow with you."
+
+func TestDelivery_Gsm7(t *testing.T) {
+	ctx, err := NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{"version": 0x30, "gsm7-msg-fmt": 17}))
+	assert.Nil(t, err)
+
+	msg := "Price: 5€ [discount] {ok}"
+	d := ctx.NewDelivery("17011110000", msg, "", "")
+	assert.Equal(t, uint8(17), d.MsgFmt())
+	bts := d.Encode()
+	assert.Equal(t, uint32(len(bts)), d.TotalLength)
+
+	h := &MessageHeader{}
+	_ = h.Decode(bts)
+	dec := &Delivery{}
+	assert.Nil(t, dec.Decode(h, bts[HeadLength:], ctx))
+	assert.Equal(t, msg, dec.MsgContent())
+	// 解码后按原始内容编码
+	assert.Equal(t, bts, dec.Encode())
+
+	// 上行不支持长短信，只取前160个septet
+	d = ctx.NewDelivery("17011110000", strings.Repeat("é", 200), "", "")
+	assert.Equal(t, uint8(140), d.msgLength)
+	assert.Equal(t, 160, len([]rune(d.MsgContent())))
+}
+
+func TestDelivery_Reassemble(t *testing.T) {
+	slices := MsgSlices(8, Poem)
+	assert.True(t, len(slices) > 1)
+
+	r := comm.NewReassembler(time.Minute)
+	for i := len(slices) - 1; i >= 0; i-- {
+		d := NewDelivery("13800001111", "", "", "", ConfVersion())
+		d.tpUdhi, d.msgFmt = 1, 8
+		d.msgBytes = slices[i]
+		ok := d.Reassemble(r)
+		assert.Equal(t, i == 0, ok)
+		if ok {
+			assert.Equal(t, Poem, d.MsgContent())
+		}
+	}
+}
+
+func TestSubmit_ToDeliveryReport(t *testing.T) {
+	sub := NewSubmit([]string{"17011110000"}, "hello")[0]
+	msgId := uint64(Seq64.NextVal())
+	d := sub.ToDeliveryReport(msgId)
+	// 状态报告自身有独立的MsgId，SP在DELIVER_RESP中回填，用于确认
+	assert.NotEqual(t, uint64(0), d.MsgId())
+	assert.NotEqual(t, msgId, d.MsgId())
+	assert.Equal(t, msgId, d.Report().MsgId())
+
+	resp := d.ToResponse(0).(*DeliveryResp)
+	dr := &DeliveryResp{}
+	bts := resp.Encode()
+	assert.Nil(t, dr.Decode(resp.MessageHeader, bts[HeadLength:], Default().WithVersion(d.Version())))
+	assert.Equal(t, d.MsgId(), dr.MsgId())
+}
+
+func TestDelivery_ToVersion(t *testing.T) {
+	sub := Default().WithVersion(V20).NewSubmit([]string{"17011110000"}, "hello")[0]
+	d := sub.ToDeliveryReport(uint64(Seq64.NextVal()))
+	d3 := d.ToVersion(V30)
+	assert.Equal(t, V20, d.Version())
+	assert.Equal(t, d.TotalLength+24, d3.TotalLength)
+
+	bts := d3.Encode()
+	assert.Equal(t, uint32(len(bts)), d3.TotalLength)
+	h := &MessageHeader{}
+	_ = h.Decode(bts)
+	dec := &Delivery{}
+	assert.Nil(t, dec.Decode(h, bts[HeadLength:], Default().WithVersion(V30)))
+	assert.Equal(t, d.MsgId(), dec.MsgId())
+	assert.Equal(t, d.SequenceId, dec.SequenceId)
+	assert.Equal(t, d.Report().MsgId(), dec.Report().MsgId())
+	assert.Equal(t, "17011110000", dec.SrcTerminalId())
+}
@@ -48,8 +48,37 @@ func TrimStr(bts []byte) string {
 	return *(*string)(unsafe.Pointer(&ns))
 }
 
-func V3() bool {
-	return int(Conf.GetInt("version"))&0xf0 == 0x30
+// Version 协议版本号，高4位为主版本号，低4位为次版本号，如0x30表示3.0
+// 3.x 与 2.x 的 Submit、Deliver 等报文格式不同，编解码时需使用连接协商的版本
+type Version uint8
+
+const (
+	V20        Version = 0x20
+	V30        Version = 0x30
+	MaxVersion         = V30 // 支持的最高版本，网关未限制账号的版本时按此协商
+)
+
+// V3 是否为3.x版本
+func (v Version) V3() bool {
+	return v&0xf0 == 0x30
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v>>4, v&0x0f)
+}
+
+// Negotiate 协商连接使用的版本：取客户端版本与网关支持的最高版本中较低者，低于2.0时不支持
+func Negotiate(client, max Version) (Version, bool) {
+	v := client
+	if v > max {
+		v = max
+	}
+	return v, v >= V20
+}
+
+// ConfVersion 配置的版本号，客户端登录时使用
+func ConfVersion() Version {
+	return Default().ConfVersion()
 }
 
 const (
@@ -64,10 +93,10 @@ const (
 	CMPP_DELIVER_RESP     = uint32(0x80000005) // 下发短信应答
 	CMPP_ACTIVE_TEST      = uint32(0x00000008) // 激活测试
 	CMPP_ACTIVE_TEST_RESP = uint32(0x80000008) // 激活测试应答
-	// CMPP_QUERY                     = uint32(0x00000006) // 发送短信状态查询
-	// CMPP_QUERY_RESP                = uint32(0x80000006) // 发送短信状态查询应答
-	// CMPP_CANCEL                    = uint32(0x00000007) // 删除短信
-	// CMPP_CANCEL_RESP               = uint32(0x80000007) // 删除短信应答
+	CMPP_QUERY            = uint32(0x00000006) // 发送短信状态查询
+	CMPP_QUERY_RESP       = uint32(0x80000006) // 发送短信状态查询应答
+	CMPP_CANCEL           = uint32(0x00000007) // 删除短信
+	CMPP_CANCEL_RESP      = uint32(0x80000007) // 删除短信应答
 	// CMPP_FWD                       = uint32(0x00000009) // 消息前转
 	// CMPP_FWD_RESP                  = uint32(0x80000009) // 消息前转应答
 	// CMPP_MT_ROUTE                  = uint32(0x00000010) // MT 路由请求
@@ -101,4 +130,8 @@ func init() {
 	CommandMap[CMPP_DELIVER_RESP] = "CMPP_DELIVER_RESP"
 	CommandMap[CMPP_ACTIVE_TEST] = "CMPP_ACTIVE_TEST"
 	CommandMap[CMPP_ACTIVE_TEST_RESP] = "CMPP_ACTIVE_TEST_RESP"
+	CommandMap[CMPP_QUERY] = "CMPP_QUERY"
+	CommandMap[CMPP_QUERY_RESP] = "CMPP_QUERY_RESP"
+	CommandMap[CMPP_CANCEL] = "CMPP_CANCEL"
+	CommandMap[CMPP_CANCEL_RESP] = "CMPP_CANCEL_RESP"
 }
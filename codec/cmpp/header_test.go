@@ -16,7 +16,7 @@ import (
 func init() {
 	rand.Seed(time.Now().Unix()) // 随机种子
 	Conf = yml_config.CreateYamlFactory("cmpp.yaml")
-	dc := Conf.GetInt("data-center-id")
+	dc := Conf.GetInt("datacenter-id")
 	wk := Conf.GetInt("worker-id")
 	Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
 	Seq64 = snowflake.NewSnowflake(int64(dc), int64(wk))
@@ -2,16 +2,19 @@ package cmpp
 
 import (
 	"time"
+
+	"github.com/aaronwong1989/gosms/comm"
 )
 
 type Option func(mtOps *MtOptions)
 
-func loadOptions(options ...Option) *MtOptions {
+func (ctx *Context) loadOptions(options ...Option) *MtOptions {
 	opts := &MtOptions{
 		RegisteredDel:   uint8(0xf),
 		MsgLevel:        uint8(0xf),
 		FeeUsertype:     uint8(0xf),
 		FeeTerminalType: uint8(0xf),
+		Version:         ctx.version(),
 	}
 	for _, option := range options {
 		option(opts)
@@ -32,6 +35,7 @@ type MtOptions struct {
 	AtTime          string
 	SrcId           string
 	LinkID          string
+	Version         Version // 协议版本，默认为上下文协商的版本或配置的version，需与连接协商的版本一致
 }
 
 // WithOptions 设置配置项
@@ -65,6 +69,13 @@ func MtFeeUsertype(t uint8) Option {
 	}
 }
 
+// MtVersion 按连接协商的版本编码
+func MtVersion(v Version) Option {
+	return func(opts *MtOptions) {
+		opts.Version = v
+	}
+}
+
 // MtLinkID 点播业务使用的LinkID，非点播类业务的MT流程不使用该字段
 func MtLinkID(s string) Option {
 	return func(opts *MtOptions) {
@@ -82,18 +93,17 @@ func MtSrcId(s string) Option {
 // MtAtTime 定时发送时间，格式遵循SMPP3.3协议
 func MtAtTime(t time.Time) Option {
 	return func(opts *MtOptions) {
-		s := t.Format("060102150405")
-		opts.AtTime = s + "032+"
+		opts.AtTime = comm.FormatTime(t)
 	}
 }
 
-// MtAtTimeStr 定时发送时间，格式:yyMMddHHmmss
+// MtAtTimeStr 定时发送时间，格式:yyMMddHHmmss，按本地时区处理
 func MtAtTimeStr(s string) Option {
 	return func(opts *MtOptions) {
 		if len(s) > 12 {
 			s = s[:12]
 		}
-		opts.AtTime = s + "032+"
+		opts.AtTime = s + comm.FormatTime(time.Now())[12:]
 	}
 }
 
@@ -0,0 +1,143 @@
+package cmpp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Query SP向ISMG查询某时间的业务统计情况，可以按总数或按业务代码查询
+type Query struct {
+	*MessageHeader        // 消息头，【12字节】
+	time           string // 时间YYYYMMDD(精确至日)【8字节】
+	queryType      uint8  // 查询类别，0：总数查询；1：按业务类型查询【1字节】
+	queryCode      string // 查询码，当Query_Type为0时，此项无效；当Query_Type为1时，此项填写业务类型Service_Id【10字节】
+	reserve        string // 保留【8字节】
+}
+
+// QueryCounters 查询应答中的统计数据
+type QueryCounters struct {
+	MtTlMsg uint32 // 从SP接收信息总数
+	MtTlUsr uint32 // 从SP接收用户总数
+	MtScs   uint32 // 成功转发数量
+	MtWt    uint32 // 待转发数量
+	MtFl    uint32 // 转发失败数量
+	MoScs   uint32 // 向SP成功送达数量
+	MoWt    uint32 // 向SP待送达数量
+	MoFl    uint32 // 向SP送达失败数量
+}
+
+type QueryResp struct {
+	*MessageHeader               // 消息头，【12字节】
+	time           string        // 时间YYYYMMDD(精确至日)【8字节】
+	queryType      uint8         // 查询类别【1字节】
+	queryCode      string        // 查询码【10字节】
+	counters       QueryCounters // 统计数据，各项均为【4字节】
+}
+
+const (
+	QueryLen     = HeadLength + 27
+	QueryRespLen = HeadLength + 51
+)
+
+// NewQuery 生成查询请求，serviceId为空时查询总数
+func NewQuery(day time.Time, serviceId string) *Query {
+	return Default().NewQuery(day, serviceId)
+}
+
+func (ctx *Context) NewQuery(day time.Time, serviceId string) *Query {
+	header := &MessageHeader{TotalLength: QueryLen, CommandId: CMPP_QUERY, SequenceId: uint32(ctx.Seq32.NextVal())}
+	q := &Query{MessageHeader: header}
+	q.time = day.Format("20060102")
+	if serviceId != "" {
+		q.queryType = 1
+		q.queryCode = serviceId
+	}
+	return q
+}
+
+func (q *Query) Encode() []byte {
+	frame := q.MessageHeader.Encode()
+	copy(frame[12:20], q.time)
+	frame[20] = q.queryType
+	copy(frame[21:31], q.queryCode)
+	copy(frame[31:39], q.reserve)
+	return frame
+}
+
+func (q *Query) Decode(header *MessageHeader, frame []byte, _ *Context) error {
+	if header == nil || header.CommandId != CMPP_QUERY || len(frame) < QueryLen-HeadLength {
+		return ErrorPacket
+	}
+	q.MessageHeader = header
+	q.time = TrimStr(frame[0:8])
+	q.queryType = frame[8]
+	q.queryCode = TrimStr(frame[9:19])
+	q.reserve = TrimStr(frame[19:27])
+	return nil
+}
+
+func (q *Query) ToResponse(_ uint32) interface{} {
+	header := &MessageHeader{TotalLength: QueryRespLen, CommandId: CMPP_QUERY_RESP, SequenceId: q.SequenceId}
+	return &QueryResp{MessageHeader: header, time: q.time, queryType: q.queryType, queryCode: q.queryCode}
+}
+
+func (q *Query) String() string {
+	return fmt.Sprintf("{ header: %s, time: %s, queryType: %d, queryCode: %s }", q.MessageHeader, q.time, q.queryType, q.queryCode)
+}
+
+func (q *Query) Time() string {
+	return q.time
+}
+
+func (q *Query) QueryType() uint8 {
+	return q.queryType
+}
+
+func (q *Query) QueryCode() string {
+	return q.queryCode
+}
+
+func (r *QueryResp) Encode() []byte {
+	frame := r.MessageHeader.Encode()
+	copy(frame[12:20], r.time)
+	frame[20] = r.queryType
+	copy(frame[21:31], r.queryCode)
+	index := 31
+	for _, v := range []uint32{r.counters.MtTlMsg, r.counters.MtTlUsr, r.counters.MtScs, r.counters.MtWt,
+		r.counters.MtFl, r.counters.MoScs, r.counters.MoWt, r.counters.MoFl} {
+		binary.BigEndian.PutUint32(frame[index:index+4], v)
+		index += 4
+	}
+	return frame
+}
+
+func (r *QueryResp) Decode(header *MessageHeader, frame []byte, _ *Context) error {
+	if header == nil || header.CommandId != CMPP_QUERY_RESP || len(frame) < QueryRespLen-HeadLength {
+		return ErrorPacket
+	}
+	r.MessageHeader = header
+	r.time = TrimStr(frame[0:8])
+	r.queryType = frame[8]
+	r.queryCode = TrimStr(frame[9:19])
+	index := 19
+	for _, v := range []*uint32{&r.counters.MtTlMsg, &r.counters.MtTlUsr, &r.counters.MtScs, &r.counters.MtWt,
+		&r.counters.MtFl, &r.counters.MoScs, &r.counters.MoWt, &r.counters.MoFl} {
+		*v = binary.BigEndian.Uint32(frame[index : index+4])
+		index += 4
+	}
+	return nil
+}
+
+func (r *QueryResp) String() string {
+	return fmt.Sprintf("{ header: %s, time: %s, queryType: %d, queryCode: %s, counters: %+v }",
+		r.MessageHeader, r.time, r.queryType, r.queryCode, r.counters)
+}
+
+func (r *QueryResp) SetCounters(c QueryCounters) {
+	r.counters = c
+}
+
+func (r *QueryResp) Counters() QueryCounters {
+	return r.counters
+}
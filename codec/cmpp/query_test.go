@@ -0,0 +1,60 @@
+package cmpp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery(t *testing.T) {
+	q := NewQuery(time.Now(), "MI0000")
+	data := q.Encode()
+	assert.Equal(t, QueryLen, len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	dec := &Query{}
+	assert.True(t, dec.Decode(h, data[HeadLength:], nil) == nil)
+	assert.Equal(t, time.Now().Format("20060102"), dec.Time())
+	assert.Equal(t, uint8(1), dec.QueryType())
+	assert.Equal(t, "MI0000", dec.QueryCode())
+	t.Logf("%s", dec)
+
+	resp := dec.ToResponse(0).(*QueryResp)
+	resp.SetCounters(QueryCounters{MtTlMsg: 10, MtTlUsr: 12, MtScs: 8, MtWt: 1, MtFl: 1, MoScs: 3, MoFl: 1})
+	data = resp.Encode()
+	assert.Equal(t, QueryRespLen, len(data))
+	_ = h.Decode(data)
+	respDec := &QueryResp{}
+	assert.True(t, respDec.Decode(h, data[HeadLength:], nil) == nil)
+	assert.Equal(t, q.SequenceId, respDec.SequenceId)
+	assert.Equal(t, resp.Counters(), respDec.Counters())
+	t.Logf("%s", respDec)
+
+	assert.Equal(t, uint8(0), NewQuery(time.Now(), "").queryType)
+}
+
+func TestCancel(t *testing.T) {
+	c := NewCancel(uint64(Seq64.NextVal()))
+	data := c.Encode()
+	assert.Equal(t, CancelLen, len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	dec := &Cancel{}
+	assert.True(t, dec.Decode(h, data[HeadLength:], nil) == nil)
+	assert.Equal(t, c.MsgId(), dec.MsgId())
+	t.Logf("%s", dec)
+
+	for code, want := range map[uint32]uint32{0: 0, 9: 1} {
+		resp := dec.ToResponse(code).(*CancelResp)
+		data = resp.Encode()
+		assert.Equal(t, int(resp.TotalLength), len(data))
+		_ = h.Decode(data)
+		respDec := &CancelResp{}
+		assert.True(t, respDec.Decode(h, data[HeadLength:], nil) == nil)
+		assert.Equal(t, want, respDec.SuccessId())
+		t.Logf("%s", respDec)
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 )
 
-var ReportSeq Sequence32
-
 type Report struct {
 	msgId          uint64 // 信息标识，SP提交短信(CMPP_SUBMIT)操作时，与SP相连的ISMG产生的 Msg_Id。【8字节】
 	stat           string // 发送短信的应答结果。【7字节】
@@ -17,8 +15,12 @@ type Report struct {
 }
 
 func NewReport(msgId uint64, destTerminalId string, submitTime string, doneTime string) *Report {
+	return Default().NewReport(msgId, destTerminalId, submitTime, doneTime)
+}
+
+func (ctx *Context) NewReport(msgId uint64, destTerminalId string, submitTime string, doneTime string) *Report {
 	report := &Report{msgId: msgId, submitTime: submitTime, doneTime: doneTime, destTerminalId: destTerminalId}
-	report.smscSequence = uint32(ReportSeq.NextVal())
+	report.smscSequence = uint32(ctx.ReportSeq.NextVal())
 	// 判断序号的时间戳部分
 	switch (report.smscSequence >> 14) % 100 {
 	case 99:
@@ -75,3 +77,28 @@ func (rt *Report) String() string {
 	return fmt.Sprintf("{ msgId: %d, stat: %s, submitTime: %s, doneTime: %s, destTerminalId: %s, smscSequence: %d }",
 		rt.msgId, rt.stat, rt.submitTime, rt.doneTime, rt.destTerminalId, rt.smscSequence)
 }
+
+func (rt *Report) MsgId() uint64 {
+	return rt.msgId
+}
+
+func (rt *Report) Stat() string {
+	return rt.stat
+}
+
+// SetStat 指定状态报告的结果，如超过有效期未下发的短信为 EXPIRED
+func (rt *Report) SetStat(stat string) {
+	rt.stat = stat
+}
+
+func (rt *Report) DestTerminalId() string {
+	return rt.destTerminalId
+}
+
+func (rt *Report) SubmitTime() string {
+	return rt.submitTime
+}
+
+func (rt *Report) DoneTime() string {
+	return rt.doneTime
+}
@@ -41,36 +41,33 @@ type Submit struct {
 	msgContent       string // 信息内容 【MsgLength字节】
 	msgBytes         []byte // 消息内容按照Msg_Fmt编码后的数据
 	linkID           string // 点播业务使用的LinkID，非点播类业务的MT流程不使用该字段 【20字节】
+	version          Version
+	ctx              *Context // 生成应答及状态报告使用的上下文
 }
 
 func NewSubmit(phones []string, content string, opts ...Option) (messages []*Submit) {
-	options := loadOptions(opts...)
-	baseLen := 138
-	if V3() {
-		baseLen = 163
-	}
-	header := &MessageHeader{TotalLength: uint32(baseLen), CommandId: CMPP_SUBMIT, SequenceId: uint32(Seq32.NextVal())}
-	mt := &Submit{MessageHeader: header}
+	return Default().NewSubmit(phones, content, opts...)
+}
 
-	setOptions(mt, options)
-	mt.msgFmt = MsgFmt(content)
+// NewSubmit 未指定的参数取自上下文的配置，未指定 MtVersion 时按上下文的版本编码
+func (ctx *Context) NewSubmit(phones []string, content string, opts ...Option) (messages []*Submit) {
+	options := ctx.loadOptions(opts...)
+	baseLen := submitBaseLen(options.Version)
+	header := &MessageHeader{TotalLength: uint32(baseLen), CommandId: CMPP_SUBMIT, SequenceId: uint32(ctx.Seq32.NextVal())}
+	mt := &Submit{MessageHeader: header, version: options.Version, ctx: ctx}
+
+	ctx.setOptions(mt, options)
+	mt.msgFmt = ctx.MsgFmt(content)
 
 	mt.destUsrTl = uint8(len(phones))
 	mt.destTerminalId = strings.Join(phones, ",")
-	idLen := 21
-	if V3() {
-		idLen = 32
-	}
-	termIds := make([]byte, idLen*int(mt.destUsrTl))
-	for i, p := range phones {
-		copy(termIds[i*idLen:(i+1)*idLen], p)
-	}
+	termIds := encodeTermIds(phones, options.Version)
 	mt.termIds = termIds
 
-	mt.msgSrc = Conf.GetString("source-addr")
+	mt.msgSrc = ctx.Config().SourceAddr
 
 	mt.msgContent = content
-	slices := MsgSlices(mt.msgFmt, content)
+	slices := ctx.MsgSlices(mt.msgFmt, content)
 
 	if len(slices) == 1 {
 		mt.pkTotal = 1
@@ -90,7 +87,7 @@ func NewSubmit(phones []string, content string, opts ...Option) (messages []*Sub
 			sub := &tmp
 			sub.MessageHeader = &tmpHead
 			if i != 0 {
-				sub.SequenceId = uint32(Seq32.NextVal())
+				sub.SequenceId = uint32(ctx.Seq32.NextVal())
 			}
 			sub.pkNumber = uint8(i + 1)
 			sub.msgLength = uint8(len(msgBytes))
@@ -103,6 +100,41 @@ func NewSubmit(phones []string, content string, opts ...Option) (messages []*Sub
 	}
 }
 
+// 不含号码及消息内容的报文长度
+func submitBaseLen(v Version) int {
+	if v.V3() {
+		return 163
+	}
+	return 138
+}
+
+// 3.0版号码为32字节，2.0版为21字节
+func encodeTermIds(phones []string, v Version) []byte {
+	idLen := 21
+	if v.V3() {
+		idLen = 32
+	}
+	termIds := make([]byte, idLen*len(phones))
+	for i, p := range phones {
+		copy(termIds[i*idLen:(i+1)*idLen], p)
+	}
+	return termIds
+}
+
+// SetVersion 按连接协商的版本调整报文格式，如网关应答的版本低于登录时请求的版本
+func (sub *Submit) SetVersion(v Version) {
+	if sub.version.V3() != v.V3() {
+		sub.termIds = encodeTermIds(sub.DestTerminalIds(), v)
+		sub.TotalLength = uint32(submitBaseLen(v) + len(sub.termIds) + len(sub.msgBytes))
+	}
+	sub.version = v
+}
+
+// Version 报文的协议版本
+func (sub *Submit) Version() Version {
+	return sub.version
+}
+
 func (sub *Submit) Encode() []byte {
 	frame := sub.MessageHeader.Encode()
 	frame[20] = sub.pkTotal
@@ -112,7 +144,7 @@ func (sub *Submit) Encode() []byte {
 	copy(frame[24:34], sub.serviceId)
 	frame[34] = sub.feeUsertype
 	index := 35
-	if V3() {
+	if sub.version.V3() {
 		copy(frame[index:index+32], sub.feeTerminalId)
 		index += 32
 		frame[index] = sub.feeTerminalType
@@ -143,7 +175,7 @@ func (sub *Submit) Encode() []byte {
 	index++
 	copy(frame[index:index+len(sub.termIds)], sub.termIds)
 	index += len(sub.termIds)
-	if V3() {
+	if sub.version.V3() {
 		frame[index] = sub.destTerminalType
 		index++
 	}
@@ -151,18 +183,21 @@ func (sub *Submit) Encode() []byte {
 	index++
 	copy(frame[index:index+len(sub.msgBytes)], sub.msgBytes)
 	index += len(sub.msgBytes)
-	if V3() {
+	if sub.version.V3() {
 		copy(frame[index:index+20], sub.linkID)
 	}
 	return frame
 }
 
-func (sub *Submit) Decode(header *MessageHeader, frame []byte) error {
+func (sub *Submit) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
+	v := orDefault(ctx).version()
+	sub.ctx = ctx
 	// check
 	if header == nil || header.CommandId != CMPP_SUBMIT || uint32(len(frame)) < (header.TotalLength-HeadLength) {
 		return ErrorPacket
 	}
 	sub.MessageHeader = header
+	sub.version = v
 	// msgId uint64
 	index := 8
 	sub.pkTotal = frame[index]
@@ -177,7 +212,7 @@ func (sub *Submit) Decode(header *MessageHeader, frame []byte) error {
 	index += 10
 	sub.feeUsertype = frame[index]
 	index++
-	if V3() {
+	if v.V3() {
 		sub.feeTerminalId = TrimStr(frame[index : index+32])
 		index += 32
 		sub.feeTerminalType = frame[index]
@@ -206,13 +241,19 @@ func (sub *Submit) Decode(header *MessageHeader, frame []byte) error {
 	index += 21
 	sub.destUsrTl = frame[index]
 	index++
-	l := int(sub.destUsrTl * 21)
-	if V3() {
-		l = int(sub.destUsrTl) << 5
+	idLen := 21
+	if v.V3() {
+		idLen = 32
+	}
+	l := int(sub.destUsrTl) * idLen
+	sub.termIds = frame[index : index+l]
+	phones := make([]string, sub.destUsrTl)
+	for i := range phones {
+		phones[i] = TrimStr(sub.termIds[i*idLen : (i+1)*idLen])
 	}
-	sub.destTerminalId = TrimStr(frame[index : index+l])
+	sub.destTerminalId = strings.Join(phones, ",")
 	index += l
-	if V3() {
+	if v.V3() {
 		sub.destTerminalType = frame[index]
 		index++
 	}
@@ -220,25 +261,20 @@ func (sub *Submit) Decode(header *MessageHeader, frame []byte) error {
 	index++
 	content := frame[index : index+int(sub.msgLength)]
 	sub.msgBytes = content
-	if content[0] == 0x05 && content[1] == 0x00 && content[2] == 0x03 {
-		content = content[6:]
-	}
-	if sub.msgFmt == 8 {
-		sub.msgContent = comm.Ucs2Decode(content)
-	} else {
-		sub.msgContent = TrimStr(content)
-	}
+	sub.msgContent = orDefault(ctx).decodeUserData(sub.msgFmt, sub.tpUdhi, content)
 	index += int(sub.msgLength)
-	if V3() {
+	if v.V3() {
 		sub.linkID = TrimStr(frame[index : index+20])
 	}
 	return nil
 }
 
+// SubmitResp 3.0版Result为4字节，2.0版为1字节
 type SubmitResp struct {
 	*MessageHeader
-	msgId  uint64
-	result uint32
+	msgId   uint64
+	result  uint32
+	version Version
 }
 
 func (sub *Submit) ToResponse(result uint32) interface{} {
@@ -247,38 +283,53 @@ func (sub *Submit) ToResponse(result uint32) interface{} {
 	resp.MessageHeader = &header
 	resp.CommandId = CMPP_SUBMIT_RESP
 	resp.TotalLength = HeadLength + 9
-	if V3() {
+	if sub.version.V3() {
 		resp.TotalLength = HeadLength + 12
 	}
+	resp.version = sub.version
 	if result == 0 {
-		resp.msgId = uint64(Seq64.NextVal())
+		resp.msgId = uint64(orDefault(sub.ctx).Seq64.NextVal())
 	}
 	resp.result = result
 	return resp
 }
 
+// NewSubmitResp 未解码Submit时直接应答，如接收窗口已满时的流量控制，按上下文协商的版本编码
+func (ctx *Context) NewSubmitResp(header *MessageHeader, result uint32) *SubmitResp {
+	sub := &Submit{MessageHeader: header, version: orDefault(ctx).version(), ctx: ctx}
+	return sub.ToResponse(result).(*SubmitResp)
+}
+
 func (sub *Submit) ToDeliveryReport(msgId uint64) *Delivery {
+	ctx := orDefault(sub.ctx)
 	d := Delivery{}
 
 	head := *sub.MessageHeader
 	d.MessageHeader = &head
 	d.TotalLength = 145
-	if V3() {
+	if sub.version.V3() {
 		d.TotalLength = 169
 	}
+	d.version = sub.version
 	d.CommandId = CMPP_DELIVER
-	d.SequenceId = uint32(Seq32.NextVal())
+	d.SequenceId = uint32(ctx.Seq32.NextVal())
 
+	d.msgId = uint64(ctx.Seq64.NextVal())
 	d.registeredDelivery = 1
 	d.msgLength = 60
 	d.destId = sub.srcId
 	d.serviceId = sub.serviceId
-	d.srcTerminalId = sub.destTerminalId
+	// 群发时状态报告取第一个号码
+	phone := sub.destTerminalId
+	if phones := sub.DestTerminalIds(); len(phones) > 0 {
+		phone = phones[0]
+	}
+	d.srcTerminalId = phone
 	d.srcTerminalType = sub.destTerminalType
 
 	subTime := time.Now().Format("0601021504")
 	doneTime := time.Now().Add(10 * time.Second).Format("0601021504")
-	report := NewReport(msgId, sub.destTerminalId, subTime, doneTime)
+	report := ctx.NewReport(msgId, phone, subTime, doneTime)
 	d.report = report
 
 	return &d
@@ -287,21 +338,23 @@ func (sub *Submit) ToDeliveryReport(msgId uint64) *Delivery {
 func (resp *SubmitResp) Encode() []byte {
 	frame := resp.MessageHeader.Encode()
 	binary.BigEndian.PutUint64(frame[12:20], resp.msgId)
-	if V3() {
+	if resp.version.V3() {
 		binary.BigEndian.PutUint32(frame[20:24], resp.result)
 	} else {
 		frame[20] = byte(resp.result)
 	}
 	return frame
 }
-func (resp *SubmitResp) Decode(header *MessageHeader, frame []byte) error {
+func (resp *SubmitResp) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
+	v := orDefault(ctx).version()
 	// check
 	if header == nil || header.CommandId != CMPP_SUBMIT_RESP || uint32(len(frame)) < (header.TotalLength-HeadLength) {
 		return ErrorPacket
 	}
 	resp.MessageHeader = header
+	resp.version = v
 	resp.msgId = binary.BigEndian.Uint64(frame[0:8])
-	if V3() {
+	if v.V3() {
 		resp.result = binary.BigEndian.Uint32(frame[8:12])
 	} else {
 		resp.result = uint32(frame[8])
@@ -318,64 +371,101 @@ func (resp *SubmitResp) Result() uint32 {
 }
 
 func MsgSlices(fmt uint8, content string) (slices [][]byte) {
-	var msgBytes []byte
 	// 含中文
 	if fmt == 8 {
-		msgBytes = comm.Ucs2Encode(content)
+		msgBytes := comm.Ucs2Encode(content)
 		slices = comm.ToTPUDHISlices(msgBytes, 140)
 	} else {
-		// 纯英文
-		msgBytes = []byte(content)
-		slices = comm.ToTPUDHISlices(msgBytes, 160)
+		// 纯英文，Msg_Fmt为0时按ASCII原样发送
+		slices = comm.ToTPUDHISlices([]byte(content), 160)
 	}
 	return
 }
 
 // MsgFmt 通过消息内容判断，设置编码格式。
-// 如果是纯拉丁字符采用0：ASCII串
-// 如果含多字节字符，这采用8：UCS-2编码
+// 如果是纯ASCII字符采用0：ASCII串
+// 否则采用8：UCS-2编码。CMPP没有表示GSM 7-bit的Msg_Fmt，€、é等字符也使用UCS-2，
+// 与网关约定了GSM 7-bit的Msg_Fmt时可配置 gsm7-msg-fmt，见 Context.MsgFmt
 func MsgFmt(content string) uint8 {
-	if len(content) < 2 {
+	if len(content) == len([]rune(content)) {
 		return 0
 	}
-	all7bits := len(content) == len([]rune(content))
-	if all7bits {
-		return 0
-	} else {
-		return 8
+	return 8
+}
+
+// MsgFmt 同 MsgFmt，配置了 gsm7-msg-fmt 且内容可用GSM 7-bit默认字母表(含扩展表)表示时，
+// 以该格式代替UCS-2，纯ASCII内容仍采用0
+func (ctx *Context) MsgFmt(content string) uint8 {
+	msgFmt := MsgFmt(content)
+	if g := ctx.gsm7MsgFmt(); msgFmt == 8 && g != 0 && comm.IsGsm7(content) {
+		return g
+	}
+	return msgFmt
+}
+
+// MsgSlices 同 MsgSlices，gsm7-msg-fmt 格式的内容按septet压缩，单条160个，长短信每片153个
+func (ctx *Context) MsgSlices(msgFmt uint8, content string) [][]byte {
+	if ctx.isGsm7(msgFmt) {
+		septets, _ := comm.Gsm7Encode(content)
+		return comm.ToGsm7Slices(septets, true)
 	}
+	return MsgSlices(msgFmt, content)
+}
+
+// 配置的GSM 7-bit的Msg_Fmt，为0时不启用
+func (ctx *Context) gsm7MsgFmt() uint8 {
+	return uint8(ctx.Config().Gsm7MsgFmt)
+}
+
+func (ctx *Context) isGsm7(msgFmt uint8) bool {
+	g := ctx.gsm7MsgFmt()
+	return g != 0 && msgFmt == g
+}
+
+// 按编码格式解码用户数据，udhi为1时跳过UDH
+func (ctx *Context) decodeUserData(msgFmt uint8, udhi uint8, ud []byte) string {
+	udhLen := 0
+	if udhi == 1 && len(ud) > 0 && int(ud[0]) < len(ud) {
+		udhLen = int(ud[0]) + 1
+	}
+	if ctx.isGsm7(msgFmt) {
+		// GSM 7-bit压缩时UDH之后有填充位，需从完整的用户数据解压
+		return comm.Gsm7Decode(comm.Gsm7UnpackUserData(ud, udhLen))
+	}
+	return decodeContent(msgFmt, ud[udhLen:])
 }
 
 // 设置可选项
-func setOptions(sub *Submit, opts *MtOptions) {
+func (ctx *Context) setOptions(sub *Submit, opts *MtOptions) {
+	conf := ctx.Config()
 	if opts.FeeUsertype != uint8(0xf) {
 		sub.feeUsertype = opts.FeeUsertype
 	} else {
-		sub.feeUsertype = byte(Conf.GetInt("fee-user-type"))
+		sub.feeUsertype = byte(conf.FeeUserType)
 	}
 
 	if opts.MsgLevel != uint8(0xf) {
 		sub.msgLevel = opts.MsgLevel
 	} else {
-		sub.msgLevel = byte(Conf.GetInt("default-msg-level"))
+		sub.msgLevel = byte(conf.MsgLevel)
 	}
 
 	if opts.RegisteredDel != uint8(0xf) {
 		sub.registeredDel = opts.RegisteredDel
 	} else {
-		sub.registeredDel = byte(Conf.GetInt("need-report"))
+		sub.registeredDel = byte(conf.RegisteredDel)
 	}
 
 	if opts.FeeTerminalType != uint8(0xf) {
 		sub.feeTerminalType = opts.FeeTerminalType
 	} else {
-		sub.feeTerminalType = byte(Conf.GetInt("fee-terminal-type"))
+		sub.feeTerminalType = byte(conf.FeeTerminalType)
 	}
 
 	if opts.FeeType != "" {
 		sub.feeType = opts.FeeType
 	} else {
-		sub.feeType = Conf.GetString("fee-type")
+		sub.feeType = conf.FeeType
 	}
 
 	if opts.AtTime != "" {
@@ -385,39 +475,38 @@ func setOptions(sub *Submit, opts *MtOptions) {
 	if opts.ValidTime != "" {
 		sub.validTime = opts.ValidTime
 	} else {
-		t := time.Now().Add(Conf.GetDuration("default-valid-duration"))
-		s := t.Format("060102150405")
-		sub.validTime = s + "032+"
+		t := time.Now().Add(conf.ValidDuration)
+		sub.validTime = comm.FormatTime(t)
 	}
 
 	if opts.FeeCode != "" {
 		sub.feeCode = opts.FeeCode
 	} else {
-		sub.feeCode = Conf.GetString("fee-code")
+		sub.feeCode = conf.FeeCode
 	}
 
 	if opts.FeeTerminalId != "" {
 		sub.feeTerminalId = opts.FeeTerminalId
 	} else {
-		sub.feeTerminalId = Conf.GetString("fee-terminal-id")
+		sub.feeTerminalId = conf.FeeTerminalId
 	}
 
 	if opts.SrcId != "" {
 		sub.srcId = opts.SrcId
 	} else {
-		sub.srcId = Conf.GetString("sms-display-no")
+		sub.srcId = conf.SrcId
 	}
 
 	if opts.ServiceId != "" {
 		sub.serviceId = opts.ServiceId
 	} else {
-		sub.serviceId = Conf.GetString("service-id")
+		sub.serviceId = conf.ServiceId
 	}
 
 	if opts.LinkID != "" {
 		sub.linkID = opts.LinkID
 	} else {
-		sub.linkID = Conf.GetString("link-id")
+		sub.linkID = conf.LinkID
 	}
 }
 
@@ -457,3 +546,32 @@ var SubmitResultMap = map[uint32]string{
 	12: "Fee_terminal_Id 错误",
 	13: "Dest_terminal_Id 错误",
 }
+
+func (sub *Submit) ServiceId() string {
+	return sub.serviceId
+}
+
+// DestTerminalIds 接收短信的号码列表
+func (sub *Submit) DestTerminalIds() []string {
+	return strings.FieldsFunc(sub.destTerminalId, func(r rune) bool { return r == ',' || r == 0 })
+}
+
+func (sub *Submit) MsgContent() string {
+	return sub.msgContent
+}
+
+func (sub *Submit) SrcId() string {
+	return sub.srcId
+}
+
+func (sub *Submit) AtTime() string {
+	return sub.atTime
+}
+
+func (sub *Submit) ValidTime() string {
+	return sub.validTime
+}
+
+func (sub *Submit) DestUsrTl() uint8 {
+	return sub.destUsrTl
+}
@@ -2,12 +2,14 @@ package cmpp
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
 func TestEncode(t *testing.T) {
@@ -127,7 +129,7 @@ func TestSubmit_Encode(t *testing.T) {
 			return
 		}
 		decMt := &Submit{}
-		err = decMt.Decode(header, enc[12:])
+		err = decMt.Decode(header, enc[12:], Default().WithVersion(mt.Version()))
 		if err != nil {
 			return
 		}
@@ -137,6 +139,124 @@ func TestSubmit_Encode(t *testing.T) {
 	}
 }
 
+func TestSubmit_Gsm7(t *testing.T) {
+	ctx, err := NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{"version": 0x30, "gsm7-msg-fmt": 17}))
+	assert.Nil(t, err)
+	phones := []string{"17011112222"}
+
+	// 纯ASCII仍为0，不可用GSM 7-bit表示的内容仍为UCS-2
+	assert.Equal(t, uint8(0), ctx.MsgFmt("hello"))
+	assert.Equal(t, uint8(8), ctx.MsgFmt("价格"))
+	content := "Price: 5€ [discount] {ok} café"
+	assert.Equal(t, uint8(17), ctx.MsgFmt(content))
+
+	mts := ctx.NewSubmit(phones, content)
+	assert.Equal(t, 1, len(mts))
+	assert.Equal(t, uint8(17), mts[0].msgFmt)
+	dec := encodeDecode(t, ctx, mts[0])
+	assert.Equal(t, content, dec.MsgContent())
+
+	// 160个septet压缩为140字节，不拆分
+	mts = ctx.NewSubmit(phones, strings.Repeat("é", 160))
+	assert.Equal(t, 1, len(mts))
+	assert.Equal(t, uint8(140), mts[0].msgLength)
+
+	// 长短信每片153个septet，接收方按相同配置组装
+	long := strings.Repeat("€uro ", 60)
+	mts = ctx.NewSubmit(phones, long)
+	assert.Equal(t, 3, len(mts))
+	r := comm.NewReassembler(time.Minute)
+	for i, mt := range mts {
+		assert.True(t, mt.msgLength <= 140)
+		dec := encodeDecode(t, ctx, mt)
+		d := ctx.NewDelivery("17011112222", "", "", "")
+		d.tpUdhi, d.msgFmt, d.msgBytes = dec.tpUdhi, dec.msgFmt, dec.msgBytes
+		ok := d.Reassemble(r)
+		assert.Equal(t, i == len(mts)-1, ok)
+		if ok {
+			assert.Equal(t, long, d.MsgContent())
+		}
+	}
+
+	// 未配置时€、é使用UCS-2
+	mts = NewSubmit(phones, content)
+	assert.Equal(t, uint8(8), mts[0].msgFmt)
+}
+
+func encodeDecode(t *testing.T, ctx *Context, mt *Submit) *Submit {
+	enc := mt.Encode()
+	header := &MessageHeader{}
+	assert.Nil(t, header.Decode(enc))
+	dec := &Submit{}
+	assert.Nil(t, dec.Decode(header, enc[12:], ctx))
+	assert.Equal(t, enc, dec.Encode())
+	return dec
+}
+
+func TestSubmit_Ascii(t *testing.T) {
+	phones := []string{"17011112222"}
+	// Msg_Fmt为0时按ASCII原样发送，@、$、_ 等不按GSM 7-bit转换
+	content := "Price: $5 [discount] @shop_01 {ok} ~|^\\"
+	assert.Equal(t, uint8(0), MsgFmt(content))
+	assert.Equal(t, []byte(content), MsgSlices(0, content)[0])
+	// CMPP没有GSM 7-bit的编码格式，€、é使用UCS-2
+	assert.Equal(t, uint8(8), MsgFmt("5€"))
+	assert.Equal(t, uint8(8), MsgFmt("café"))
+	assert.Equal(t, uint8(8), MsgFmt("价格"))
+
+	mts := NewSubmit(phones, content)
+	assert.Equal(t, 1, len(mts))
+	testSubmitDecode(t, mts[0], content)
+
+	// 200个字符，拆分为154+46
+	long := strings.Repeat("0123456789", 20)
+	mts = NewSubmit(phones, long)
+	assert.Equal(t, 2, len(mts))
+	assert.Equal(t, uint8(160), mts[0].msgLength)
+	testSubmitDecode(t, mts[0], long[:154])
+	testSubmitDecode(t, mts[1], long[154:])
+}
+
+func testSubmitDecode(t *testing.T, mt *Submit, content string) {
+	enc := mt.Encode()
+	header := &MessageHeader{}
+	assert.True(t, header.Decode(enc[:12]) == nil)
+	decMt := &Submit{}
+	assert.True(t, decMt.Decode(header, enc[12:], Default().WithVersion(mt.Version())) == nil)
+	assert.Equal(t, uint8(0), decMt.msgFmt)
+	assert.Equal(t, content, decMt.msgContent)
+	// 解码后重新编码与原报文一致
+	assert.Equal(t, enc, decMt.Encode())
+}
+
+func TestSubmit_Version(t *testing.T) {
+	phones := []string{"17011112222", "17500002222"}
+	for _, v := range []Version{V20, V30} {
+		mt := NewSubmit(phones, "hello world", MtVersion(v))[0]
+		enc := mt.Encode()
+		assert.Equal(t, submitBaseLen(v)+len(phones)*map[Version]int{V20: 21, V30: 32}[v]+11, len(enc))
+		header := &MessageHeader{}
+		assert.Nil(t, header.Decode(enc[:12]))
+		decMt := &Submit{}
+		assert.Nil(t, decMt.Decode(header, enc[12:], Default().WithVersion(v)))
+		assert.Equal(t, phones, decMt.DestTerminalIds())
+		assert.Equal(t, "hello world", decMt.MsgContent())
+		assert.Equal(t, enc, decMt.Encode())
+
+		resp := decMt.ToResponse(0).(*SubmitResp)
+		assert.Equal(t, v.V3(), len(resp.Encode()) == HeadLength+12)
+		assert.Equal(t, v.V3(), len(decMt.ToDeliveryReport(1).Encode()) == 169)
+	}
+
+	// 网关应答的版本低于请求的版本时转换格式
+	mt := NewSubmit(phones, "hello world", MtVersion(V30))[0]
+	mt.SetVersion(V20)
+	want := NewSubmit(phones, "hello world", MtVersion(V20))[0]
+	assert.Equal(t, want.TotalLength, mt.TotalLength)
+	assert.Equal(t, want.termIds, mt.termIds)
+	assert.Equal(t, int(mt.TotalLength), len(mt.Encode()))
+}
+
 const Poem = "将进酒\n" +
 	"君不见黄河之水天上来，奔流到海不复回。\n" +
 	"君不见高堂明镜悲白发，朝如青丝暮成雪。\n" +
@@ -1,9 +1,13 @@
 package cmpp
 
 func NewTerminate() *MessageHeader {
+	return Default().NewTerminate()
+}
+
+func (ctx *Context) NewTerminate() *MessageHeader {
 	t := MessageHeader{}
 	t.TotalLength = 12
-	t.SequenceId = uint32(Seq32.NextVal())
+	t.SequenceId = uint32(ctx.Seq32.NextVal())
 	t.CommandId = CMPP_TERMINATE
 	return &t
 }
@@ -0,0 +1,81 @@
+package sgip
+
+import (
+	"fmt"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+type Bind struct {
+	*MessageHeader        // 【20字节】消息头
+	loginType      byte   // 【1字节】登录类型，1：SP向SMG建立的连接，用于发送命令；2：SMG向SP建立的连接，用于发送命令
+	loginName      string // 【16字节】服务器端给客户端分配的登录名
+	loginPassword  string // 【16字节】服务器端和Login Name对应的密码
+	reserve        string // 【8字节】保留，扩展用
+}
+
+const BindLen = HeadLength + 41
+
+func NewBind(loginType byte) *Bind {
+	header := &MessageHeader{MessageLength: BindLen, CommandId: SGIP_BIND, SequenceNumber: Seq96.NextVal()}
+	bind := &Bind{MessageHeader: header}
+	bind.loginType = loginType
+	bind.loginName = Conf.GetString("login-name")
+	bind.loginPassword = Conf.GetString("login-password")
+	return bind
+}
+
+func (b *Bind) Encode() []byte {
+	frame := b.MessageHeader.Encode()
+	if len(frame) == BindLen && b.MessageLength == BindLen {
+		index := 20
+		index = comm.CopyByte(frame, b.loginType, index)
+		index = comm.CopyStr(frame, b.loginName, index, 16)
+		index = comm.CopyStr(frame, b.loginPassword, index, 16)
+		comm.CopyStr(frame, b.reserve, index, 8)
+	}
+	return frame
+}
+
+func (b *Bind) Decode(header *MessageHeader, frame []byte) error {
+	// check
+	if header == nil || header.CommandId != SGIP_BIND || len(frame) < (BindLen-HeadLength) {
+		return ErrorPacket
+	}
+	b.MessageHeader = header
+	b.loginType = frame[0]
+	b.loginName = comm.TrimStr(frame[1:17])
+	b.loginPassword = comm.TrimStr(frame[17:33])
+	b.reserve = comm.TrimStr(frame[33:41])
+	return nil
+}
+
+func (b *Bind) String() string {
+	return fmt.Sprintf("{ header: %s, loginType: %d, loginName: %s, loginPassword: ******, reserve: %s }",
+		b.MessageHeader, b.loginType, b.loginName, b.reserve)
+}
+
+func (b *Bind) Check() uint32 {
+	if b.loginType != 1 && b.loginType != 2 {
+		return 4
+	}
+	// 配置不做校验或校验通过时返回0
+	if !Conf.GetBool("auth-check") {
+		return 0
+	}
+	if b.loginName == Conf.GetString("login-name") && b.loginPassword == Conf.GetString("login-password") {
+		return 0
+	}
+	return 1
+}
+
+func (b *Bind) ToResponse(code uint32) interface{} {
+	if code == 0 {
+		code = b.Check()
+	}
+	return newResp(b.MessageHeader, SGIP_BIND_RESP, code)
+}
+
+func (b *Bind) LoginName() string {
+	return b.loginName
+}
@@ -0,0 +1,38 @@
+package sgip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBind(t *testing.T) {
+	bind := NewBind(1)
+	t.Logf("bind    : %s", bind)
+	data := bind.Encode()
+	assert.Equal(t, BindLen, len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	bind2 := &Bind{}
+	err := bind2.Decode(h, data[HeadLength:])
+	assert.True(t, err == nil)
+	assert.Equal(t, Conf.GetString("login-name"), bind2.LoginName())
+	assert.Equal(t, uint32(0), bind2.Check())
+	t.Logf("bindDec : %s", bind2)
+
+	resp := bind2.ToResponse(0).(*Resp)
+	data = resp.Encode()
+	assert.Equal(t, RespLen, len(data))
+	_ = h.Decode(data)
+	resp2 := &Resp{}
+	err = resp2.Decode(h, data[HeadLength:])
+	assert.True(t, err == nil)
+	assert.Equal(t, SGIP_BIND_RESP, resp2.CommandId)
+	assert.Equal(t, bind.SequenceNumber, resp2.SequenceNumber)
+	assert.Equal(t, uint32(0), resp2.Result())
+	t.Logf("respDec : %s", resp2)
+
+	bind2.loginType = 9
+	assert.Equal(t, uint32(4), bind2.ToResponse(0).(*Resp).Result())
+}
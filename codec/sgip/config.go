@@ -0,0 +1,47 @@
+package sgip
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+var log = logging.GetDefaultLogger()
+var ErrorPacket = errors.New("error packet")
+var Conf yml_config.YmlConfig
+var Seq96 Sequence96
+
+// Config 配置文件中的参数，各参数的含义见 config/sgip.yaml。
+// 报文编解码仍通过 Conf 按名称读取，此处列出各参数的类型，供网关注册同名的命令行参数，见 yml_config.NewOverrides
+type Config struct {
+	// 网关参数
+	LoginName         string `mapstructure:"login-name"`
+	LoginPassword     string `mapstructure:"login-password"`
+	AuthCheck         bool   `mapstructure:"auth-check"`
+	NodeId            int64  `mapstructure:"node-id"`
+	CorpId            string `mapstructure:"corp-id"`
+	MaxCons           int    `mapstructure:"max-cons"`
+	ReceiveWindowSize int    `mapstructure:"receive-window-size"`
+	MaxPoolSize       int    `mapstructure:"max-pool-size"`
+
+	// MT消息相关
+	SmsDisplayNo         string        `mapstructure:"sms-display-no"`
+	ChargeNumber         string        `mapstructure:"charge-number"`
+	ServiceType          string        `mapstructure:"service-type"`
+	FeeType              int           `mapstructure:"fee-type"`
+	FeeValue             string        `mapstructure:"fee-value"`
+	GivenValue           string        `mapstructure:"given-value"`
+	AgentFlag            int           `mapstructure:"agent-flag"`
+	MorelatetoMTFlag     int           `mapstructure:"morelateto-mt-flag"`
+	Priority             int           `mapstructure:"priority"`
+	ReportFlag           int           `mapstructure:"report-flag"`
+	DefaultValidDuration time.Duration `mapstructure:"default-valid-duration"`
+
+	// 模拟网关相关参数
+	SuccessRate     float64 `mapstructure:"success-rate"`
+	MinSubmitRespMs int     `mapstructure:"min-submit-resp-ms"`
+	MaxSubmitRespMs int     `mapstructure:"max-submit-resp-ms"`
+	FixReportRespMs int     `mapstructure:"fix-report-resp-ms"`
+}
@@ -0,0 +1,108 @@
+package sgip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+// Deliver 上行短信，不支持长短信
+type Deliver struct {
+	*MessageHeader        // 【20字节】消息头
+	userNumber     string // 【21字节】发送短消息的用户手机号，手机号码前加“86”国别标志
+	spNumber       string // 【21字节】SP的接入号码
+	tpPid          byte   // 【1字节】GSM协议类型
+	tpUdhi         byte   // 【1字节】GSM协议类型
+	messageCoding  byte   // 【1字节】短消息的编码格式
+	messageLength  uint32 // 【4字节】短消息的长度
+	messageContent string // 【MessageLength字节】短消息的内容
+	msgBytes       []byte // 消息内容按照MessageCoding编码后的数据
+	reserve        string // 【8字节】保留，扩展用
+}
+
+const MoBaseLen = HeadLength + 57
+
+func NewDeliver(userNumber string, content string, spNumber string) *Deliver {
+	header := &MessageHeader{MessageLength: MoBaseLen, CommandId: SGIP_DELIVER, SequenceNumber: Seq96.NextVal()}
+	dlv := &Deliver{MessageHeader: header}
+	dlv.userNumber = userNumber
+	dlv.spNumber = Conf.GetString("sms-display-no") + spNumber
+	dlv.messageCoding = MsgCoding(content)
+	// 上行不支持长短信，只取第一片的内容
+	rs := []rune(content)
+	if dlv.messageCoding == 8 && len(rs) > 70 {
+		content = string(rs[:70])
+	} else if dlv.messageCoding == 0 && len(content) > 160 {
+		content = content[:160]
+	}
+	dlv.messageContent = content
+	dlv.msgBytes = MsgSlices(dlv.messageCoding, content)[0]
+	dlv.messageLength = uint32(len(dlv.msgBytes))
+	dlv.MessageLength = MoBaseLen + dlv.messageLength
+	return dlv
+}
+
+func (d *Deliver) Encode() []byte {
+	frame := d.MessageHeader.Encode()
+	index := 20
+	index = comm.CopyStr(frame, d.userNumber, index, 21)
+	index = comm.CopyStr(frame, d.spNumber, index, 21)
+	index = comm.CopyByte(frame, d.tpPid, index)
+	index = comm.CopyByte(frame, d.tpUdhi, index)
+	index = comm.CopyByte(frame, d.messageCoding, index)
+	binary.BigEndian.PutUint32(frame[index:index+4], d.messageLength)
+	index += 4
+	copy(frame[index:index+int(d.messageLength)], d.msgBytes)
+	index += int(d.messageLength)
+	comm.CopyStr(frame, d.reserve, index, 8)
+	return frame
+}
+
+func (d *Deliver) Decode(header *MessageHeader, frame []byte) error {
+	// check
+	if header == nil || header.CommandId != SGIP_DELIVER || len(frame) < MoBaseLen-HeadLength ||
+		uint32(len(frame)) < (header.MessageLength-HeadLength) {
+		return ErrorPacket
+	}
+	d.MessageHeader = header
+	d.userNumber = comm.TrimStr(frame[0:21])
+	d.spNumber = comm.TrimStr(frame[21:42])
+	d.tpPid = frame[42]
+	d.tpUdhi = frame[43]
+	d.messageCoding = frame[44]
+	d.messageLength = binary.BigEndian.Uint32(frame[45:49])
+	index := 49
+	if len(frame) < index+int(d.messageLength)+8 {
+		return ErrorPacket
+	}
+	d.msgBytes = frame[index : index+int(d.messageLength)]
+	d.messageContent = MsgContent(d.messageCoding, d.tpUdhi, d.msgBytes)
+	index += int(d.messageLength)
+	d.reserve = comm.TrimStr(frame[index : index+8])
+	return nil
+}
+
+func (d *Deliver) ToResponse(code uint32) interface{} {
+	return newResp(d.MessageHeader, SGIP_DELIVER_RESP, code)
+}
+
+func (d *Deliver) String() string {
+	return fmt.Sprintf("{ header: %s, userNumber: %s, spNumber: %s, tpPid: %d, tpUdhi: %d, "+
+		"messageCoding: %d, messageLength: %d, messageContent: %s }",
+		d.MessageHeader, d.userNumber, d.spNumber, d.tpPid, d.tpUdhi,
+		d.messageCoding, d.messageLength, strings.ReplaceAll(d.messageContent, "\n", " "))
+}
+
+func (d *Deliver) UserNumber() string {
+	return d.userNumber
+}
+
+func (d *Deliver) SpNumber() string {
+	return d.spNumber
+}
+
+func (d *Deliver) MessageContent() string {
+	return d.messageContent
+}
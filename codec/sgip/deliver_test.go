@@ -0,0 +1,50 @@
+package sgip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliver(t *testing.T) {
+	cases := []string{"TD", "hello world", "你好，世界。 hello world", Poem}
+	for _, msg := range cases {
+		dlv := NewDeliver("8613700001111", msg, "01")
+		t.Logf("%s", dlv)
+		data := dlv.Encode()
+		assert.Equal(t, int(dlv.MessageLength), len(data))
+
+		h := &MessageHeader{}
+		_ = h.Decode(data)
+		dec := &Deliver{}
+		err := dec.Decode(h, data[HeadLength:])
+		assert.True(t, err == nil)
+		assert.Equal(t, dlv.MessageContent(), dec.MessageContent())
+		assert.Equal(t, Conf.GetString("sms-display-no")+"01", dec.SpNumber())
+		assert.Equal(t, "8613700001111", dec.UserNumber())
+
+		resp := dec.ToResponse(0).(*Resp)
+		assert.Equal(t, SGIP_DELIVER_RESP, resp.CommandId)
+	}
+}
+
+func TestReport(t *testing.T) {
+	sub := NewSubmit([]string{"8617600001111"}, "hello world")[0]
+	rpt := sub.ToReport("8617600001111")
+	t.Logf("%s", rpt)
+	data := rpt.Encode()
+	assert.Equal(t, ReportLen, len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	dec := &Report{}
+	err := dec.Decode(h, data[HeadLength:])
+	assert.True(t, err == nil)
+	assert.Equal(t, sub.SequenceNumber, dec.SubmitSequenceNumber())
+	assert.Equal(t, rpt.State(), dec.State())
+	assert.Equal(t, data, dec.Encode())
+
+	resp := dec.ToResponse(0).(*Resp)
+	assert.Equal(t, SGIP_REPORT_RESP, resp.CommandId)
+	assert.Equal(t, rpt.SequenceNumber, resp.SequenceNumber)
+}
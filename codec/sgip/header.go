@@ -0,0 +1,132 @@
+package sgip
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type MessageHeader struct {
+	MessageLength  uint32    // 消息的总长度(字节)
+	CommandId      uint32    // 命令ID
+	SequenceNumber [3]uint32 // 序列号：源节点编号、时间(MMDDHHMMSS)、序号
+}
+
+func (header *MessageHeader) Encode() []byte {
+	if header.MessageLength < HeadLength {
+		header.MessageLength = HeadLength
+	}
+	frame := make([]byte, header.MessageLength)
+	binary.BigEndian.PutUint32(frame[0:4], header.MessageLength)
+	binary.BigEndian.PutUint32(frame[4:8], header.CommandId)
+	binary.BigEndian.PutUint32(frame[8:12], header.SequenceNumber[0])
+	binary.BigEndian.PutUint32(frame[12:16], header.SequenceNumber[1])
+	binary.BigEndian.PutUint32(frame[16:20], header.SequenceNumber[2])
+	return frame
+}
+
+func (header *MessageHeader) Decode(frame []byte) error {
+	if len(frame) < HeadLength {
+		return ErrorPacket
+	}
+	header.MessageLength = binary.BigEndian.Uint32(frame[0:4])
+	header.CommandId = binary.BigEndian.Uint32(frame[4:8])
+	header.SequenceNumber[0] = binary.BigEndian.Uint32(frame[8:12])
+	header.SequenceNumber[1] = binary.BigEndian.Uint32(frame[12:16])
+	header.SequenceNumber[2] = binary.BigEndian.Uint32(frame[16:20])
+	return nil
+}
+
+func (header *MessageHeader) String() string {
+	return fmt.Sprintf("{ MessageLength: %d, CommandId: %s, SequenceNumber: %s }",
+		header.MessageLength, CommandMap[header.CommandId], SequenceString(header.SequenceNumber))
+}
+
+// SequenceString 序列号的字符串形式，如：3020012345:1018103015:1
+func SequenceString(seq [3]uint32) string {
+	return fmt.Sprintf("%d:%010d:%d", seq[0], seq[1], seq[2])
+}
+
+const (
+	HeadLength        = 20                 // 报文头长度
+	SGIP_BIND         = uint32(0x00000001) // 建立连接
+	SGIP_BIND_RESP    = uint32(0x80000001) // 建立连接应答
+	SGIP_UNBIND       = uint32(0x00000002) // 断开连接
+	SGIP_UNBIND_RESP  = uint32(0x80000002) // 断开连接应答
+	SGIP_SUBMIT       = uint32(0x00000003) // 提交短信
+	SGIP_SUBMIT_RESP  = uint32(0x80000003) // 提交短信应答
+	SGIP_DELIVER      = uint32(0x00000004) // 上行短信
+	SGIP_DELIVER_RESP = uint32(0x80000004) // 上行短信应答
+	SGIP_REPORT       = uint32(0x00000005) // 状态报告
+	SGIP_REPORT_RESP  = uint32(0x80000005) // 状态报告应答
+	// SGIP_ADDSP                = uint32(0x00000006)
+	// SGIP_ADDSP_RESP           = uint32(0x80000006)
+	// SGIP_MODIFYSP             = uint32(0x00000007)
+	// SGIP_MODIFYSP_RESP        = uint32(0x80000007)
+	// SGIP_DELETESP             = uint32(0x00000008)
+	// SGIP_DELETESP_RESP        = uint32(0x80000008)
+	// SGIP_QUERYROUTE           = uint32(0x00000009)
+	// SGIP_QUERYROUTE_RESP      = uint32(0x80000009)
+	// SGIP_ADDTELESEG           = uint32(0x0000000a)
+	// SGIP_ADDTELESEG_RESP      = uint32(0x8000000a)
+	// SGIP_MODIFYTELESEG        = uint32(0x0000000b)
+	// SGIP_MODIFYTELESEG_RESP   = uint32(0x8000000b)
+	// SGIP_DELETETELESEG        = uint32(0x0000000c)
+	// SGIP_DELETETELESEG_RESP   = uint32(0x8000000c)
+	// SGIP_ADDSMG               = uint32(0x0000000d)
+	// SGIP_ADDSMG_RESP          = uint32(0x8000000d)
+	// SGIP_MODIFYSMG            = uint32(0x0000000e)
+	// SGIP_MODIFYSMG_RESP       = uint32(0x8000000e)
+	// SGIP_DELETESMG            = uint32(0x0000000f)
+	// SGIP_DELETESMG_RESP       = uint32(0x8000000f)
+	// SGIP_CHECKUSER            = uint32(0x00000010)
+	// SGIP_CHECKUSER_RESP       = uint32(0x80000010)
+	// SGIP_USERRPT              = uint32(0x00000011)
+	// SGIP_USERRPT_RESP         = uint32(0x80000011)
+	// SGIP_TRACE                = uint32(0x00001000)
+	// SGIP_TRACE_RESP           = uint32(0x80001000)
+)
+
+var CommandMap = make(map[uint32]string)
+
+func init() {
+	CommandMap[SGIP_BIND] = "SGIP_BIND"
+	CommandMap[SGIP_BIND_RESP] = "SGIP_BIND_RESP"
+	CommandMap[SGIP_UNBIND] = "SGIP_UNBIND"
+	CommandMap[SGIP_UNBIND_RESP] = "SGIP_UNBIND_RESP"
+	CommandMap[SGIP_SUBMIT] = "SGIP_SUBMIT"
+	CommandMap[SGIP_SUBMIT_RESP] = "SGIP_SUBMIT_RESP"
+	CommandMap[SGIP_DELIVER] = "SGIP_DELIVER"
+	CommandMap[SGIP_DELIVER_RESP] = "SGIP_DELIVER_RESP"
+	CommandMap[SGIP_REPORT] = "SGIP_REPORT"
+	CommandMap[SGIP_REPORT_RESP] = "SGIP_REPORT_RESP"
+}
+
+// ResultMap 应答报文中 Result 字段的取值
+var ResultMap = map[uint32]string{
+	0:  "成功",
+	1:  "非法登录，如登录名、口令出错、登录名与口令不符等",
+	2:  "重复登录，如在同一TCP/IP连接中连续两次以上请求登录",
+	3:  "连接过多，指单个节点要求同时建立的连接数过多",
+	4:  "登录类型错，指bind命令中的logintype字段出错",
+	5:  "参数格式错，指命令中参数值与参数类型不符或与协议规定的范围不符",
+	6:  "非法手机号码，协议中所有手机号码字段出现非86130号码或手机号码前未加“86”时都应报错",
+	7:  "消息ID错",
+	8:  "信息长度错",
+	9:  "非法序列号，包括序列号重复、序列号格式错误等",
+	10: "非法操作GNS",
+	11: "节点忙，指本节点存储队列满或其他原因，暂时不能提供服务的情况",
+	21: "目的地址不可达，指路由表存在路由且消息路由正确但被路由的节点暂时不能提供服务的情况",
+	22: "路由错，指路由表存在路由但消息路由出错的情况，如转错SMG等",
+	23: "路由不存在，指消息路由的节点在路由表中不存在",
+	24: "计费号码无效，鉴权不成功时反馈的错误信息",
+	25: "用户不能通信（如不在服务区、未开机等情况）",
+	26: "手机内存不足",
+	27: "手机不支持短消息",
+	28: "手机接收短消息出现错误",
+	29: "不知道的用户",
+	30: "不提供此功能",
+	31: "非法设备",
+	32: "系统失败",
+	33: "短信中心队列满",
+	99: "其他错误",
+}
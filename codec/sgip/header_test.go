@@ -0,0 +1,52 @@
+package sgip
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func init() {
+	rand.Seed(time.Now().Unix()) // 随机种子
+	Conf = yml_config.CreateYamlFactory("sgip.yaml")
+	Seq96 = comm.NewNodeSequence(uint32(Conf.GetInt64("node-id")))
+}
+
+func TestMessageHeader(t *testing.T) {
+	header := &MessageHeader{MessageLength: HeadLength, CommandId: SGIP_UNBIND, SequenceNumber: Seq96.NextVal()}
+	t.Logf("%s", header)
+	data := header.Encode()
+	assert.Equal(t, HeadLength, len(data))
+	t.Logf("%x", data)
+
+	h2 := &MessageHeader{}
+	err := h2.Decode(data)
+	assert.True(t, err == nil)
+	assert.Equal(t, *header, *h2)
+	assert.Equal(t, uint32(Conf.GetInt64("node-id")), h2.SequenceNumber[0])
+}
+
+func TestUnbind(t *testing.T) {
+	ub := NewUnbind()
+	data := ub.Encode()
+	assert.Equal(t, HeadLength, len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	ub2 := &Unbind{}
+	assert.True(t, ub2.Decode(h, nil) == nil)
+	t.Logf("%s", ub2)
+
+	resp := ub2.ToResponse(0).(*UnbindResp)
+	data = resp.Encode()
+	_ = h.Decode(data)
+	resp2 := &UnbindResp{}
+	assert.True(t, resp2.Decode(h, nil) == nil)
+	assert.Equal(t, ub.SequenceNumber, resp2.SequenceNumber)
+	t.Logf("%s", resp2)
+}
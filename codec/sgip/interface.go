@@ -0,0 +1,20 @@
+package sgip
+
+import (
+	"fmt"
+)
+
+type Codec interface {
+	Encode() []byte
+	Decode(header *MessageHeader, frame []byte) error
+}
+
+type Pdu interface {
+	Codec
+	fmt.Stringer
+	ToResponse(code uint32) interface{}
+}
+
+type Sequence96 interface {
+	NextVal() [3]uint32
+}
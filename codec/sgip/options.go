@@ -0,0 +1,150 @@
+package sgip
+
+import (
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+type Option func(mtOps *MtOptions)
+
+func loadOptions(options ...Option) *MtOptions {
+	opts := &MtOptions{
+		MorelatetoMTFlag: uint8(0xf),
+		Priority:         uint8(0xf),
+		ReportFlag:       uint8(0xf),
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+type MtOptions struct {
+	MorelatetoMTFlag uint8
+	Priority         uint8
+	ReportFlag       uint8
+	SpNumber         string
+	ChargeNumber     string
+	ServiceType      string
+	ExpireTime       string
+	ScheduleTime     string
+}
+
+// MtSpNumber SP的接入号码，会拼接到配置文件的sms-display-no后面
+func MtSpNumber(s string) Option {
+	return func(opts *MtOptions) {
+		opts.SpNumber = s
+	}
+}
+
+// MtChargeNumber 付费号码，手机号码前加“86”国别标志；当且仅当群发且对用户收费时为空；
+// 如果为空，则该条短消息产生的费用由UserNumber代表的用户支付；
+// 如果为全零字符串“000000000000000000000”，表示该条短消息产生的费用由SP支付。
+func MtChargeNumber(s string) Option {
+	return func(opts *MtOptions) {
+		opts.ChargeNumber = s
+	}
+}
+
+// MtServiceType 业务代码，由SP定义
+func MtServiceType(s string) Option {
+	return func(opts *MtOptions) {
+		opts.ServiceType = s
+	}
+}
+
+// MtScheduleTime 短消息定时发送的时间
+func MtScheduleTime(t time.Time) Option {
+	return func(opts *MtOptions) {
+		opts.ScheduleTime = comm.FormatTime(t)
+	}
+}
+
+// MtExpireTime 短消息寿命的终止时间
+func MtExpireTime(t time.Time) Option {
+	return func(opts *MtOptions) {
+		opts.ExpireTime = comm.FormatTime(t)
+	}
+}
+
+// MtMorelatetoMTFlag 引起MT消息的原因
+// 0-MO点播引起的第一条MT消息；
+// 1-MO点播引起的非第一条MT消息；
+// 2-非MO点播引起的MT消息；
+// 3-系统反馈引起的MT消息。
+func MtMorelatetoMTFlag(f uint8) Option {
+	if f > 3 {
+		f = uint8(0xf)
+	}
+	return func(opts *MtOptions) {
+		opts.MorelatetoMTFlag = f
+	}
+}
+
+// MtPriority 优先级0-9从低到高
+func MtPriority(p uint8) Option {
+	if p > 9 {
+		p = uint8(0xf)
+	}
+	return func(opts *MtOptions) {
+		opts.Priority = p
+	}
+}
+
+// MtReportFlag 状态报告标记
+// 0-该条消息只有最后出错时要返回状态报告
+// 1-该条消息无论最后是否成功都要返回状态报告
+// 2-该条消息不需要返回状态报告
+// 3-该条消息仅携带包月计费信息，不下发给用户，要返回状态报告
+func MtReportFlag(f uint8) Option {
+	if f > 3 {
+		f = uint8(0xf)
+	}
+	return func(opts *MtOptions) {
+		opts.ReportFlag = f
+	}
+}
+
+// 设置可选项
+func setOptions(sub *Submit, opts *MtOptions) {
+	sub.spNumber = Conf.GetString("sms-display-no") + opts.SpNumber
+
+	if opts.ChargeNumber != "" {
+		sub.chargeNumber = opts.ChargeNumber
+	} else {
+		sub.chargeNumber = Conf.GetString("charge-number")
+	}
+
+	if opts.ServiceType != "" {
+		sub.serviceType = opts.ServiceType
+	} else {
+		sub.serviceType = Conf.GetString("service-type")
+	}
+
+	if opts.MorelatetoMTFlag != uint8(0xf) {
+		sub.morelatetoMTFlag = opts.MorelatetoMTFlag
+	} else {
+		sub.morelatetoMTFlag = byte(Conf.GetInt("morelateto-mt-flag"))
+	}
+
+	if opts.Priority != uint8(0xf) {
+		sub.priority = opts.Priority
+	} else {
+		sub.priority = byte(Conf.GetInt("priority"))
+	}
+
+	if opts.ReportFlag != uint8(0xf) {
+		sub.reportFlag = opts.ReportFlag
+	} else {
+		sub.reportFlag = byte(Conf.GetInt("report-flag"))
+	}
+
+	sub.scheduleTime = opts.ScheduleTime
+
+	if opts.ExpireTime != "" {
+		sub.expireTime = opts.ExpireTime
+	} else {
+		sub.expireTime = comm.FormatTime(time.Now().Add(Conf.GetDuration("default-valid-duration")))
+	}
+}
@@ -0,0 +1,93 @@
+package sgip
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+type Report struct {
+	*MessageHeader                 // 【20字节】消息头
+	submitSequenceNumber [3]uint32 // 【12字节】该命令所涉及的Submit或deliver命令的序列号
+	reportType           byte      // 【1字节】Report命令类型，0：对先前一条Submit命令的状态报告；1：对先前一条前转Deliver命令的状态报告
+	userNumber           string    // 【21字节】接收短消息的手机号，手机号码前加“86”国别标志
+	state                byte      // 【1字节】该命令所涉及的短消息的当前执行状态，0：发送成功；1：等待发送；2：发送失败
+	errorCode            byte      // 【1字节】当State=2时为错误码值，否则为0
+	reserve              string    // 【8字节】保留，扩展用
+}
+
+const ReportLen = HeadLength + 44
+
+func NewReport(submitSeq [3]uint32, userNumber string) *Report {
+	header := &MessageHeader{MessageLength: ReportLen, CommandId: SGIP_REPORT, SequenceNumber: Seq96.NextVal()}
+	rpt := &Report{MessageHeader: header, submitSequenceNumber: submitSeq, userNumber: userNumber}
+	// 判断序号的序列部分
+	switch header.SequenceNumber[2] % 1000 {
+	case 999:
+		rpt.state, rpt.errorCode = 2, 25
+	case 998:
+		rpt.state, rpt.errorCode = 2, 26
+	case 997:
+		rpt.state, rpt.errorCode = 2, 27
+	case 996:
+		rpt.state, rpt.errorCode = 2, 29
+	case 995:
+		rpt.state, rpt.errorCode = 1, 0
+	default:
+		rpt.state, rpt.errorCode = 0, 0
+	}
+	return rpt
+}
+
+func (r *Report) Encode() []byte {
+	frame := r.MessageHeader.Encode()
+	binary.BigEndian.PutUint32(frame[20:24], r.submitSequenceNumber[0])
+	binary.BigEndian.PutUint32(frame[24:28], r.submitSequenceNumber[1])
+	binary.BigEndian.PutUint32(frame[28:32], r.submitSequenceNumber[2])
+	index := 32
+	index = comm.CopyByte(frame, r.reportType, index)
+	index = comm.CopyStr(frame, r.userNumber, index, 21)
+	index = comm.CopyByte(frame, r.state, index)
+	index = comm.CopyByte(frame, r.errorCode, index)
+	comm.CopyStr(frame, r.reserve, index, 8)
+	return frame
+}
+
+func (r *Report) Decode(header *MessageHeader, frame []byte) error {
+	// check
+	if header == nil || header.CommandId != SGIP_REPORT || len(frame) < (ReportLen-HeadLength) {
+		return ErrorPacket
+	}
+	r.MessageHeader = header
+	r.submitSequenceNumber[0] = binary.BigEndian.Uint32(frame[0:4])
+	r.submitSequenceNumber[1] = binary.BigEndian.Uint32(frame[4:8])
+	r.submitSequenceNumber[2] = binary.BigEndian.Uint32(frame[8:12])
+	r.reportType = frame[12]
+	r.userNumber = comm.TrimStr(frame[13:34])
+	r.state = frame[34]
+	r.errorCode = frame[35]
+	r.reserve = comm.TrimStr(frame[36:44])
+	return nil
+}
+
+func (r *Report) ToResponse(code uint32) interface{} {
+	return newResp(r.MessageHeader, SGIP_REPORT_RESP, code)
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("{ header: %s, submitSequenceNumber: %s, reportType: %d, userNumber: %s, state: %d, errorCode: {%d: %s} }",
+		r.MessageHeader, SequenceString(r.submitSequenceNumber), r.reportType, r.userNumber, r.state, r.errorCode, ResultMap[uint32(r.errorCode)])
+}
+
+func (r *Report) SubmitSequenceNumber() [3]uint32 {
+	return r.submitSequenceNumber
+}
+
+func (r *Report) State() byte {
+	return r.state
+}
+
+func (r *Report) ErrorCode() byte {
+	return r.errorCode
+}
@@ -0,0 +1,47 @@
+package sgip
+
+import (
+	"fmt"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+// Resp SGIP_BIND_RESP、SGIP_SUBMIT_RESP、SGIP_DELIVER_RESP、SGIP_REPORT_RESP 的消息体结构相同
+type Resp struct {
+	*MessageHeader        // 【20字节】消息头
+	result         byte   // 【1字节】执行命令是否成功
+	reserve        string // 【8字节】保留
+}
+
+const RespLen = HeadLength + 9
+
+func newResp(header *MessageHeader, commandId uint32, result uint32) *Resp {
+	h := &MessageHeader{MessageLength: RespLen, CommandId: commandId, SequenceNumber: header.SequenceNumber}
+	return &Resp{MessageHeader: h, result: byte(result)}
+}
+
+func (r *Resp) Encode() []byte {
+	frame := r.MessageHeader.Encode()
+	frame[20] = r.result
+	copy(frame[21:29], r.reserve)
+	return frame
+}
+
+func (r *Resp) Decode(header *MessageHeader, frame []byte) error {
+	// check
+	if header == nil || header.CommandId&0x80000000 == 0 || len(frame) < (RespLen-HeadLength) {
+		return ErrorPacket
+	}
+	r.MessageHeader = header
+	r.result = frame[0]
+	r.reserve = comm.TrimStr(frame[1:9])
+	return nil
+}
+
+func (r *Resp) String() string {
+	return fmt.Sprintf("{ header: %s, result: {%d: %s} }", r.MessageHeader, r.result, ResultMap[uint32(r.result)])
+}
+
+func (r *Resp) Result() uint32 {
+	return uint32(r.result)
+}
@@ -0,0 +1,257 @@
+package sgip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+type Submit struct {
+	*MessageHeader            // 【20字节】消息头
+	spNumber         string   // 【21字节】SP的接入号码
+	chargeNumber     string   // 【21字节】付费号码
+	userCount        byte     // 【1字节】接收短消息的手机数量，取值范围1至100
+	userNumber       []string // 【21*UserCount字节】接收该短消息的手机号
+	corpId           string   // 【5字节】企业代码，取值范围0-99999
+	serviceType      string   // 【10字节】业务代码，由SP定义
+	feeType          byte     // 【1字节】计费类型
+	feeValue         string   // 【6字节】取值范围0-99999，该条短消息的收费值，单位为分
+	givenValue       string   // 【6字节】取值范围0-99999，赠送用户的话费，单位为分
+	agentFlag        byte     // 【1字节】代收费标志，0：应收；1：实收
+	morelatetoMTFlag byte     // 【1字节】引起MT消息的原因
+	priority         byte     // 【1字节】优先级0-9从低到高，默认为0
+	expireTime       string   // 【16字节】短消息寿命的终止时间
+	scheduleTime     string   // 【16字节】短消息定时发送的时间
+	reportFlag       byte     // 【1字节】状态报告标记
+	tpPid            byte     // 【1字节】GSM协议类型
+	tpUdhi           byte     // 【1字节】GSM协议类型
+	messageCoding    byte     // 【1字节】短消息的编码格式，0：纯ASCII字符串；8：UCS2编码；15：GBK编码
+	messageType      byte     // 【1字节】信息类型，0-短消息信息
+	messageLength    uint32   // 【4字节】短消息的长度
+	messageContent   string   // 【MessageLength字节】短消息的内容
+	msgBytes         []byte   // 消息内容按照MessageCoding编码后的数据
+	reserve          string   // 【8字节】保留，扩展用
+}
+
+const MtBaseLen = HeadLength + 123
+
+func NewSubmit(phones []string, content string, opts ...Option) (messages []*Submit) {
+	options := loadOptions(opts...)
+	header := &MessageHeader{MessageLength: MtBaseLen, CommandId: SGIP_SUBMIT, SequenceNumber: Seq96.NextVal()}
+	mt := &Submit{MessageHeader: header}
+	setOptions(mt, options)
+
+	mt.userCount = byte(len(phones))
+	mt.userNumber = phones
+	mt.corpId = Conf.GetString("corp-id")
+	mt.feeType = byte(Conf.GetInt("fee-type"))
+	mt.feeValue = Conf.GetString("fee-value")
+	mt.givenValue = Conf.GetString("given-value")
+	mt.agentFlag = byte(Conf.GetInt("agent-flag"))
+	mt.messageType = 0
+
+	mt.messageContent = content
+	mt.messageCoding = MsgCoding(content)
+	slices := MsgSlices(mt.messageCoding, content)
+	baseLen := MtBaseLen + 21*len(phones)
+	if len(slices) == 1 {
+		mt.msgBytes = slices[0]
+		mt.messageLength = uint32(len(mt.msgBytes))
+		mt.MessageLength = uint32(baseLen + len(mt.msgBytes))
+		return []*Submit{mt}
+	}
+
+	mt.tpUdhi = 1
+	for i, msgBytes := range slices {
+		// 拷贝 mt
+		tmp := *mt
+		tmpHead := *tmp.MessageHeader
+		sub := &tmp
+		sub.MessageHeader = &tmpHead
+		if i != 0 {
+			sub.SequenceNumber = Seq96.NextVal()
+		}
+		sub.msgBytes = msgBytes
+		sub.messageLength = uint32(len(msgBytes))
+		sub.MessageLength = uint32(baseLen + len(msgBytes))
+		messages = append(messages, sub)
+	}
+	return messages
+}
+
+func (s *Submit) Encode() []byte {
+	if len(s.userNumber) != int(s.userCount) {
+		return nil
+	}
+	frame := s.MessageHeader.Encode()
+	index := 20
+	index = comm.CopyStr(frame, s.spNumber, index, 21)
+	index = comm.CopyStr(frame, s.chargeNumber, index, 21)
+	index = comm.CopyByte(frame, s.userCount, index)
+	for _, phone := range s.userNumber {
+		index = comm.CopyStr(frame, phone, index, 21)
+	}
+	index = comm.CopyStr(frame, s.corpId, index, 5)
+	index = comm.CopyStr(frame, s.serviceType, index, 10)
+	index = comm.CopyByte(frame, s.feeType, index)
+	index = comm.CopyStr(frame, s.feeValue, index, 6)
+	index = comm.CopyStr(frame, s.givenValue, index, 6)
+	index = comm.CopyByte(frame, s.agentFlag, index)
+	index = comm.CopyByte(frame, s.morelatetoMTFlag, index)
+	index = comm.CopyByte(frame, s.priority, index)
+	index = comm.CopyStr(frame, s.expireTime, index, 16)
+	index = comm.CopyStr(frame, s.scheduleTime, index, 16)
+	index = comm.CopyByte(frame, s.reportFlag, index)
+	index = comm.CopyByte(frame, s.tpPid, index)
+	index = comm.CopyByte(frame, s.tpUdhi, index)
+	index = comm.CopyByte(frame, s.messageCoding, index)
+	index = comm.CopyByte(frame, s.messageType, index)
+	binary.BigEndian.PutUint32(frame[index:index+4], s.messageLength)
+	index += 4
+	copy(frame[index:index+int(s.messageLength)], s.msgBytes)
+	index += int(s.messageLength)
+	comm.CopyStr(frame, s.reserve, index, 8)
+	return frame
+}
+
+func (s *Submit) Decode(header *MessageHeader, frame []byte) error {
+	// check
+	if header == nil || header.CommandId != SGIP_SUBMIT || len(frame) < MtBaseLen-HeadLength ||
+		uint32(len(frame)) < (header.MessageLength-HeadLength) {
+		return ErrorPacket
+	}
+	s.MessageHeader = header
+	index := 0
+	s.spNumber = comm.TrimStr(frame[index : index+21])
+	index += 21
+	s.chargeNumber = comm.TrimStr(frame[index : index+21])
+	index += 21
+	s.userCount = frame[index]
+	index++
+	if len(frame) < MtBaseLen-HeadLength+21*int(s.userCount) {
+		return ErrorPacket
+	}
+	s.userNumber = make([]string, 0, s.userCount)
+	for i := byte(0); i < s.userCount; i++ {
+		s.userNumber = append(s.userNumber, comm.TrimStr(frame[index:index+21]))
+		index += 21
+	}
+	s.corpId = comm.TrimStr(frame[index : index+5])
+	index += 5
+	s.serviceType = comm.TrimStr(frame[index : index+10])
+	index += 10
+	s.feeType = frame[index]
+	index++
+	s.feeValue = comm.TrimStr(frame[index : index+6])
+	index += 6
+	s.givenValue = comm.TrimStr(frame[index : index+6])
+	index += 6
+	s.agentFlag = frame[index]
+	index++
+	s.morelatetoMTFlag = frame[index]
+	index++
+	s.priority = frame[index]
+	index++
+	s.expireTime = comm.TrimStr(frame[index : index+16])
+	index += 16
+	s.scheduleTime = comm.TrimStr(frame[index : index+16])
+	index += 16
+	s.reportFlag = frame[index]
+	index++
+	s.tpPid = frame[index]
+	index++
+	s.tpUdhi = frame[index]
+	index++
+	s.messageCoding = frame[index]
+	index++
+	s.messageType = frame[index]
+	index++
+	s.messageLength = binary.BigEndian.Uint32(frame[index : index+4])
+	index += 4
+	if len(frame) < index+int(s.messageLength)+8 {
+		return ErrorPacket
+	}
+	s.msgBytes = frame[index : index+int(s.messageLength)]
+	s.messageContent = MsgContent(s.messageCoding, s.tpUdhi, s.msgBytes)
+	index += int(s.messageLength)
+	s.reserve = comm.TrimStr(frame[index : index+8])
+	return nil
+}
+
+func (s *Submit) ToResponse(code uint32) interface{} {
+	return newResp(s.MessageHeader, SGIP_SUBMIT_RESP, code)
+}
+
+// ToReport 生成发往某个接收号码的状态报告
+func (s *Submit) ToReport(userNumber string) *Report {
+	return NewReport(s.SequenceNumber, userNumber)
+}
+
+func (s *Submit) String() string {
+	bts := s.msgBytes
+	if len(bts) > 6 {
+		bts = bts[:6]
+	}
+	return fmt.Sprintf("{ header: %s, spNumber: %s, chargeNumber: %s, userCount: %d, userNumber: %v, "+
+		"corpId: %s, serviceType: %s, feeType: %d, feeValue: %s, givenValue: %s, agentFlag: %d, "+
+		"morelatetoMTFlag: %d, priority: %d, expireTime: %s, scheduleTime: %s, reportFlag: %d, "+
+		"tpPid: %d, tpUdhi: %d, messageCoding: %d, messageType: %d, messageLength: %d, msgBytes: %#x... }",
+		s.MessageHeader, s.spNumber, s.chargeNumber, s.userCount, s.userNumber,
+		s.corpId, s.serviceType, s.feeType, s.feeValue, s.givenValue, s.agentFlag,
+		s.morelatetoMTFlag, s.priority, s.expireTime, s.scheduleTime, s.reportFlag,
+		s.tpPid, s.tpUdhi, s.messageCoding, s.messageType, s.messageLength, bts)
+}
+
+func (s *Submit) UserNumber() []string {
+	return s.userNumber
+}
+
+func (s *Submit) ReportFlag() byte {
+	return s.reportFlag
+}
+
+func (s *Submit) MessageContent() string {
+	return s.messageContent
+}
+
+// MsgCoding 通过消息内容判断，设置编码格式。
+// 如果是纯拉丁字符采用0：ASCII串
+// 如果含多字节字符，这采用8：UCS-2编码
+func MsgCoding(content string) byte {
+	if len(content) == len([]rune(content)) {
+		return 0
+	}
+	return 8
+}
+
+// MsgSlices 按编码格式对消息内容编码并拆分为长短信切片
+func MsgSlices(coding byte, content string) [][]byte {
+	if coding == 8 {
+		return comm.ToTPUDHISlices(comm.Ucs2Encode(content), 140)
+	}
+	return comm.ToTPUDHISlices([]byte(content), 160)
+}
+
+// MsgContent 按编码格式解码消息内容，tpUdhi为1时跳过消息头
+func MsgContent(coding byte, tpUdhi byte, msgBytes []byte) string {
+	content := msgBytes
+	if tpUdhi == 1 && len(content) > 0 && int(content[0]) < len(content) {
+		content = content[content[0]+1:]
+	}
+	switch coding {
+	case 8:
+		return comm.Ucs2Decode(content)
+	case 15:
+		bts, err := simplifiedchinese.GB18030.NewDecoder().Bytes(content)
+		if err != nil {
+			return ""
+		}
+		return string(bts)
+	default:
+		return strings.TrimRight(string(content), "\x00")
+	}
+}
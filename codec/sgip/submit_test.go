@@ -0,0 +1,80 @@
+package sgip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSubmit(t *testing.T) {
+	phones := []string{"8617600001111", "8617600002222"}
+	subs := NewSubmit(phones, Poem, MtScheduleTime(time.Now().Add(time.Minute)))
+	assert.True(t, len(subs) > 1)
+	for _, sub := range subs {
+		t.Logf("%s", sub)
+		assert.True(t, sub.messageLength <= 140)
+		assert.Equal(t, byte(1), sub.tpUdhi)
+		assert.Equal(t, int(sub.MessageLength), MtBaseLen+21*len(phones)+len(sub.msgBytes))
+	}
+
+	subs = NewSubmit(phones[:1], "hello world")
+	assert.Equal(t, 1, len(subs))
+	assert.Equal(t, byte(0), subs[0].messageCoding)
+}
+
+func TestSubmit_Decode(t *testing.T) {
+	decode(t, []string{"8617600001111", "8617600002222"}, Poem)
+	decode(t, []string{"8617600001111"}, "hello world 世界，你好！")
+	decode(t, []string{"8617600001111"}, "hello world")
+}
+
+func decode(t *testing.T, phones []string, txt string) {
+	subs := NewSubmit(phones, txt)
+	content := ""
+	for _, sub := range subs {
+		data := sub.Encode()
+		assert.Equal(t, int(sub.MessageLength), len(data))
+
+		h := &MessageHeader{}
+		_ = h.Decode(data)
+		dec := &Submit{}
+		err := dec.Decode(h, data[HeadLength:])
+		assert.True(t, err == nil)
+		assert.Equal(t, phones, dec.UserNumber())
+		assert.Equal(t, data, dec.Encode())
+		content += dec.MessageContent()
+		t.Logf("%s", dec)
+
+		resp := dec.ToResponse(0).(*Resp)
+		assert.Equal(t, sub.SequenceNumber, resp.SequenceNumber)
+		assert.Equal(t, SGIP_SUBMIT_RESP, resp.CommandId)
+
+		rpt := dec.ToReport(phones[0])
+		assert.Equal(t, sub.SequenceNumber, rpt.SubmitSequenceNumber())
+	}
+	assert.Equal(t, txt, content)
+}
+
+func TestSubmit_DecodeError(t *testing.T) {
+	sub := NewSubmit([]string{"8617600001111"}, "hello world")[0]
+	data := sub.Encode()
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	err := (&Submit{}).Decode(h, data[HeadLength:len(data)-10])
+	assert.Equal(t, ErrorPacket, err)
+}
+
+const Poem = "将进酒\n" +
+	"君不见黄河之水天上来，奔流到海不复回。\n" +
+	"君不见高堂明镜悲白发，朝如青丝暮成雪。\n" +
+	"人生得意须尽欢，莫使金樽空对月。\n" +
+	"天生我材必有用，千金散尽还复来。\n" +
+	"烹羊宰牛且为乐，会须一饮三百杯。\n" +
+	"岑夫子，丹丘生，将进酒，杯莫停。\n" +
+	"与君歌一曲，请君为我倾耳听。\n" +
+	"钟鼓馔玉不足贵，但愿长醉不愿醒。\n" +
+	"古来圣贤皆寂寞，惟有饮者留其名。\n" +
+	"陈王昔时宴平乐，斗酒十千恣欢谑。\n" +
+	"主人何为言少钱，径须沽取对君酌。\n" +
+	"五花马、千金裘，呼儿将出换美酒，与尔同销万古愁。"
@@ -0,0 +1,48 @@
+package sgip
+
+type Unbind MessageHeader
+type UnbindResp MessageHeader
+
+func NewUnbind() *Unbind {
+	return &Unbind{MessageLength: HeadLength, CommandId: SGIP_UNBIND, SequenceNumber: Seq96.NextVal()}
+}
+
+func NewUnbindResp(seq [3]uint32) *UnbindResp {
+	return &UnbindResp{MessageLength: HeadLength, CommandId: SGIP_UNBIND_RESP, SequenceNumber: seq}
+}
+
+func (u *Unbind) Encode() []byte {
+	return (*MessageHeader)(u).Encode()
+}
+
+func (u *Unbind) Decode(header *MessageHeader, _ []byte) error {
+	if header == nil || header.CommandId != SGIP_UNBIND {
+		return ErrorPacket
+	}
+	*u = Unbind(*header)
+	return nil
+}
+
+func (u *Unbind) ToResponse(_ uint32) interface{} {
+	return NewUnbindResp(u.SequenceNumber)
+}
+
+func (u *Unbind) String() string {
+	return (*MessageHeader)(u).String()
+}
+
+func (resp *UnbindResp) Encode() []byte {
+	return (*MessageHeader)(resp).Encode()
+}
+
+func (resp *UnbindResp) Decode(header *MessageHeader, _ []byte) error {
+	if header == nil || header.CommandId != SGIP_UNBIND_RESP {
+		return ErrorPacket
+	}
+	*resp = UnbindResp(*header)
+	return nil
+}
+
+func (resp *UnbindResp) String() string {
+	return (*MessageHeader)(resp).String()
+}
@@ -8,12 +8,16 @@ type ActiveTest MessageHeader
 type ActiveTestResp MessageHeader
 
 func NewActiveTest() *ActiveTest {
-	at := &ActiveTest{PacketLength: HeadLength, RequestId: CmdActiveTest, SequenceId: uint32(Seq32.NextVal())}
+	return Default().NewActiveTest()
+}
+
+func (ctx *Context) NewActiveTest() *ActiveTest {
+	at := &ActiveTest{PacketLength: HeadLength, RequestId: CmdActiveTest, SequenceId: uint32(ctx.Seq32.NextVal())}
 	return at
 }
 
 func NewActiveTestResp(seq uint32) *ActiveTestResp {
-	at := &ActiveTestResp{PacketLength: HeadLength, RequestId: CmdActiveTest, SequenceId: seq}
+	at := &ActiveTestResp{PacketLength: HeadLength, RequestId: CmdActiveTestResp, SequenceId: seq}
 	return at
 }
 
@@ -21,7 +25,7 @@ func (at *ActiveTest) Encode() []byte {
 	return (*MessageHeader)(at).Encode()
 }
 
-func (at *ActiveTest) Decode(header *MessageHeader, _ []byte) error {
+func (at *ActiveTest) Decode(header *MessageHeader, _ []byte, _ *Context) error {
 	at.PacketLength = header.PacketLength
 	at.RequestId = header.RequestId
 	at.SequenceId = header.SequenceId
@@ -44,7 +48,7 @@ func (resp *ActiveTestResp) Encode() []byte {
 	return (*MessageHeader)(resp).Encode()
 }
 
-func (resp *ActiveTestResp) Decode(header *MessageHeader, _ []byte) error {
+func (resp *ActiveTestResp) Decode(header *MessageHeader, _ []byte, _ *Context) error {
 	resp.PacketLength = header.PacketLength
 	resp.RequestId = header.RequestId
 	resp.SequenceId = header.SequenceId
@@ -9,7 +9,7 @@ import (
 
 func init() {
 	Conf = yml_config.CreateYamlFactory("smgp.yaml")
-	dc := Conf.GetInt("data-center-id")
+	dc := Conf.GetInt("datacenter-id")
 	wk := Conf.GetInt("worker-id")
 	smgwId := Conf.GetString("smgw-id")
 	Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
@@ -28,7 +28,7 @@ func TestActiveTest(t *testing.T) {
 	t.Logf("%T : %s", h, h)
 
 	at2 := &ActiveTest{}
-	_ = at2.Decode(h, data)
+	_ = at2.Decode(h, data, nil)
 	t.Logf("%T : %s", at2, at2)
 
 	resp := at.ToResponse(0).(*ActiveTestResp)
@@ -39,6 +39,6 @@ func TestActiveTest(t *testing.T) {
 	_ = h.Decode(data)
 
 	resp2 := &ActiveTestResp{}
-	_ = resp2.Decode(h, data)
+	_ = resp2.Decode(h, data, nil)
 	t.Logf("%T : %s", resp2, resp2)
 }
@@ -2,10 +2,14 @@ package smgp
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
 
 	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/sp"
 	"github.com/aaronwong1989/gosms/comm/yml_config"
 )
 
@@ -13,42 +17,121 @@ var log = logging.GetDefaultLogger()
 var ErrorPacket = errors.New("error packet")
 var GbEncoder = simplifiedchinese.GB18030.NewEncoder()
 var GbDecoder = simplifiedchinese.GB18030.NewDecoder()
+
+// Conf、Seq32、Seq80、Accounts 组成默认的编解码上下文，见 Default
 var Conf yml_config.YmlConfig
 var Seq32 Sequence32
 var Seq80 Sequence80
 
-// type Config struct {
-// 	// 公共参数
-// 	ClientId           string        `yaml:"client-id"`
-// 	SharedSecret       string        `yaml:"shared-secret"`
-// 	AuthCheck          bool          `yaml:"auth-check"`
-// 	Version            byte          `yaml:"version"`
-// 	MaxCons            int           `yaml:"max-cons"`
-// 	ActiveTestDuration time.Duration `yaml:"active-test-duration"`
-// 	DataCenterId       int32         `yaml:"datacenter-id"`
-// 	WorkerId           int32         `yaml:"worker-id"`
-// 	SmgwId             string        `yaml:"smgw-id"`
-// 	ReceiveWindowSize  int           `yaml:"receive-window-size"`
-// 	MaxPoolSize        int           `yaml:"max-pool-size"`
-//
-// 	// MT消息相关
-// 	NeedReport    byte          `yaml:"need-report"`
-// 	Priority      byte          `yaml:"Priority "`
-// 	DisplayNo     string        `yaml:"sms-display-no"`
-// 	ServiceId     string        `yaml:"service-id"`
-// 	FeeType       string        `yaml:"fee-type"`
-// 	FeeCode       string        `yaml:"fee-code"`
-// 	ChargeTermID  string        `yaml:"charge-term-id"`
-// 	FixedFee      string        `yaml:"fixed-fee"`
-// 	LinkID        string        `yaml:"link-id"`
-// 	ValidDuration time.Duration `yaml:"default-valid-duration"`
-//
-// 	// 模拟网关相关参数
-// 	SuccessRate     float64 `yaml:"success-rate"`
-// 	MinSubmitRespMs int32   `yaml:"min-submit-resp-ms"`
-// 	MaxSubmitRespMs int32   `yaml:"max-submit-resp-ms"`
-// 	FixReportRespMs int32   `yaml:"fix-report-resp-ms"`
-// }
+// Accounts SP账号注册表，为nil时仅支持client-id与shared-secret配置的单一账号
+var Accounts *sp.Registry
+
+// Config 配置文件中的参数，由 LoadConfig 解析并校验，各参数的含义见 config/smgp.yaml
+type Config struct {
+	// 公共参数
+	ClientId           string        `mapstructure:"client-id"`
+	SharedSecret       string        `mapstructure:"shared-secret"`
+	AuthCheck          bool          `mapstructure:"auth-check"`
+	Version            int           `mapstructure:"version"`
+	MaxCons            int           `mapstructure:"max-cons"`
+	ActiveTestDuration time.Duration `mapstructure:"active-test-duration"`
+	DatacenterId       int           `mapstructure:"datacenter-id"`
+	WorkerId           int           `mapstructure:"worker-id"`
+	SmgwId             string        `mapstructure:"smgw-id"`
+	ReceiveWindowSize  int           `mapstructure:"receive-window-size"`
+	MaxPoolSize        int           `mapstructure:"max-pool-size"`
+
+	// MT消息相关
+	NeedReport    int           `mapstructure:"need-report"`
+	Priority      int           `mapstructure:"priority"`
+	DisplayNo     string        `mapstructure:"sms-display-no"`
+	ServiceId     string        `mapstructure:"service-id"`
+	FeeType       string        `mapstructure:"fee-type"`
+	FeeCode       string        `mapstructure:"fee-code"`
+	ChargeTermID  string        `mapstructure:"charge-term-id"`
+	FixedFee      string        `mapstructure:"fixed-fee"`
+	LinkID        string        `mapstructure:"link-id"`
+	ValidDuration time.Duration `mapstructure:"default-valid-duration"`
+
+	// 模拟网关相关参数
+	SuccessRate         float64       `mapstructure:"success-rate"`
+	MinSubmitRespMs     int           `mapstructure:"min-submit-resp-ms"`
+	MaxSubmitRespMs     int           `mapstructure:"max-submit-resp-ms"`
+	FixReportRespMs     int           `mapstructure:"fix-report-resp-ms"`
+	ReportRetryInterval time.Duration `mapstructure:"report-retry-interval"`
+	ReportMaxRetry      int           `mapstructure:"report-max-retry"`
+	StoreFile           string        `mapstructure:"store-file"`
+	StoreRetention      time.Duration `mapstructure:"store-retention"`
+	CaptureFile         string        `mapstructure:"capture-file"`
+}
+
+// LoadConfig 解析配置并校验取值范围
+func LoadConfig(conf yml_config.YmlConfig) (*Config, error) {
+	c := &Config{}
+	if err := conf.Unmarshal(c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// 默认上下文兼容只设置包级变量的用法，不校验配置，未设置Conf时各参数为零值
+func decodeConfig(conf yml_config.YmlConfig) *Config {
+	c := &Config{}
+	if conf != nil {
+		_ = conf.Unmarshal(c)
+	}
+	return c
+}
+
+// Validate 校验各参数的取值范围，返回的错误包含配置项名称
+func (c *Config) Validate() error {
+	if v := Version(c.Version); v != V13 && v != V20 && v != V30 {
+		return fmt.Errorf("version: %d not supported, should be 19(1.3), 32(2.0) or 48(3.0)", c.Version)
+	}
+	if len(c.SmgwId) > 6 || strings.Trim(c.SmgwId, "0123456789") != "" {
+		return fmt.Errorf("smgw-id: %s should be at most 6 digits", c.SmgwId)
+	}
+	if c.SuccessRate < 0 || c.SuccessRate > 1 {
+		return fmt.Errorf("success-rate: %v out of range [0,1]", c.SuccessRate)
+	}
+	if c.MinSubmitRespMs > c.MaxSubmitRespMs {
+		return fmt.Errorf("min-submit-resp-ms: %d greater than max-submit-resp-ms %d", c.MinSubmitRespMs, c.MaxSubmitRespMs)
+	}
+	for _, err := range []error{
+		checkRange("datacenter-id", c.DatacenterId, 0, 1),
+		checkRange("worker-id", c.WorkerId, 0, 7),
+		checkRange("need-report", c.NeedReport, 0, 1),
+		checkRange("priority", c.Priority, 0, 3),
+		checkMin("max-cons", c.MaxCons, 0),
+		checkMin("receive-window-size", c.ReceiveWindowSize, 0),
+		checkMin("max-pool-size", c.MaxPoolSize, 0),
+		checkMin("min-submit-resp-ms", c.MinSubmitRespMs, 0),
+		checkMin("fix-report-resp-ms", c.FixReportRespMs, 0),
+		checkMin("report-max-retry", c.ReportMaxRetry, 0),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkRange(key string, v int, min int, max int) error {
+	if v < min || v > max {
+		return fmt.Errorf("%s: %d out of range [%d,%d]", key, v, min, max)
+	}
+	return nil
+}
+
+func checkMin(key string, v int, min int) error {
+	if v < min {
+		return fmt.Errorf("%s: %d should not be less than %d", key, v, min)
+	}
+	return nil
+}
 
 const (
 	TP_pid           = uint16(0x0001)
@@ -71,6 +154,28 @@ const (
 	MServiceID       = uint16(0x0012)
 )
 
+// TlvMap 可选参数的名称
+var TlvMap = map[uint16]string{
+	TP_pid:           "TP_pid",
+	TP_udhi:          "TP_udhi",
+	LinkID:           "LinkID",
+	ChargeUserType:   "ChargeUserType",
+	ChargeTermType:   "ChargeTermType",
+	ChargeTermPseudo: "ChargeTermPseudo",
+	DestTermType:     "DestTermType",
+	DestTermPseudo:   "DestTermPseudo",
+	PkTotal:          "PkTotal",
+	PkNumber:         "PkNumber",
+	SubmitMsgType:    "SubmitMsgType",
+	SPDealReslt:      "SPDealReslt",
+	SrcTermType:      "SrcTermType",
+	SrcTermPseudo:    "SrcTermPseudo",
+	NodesCount:       "NodesCount",
+	MsgSrc:           "MsgSrc",
+	SrcType:          "SrcType",
+	MServiceID:       "MServiceID",
+}
+
 var StatMap = map[uint32]string{
 	0:  "成功",
 	1:  "系统忙",
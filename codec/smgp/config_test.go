@@ -0,0 +1,59 @@
+package smgp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func TestLoadConfig(t *testing.T) {
+	c, err := LoadConfig(yml_config.CreateYamlFactory("smgp.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, Conf.GetString("client-id"), c.ClientId)
+	assert.Equal(t, Conf.GetInt("version"), c.Version)
+	assert.Equal(t, Conf.GetString("smgw-id"), c.SmgwId)
+	assert.Equal(t, Conf.GetInt("priority"), c.Priority)
+	assert.Equal(t, Conf.GetDuration("default-valid-duration"), c.ValidDuration)
+	assert.Equal(t, Conf.GetString("sms-display-no"), c.DisplayNo)
+
+	for want, values := range map[string]map[string]interface{}{
+		"version: 33 not supported":                               {"version": 33},
+		"smgw-id: 1000001 should be at most 6 digits":             {"smgw-id": "1000001"},
+		"smgw-id: 10a001 should be at most 6 digits":              {"smgw-id": "10a001"},
+		"priority: 4 out of range [0,3]":                          {"priority": 4},
+		"datacenter-id: 2 out of range [0,1]":                     {"datacenter-id": 2},
+		"success-rate: 965 out of range [0,1]":                    {"success-rate": 965},
+		"min-submit-resp-ms: 5 greater than max-submit-resp-ms 3": {"min-submit-resp-ms": 5, "max-submit-resp-ms": 3},
+		"report-max-retry: -1 should not be less than 0":          {"report-max-retry": -1},
+	} {
+		if _, ok := values["version"]; !ok {
+			values["version"] = 0x30
+		}
+		_, err := LoadConfig(yml_config.CreateMemoryFactory(values))
+		if assert.NotNil(t, err, want) {
+			assert.Contains(t, err.Error(), want)
+		}
+	}
+}
+
+func TestContext_Reload(t *testing.T) {
+	conf := yml_config.CreateMemoryFactory(map[string]interface{}{"version": 0x30, "priority": 1, "fix-report-resp-ms": 5})
+	ctx, err := NewContext(conf)
+	assert.Nil(t, err)
+	session := ctx.WithVersion(V20)
+	assert.Equal(t, byte(1), ctx.NewSubmit([]string{"17011112222"}, "hi", MtOptions{})[0].priority)
+
+	// 校验失败时保留原有配置
+	conf.Set("priority", 9)
+	assert.NotNil(t, ctx.Reload())
+	assert.Equal(t, 1, ctx.Config().Priority)
+
+	// 重新加载后复制的上下文同时生效
+	conf.Set("priority", 2)
+	conf.Set("fix-report-resp-ms", 50)
+	assert.Nil(t, ctx.Reload())
+	assert.Equal(t, byte(2), session.NewSubmit([]string{"17011112222"}, "hi", MtOptions{})[0].priority)
+	assert.Equal(t, 50, session.Config().FixReportRespMs)
+}
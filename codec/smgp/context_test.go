@@ -0,0 +1,67 @@
+package smgp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func TestContext(t *testing.T) {
+	// 同一进程中两个配置不同的上下文互不影响
+	c1, err := NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"client-id": "10000001", "shared-secret": "s1", "version": 0x20, "service-id": "svc1", "smgw-id": "100001",
+	}))
+	assert.Nil(t, err)
+	c2, err := NewContext(yml_config.CreateMemoryFactory(map[string]interface{}{
+		"client-id": "10000002", "shared-secret": "s2", "version": 0x30, "service-id": "svc2", "smgw-id": "100002",
+	}))
+	assert.Nil(t, err)
+
+	lo1, lo2 := c1.NewLogin(), c2.NewLogin()
+	assert.Equal(t, "10000001", lo1.ClientID())
+	assert.Equal(t, V20, lo1.Version())
+	assert.Equal(t, "10000002", lo2.ClientID())
+	assert.Equal(t, V30, lo2.Version())
+	assert.Equal(t, c1.NewActiveTest().SequenceId+1, c1.NewActiveTest().SequenceId)
+
+	// 2.0的长短信不携带可选参数
+	long := strings.Repeat("你好", 100)
+	sub1 := c1.NewSubmit([]string{"17011112222"}, long, MtOptions{})
+	sub2 := c2.NewSubmit([]string{"17011112222"}, long, MtOptions{})
+	assert.Equal(t, V20, sub1[0].Version())
+	assert.Nil(t, sub1[0].TlvList())
+	assert.Equal(t, "svc1", sub1[0].ServiceID())
+	assert.Equal(t, V30, sub2[0].Version())
+	assert.NotNil(t, sub2[0].TlvList())
+	assert.Equal(t, "svc2", sub2[0].ServiceID())
+
+	// 流水号取自各自的smgw-id
+	resp1 := sub1[0].ToResponse(0).(*SubmitResp)
+	resp2 := sub2[0].ToResponse(0).(*SubmitResp)
+	assert.NotEqual(t, resp1.MsgId()[:3], resp2.MsgId()[:3])
+	// 流量控制时未解码Submit直接应答，同样使用上下文的流水号
+	fc := c1.NewSubmitResp(&MessageHeader{PacketLength: 200, RequestId: CmdSubmit, SequenceId: 7}, 1)
+	assert.Equal(t, resp1.MsgId()[:3], fc.MsgId()[:3])
+	assert.Equal(t, uint32(7), fc.SequenceId)
+	assert.Equal(t, 26, len(fc.Encode()))
+
+	// 协商的版本优先于配置的版本
+	assert.Equal(t, V30, c1.WithVersion(V30).NewDeliver("17011112222", "", "hi").Version())
+	assert.Equal(t, V20, c1.NewDeliver("17011112222", "", "hi").Version())
+	assert.Equal(t, V20, c1.NewDeliveryReport(sub1[0], resp1.MsgId()).Version())
+}
+
+func TestDefault(t *testing.T) {
+	d := Default()
+	assert.Same(t, d, Default())
+
+	// 配置修改后重建
+	old := Conf.GetString("service-id")
+	defer Conf.Set("service-id", old)
+	Conf.Set("service-id", "svc-default")
+	assert.NotSame(t, d, Default())
+	assert.Equal(t, "svc-default", Default().Config().ServiceId)
+}
@@ -1,6 +1,7 @@
 package smgp
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"strings"
@@ -23,6 +24,8 @@ type Deliver struct {
 	report     *Report       // 状态报告
 	reserve    string        // 【8字节】保留
 	tlvList    *comm.TlvList // 【TLV】可选项参数
+	version    Version       // 报文的协议版本
+	ctx        *Context      // 生成应答使用的上下文
 }
 
 type DeliverResp struct {
@@ -31,16 +34,22 @@ type DeliverResp struct {
 	status uint32
 }
 
-func NewDeliver(srcNo string, destNo string, txt string) *Deliver {
+// NewDeliver 上行短信，v为接收连接协商的版本
+func NewDeliver(srcNo string, destNo string, txt string, v Version) *Deliver {
+	return Default().WithVersion(v).NewDeliver(srcNo, destNo, txt)
+}
+
+// NewDeliver 上行短信，按上下文中接收连接协商的版本编码
+func (ctx *Context) NewDeliver(srcNo string, destNo string, txt string) *Deliver {
 	baseLen := uint32(89)
-	head := &MessageHeader{PacketLength: baseLen, RequestId: CmdDeliver, SequenceId: uint32(Seq32.NextVal())}
-	dlv := &Deliver{MessageHeader: head}
-	dlv.msgId = Seq80.NextVal()
+	head := &MessageHeader{PacketLength: baseLen, RequestId: CmdDeliver, SequenceId: uint32(ctx.Seq32.NextVal())}
+	dlv := &Deliver{MessageHeader: head, version: ctx.version(), ctx: ctx}
+	dlv.msgId = ctx.Seq80.NextVal()
 	dlv.isReport = 0
 	dlv.msgFormat = 15
 	dlv.recvTime = time.Now().Format("20060102150405")
 	dlv.srcTermID = srcNo
-	dlv.destTermID = Conf.GetString("sms-display-no") + destNo
+	dlv.destTermID = ctx.Config().DisplayNo + destNo
 	// 上行最长70字符
 	subTxt := txt
 	rs := []rune(txt)
@@ -57,12 +66,44 @@ func NewDeliver(srcNo string, destNo string, txt string) *Deliver {
 	return dlv
 }
 
+// SetMsgFormat 指定上行短信的编码格式，0：ASCII，8：UCS2，15：GB，NewDeliver默认为15
+func (dlv *Deliver) SetMsgFormat(format byte) error {
+	var msg []byte
+	switch format {
+	case 0:
+		for _, r := range dlv.msgContent {
+			if r > 0x7f {
+				return fmt.Errorf("content can not be encoded in ASCII")
+			}
+		}
+		msg = []byte(dlv.msgContent)
+	case 8:
+		msg = comm.Ucs2Encode(dlv.msgContent)
+	case 15:
+		gbs, _ := GbEncoder.String(dlv.msgContent)
+		msg = []byte(gbs)
+	default:
+		return fmt.Errorf("unsupported msg format %d", format)
+	}
+	dlv.PacketLength = dlv.PacketLength - uint32(dlv.msgLength) + uint32(len(msg))
+	dlv.msgFormat = format
+	dlv.msgBytes = msg
+	dlv.msgLength = byte(len(msg))
+	return nil
+}
+
+// NewDeliveryReport MT的状态报告，版本与MT相同
 func NewDeliveryReport(mt *Submit, msgId []byte) *Deliver {
+	return orDefault(mt.ctx).NewDeliveryReport(mt, msgId)
+}
+
+// NewDeliveryReport MT的状态报告，版本与MT相同
+func (ctx *Context) NewDeliveryReport(mt *Submit, msgId []byte) *Deliver {
 	baseLen := uint32(89)
-	head := &MessageHeader{PacketLength: baseLen, RequestId: CmdDeliver, SequenceId: uint32(Seq32.NextVal())}
-	dlv := &Deliver{MessageHeader: head}
+	head := &MessageHeader{PacketLength: baseLen, RequestId: CmdDeliver, SequenceId: uint32(ctx.Seq32.NextVal())}
+	dlv := &Deliver{MessageHeader: head, version: mt.version, ctx: ctx}
 	rpt := NewReport(msgId)
-	dlv.msgId = Seq80.NextVal()
+	dlv.msgId = ctx.Seq80.NextVal()
 	dlv.report = rpt
 	dlv.msgLength = 115
 	dlv.isReport = 1
@@ -94,15 +135,27 @@ func (dlv *Deliver) Encode() []byte {
 		index += int(dlv.msgLength)
 	}
 	index = comm.CopyStr(frame, dlv.reserve, index, 8)
+	if dlv.tlvList != nil {
+		buff := new(bytes.Buffer)
+		err := dlv.tlvList.Write(buff)
+		if err != nil {
+			log.Errorf("%v", err)
+			return nil
+		}
+		copy(frame[index:], buff.Bytes())
+	}
 	return frame
 }
 
-func (dlv *Deliver) Decode(header *MessageHeader, frame []byte) error {
+func (dlv *Deliver) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
 	// check
 	if header == nil || header.RequestId != CmdDeliver || uint32(len(frame)) < (header.PacketLength-HeadLength) {
 		return ErrorPacket
 	}
+	v := orDefault(ctx).version()
 	dlv.MessageHeader = header
+	dlv.ctx = ctx
+	dlv.version = v
 	var index int
 	dlv.msgId = frame[index : index+10]
 	index += 10
@@ -124,14 +177,29 @@ func (dlv *Deliver) Decode(header *MessageHeader, frame []byte) error {
 		if err != nil {
 			return err
 		}
+		index += RptLen
 	} else {
-		bytes, err := GbDecoder.Bytes(frame[index : index+int(dlv.msgLength)])
+		dlv.msgBytes = frame[index : index+int(dlv.msgLength)]
+		index += int(dlv.msgLength)
+	}
+	dlv.reserve = comm.TrimStr(frame[index : index+8])
+	index += 8
+	// 一个tlv至少5字节
+	if v.HasTlv() && uint32(index+5) <= dlv.PacketLength-HeadLength {
+		buf := bytes.NewBuffer(frame[index:])
+		dlv.tlvList, _ = comm.Read(buf)
+	}
+	if !dlv.IsReport() {
+		content := dlv.msgBytes
+		if dlv.TpUdhi() == 1 && len(content) > 0 && int(content[0]) < len(content) {
+			content = content[content[0]+1:]
+		}
+		txt, err := decodeContent(dlv.msgFormat, content)
 		if err != nil {
 			return err
 		}
-		dlv.msgContent = string(bytes)
+		dlv.msgContent = txt
 	}
-	// 后续字节不解析了
 	return nil
 }
 
@@ -141,7 +209,7 @@ func (dlv *Deliver) ToResponse(code uint32) interface{} {
 	header.PacketLength = 26
 	resp := &DeliverResp{MessageHeader: &header}
 	resp.status = code
-	resp.msgId = Seq80.NextVal()
+	resp.msgId = orDefault(dlv.ctx).Seq80.NextVal()
 	return resp
 }
 
@@ -165,6 +233,81 @@ func (dlv *Deliver) IsReport() bool {
 	return dlv.isReport == 1
 }
 
+func (dlv *Deliver) MsgId() []byte {
+	return dlv.msgId
+}
+
+func (dlv *Deliver) SrcTermID() string {
+	return dlv.srcTermID
+}
+
+func (dlv *Deliver) DestTermID() string {
+	return dlv.destTermID
+}
+
+func (dlv *Deliver) MsgContent() string {
+	return dlv.msgContent
+}
+
+func (dlv *Deliver) Report() *Report {
+	return dlv.report
+}
+
+// TlvList 可选参数，SMGP 3.0以下版本或未携带时为nil或为空
+func (dlv *Deliver) TlvList() *comm.TlvList {
+	return dlv.tlvList
+}
+
+// Version 报文的协议版本
+func (dlv *Deliver) Version() Version {
+	return dlv.version
+}
+
+func (dlv *Deliver) MsgFormat() byte {
+	return dlv.msgFormat
+}
+
+func (dlv *Deliver) MsgBytes() []byte {
+	return dlv.msgBytes
+}
+
+// TpUdhi 取自可选参数TP_udhi，为1时消息内容含UDH
+func (dlv *Deliver) TpUdhi() byte {
+	if dlv.tlvList == nil {
+		return 0
+	}
+	tlv, err := dlv.tlvList.Get(TP_udhi)
+	if err != nil || tlv == nil || len(tlv.Value()) == 0 {
+		return 0
+	}
+	return tlv.Value()[0]
+}
+
+// Reassemble 将长短信分片交给组装器，全部分片到达后将消息内容置为完整内容并返回true，
+// 分片未收齐时返回false，非长短信直接返回true
+func (dlv *Deliver) Reassemble(r *comm.Reassembler) bool {
+	if dlv.IsReport() || dlv.TpUdhi() != 1 {
+		return true
+	}
+	data, ok := r.Add(dlv.srcTermID, dlv.destTermID, dlv.msgBytes)
+	if ok {
+		txt, err := decodeContent(dlv.msgFormat, data)
+		if err != nil {
+			log.Errorf("[%-9s] decode content error: %v", "Reassemble", err)
+		}
+		dlv.msgContent = txt
+	}
+	return ok
+}
+
+func decodeContent(msgFormat byte, content []byte) (string, error) {
+	if msgFormat == 8 {
+		return comm.Ucs2Decode(content), nil
+	}
+	bts, err := GbDecoder.Bytes(content)
+	return string(bts), err
+}
+
 func (r *DeliverResp) Encode() []byte {
 	frame := r.MessageHeader.Encode()
 	index := 12
@@ -174,7 +317,7 @@ func (r *DeliverResp) Encode() []byte {
 	return frame
 }
 
-func (r *DeliverResp) Decode(header *MessageHeader, frame []byte) error {
+func (r *DeliverResp) Decode(header *MessageHeader, frame []byte, _ *Context) error {
 	// check
 	if header == nil || header.RequestId != CmdDeliverResp || uint32(len(frame)) < (header.PacketLength-HeadLength) {
 		return ErrorPacket
@@ -193,3 +336,7 @@ func (r *DeliverResp) String() string {
 func (r *DeliverResp) MsgId() string {
 	return fmt.Sprintf("%x", r.msgId)
 }
+
+func (r *DeliverResp) Status() uint32 {
+	return r.status
+}
@@ -1,17 +1,34 @@
 package smgp
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm"
 )
 
 func TestDeliver_Decode(t *testing.T) {
-	dlv := NewDeliver("123", "95535", "TD:123456")
+	dlv := NewDeliver("123", "95535", "TD:123456", ConfVersion())
 	t.Logf("dlv: %s", dlv)
 	testDeliver(t, dlv)
 }
 
+func TestDeliver_SetMsgFormat(t *testing.T) {
+	dlv := NewDeliver("123", "95535", "TD:你好", ConfVersion())
+	assert.Nil(t, dlv.SetMsgFormat(8))
+	assert.Equal(t, byte(10), dlv.msgLength)
+	testDeliver(t, dlv)
+	assert.NotNil(t, dlv.SetMsgFormat(0))
+	assert.NotNil(t, dlv.SetMsgFormat(4))
+
+	dlv = NewDeliver("123", "95535", "TD:123456", ConfVersion())
+	assert.Nil(t, dlv.SetMsgFormat(0))
+	testDeliver(t, dlv)
+}
+
 func TestDeliver_ReportDecode(t *testing.T) {
 	mts := NewSubmit([]string{"17011113333"}, "hello world，世界", MtOptions{})
 	mt := mts[0]
@@ -34,9 +51,17 @@ func testDeliver(t *testing.T, dlv *Deliver) {
 	err := h.Decode(dt)
 	assert.True(t, err == nil)
 	dlvDec := &Deliver{}
-	err = dlvDec.Decode(h, dt[12:])
+	err = dlvDec.Decode(h, dt[12:], Default().WithVersion(dlv.Version()))
 	assert.True(t, err == nil)
 	assert.True(t, dlvDec.MessageHeader.SequenceId == dlv.MessageHeader.SequenceId)
+	assert.Equal(t, dlv.IsReport(), dlvDec.IsReport())
+	assert.Equal(t, dlv.SrcTermID(), dlvDec.SrcTermID())
+	if dlv.IsReport() {
+		assert.Equal(t, dlv.Report().Id(), dlvDec.Report().Id())
+		assert.Equal(t, dlv.Report().Stat(), dlvDec.Report().Stat())
+	} else {
+		assert.Equal(t, dlv.MsgContent(), dlvDec.MsgContent())
+	}
 	t.Logf("dlv_decode: %s", dlvDec)
 
 	// 测试DeliverResp Encode
@@ -48,8 +73,37 @@ func testDeliver(t *testing.T, dlv *Deliver) {
 	err = h.Decode(dt)
 	assert.True(t, err == nil)
 	respDec := &DeliverResp{}
-	err = respDec.Decode(h, dt[12:])
+	err = respDec.Decode(h, dt[12:], Default().WithVersion(dlv.Version()))
 	assert.True(t, err == nil)
 	assert.True(t, respDec.MessageHeader.SequenceId == respDec.MessageHeader.SequenceId)
 	t.Logf("resp_decode: %s", dlvDec)
 }
+
+func TestDeliver_Reassemble(t *testing.T) {
+	txt := strings.Repeat("长短信上行测试，", 20)
+	data, _ := GbEncoder.Bytes([]byte(txt))
+	slices := comm.ToTPUDHISlices(data, 140)
+	assert.True(t, len(slices) > 1)
+
+	r := comm.NewReassembler(time.Minute)
+	for i := len(slices) - 1; i >= 0; i-- {
+		dlv := NewDeliver("13300001111", "10690", "", V30)
+		dlv.msgBytes = slices[i]
+		dlv.msgLength = byte(len(slices[i]))
+		dlv.tlvList = comm.NewTlvList()
+		dlv.tlvList.Add(TP_udhi, []byte{0x01})
+		dlv.PacketLength += uint32(dlv.msgLength) + 5
+
+		h := &MessageHeader{}
+		dt := dlv.Encode()
+		assert.True(t, h.Decode(dt) == nil)
+		dec := &Deliver{}
+		assert.True(t, dec.Decode(h, dt[12:], Default().WithVersion(V30)) == nil)
+		assert.Equal(t, byte(1), dec.TpUdhi())
+		ok := dec.Reassemble(r)
+		assert.Equal(t, i == 0, ok)
+		if ok {
+			assert.Equal(t, txt, dec.MsgContent())
+		}
+	}
+}
@@ -8,7 +8,11 @@ type Exit MessageHeader
 type ExitResp MessageHeader
 
 func NewExit() *Exit {
-	at := &Exit{PacketLength: HeadLength, RequestId: CmdExit, SequenceId: uint32(Seq32.NextVal())}
+	return Default().NewExit()
+}
+
+func (ctx *Context) NewExit() *Exit {
+	at := &Exit{PacketLength: HeadLength, RequestId: CmdExit, SequenceId: uint32(ctx.Seq32.NextVal())}
 	return at
 }
 
@@ -21,7 +25,7 @@ func (at *Exit) Encode() []byte {
 	return (*MessageHeader)(at).Encode()
 }
 
-func (at *Exit) Decode(header *MessageHeader, _ []byte) error {
+func (at *Exit) Decode(header *MessageHeader, _ []byte, _ *Context) error {
 	at.PacketLength = header.PacketLength
 	at.RequestId = header.RequestId
 	at.SequenceId = header.SequenceId
@@ -44,7 +48,7 @@ func (resp *ExitResp) Encode() []byte {
 	return (*MessageHeader)(resp).Encode()
 }
 
-func (resp *ExitResp) Decode(header *MessageHeader, _ []byte) error {
+func (resp *ExitResp) Decode(header *MessageHeader, _ []byte, _ *Context) error {
 	resp.PacketLength = header.PacketLength
 	resp.RequestId = header.RequestId
 	resp.SequenceId = header.SequenceId
@@ -16,7 +16,7 @@ func TestExit(t *testing.T) {
 	t.Logf("%T : %s", h, h)
 
 	e2 := &Exit{}
-	_ = e2.Decode(h, data)
+	_ = e2.Decode(h, data, nil)
 	t.Logf("%T : %s", e2, e2)
 
 	resp := exit.ToResponse(0).(*ExitResp)
@@ -27,6 +27,6 @@ func TestExit(t *testing.T) {
 	_ = h.Decode(data)
 
 	resp2 := &ExitResp{}
-	_ = resp2.Decode(h, data)
+	_ = resp2.Decode(h, data, nil)
 	t.Logf("%T : %s", resp2, resp2)
 }
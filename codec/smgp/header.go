@@ -32,6 +32,47 @@ func (header *MessageHeader) Decode(frame []byte) error {
 	return nil
 }
 
+// Version 协议版本，高4位为主版本号，低4位为次版本号，如0x30表示3.0
+type Version uint8
+
+const (
+	V13        Version = 0x13
+	V20        Version = 0x20
+	V30        Version = 0x30
+	MaxVersion         = V30 // 支持的最高版本，网关未限制账号的版本时按此协商
+)
+
+// Supported 是否为支持的版本：1.3、2.0、3.0
+func (v Version) Supported() bool {
+	return v == V13 || v == V20 || v == V30
+}
+
+// HasTlv 可选参数(TLV)为3.0新增，3.0以下版本的报文不携带可选参数
+func (v Version) HasTlv() bool {
+	return v >= V30
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v>>4, v&0x0f)
+}
+
+// Negotiate 按客户端的版本与服务端支持的最高版本协商，取二者中较低者，客户端的版本不受支持时返回false
+func Negotiate(client, max Version) (Version, bool) {
+	if !client.Supported() {
+		return client, false
+	}
+	v := client
+	if max < v {
+		v = max
+	}
+	return v, v.Supported()
+}
+
+// ConfVersion 配置的版本，客户端登录及未指定版本的报文使用
+func ConfVersion() Version {
+	return Default().ConfVersion()
+}
+
 func (header *MessageHeader) String() string {
 	return fmt.Sprintf("{ PacketLength: %d, RequestId: %s, SequenceId: %d }", header.PacketLength, CommandMap[header.RequestId], header.SequenceId)
 }
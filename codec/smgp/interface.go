@@ -4,9 +4,10 @@ import (
 	"fmt"
 )
 
+// Codec 报文编解码，ctx为连接的上下文，为nil时使用 Default；解码后的报文保留上下文中协商的版本
 type Codec interface {
 	Encode() []byte
-	Decode(header *MessageHeader, frame []byte) error
+	Decode(header *MessageHeader, frame []byte, ctx *Context) error
 }
 
 type Pdu interface {
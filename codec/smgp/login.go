@@ -7,21 +7,25 @@ import (
 	"fmt"
 	"strconv"
 	"time"
+
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/sp"
 )
 
 type Login struct {
-	*MessageHeader             //  【12字节】消息头
-	clientID            string //  【8字节】客户端用来登录服务器端的用户账号。
-	authenticatorClient []byte //  【16字节】客户端认证码，用来鉴别客户端的合法性。
-	loginMode           byte   //  【1字节】客户端用来登录服务器端的登录类型。
-	timestamp           uint32 //  【4字节】时间戳
-	version             byte   //  【1字节】客户端支持的协议版本号
+	*MessageHeader               //  【12字节】消息头
+	clientID            string   //  【8字节】客户端用来登录服务器端的用户账号。
+	authenticatorClient []byte   //  【16字节】客户端认证码，用来鉴别客户端的合法性。
+	loginMode           byte     //  【1字节】客户端用来登录服务器端的登录类型。
+	timestamp           uint32   //  【4字节】时间戳
+	version             Version  //  【1字节】客户端支持的协议版本号
+	ctx                 *Context // 校验账号及生成应答使用的上下文
 }
 type LoginResp struct {
-	*MessageHeader             // 协议头, 12字节
-	status              uint32 // 状态码，4字节
-	authenticatorServer []byte // 认证串，16字节
-	version             byte   // 版本，1字节
+	*MessageHeader              // 协议头, 12字节
+	status              uint32  // 状态码，4字节
+	authenticatorServer []byte  // 认证串，16字节
+	version             Version // 版本，1字节，成功时为协商的版本，版本不支持时为服务端支持的最高版本
 }
 
 const (
@@ -30,21 +34,27 @@ const (
 )
 
 func NewLogin() *Login {
-	lo := &Login{}
+	return Default().NewLogin()
+}
+
+// NewLogin 使用上下文配置的 client-id、shared-secret、version 登录
+func (ctx *Context) NewLogin() *Login {
+	lo := &Login{ctx: ctx}
 	header := &MessageHeader{}
 	header.PacketLength = LoginLen
 	header.RequestId = CmdLogin
-	header.SequenceId = uint32(Seq32.NextVal())
+	header.SequenceId = uint32(ctx.Seq32.NextVal())
 	lo.MessageHeader = header
-	lo.clientID = Conf.GetString("client-id")
+	conf := ctx.Config()
+	lo.clientID = conf.ClientId
 	lo.loginMode = 2
 	ts, _ := strconv.ParseUint(time.Now().Format("0102150405"), 10, 32)
 	lo.timestamp = uint32(ts)
 	// TODO TEST ONLY
 	// lo.timestamp = uint32(705192634)
-	ss := reqAuthMd5(lo)
+	ss := reqAuthMd5(lo.clientID, conf.SharedSecret, lo.timestamp)
 	lo.authenticatorClient = ss[:]
-	lo.version = byte(Conf.GetInt("version"))
+	lo.version = ctx.ConfVersion()
 	return lo
 }
 
@@ -55,49 +65,90 @@ func (lo *Login) Encode() []byte {
 		copy(frame[20:36], lo.authenticatorClient)
 		frame[36] = lo.loginMode
 		binary.BigEndian.PutUint32(frame[37:41], lo.timestamp)
-		frame[41] = lo.version
+		frame[41] = byte(lo.version)
 	}
 	return frame
 }
 
-func (lo *Login) Decode(header *MessageHeader, frame []byte) error {
+func (lo *Login) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
 	// check
 	if header == nil || header.RequestId != CmdLogin || len(frame) < (LoginLen-HeadLength) {
 		return ErrorPacket
 	}
 	lo.MessageHeader = header
+	lo.ctx = ctx
 	lo.clientID = string(frame[0:8])
 	lo.authenticatorClient = frame[8:24]
 	lo.loginMode = frame[24]
 	lo.timestamp = binary.BigEndian.Uint32(frame[25:29])
-	lo.version = frame[29]
+	lo.version = Version(frame[29])
 	return nil
 }
 
+// Version 客户端支持的版本
+func (lo *Login) Version() Version {
+	return lo.version
+}
+
+// ClientID 客户端登录账号
+func (lo *Login) ClientID() string {
+	return comm.TrimStr([]byte(lo.clientID))
+}
+
 func (lo *Login) String() string {
 	return fmt.Sprintf("{ Header: %s, clientID: %s, authenticatorClient: %x, logoinMode: %x, timestamp: %010d, version: %#x }",
-		lo.MessageHeader, lo.clientID, lo.authenticatorClient, lo.loginMode, lo.timestamp, lo.version)
+		lo.MessageHeader, lo.clientID, lo.authenticatorClient, lo.loginMode, lo.timestamp, uint8(lo.version))
 }
 
 func (lo *Login) Check() uint32 {
-	// 大版本不匹配
-	if lo.version&0xf0 != byte(Conf.GetInt("version"))&0xf0 {
+	ctx := orDefault(lo.ctx)
+	acc := ctx.lookupAccount(lo.ClientID())
+	// 不支持的版本，或低于1.3
+	if _, ok := Negotiate(lo.version, accountVersion(acc)); !ok {
 		return 22
 	}
+	// 配置不做校验时返回0
+	if !ctx.Config().AuthCheck {
+		return 0
+	}
+	if acc == nil {
+		log.Warnf("[AuthCheck] unknown client id: %s", lo.ClientID())
+		return 21
+	}
 
 	authSource := lo.authenticatorClient
-	authMd5 := reqAuthMd5(lo)
+	authMd5 := reqAuthMd5(acc.Id, acc.Secret, lo.timestamp)
 	log.Debugf("[AuthCheck] input  : %x", authSource)
 	log.Debugf("[AuthCheck] compute: %x", authMd5)
-	i := bytes.Compare(authSource, authMd5[:])
-	// 配置不做校验或校验通过时返回0
-	if !Conf.GetBool("auth-check") || i == 0 {
+	if bytes.Equal(authSource, authMd5[:]) {
 		return 0
 	}
 	return 21
 }
 
+// accountVersion 账号支持的最高版本，未配置时不限制
+func accountVersion(acc *sp.Account) Version {
+	if acc != nil && acc.Version != 0 {
+		return Version(acc.Version)
+	}
+	return MaxVersion
+}
+
+// AccountVersion 账号支持的最高版本，网关向无在线连接的账号下发报文时使用
+func AccountVersion(id string) Version {
+	return Default().AccountVersion(id)
+}
+
+// accountSecret 账号的shared secret，未知账号使用全局配置
+func (ctx *Context) accountSecret(acc *sp.Account) string {
+	if acc != nil {
+		return acc.Secret
+	}
+	return ctx.Config().SharedSecret
+}
+
 func (lo *Login) ToResponse(code uint32) interface{} {
+	ctx := orDefault(lo.ctx)
 	response := &LoginResp{}
 	header := &MessageHeader{}
 	header.PacketLength = LoginRespLen
@@ -112,19 +163,24 @@ func (lo *Login) ToResponse(code uint32) interface{} {
 	authDt := make([]byte, 0, 64)
 	authDt = append(authDt, fmt.Sprintf("%d", response.status)...)
 	authDt = append(authDt, lo.authenticatorClient...)
-	authDt = append(authDt, Conf.GetString("shared-secret")...)
+	acc := ctx.lookupAccount(lo.ClientID())
+	authDt = append(authDt, ctx.accountSecret(acc)...)
 	auth := md5.Sum(authDt)
 	response.authenticatorServer = auth[:]
-	response.version = byte(Conf.GetInt("version"))
+	version, ok := Negotiate(lo.version, accountVersion(acc))
+	if !ok {
+		version = accountVersion(acc)
+	}
+	response.version = version
 	return response
 }
 
-func reqAuthMd5(connect *Login) [16]byte {
+func reqAuthMd5(clientID string, secret string, timestamp uint32) [16]byte {
 	authDt := make([]byte, 0, 64)
-	authDt = append(authDt, Conf.GetString("client-id")...)
+	authDt = append(authDt, clientID...)
 	authDt = append(authDt, 0, 0, 0, 0, 0, 0, 0)
-	authDt = append(authDt, Conf.GetString("shared-secret")...)
-	authDt = append(authDt, fmt.Sprintf("%010d", connect.timestamp)...)
+	authDt = append(authDt, secret...)
+	authDt = append(authDt, fmt.Sprintf("%010d", timestamp)...)
 	log.Debugf("[AuthCheck] auth data: %x", authDt)
 	authMd5 := md5.Sum(authDt)
 	return authMd5
@@ -139,12 +195,12 @@ func (resp *LoginResp) Encode() []byte {
 		index += 4
 		copy(frame[index:index+16], resp.authenticatorServer)
 		index += 16
-		frame[index] = resp.version
+		frame[index] = byte(resp.version)
 	}
 	return frame
 }
 
-func (resp *LoginResp) Decode(header *MessageHeader, frame []byte) error {
+func (resp *LoginResp) Decode(header *MessageHeader, frame []byte, _ *Context) error {
 	// check
 	if header == nil || header.RequestId != CmdLoginResp || len(frame) < (LoginRespLen-HeadLength) {
 		return ErrorPacket
@@ -155,19 +211,24 @@ func (resp *LoginResp) Decode(header *MessageHeader, frame []byte) error {
 	index = 4
 	resp.authenticatorServer = frame[index : index+16]
 	index += 16
-	resp.version = frame[index]
+	resp.version = Version(frame[index])
 	return nil
 }
 
 func (resp *LoginResp) String() string {
 	return fmt.Sprintf("{ Header: %s, status: {%d: %s}, authenticatorISMG: %x, version: %#x }",
-		resp.MessageHeader, resp.status, ConnectStatusMap[resp.status], resp.authenticatorServer, resp.version)
+		resp.MessageHeader, resp.status, ConnectStatusMap[resp.status], resp.authenticatorServer, uint8(resp.version))
 }
 
 func (resp *LoginResp) Status() uint32 {
 	return resp.status
 }
 
+// Version 服务端应答的版本，登录成功时为该连接使用的版本
+func (resp *LoginResp) Version() Version {
+	return resp.version
+}
+
 var ConnectStatusMap = map[uint32]string{
 	0:  "成功",
 	1:  "系统忙",
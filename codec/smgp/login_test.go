@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/sp"
 )
 
 func TestLogin_Decode(t *testing.T) {
@@ -21,12 +23,72 @@ func TestLogin_Decode(t *testing.T) {
 		assert.True(t, len(dt1) == LoginLen)
 		assert.True(t, len(dt2) == LoginRespLen)
 
-		err := lo.Decode(lo.MessageHeader, dt1[12:])
+		err := lo.Decode(lo.MessageHeader, dt1[12:], Default().WithVersion(lo.Version()))
 		assert.True(t, err == nil)
 		t.Logf("loginDec: %s, err: %s", lo, err)
-		err = resp.Decode(resp.MessageHeader, dt2[12:])
+		err = resp.Decode(resp.MessageHeader, dt2[12:], Default().WithVersion(lo.Version()))
 		assert.True(t, err == nil)
 		t.Logf("respDec : %s, err: %s", resp, err)
 		i--
 	}
 }
+
+func TestLogin_Check(t *testing.T) {
+	accounts, err := sp.Load(Conf, "client-id")
+	assert.Nil(t, err)
+	// 开启登录校验
+	authCheck := Conf.GetBool("auth-check")
+	Conf.Set("auth-check", true)
+	Accounts = accounts
+	defer func() {
+		Conf.Set("auth-check", authCheck)
+		Accounts = nil
+	}()
+
+	lo := NewLogin()
+	assert.Equal(t, uint32(0), lo.Check())
+
+	lo.clientID = "87654321"
+	assert.Equal(t, uint32(21), lo.Check())
+	md5str := reqAuthMd5(lo.clientID, "another secret", lo.timestamp)
+	lo.authenticatorClient = md5str[:]
+	assert.Equal(t, uint32(0), lo.Check())
+
+	lo.clientID = "00000000"
+	assert.Equal(t, uint32(21), lo.Check())
+}
+
+func TestLogin_Negotiate(t *testing.T) {
+	accounts, err := sp.Load(Conf, "client-id")
+	assert.Nil(t, err)
+	Accounts = accounts
+	defer func() { Accounts = nil }()
+
+	// 未限制版本的账号，按客户端的版本应答
+	for _, v := range []Version{V13, V20, V30} {
+		lo := NewLogin()
+		lo.version = v
+		resp := lo.ToResponse(0).(*LoginResp)
+		assert.Equal(t, uint32(0), resp.Status())
+		assert.Equal(t, v, resp.Version())
+	}
+
+	// 不支持的版本
+	for _, v := range []Version{0x12, 0x31, 0x40} {
+		lo := NewLogin()
+		lo.version = v
+		resp := lo.ToResponse(0).(*LoginResp)
+		assert.Equal(t, uint32(22), resp.Status())
+		assert.Equal(t, MaxVersion, resp.Version())
+	}
+
+	// 账号仅支持2.0，3.0的客户端按2.0应答
+	acc, _ := accounts.Get("87654321")
+	acc.Version = int(V20)
+	lo := NewLogin()
+	lo.clientID = "87654321"
+	lo.version = V30
+	resp := lo.ToResponse(0).(*LoginResp)
+	assert.Equal(t, uint32(0), resp.Status())
+	assert.Equal(t, V20, resp.Version())
+}
@@ -13,22 +13,25 @@ type MtOptions struct {
 	AtTime        time.Time     // 短消息定时发送时间
 	ValidDuration time.Duration // 短消息有效时长
 	SrcTermID     string        // 会拼接到配置文件的sms-display-no后面
+	Version       Version       // 协议版本，未指定时使用上下文协商的版本或配置的version，3.0以下版本不携带可选参数
 }
 
 func (s *Submit) SetOptions(options MtOptions) {
-	s.needReport = byte(Conf.GetInt("need-report"))
+	ctx := orDefault(s.ctx)
+	conf := ctx.Config()
+	s.needReport = byte(conf.NeedReport)
 	// 有点小bug，不能通过传参的方式设置未变量的"零值"
 	if options.NeedReport != 0 {
 		s.needReport = options.NeedReport
 	}
 
-	s.priority = byte(Conf.GetInt("Priority"))
+	s.priority = byte(conf.Priority)
 	// 有点小bug，不能通过传参的方式设置未变量的"零值"
 	if options.Priority != 0 {
 		s.priority = options.Priority
 	}
 
-	s.serviceID = Conf.GetString("service-id")
+	s.serviceID = conf.ServiceId
 	if options.ServiceID != "" {
 		s.serviceID = options.ServiceID
 	}
@@ -41,13 +44,18 @@ func (s *Submit) SetOptions(options MtOptions) {
 
 	vt := time.Now()
 	if options.ValidDuration != 0 {
-		vt.Add(options.ValidDuration)
+		vt = vt.Add(options.ValidDuration)
 	} else {
-		vt.Add(Conf.GetDuration("default-valid-duration"))
+		vt = vt.Add(conf.ValidDuration)
 	}
 	s.validTime = comm.FormatTime(vt)
 
-	s.srcTermID = Conf.GetString("sms-display-no")
+	s.version = ctx.version()
+	if options.Version != 0 {
+		s.version = options.Version
+	}
+
+	s.srcTermID = conf.DisplayNo
 	if options.SrcTermID != "" {
 		s.srcTermID += options.SrcTermID
 	}
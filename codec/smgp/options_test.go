@@ -3,6 +3,10 @@ package smgp
 import (
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm"
 )
 
 func TestMtOptions(t *testing.T) {
@@ -13,3 +17,15 @@ func TestMtOptions(t *testing.T) {
 	var d time.Duration
 	t.Logf("%v", d)
 }
+
+func TestSubmit_SetOptions(t *testing.T) {
+	now := time.Now()
+	sub := NewSubmit([]string{"17600001111"}, "hello", MtOptions{ValidDuration: time.Hour})[0]
+	vt, ok := comm.ParseTime(sub.ValidTime(), now)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour.Seconds(), vt.Sub(now).Seconds(), 1)
+
+	sub = NewSubmit([]string{"17600001111"}, "hello", MtOptions{})[0]
+	vt, _ = comm.ParseTime(sub.ValidTime(), now)
+	assert.InDelta(t, Conf.GetDuration("default-valid-duration").Seconds(), vt.Sub(now).Seconds(), 1)
+}
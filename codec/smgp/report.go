@@ -116,6 +116,46 @@ func (rt *Report) Decode(frame []byte) error {
 	return nil
 }
 
+func (rt *Report) Id() []byte {
+	return rt.id
+}
+
+func (rt *Report) Stat() string {
+	return rt.stat
+}
+
+// SetErr 指定状态报告的错误码，stat取错误码对应的最终状态，如"001"对应 EXPIRED
+func (rt *Report) SetErr(err string) {
+	rt.err = err
+	rt.stat = reportStatMap[err]
+}
+
+// SetStat 指定状态报告的最终状态，err与之不对应时取对应该状态的最小错误码，没有对应的错误码时为"999"
+func (rt *Report) SetStat(stat string) {
+	rt.stat = stat
+	if reportStatMap[rt.err] == stat {
+		return
+	}
+	rt.err = "999"
+	for code, s := range reportStatMap {
+		if s == stat && code < rt.err {
+			rt.err = code
+		}
+	}
+}
+
+func (rt *Report) Err() string {
+	return rt.err
+}
+
+func (rt *Report) SubmitDate() string {
+	return rt.submitDate
+}
+
+func (rt *Report) DoneDate() string {
+	return rt.doneDate
+}
+
 var reportStatMap = map[string]string{
 	"000": "DELIVRD", // 成功
 	"001": "EXPIRED", // 用户不能通信
@@ -18,4 +18,19 @@ func TestReport(t *testing.T) {
 	err := rpt2.Decode(data)
 	assert.True(t, err == nil)
 	t.Logf("rpt2: %s", rpt2)
+
+	rpt.SetErr("001")
+	assert.Equal(t, "EXPIRED", rpt.Stat())
+	_ = rpt2.Decode(rpt.Encode())
+	assert.Equal(t, "EXPIRED", rpt2.Stat())
+	assert.Equal(t, "001", rpt2.Err())
+
+	rpt.SetStat("UNDELIV")
+	assert.Equal(t, "003", rpt.Err())
+	rpt.SetErr("005")
+	rpt.SetStat("UNDELIV")
+	assert.Equal(t, "005", rpt.Err())
+	rpt.SetStat("REJECTD")
+	assert.Equal(t, "999", rpt.Err())
+	assert.Equal(t, "REJECTD", rpt.Stat())
 }
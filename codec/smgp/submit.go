@@ -29,6 +29,8 @@ type Submit struct {
 	msgBytes        []byte        // 消息内容按照Msg_Fmt编码后的数据
 	reserve         string        // 【8字节】保留
 	tlvList         *comm.TlvList // 【TLV】可选项参数
+	version         Version       // 报文的协议版本，3.0以下版本不携带可选参数
+	ctx             *Context      // 生成应答及状态报告使用的上下文
 }
 
 type SubmitResp struct {
@@ -40,17 +42,23 @@ type SubmitResp struct {
 const MtBaseLen = 126
 
 func NewSubmit(phones []string, content string, options MtOptions) (messages []*Submit) {
+	return Default().NewSubmit(phones, content, options)
+}
+
+// NewSubmit 未指定的参数取自上下文的配置，未指定 MtOptions.Version 时按上下文的版本编码
+func (ctx *Context) NewSubmit(phones []string, content string, options MtOptions) (messages []*Submit) {
 
-	head := &MessageHeader{PacketLength: MtBaseLen, RequestId: CmdSubmit, SequenceId: uint32(Seq32.NextVal())}
-	mt := &Submit{}
+	head := &MessageHeader{PacketLength: MtBaseLen, RequestId: CmdSubmit, SequenceId: uint32(ctx.Seq32.NextVal())}
+	mt := &Submit{ctx: ctx}
 	mt.MessageHeader = head
 	mt.SetOptions(options)
 	mt.msgType = 6
 	// 从配置文件设置属性
-	mt.feeType = Conf.GetString("fee-type")
-	mt.feeCode = Conf.GetString("fee-code")
-	mt.chargeTermID = Conf.GetString("charge-term-id")
-	mt.fixedFee = Conf.GetString("fixed-fee")
+	conf := ctx.Config()
+	mt.feeType = conf.FeeType
+	mt.feeCode = conf.FeeCode
+	mt.chargeTermID = conf.ChargeTermID
+	mt.fixedFee = conf.FixedFee
 	// 初步设置入参
 	mt.destTermID = phones
 	mt.destTermIDCount = byte(len(phones))
@@ -74,20 +82,23 @@ func NewSubmit(phones []string, content string, options MtOptions) (messages []*
 			sub := &tmp
 			sub.MessageHeader = &tmpHead
 			if i != 0 {
-				sub.SequenceId = uint32(Seq32.NextVal())
+				sub.SequenceId = uint32(ctx.Seq32.NextVal())
 			}
 			sub.msgLength = byte(len(dt))
 			sub.msgBytes = dt
 			l := 0
-			sub.tlvList = comm.NewTlvList()
-			sub.tlvList.Add(TP_pid, []byte{0x01})
-			l += 5
-			sub.tlvList.Add(TP_udhi, []byte{0x01})
-			l += 5
-			sub.tlvList.Add(PkTotal, []byte{byte(len(slices))})
-			l += 5
-			sub.tlvList.Add(PkNumber, []byte{byte(i)})
-			l += 5
+			// 3.0以下版本没有可选参数，长短信分片不携带TP_udhi等参数
+			if sub.version.HasTlv() {
+				sub.tlvList = comm.NewTlvList()
+				sub.tlvList.Add(TP_pid, []byte{0x01})
+				l += 5
+				sub.tlvList.Add(TP_udhi, []byte{0x01})
+				l += 5
+				sub.tlvList.Add(PkTotal, []byte{byte(len(slices))})
+				l += 5
+				sub.tlvList.Add(PkNumber, []byte{byte(i)})
+				l += 5
+			}
 			sub.PacketLength = uint32(MtBaseLen + len(sub.destTermID)*21 + int(sub.msgLength) + l)
 			messages = append(messages, sub)
 		}
@@ -134,12 +145,15 @@ func (s *Submit) Encode() []byte {
 	return frame
 }
 
-func (s *Submit) Decode(header *MessageHeader, frame []byte) error {
+func (s *Submit) Decode(header *MessageHeader, frame []byte, ctx *Context) error {
 	// check
 	if header == nil || header.RequestId != CmdSubmit || uint32(len(frame)) < (header.PacketLength-HeadLength) {
 		return ErrorPacket
 	}
+	v := orDefault(ctx).version()
 	s.MessageHeader = header
+	s.ctx = ctx
+	s.version = v
 
 	var index int
 	s.msgType = frame[index]
@@ -185,7 +199,7 @@ func (s *Submit) Decode(header *MessageHeader, frame []byte) error {
 	s.reserve = comm.TrimStr(frame[index : index+8])
 	index += 8
 	// 一个tlv至少5字节
-	if uint32(index+5) < s.PacketLength {
+	if v.HasTlv() && uint32(index+5) < s.PacketLength {
 		buf := bytes.NewBuffer(frame[index:])
 		s.tlvList, _ = comm.Read(buf)
 	}
@@ -198,10 +212,16 @@ func (s *Submit) ToResponse(code uint32) interface{} {
 	header.PacketLength = 26
 	resp := &SubmitResp{MessageHeader: &header}
 	resp.status = code
-	resp.msgId = Seq80.NextVal()
+	resp.msgId = orDefault(s.ctx).Seq80.NextVal()
 	return resp
 }
 
+// NewSubmitResp 未解码Submit时直接应答，如接收窗口已满时的流量控制，MsgID取自上下文的流水号
+func (ctx *Context) NewSubmitResp(header *MessageHeader, code uint32) *SubmitResp {
+	sub := &Submit{MessageHeader: header, version: orDefault(ctx).version(), ctx: ctx}
+	return sub.ToResponse(code).(*SubmitResp)
+}
+
 func (s *Submit) String() string {
 	bts := s.msgBytes
 	if s.msgLength > 6 {
@@ -217,6 +237,53 @@ func (s *Submit) String() string {
 		s.reserve, s.tlvList)
 }
 
+func (s *Submit) DestTermID() []string {
+	return s.destTermID
+}
+
+func (s *Submit) MsgContent() string {
+	return s.msgContent
+}
+
+func (s *Submit) ServiceID() string {
+	return s.serviceID
+}
+
+func (s *Submit) SrcTermID() string {
+	return s.srcTermID
+}
+
+func (s *Submit) AtTime() string {
+	return s.atTime
+}
+
+func (s *Submit) ValidTime() string {
+	return s.validTime
+}
+
+// TlvList 可选参数，SMGP 3.0以下版本或未携带时为nil或为空
+func (s *Submit) TlvList() *comm.TlvList {
+	return s.tlvList
+}
+
+// Version 报文的协议版本
+func (s *Submit) Version() Version {
+	return s.version
+}
+
+// SetVersion 按连接协商的版本发送，3.0以下版本去掉可选参数
+func (s *Submit) SetVersion(v Version) {
+	s.version = v
+	if v.HasTlv() || s.tlvList == nil {
+		return
+	}
+	buff := new(bytes.Buffer)
+	if err := s.tlvList.Write(buff); err == nil {
+		s.PacketLength -= uint32(buff.Len())
+	}
+	s.tlvList = nil
+}
+
 func (r *SubmitResp) Encode() []byte {
 	frame := r.MessageHeader.Encode()
 	index := 12
@@ -226,7 +293,7 @@ func (r *SubmitResp) Encode() []byte {
 	return frame
 }
 
-func (r *SubmitResp) Decode(header *MessageHeader, frame []byte) error {
+func (r *SubmitResp) Decode(header *MessageHeader, frame []byte, _ *Context) error {
 	// check
 	if header == nil || header.RequestId != CmdSubmitResp || uint32(len(frame)) < (header.PacketLength-HeadLength) {
 		return ErrorPacket
@@ -68,7 +68,7 @@ func decode(t *testing.T, phones []string, txt string, l int) {
 			continue
 		}
 		subDec := &Submit{}
-		err = subDec.Decode(&head, dt[12:])
+		err = subDec.Decode(&head, dt[12:], Default().WithVersion(sub.Version()))
 		if err != nil {
 			t.Fail()
 			continue
@@ -90,7 +90,7 @@ func decode(t *testing.T, phones []string, txt string, l int) {
 			continue
 		}
 		respDec := &SubmitResp{}
-		err = respDec.Decode(&head, dt[12:])
+		err = respDec.Decode(&head, dt[12:], Default().WithVersion(sub.Version()))
 		if err != nil {
 			t.Fail()
 			continue
@@ -102,6 +102,35 @@ func decode(t *testing.T, phones []string, txt string, l int) {
 	}
 }
 
+func TestSubmit_Version(t *testing.T) {
+	// 3.0以下版本的长短信分片不携带可选参数
+	subs := NewSubmit([]string{"17600001111"}, Poem, MtOptions{Version: V20})
+	assert.True(t, len(subs) > 1)
+	for _, sub := range subs {
+		assert.Nil(t, sub.TlvList())
+		dt := sub.Encode()
+		assert.Equal(t, int(sub.PacketLength), len(dt))
+		head := &MessageHeader{}
+		assert.Nil(t, head.Decode(dt))
+		dec := &Submit{}
+		assert.Nil(t, dec.Decode(head, dt[12:], Default().WithVersion(V20)))
+		assert.Equal(t, V20, dec.Version())
+		assert.Equal(t, dt, dec.Encode())
+	}
+
+	// 按2.0发送时去掉可选参数
+	subs = NewSubmit([]string{"17600001111"}, Poem, MtOptions{Version: V30})
+	sub := subs[0]
+	assert.NotNil(t, sub.TlvList())
+	l := sub.PacketLength
+	sub.SetVersion(V20)
+	assert.Nil(t, sub.TlvList())
+	assert.Equal(t, l-20, sub.PacketLength)
+	assert.Equal(t, int(sub.PacketLength), len(sub.Encode()))
+	rpt := NewDeliveryReport(sub, Seq80.NextVal())
+	assert.Equal(t, V20, rpt.Version())
+}
+
 func TestGbk(t *testing.T) {
 	gb, _ := GbEncoder.String(Poem)
 	gbDec, _ := GbDecoder.String(gb)
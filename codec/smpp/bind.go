@@ -0,0 +1,176 @@
+package smpp
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+// Bind bind_transmitter、bind_receiver、bind_transceiver 的消息体结构相同，通过CommandId区分
+type Bind struct {
+	*MessageHeader          // 【16字节】消息头
+	systemId         string // 【最长16字节】ESME的标识
+	password         string // 【最长9字节】密码
+	systemType       string // 【最长13字节】ESME的类型
+	interfaceVersion byte   // 【1字节】SMPP协议版本号，3.4版本为0x34
+	addrTon          byte   // 【1字节】ESME地址的TON
+	addrNpi          byte   // 【1字节】ESME地址的NPI
+	addressRange     string // 【最长41字节】ESME服务的地址范围
+}
+
+func NewBind(commandId uint32) *Bind {
+	header := &MessageHeader{CommandId: commandId, SequenceNumber: uint32(Seq32.NextVal())}
+	bind := &Bind{MessageHeader: header}
+	bind.systemId = Conf.GetString("system-id")
+	bind.password = Conf.GetString("password")
+	bind.systemType = Conf.GetString("system-type")
+	bind.interfaceVersion = byte(Conf.GetInt("interface-version"))
+	bind.addrTon = byte(Conf.GetInt("source-addr-ton"))
+	bind.addrNpi = byte(Conf.GetInt("source-addr-npi"))
+	return bind
+}
+
+func (b *Bind) Encode() []byte {
+	var buf bytes.Buffer
+	writeCStr(&buf, b.systemId, 16)
+	writeCStr(&buf, b.password, 9)
+	writeCStr(&buf, b.systemType, 13)
+	buf.WriteByte(b.interfaceVersion)
+	buf.WriteByte(b.addrTon)
+	buf.WriteByte(b.addrNpi)
+	writeCStr(&buf, b.addressRange, 41)
+	return b.MessageHeader.encodeWithBody(buf.Bytes())
+}
+
+func (b *Bind) Decode(header *MessageHeader, frame []byte) (err error) {
+	// check
+	if header == nil || !IsBind(header.CommandId) {
+		return ErrorPacket
+	}
+	b.MessageHeader = header
+	index := 0
+	if b.systemId, index, err = readCStr(frame, index, 16); err != nil {
+		return err
+	}
+	if b.password, index, err = readCStr(frame, index, 9); err != nil {
+		return err
+	}
+	if b.systemType, index, err = readCStr(frame, index, 13); err != nil {
+		return err
+	}
+	if b.interfaceVersion, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if b.addrTon, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if b.addrNpi, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	b.addressRange, _, err = readCStr(frame, index, 41)
+	return err
+}
+
+func (b *Bind) String() string {
+	return fmt.Sprintf("{ header: %s, systemId: %s, password: ******, systemType: %s, interfaceVersion: %#x, "+
+		"addrTon: %d, addrNpi: %d, addressRange: %s }",
+		b.MessageHeader, b.systemId, b.systemType, b.interfaceVersion, b.addrTon, b.addrNpi, b.addressRange)
+}
+
+func (b *Bind) Check() uint32 {
+	// 配置不做校验或校验通过时返回0
+	if !Conf.GetBool("auth-check") {
+		return ESME_ROK
+	}
+	if b.systemId != Conf.GetString("system-id") {
+		return ESME_RINVSYSID
+	}
+	if b.password != Conf.GetString("password") {
+		return ESME_RINVPASWD
+	}
+	return ESME_ROK
+}
+
+func (b *Bind) ToResponse(code uint32) interface{} {
+	if code == 0 {
+		code = b.Check()
+	}
+	header := &MessageHeader{CommandId: b.CommandId | respFlag, CommandStatus: code, SequenceNumber: b.SequenceNumber}
+	resp := &BindResp{MessageHeader: header}
+	if code == ESME_ROK {
+		resp.systemId = Conf.GetString("smsc-id")
+		resp.tlvList = comm.NewTlvList()
+		resp.tlvList.Add(TagScInterfaceVersion, []byte{byte(Conf.GetInt("interface-version"))})
+	}
+	return resp
+}
+
+func (b *Bind) SystemId() string {
+	return b.systemId
+}
+
+// IsReceiver 是否可以接收上行短信及状态报告
+func (b *Bind) IsReceiver() bool {
+	return b.CommandId == SMPP_BIND_RECEIVER || b.CommandId == SMPP_BIND_TRANSCEIVER
+}
+
+// IsTransmitter 是否可以提交短信
+func (b *Bind) IsTransmitter() bool {
+	return b.CommandId == SMPP_BIND_TRANSMITTER || b.CommandId == SMPP_BIND_TRANSCEIVER
+}
+
+// IsBind 是否为绑定请求
+func IsBind(commandId uint32) bool {
+	return commandId == SMPP_BIND_RECEIVER || commandId == SMPP_BIND_TRANSMITTER || commandId == SMPP_BIND_TRANSCEIVER
+}
+
+type BindResp struct {
+	*MessageHeader               // 【16字节】消息头
+	systemId       string        // 【最长16字节】SMSC的标识，command_status不为0时不返回消息体
+	tlvList        *comm.TlvList // 【TLV】可选参数，sc_interface_version
+}
+
+func (r *BindResp) Encode() []byte {
+	if r.CommandStatus != ESME_ROK {
+		return r.MessageHeader.encodeWithBody(nil)
+	}
+	var buf bytes.Buffer
+	writeCStr(&buf, r.systemId, 16)
+	if r.tlvList != nil {
+		_ = r.tlvList.Write(&buf)
+	}
+	return r.MessageHeader.encodeWithBody(buf.Bytes())
+}
+
+func (r *BindResp) Decode(header *MessageHeader, frame []byte) (err error) {
+	// check
+	if header == nil || !IsBind(header.CommandId&^respFlag) || header.CommandId&respFlag == 0 {
+		return ErrorPacket
+	}
+	r.MessageHeader = header
+	if len(frame) == 0 {
+		return nil
+	}
+	var index int
+	if r.systemId, index, err = readCStr(frame, 0, 16); err != nil {
+		return err
+	}
+	if index < len(frame) {
+		r.tlvList, err = comm.Read(bytes.NewBuffer(frame[index:]))
+	}
+	return err
+}
+
+func (r *BindResp) String() string {
+	return fmt.Sprintf("{ header: %s, status: {%d: %s}, systemId: %s, tlvList: %s }",
+		r.MessageHeader, r.CommandStatus, StatusMap[r.CommandStatus], r.systemId, r.tlvList)
+}
+
+func (r *BindResp) Status() uint32 {
+	return r.CommandStatus
+}
+
+func (r *BindResp) SystemId() string {
+	return r.systemId
+}
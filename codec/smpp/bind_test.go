@@ -0,0 +1,59 @@
+package smpp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBind(t *testing.T) {
+	for _, id := range []uint32{SMPP_BIND_TRANSMITTER, SMPP_BIND_RECEIVER, SMPP_BIND_TRANSCEIVER} {
+		bind := NewBind(id)
+		t.Logf("bind    : %s", bind)
+		data := bind.Encode()
+		assert.Equal(t, int(bind.CommandLength), len(data))
+
+		h := &MessageHeader{}
+		_ = h.Decode(data)
+		bind2 := &Bind{}
+		err := bind2.Decode(h, data[HeadLength:])
+		assert.True(t, err == nil)
+		assert.Equal(t, Conf.GetString("system-id"), bind2.SystemId())
+		assert.Equal(t, data, bind2.Encode())
+		t.Logf("bindDec : %s", bind2)
+
+		resp := bind2.ToResponse(0).(*BindResp)
+		data = resp.Encode()
+		_ = h.Decode(data)
+		resp2 := &BindResp{}
+		err = resp2.Decode(h, data[HeadLength:])
+		assert.True(t, err == nil)
+		assert.Equal(t, id|respFlag, resp2.CommandId)
+		assert.Equal(t, bind.SequenceNumber, resp2.SequenceNumber)
+		assert.Equal(t, ESME_ROK, resp2.Status())
+		assert.Equal(t, Conf.GetString("smsc-id"), resp2.SystemId())
+		t.Logf("respDec : %s", resp2)
+	}
+}
+
+func TestBindResp_Error(t *testing.T) {
+	bind := NewBind(SMPP_BIND_TRANSCEIVER)
+	resp := bind.ToResponse(ESME_RINVPASWD).(*BindResp)
+	data := resp.Encode()
+	assert.Equal(t, HeadLength, len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	resp2 := &BindResp{}
+	assert.True(t, resp2.Decode(h, data[HeadLength:]) == nil)
+	assert.Equal(t, ESME_RINVPASWD, resp2.Status())
+}
+
+func TestBind_DecodeError(t *testing.T) {
+	data := NewBind(SMPP_BIND_TRANSMITTER).Encode()
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	// 截断后找不到C-Octet String的结束符
+	err := (&Bind{}).Decode(h, data[HeadLength:HeadLength+3])
+	assert.Equal(t, ErrorPacket, err)
+}
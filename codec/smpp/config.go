@@ -0,0 +1,93 @@
+package smpp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+var log = logging.GetDefaultLogger()
+var ErrorPacket = errors.New("error packet")
+var Conf yml_config.YmlConfig
+var Seq32 Sequence32
+var Seq64 Sequence64
+
+// Config 配置文件中的参数，各参数的含义见 config/smpp.yaml。
+// 报文编解码仍通过 Conf 按名称读取，此处列出各参数的类型，供网关注册同名的命令行参数，见 yml_config.NewOverrides
+type Config struct {
+	// 网关参数
+	SystemId            string        `mapstructure:"system-id"`
+	Password            string        `mapstructure:"password"`
+	SystemType          string        `mapstructure:"system-type"`
+	AuthCheck           bool          `mapstructure:"auth-check"`
+	SmscId              string        `mapstructure:"smsc-id"`
+	InterfaceVersion    int           `mapstructure:"interface-version"`
+	MaxCons             int           `mapstructure:"max-cons"`
+	EnquireLinkDuration time.Duration `mapstructure:"enquire-link-duration"`
+	DatacenterId        int           `mapstructure:"datacenter-id"`
+	WorkerId            int           `mapstructure:"worker-id"`
+	ReceiveWindowSize   int           `mapstructure:"receive-window-size"`
+	MaxPoolSize         int           `mapstructure:"max-pool-size"`
+
+	// MT消息相关
+	SourceAddr           string        `mapstructure:"source-addr"`
+	SourceAddrTon        int           `mapstructure:"source-addr-ton"`
+	SourceAddrNpi        int           `mapstructure:"source-addr-npi"`
+	DestAddrTon          int           `mapstructure:"dest-addr-ton"`
+	DestAddrNpi          int           `mapstructure:"dest-addr-npi"`
+	ServiceType          string        `mapstructure:"service-type"`
+	RegisteredDelivery   int           `mapstructure:"registered-delivery"`
+	PriorityFlag         int           `mapstructure:"priority-flag"`
+	DefaultValidDuration time.Duration `mapstructure:"default-valid-duration"`
+	Gsm7Packed           bool          `mapstructure:"gsm7-packed"`
+
+	// 模拟网关相关参数
+	SuccessRate     float64 `mapstructure:"success-rate"`
+	MinSubmitRespMs int     `mapstructure:"min-submit-resp-ms"`
+	MaxSubmitRespMs int     `mapstructure:"max-submit-resp-ms"`
+	FixReportRespMs int     `mapstructure:"fix-report-resp-ms"`
+}
+
+// 可选参数（TLV）的Tag
+const (
+	TagDestAddrSubunit      = uint16(0x0005)
+	TagSourceAddrSubunit    = uint16(0x000D)
+	TagPayloadType          = uint16(0x0019)
+	TagReceiptedMessageId   = uint16(0x001E)
+	TagUserMessageReference = uint16(0x0204)
+	TagSourcePort           = uint16(0x020A)
+	TagDestinationPort      = uint16(0x020B)
+	TagSarMsgRefNum         = uint16(0x020C)
+	TagSarTotalSegments     = uint16(0x020E)
+	TagSarSegmentSeqnum     = uint16(0x020F)
+	TagScInterfaceVersion   = uint16(0x0210)
+	TagNetworkErrorCode     = uint16(0x0423)
+	TagMessagePayload       = uint16(0x0424)
+	TagMessageState         = uint16(0x0427)
+)
+
+// message_state 取值
+const (
+	StateEnroute       = byte(1)
+	StateDelivered     = byte(2)
+	StateExpired       = byte(3)
+	StateDeleted       = byte(4)
+	StateUndeliverable = byte(5)
+	StateAccepted      = byte(6)
+	StateUnknown       = byte(7)
+	StateRejected      = byte(8)
+)
+
+// StateMap message_state 与状态报告文本中 stat 的对应关系
+var StateMap = map[byte]string{
+	StateEnroute:       "ENROUTE",
+	StateDelivered:     "DELIVRD",
+	StateExpired:       "EXPIRED",
+	StateDeleted:       "DELETED",
+	StateUndeliverable: "UNDELIV",
+	StateAccepted:      "ACCEPTD",
+	StateUnknown:       "UNKNOWN",
+	StateRejected:      "REJECTD",
+}
@@ -0,0 +1,39 @@
+package smpp
+
+import (
+	"bytes"
+)
+
+// 写入C-Octet String，max为包含结尾\0在内的最大长度，超长部分会被截断
+func writeCStr(buf *bytes.Buffer, s string, max int) {
+	if len(s) > max-1 {
+		s = s[:max-1]
+	}
+	buf.WriteString(s)
+	buf.WriteByte(0)
+}
+
+// 从frame的index位置读取C-Octet String，返回字符串及下一个字段的位置
+// max为包含结尾\0在内的最大长度，找不到结尾\0时返回错误
+func readCStr(frame []byte, index int, max int) (string, int, error) {
+	if index >= len(frame) {
+		return "", index, ErrorPacket
+	}
+	end := len(frame)
+	if index+max < end {
+		end = index + max
+	}
+	i := bytes.IndexByte(frame[index:end], 0)
+	if i < 0 {
+		return "", index, ErrorPacket
+	}
+	return string(frame[index : index+i]), index + i + 1, nil
+}
+
+// 读取单字节字段
+func readByte(frame []byte, index int) (byte, int, error) {
+	if index >= len(frame) {
+		return 0, index, ErrorPacket
+	}
+	return frame[index], index + 1, nil
+}
@@ -0,0 +1,142 @@
+package smpp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+// Deliver 上行短信或状态报告，esm_class为0x04时为状态报告
+type Deliver struct {
+	*MessageHeader // 【16字节】消息头
+	shortMessage   // 消息体
+}
+
+// NewDeliver 上行短信，不支持长短信
+func NewDeliver(sourceAddr string, content string, destAddr string) *Deliver {
+	header := &MessageHeader{CommandId: SMPP_DELIVER_SM, SequenceNumber: uint32(Seq32.NextVal())}
+	dlv := &Deliver{MessageHeader: header}
+	dlv.serviceType = Conf.GetString("service-type")
+	dlv.sourceAddrTon = byte(Conf.GetInt("dest-addr-ton"))
+	dlv.sourceAddrNpi = byte(Conf.GetInt("dest-addr-npi"))
+	dlv.sourceAddr = sourceAddr
+	dlv.destAddrTon = byte(Conf.GetInt("source-addr-ton"))
+	dlv.destAddrNpi = byte(Conf.GetInt("source-addr-npi"))
+	dlv.destinationAddr = Conf.GetString("source-addr") + destAddr
+	dlv.dataCoding = MsgCoding(content)
+	// 上行不支持长短信，只取第一片的内容
+	rs := []rune(content)
+	if dlv.dataCoding == 8 && len(rs) > 70 {
+		content = string(rs[:70])
+	} else if dlv.dataCoding == 0 {
+		// 只取前160个septet，转义符不与扩展字符分开
+		septets, _ := comm.Gsm7Encode(content)
+		if l := len(septets); l > 160 {
+			l = 160
+			if septets[l-1] == 0x1B {
+				l--
+			}
+			content = comm.Gsm7Decode(septets[:l])
+		}
+	}
+	dlv.msgContent = content
+	dlv.msgBytes = MsgSlices(dlv.dataCoding, content)[0]
+	dlv.smLength = byte(len(dlv.msgBytes))
+	return dlv
+}
+
+// NewDeliveryReceipt 根据MT短信生成状态报告
+func NewDeliveryReceipt(mt *Submit, msgId string) *Deliver {
+	header := &MessageHeader{CommandId: SMPP_DELIVER_SM, SequenceNumber: uint32(Seq32.NextVal())}
+	dlv := &Deliver{MessageHeader: header}
+	dlv.serviceType = mt.serviceType
+	dlv.sourceAddrTon = mt.destAddrTon
+	dlv.sourceAddrNpi = mt.destAddrNpi
+	dlv.sourceAddr = mt.destinationAddr
+	dlv.destAddrTon = mt.sourceAddrTon
+	dlv.destAddrNpi = mt.sourceAddrNpi
+	dlv.destinationAddr = mt.sourceAddr
+	dlv.esmClass = 0x04
+
+	rpt := NewReceipt(msgId, header.SequenceNumber)
+	dlv.msgContent = rpt.String()
+	// 状态报告为ASCII文本，使用IA5编码，不按默认字母表压缩
+	dlv.dataCoding = 1
+	dlv.msgBytes = []byte(dlv.msgContent)
+	dlv.smLength = byte(len(dlv.msgBytes))
+
+	dlv.tlvList = comm.NewTlvList()
+	dlv.tlvList.Add(TagReceiptedMessageId, append([]byte(msgId), 0))
+	dlv.tlvList.Add(TagMessageState, []byte{rpt.State()})
+	if rpt.State() != StateDelivered {
+		// network_error_code：1字节网络类型(3:GSM) + 2字节错误码
+		nec := make([]byte, 3)
+		nec[0] = 3
+		binary.BigEndian.PutUint16(nec[1:3], rpt.errorCode)
+		dlv.tlvList.Add(TagNetworkErrorCode, nec)
+	}
+	return dlv
+}
+
+func (d *Deliver) Encode() []byte {
+	return d.MessageHeader.encodeWithBody(d.shortMessage.encode())
+}
+
+func (d *Deliver) Decode(header *MessageHeader, frame []byte) error {
+	// check
+	if header == nil || header.CommandId != SMPP_DELIVER_SM || uint32(len(frame)) < (header.CommandLength-HeadLength) {
+		return ErrorPacket
+	}
+	d.MessageHeader = header
+	return d.shortMessage.decode(frame)
+}
+
+func (d *Deliver) ToResponse(code uint32) interface{} {
+	header := &MessageHeader{CommandId: SMPP_DELIVER_SM_RESP, CommandStatus: code, SequenceNumber: d.SequenceNumber}
+	return &SmResp{MessageHeader: header}
+}
+
+func (d *Deliver) String() string {
+	return fmt.Sprintf("{ header: %s, %s }", d.MessageHeader, &d.shortMessage)
+}
+
+// IsReceipt 是否为状态报告
+func (d *Deliver) IsReceipt() bool {
+	return d.esmClass&0x3C == 0x04
+}
+
+// Receipt 解析状态报告的文本内容，非状态报告时返回nil
+func (d *Deliver) Receipt() *Receipt {
+	if !d.IsReceipt() {
+		return nil
+	}
+	return ParseReceipt(d.msgContent)
+}
+
+// ReceiptedMessageId 状态报告对应的MT短信的message_id，优先从可选参数中获取
+func (d *Deliver) ReceiptedMessageId() string {
+	if d.tlvList != nil {
+		if tlv, err := d.tlvList.Get(TagReceiptedMessageId); err == nil {
+			return strings.TrimRight(string(tlv.Value()), "\x00")
+		}
+	}
+	if rpt := d.Receipt(); rpt != nil {
+		return rpt.Id()
+	}
+	return ""
+}
+
+// MessageState 状态报告对应的MT短信的最终状态，优先从可选参数中获取
+func (d *Deliver) MessageState() byte {
+	if d.tlvList != nil {
+		if tlv, err := d.tlvList.Get(TagMessageState); err == nil && tlv.Length() == 1 {
+			return tlv.Value()[0]
+		}
+	}
+	if rpt := d.Receipt(); rpt != nil {
+		return rpt.State()
+	}
+	return 0
+}
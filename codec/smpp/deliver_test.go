@@ -0,0 +1,68 @@
+package smpp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliver(t *testing.T) {
+	cases := []string{"TD", "hello world", "你好，世界。 hello world", Poem}
+	for _, msg := range cases {
+		dlv := NewDeliver("8613700001111", msg, "01")
+		t.Logf("%s", dlv)
+		data := dlv.Encode()
+		assert.Equal(t, int(dlv.CommandLength), len(data))
+
+		h := &MessageHeader{}
+		_ = h.Decode(data)
+		dec := &Deliver{}
+		err := dec.Decode(h, data[HeadLength:])
+		assert.True(t, err == nil)
+		assert.False(t, dec.IsReceipt())
+		assert.Equal(t, dlv.MessageContent(), dec.MessageContent())
+		assert.Equal(t, Conf.GetString("source-addr")+"01", dec.DestinationAddr())
+		assert.Equal(t, "8613700001111", dec.SourceAddr())
+
+		resp := dec.ToResponse(0).(*SmResp)
+		assert.Equal(t, SMPP_DELIVER_SM_RESP, resp.CommandId)
+		assert.Equal(t, HeadLength+1, len(resp.Encode()))
+	}
+}
+
+func TestDeliveryReceipt(t *testing.T) {
+	sub := NewSubmit("8617600001111", "hello world")[0]
+	resp := sub.ToResponse(0).(*SmResp)
+	dlv := sub.ToDeliveryReceipt(resp.MessageId())
+	t.Logf("%s", dlv)
+	data := dlv.Encode()
+	assert.Equal(t, int(dlv.CommandLength), len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	dec := &Deliver{}
+	err := dec.Decode(h, data[HeadLength:])
+	assert.True(t, err == nil)
+	assert.True(t, dec.IsReceipt())
+	// 状态报告为IA5编码的ASCII文本
+	assert.Equal(t, byte(1), dec.dataCoding)
+	assert.Equal(t, dlv.MessageContent(), dec.MessageContent())
+	assert.Equal(t, resp.MessageId(), dec.ReceiptedMessageId())
+	assert.Equal(t, "8617600001111", dec.SourceAddr())
+	assert.Equal(t, sub.SourceAddr(), dec.DestinationAddr())
+
+	rpt := dec.Receipt()
+	t.Logf("%s", rpt)
+	assert.Equal(t, resp.MessageId(), rpt.Id())
+	assert.Equal(t, rpt.State(), dec.MessageState())
+	assert.Equal(t, StateMap[dec.MessageState()], rpt.Stat())
+}
+
+func TestParseReceipt(t *testing.T) {
+	rpt := ParseReceipt("id:7c2b1a sub:001 dlvrd:000 submit date:2210181030 done date:2210181031 stat:UNDELIV err:001 text:hello world")
+	assert.Equal(t, "7c2b1a", rpt.Id())
+	assert.Equal(t, "UNDELIV", rpt.Stat())
+	assert.Equal(t, StateUndeliverable, rpt.State())
+	assert.Equal(t, "001", rpt.Err())
+	assert.Equal(t, "hello world", rpt.text)
+}
@@ -0,0 +1,48 @@
+package smpp
+
+type EnquireLink MessageHeader
+type EnquireLinkResp MessageHeader
+
+func NewEnquireLink() *EnquireLink {
+	return &EnquireLink{CommandLength: HeadLength, CommandId: SMPP_ENQUIRE_LINK, SequenceNumber: uint32(Seq32.NextVal())}
+}
+
+func NewEnquireLinkResp(seq uint32) *EnquireLinkResp {
+	return &EnquireLinkResp{CommandLength: HeadLength, CommandId: SMPP_ENQUIRE_LINK_RESP, SequenceNumber: seq}
+}
+
+func (e *EnquireLink) Encode() []byte {
+	return (*MessageHeader)(e).Encode()
+}
+
+func (e *EnquireLink) Decode(header *MessageHeader, _ []byte) error {
+	if header == nil || header.CommandId != SMPP_ENQUIRE_LINK {
+		return ErrorPacket
+	}
+	*e = EnquireLink(*header)
+	return nil
+}
+
+func (e *EnquireLink) ToResponse(_ uint32) interface{} {
+	return NewEnquireLinkResp(e.SequenceNumber)
+}
+
+func (e *EnquireLink) String() string {
+	return (*MessageHeader)(e).String()
+}
+
+func (resp *EnquireLinkResp) Encode() []byte {
+	return (*MessageHeader)(resp).Encode()
+}
+
+func (resp *EnquireLinkResp) Decode(header *MessageHeader, _ []byte) error {
+	if header == nil || header.CommandId != SMPP_ENQUIRE_LINK_RESP {
+		return ErrorPacket
+	}
+	*resp = EnquireLinkResp(*header)
+	return nil
+}
+
+func (resp *EnquireLinkResp) String() string {
+	return (*MessageHeader)(resp).String()
+}
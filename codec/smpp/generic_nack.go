@@ -0,0 +1,28 @@
+package smpp
+
+// GenericNack 通用否定应答，用于应答无法识别或格式错误的报文
+type GenericNack MessageHeader
+
+func NewGenericNack(seq uint32, status uint32) *GenericNack {
+	return &GenericNack{CommandLength: HeadLength, CommandId: SMPP_GENERIC_NACK, CommandStatus: status, SequenceNumber: seq}
+}
+
+func (g *GenericNack) Encode() []byte {
+	return (*MessageHeader)(g).Encode()
+}
+
+func (g *GenericNack) Decode(header *MessageHeader, _ []byte) error {
+	if header == nil || header.CommandId != SMPP_GENERIC_NACK {
+		return ErrorPacket
+	}
+	*g = GenericNack(*header)
+	return nil
+}
+
+func (g *GenericNack) String() string {
+	return (*MessageHeader)(g).String()
+}
+
+func (g *GenericNack) Status() uint32 {
+	return g.CommandStatus
+}
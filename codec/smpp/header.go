@@ -0,0 +1,160 @@
+package smpp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type MessageHeader struct {
+	CommandLength  uint32 // 消息的总长度(字节)
+	CommandId      uint32 // 命令ID
+	CommandStatus  uint32 // 命令状态，请求报文固定为0，应答报文表示执行结果
+	SequenceNumber uint32 // 序列号
+}
+
+func (header *MessageHeader) Encode() []byte {
+	if header.CommandLength < HeadLength {
+		header.CommandLength = HeadLength
+	}
+	frame := make([]byte, header.CommandLength)
+	binary.BigEndian.PutUint32(frame[0:4], header.CommandLength)
+	binary.BigEndian.PutUint32(frame[4:8], header.CommandId)
+	binary.BigEndian.PutUint32(frame[8:12], header.CommandStatus)
+	binary.BigEndian.PutUint32(frame[12:16], header.SequenceNumber)
+	return frame
+}
+
+func (header *MessageHeader) Decode(frame []byte) error {
+	if len(frame) < HeadLength {
+		return ErrorPacket
+	}
+	header.CommandLength = binary.BigEndian.Uint32(frame[0:4])
+	header.CommandId = binary.BigEndian.Uint32(frame[4:8])
+	header.CommandStatus = binary.BigEndian.Uint32(frame[8:12])
+	header.SequenceNumber = binary.BigEndian.Uint32(frame[12:16])
+	return nil
+}
+
+func (header *MessageHeader) String() string {
+	return fmt.Sprintf("{ CommandLength: %d, CommandId: %s, CommandStatus: %#x, SequenceNumber: %d }",
+		header.CommandLength, CommandMap[header.CommandId], header.CommandStatus, header.SequenceNumber)
+}
+
+// 将消息体拼接到消息头之后，并设置消息总长度
+func (header *MessageHeader) encodeWithBody(body []byte) []byte {
+	header.CommandLength = uint32(HeadLength + len(body))
+	frame := header.Encode()
+	copy(frame[HeadLength:], body)
+	return frame
+}
+
+const (
+	HeadLength                 = 16                 // 报文头长度
+	respFlag                   = uint32(0x80000000) // 应答报文的CommandId最高位为1
+	SMPP_GENERIC_NACK          = uint32(0x80000000) // 通用否定应答
+	SMPP_BIND_RECEIVER         = uint32(0x00000001) // 以接收者身份绑定
+	SMPP_BIND_RECEIVER_RESP    = uint32(0x80000001) // 以接收者身份绑定应答
+	SMPP_BIND_TRANSMITTER      = uint32(0x00000002) // 以发送者身份绑定
+	SMPP_BIND_TRANSMITTER_RESP = uint32(0x80000002) // 以发送者身份绑定应答
+	// SMPP_QUERY_SM              = uint32(0x00000003)
+	// SMPP_QUERY_SM_RESP         = uint32(0x80000003)
+	SMPP_SUBMIT_SM       = uint32(0x00000004) // 提交短信
+	SMPP_SUBMIT_SM_RESP  = uint32(0x80000004) // 提交短信应答
+	SMPP_DELIVER_SM      = uint32(0x00000005) // 上行短信或状态报告
+	SMPP_DELIVER_SM_RESP = uint32(0x80000005) // 上行短信或状态报告应答
+	SMPP_UNBIND          = uint32(0x00000006) // 断开连接
+	SMPP_UNBIND_RESP     = uint32(0x80000006) // 断开连接应答
+	// SMPP_REPLACE_SM            = uint32(0x00000007)
+	// SMPP_REPLACE_SM_RESP       = uint32(0x80000007)
+	// SMPP_CANCEL_SM             = uint32(0x00000008)
+	// SMPP_CANCEL_SM_RESP        = uint32(0x80000008)
+	SMPP_BIND_TRANSCEIVER      = uint32(0x00000009) // 以收发者身份绑定
+	SMPP_BIND_TRANSCEIVER_RESP = uint32(0x80000009) // 以收发者身份绑定应答
+	// SMPP_OUTBIND               = uint32(0x0000000B)
+	SMPP_ENQUIRE_LINK      = uint32(0x00000015) // 链路检测
+	SMPP_ENQUIRE_LINK_RESP = uint32(0x80000015) // 链路检测应答
+	// SMPP_SUBMIT_MULTI          = uint32(0x00000021)
+	// SMPP_SUBMIT_MULTI_RESP     = uint32(0x80000021)
+	// SMPP_ALERT_NOTIFICATION    = uint32(0x00000102)
+	// SMPP_DATA_SM               = uint32(0x00000103)
+	// SMPP_DATA_SM_RESP          = uint32(0x80000103)
+)
+
+var CommandMap = make(map[uint32]string)
+
+func init() {
+	CommandMap[SMPP_GENERIC_NACK] = "GENERIC_NACK"
+	CommandMap[SMPP_BIND_RECEIVER] = "BIND_RECEIVER"
+	CommandMap[SMPP_BIND_RECEIVER_RESP] = "BIND_RECEIVER_RESP"
+	CommandMap[SMPP_BIND_TRANSMITTER] = "BIND_TRANSMITTER"
+	CommandMap[SMPP_BIND_TRANSMITTER_RESP] = "BIND_TRANSMITTER_RESP"
+	CommandMap[SMPP_SUBMIT_SM] = "SUBMIT_SM"
+	CommandMap[SMPP_SUBMIT_SM_RESP] = "SUBMIT_SM_RESP"
+	CommandMap[SMPP_DELIVER_SM] = "DELIVER_SM"
+	CommandMap[SMPP_DELIVER_SM_RESP] = "DELIVER_SM_RESP"
+	CommandMap[SMPP_UNBIND] = "UNBIND"
+	CommandMap[SMPP_UNBIND_RESP] = "UNBIND_RESP"
+	CommandMap[SMPP_BIND_TRANSCEIVER] = "BIND_TRANSCEIVER"
+	CommandMap[SMPP_BIND_TRANSCEIVER_RESP] = "BIND_TRANSCEIVER_RESP"
+	CommandMap[SMPP_ENQUIRE_LINK] = "ENQUIRE_LINK"
+	CommandMap[SMPP_ENQUIRE_LINK_RESP] = "ENQUIRE_LINK_RESP"
+}
+
+// command_status 取值
+const (
+	ESME_ROK           = uint32(0x00000000) // 成功
+	ESME_RINVMSGLEN    = uint32(0x00000001) // 消息长度错误
+	ESME_RINVCMDLEN    = uint32(0x00000002) // 命令长度错误
+	ESME_RINVCMDID     = uint32(0x00000003) // 非法的命令ID
+	ESME_RINVBNDSTS    = uint32(0x00000004) // 绑定状态错误
+	ESME_RALYBND       = uint32(0x00000005) // 已绑定
+	ESME_RINVPRTFLG    = uint32(0x00000006) // 优先级错误
+	ESME_RINVREGDLVFLG = uint32(0x00000007) // 状态报告标志错误
+	ESME_RSYSERR       = uint32(0x00000008) // 系统错误
+	ESME_RINVSRCADR    = uint32(0x0000000A) // 源地址错误
+	ESME_RINVDSTADR    = uint32(0x0000000B) // 目的地址错误
+	ESME_RINVMSGID     = uint32(0x0000000C) // 消息ID错误
+	ESME_RBINDFAIL     = uint32(0x0000000D) // 绑定失败
+	ESME_RINVPASWD     = uint32(0x0000000E) // 密码错误
+	ESME_RINVSYSID     = uint32(0x0000000F) // 系统ID错误
+	ESME_RMSGQFUL      = uint32(0x00000014) // 消息队列已满
+	ESME_RINVSERTYP    = uint32(0x00000015) // 业务类型错误
+	ESME_RINVESMCLASS  = uint32(0x00000043) // esm_class错误
+	ESME_RSUBMITFAIL   = uint32(0x00000045) // 提交失败
+	ESME_RTHROTTLED    = uint32(0x00000058) // 超过流量限制
+	ESME_RINVSCHED     = uint32(0x00000061) // 定时发送时间错误
+	ESME_RINVEXPIRY    = uint32(0x00000062) // 有效期错误
+	ESME_RX_T_APPN     = uint32(0x00000064) // ESME拒绝接收消息，临时错误
+	ESME_RX_P_APPN     = uint32(0x00000065) // ESME拒绝接收消息，永久错误
+	ESME_RINVOPTPARAM  = uint32(0x000000C4) // 可选参数值错误
+	ESME_RUNKNOWNERR   = uint32(0x000000FF) // 未知错误
+)
+
+var StatusMap = map[uint32]string{
+	ESME_ROK:           "成功",
+	ESME_RINVMSGLEN:    "消息长度错误",
+	ESME_RINVCMDLEN:    "命令长度错误",
+	ESME_RINVCMDID:     "非法的命令ID",
+	ESME_RINVBNDSTS:    "绑定状态错误",
+	ESME_RALYBND:       "已绑定",
+	ESME_RINVPRTFLG:    "优先级错误",
+	ESME_RINVREGDLVFLG: "状态报告标志错误",
+	ESME_RSYSERR:       "系统错误",
+	ESME_RINVSRCADR:    "源地址错误",
+	ESME_RINVDSTADR:    "目的地址错误",
+	ESME_RINVMSGID:     "消息ID错误",
+	ESME_RBINDFAIL:     "绑定失败",
+	ESME_RINVPASWD:     "密码错误",
+	ESME_RINVSYSID:     "系统ID错误",
+	ESME_RMSGQFUL:      "消息队列已满",
+	ESME_RINVSERTYP:    "业务类型错误",
+	ESME_RINVESMCLASS:  "esm_class错误",
+	ESME_RSUBMITFAIL:   "提交失败",
+	ESME_RTHROTTLED:    "超过流量限制",
+	ESME_RINVSCHED:     "定时发送时间错误",
+	ESME_RINVEXPIRY:    "有效期错误",
+	ESME_RX_T_APPN:     "ESME拒绝接收消息，临时错误",
+	ESME_RX_P_APPN:     "ESME拒绝接收消息，永久错误",
+	ESME_RINVOPTPARAM:  "可选参数值错误",
+	ESME_RUNKNOWNERR:   "未知错误",
+}
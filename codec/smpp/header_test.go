@@ -0,0 +1,79 @@
+package smpp
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm"
+	"github.com/aaronwong1989/gosms/comm/snowflake"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func init() {
+	rand.Seed(time.Now().Unix()) // 随机种子
+	Conf = yml_config.CreateYamlFactory("smpp.yaml")
+	dc := Conf.GetInt("datacenter-id")
+	wk := Conf.GetInt("worker-id")
+	Seq32 = comm.NewCycleSequence(int32(dc), int32(wk))
+	Seq64 = snowflake.NewSnowflake(int64(dc), int64(wk))
+}
+
+func TestMessageHeader(t *testing.T) {
+	header := &MessageHeader{CommandLength: HeadLength, CommandId: SMPP_ENQUIRE_LINK, SequenceNumber: uint32(Seq32.NextVal())}
+	t.Logf("%s", header)
+	data := header.Encode()
+	assert.Equal(t, HeadLength, len(data))
+	t.Logf("%x", data)
+
+	h2 := &MessageHeader{}
+	err := h2.Decode(data)
+	assert.True(t, err == nil)
+	assert.Equal(t, *header, *h2)
+}
+
+func TestEnquireLink(t *testing.T) {
+	el := NewEnquireLink()
+	data := el.Encode()
+	assert.Equal(t, HeadLength, len(data))
+
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	el2 := &EnquireLink{}
+	assert.True(t, el2.Decode(h, nil) == nil)
+	t.Logf("%s", el2)
+
+	resp := el2.ToResponse(0).(*EnquireLinkResp)
+	data = resp.Encode()
+	_ = h.Decode(data)
+	resp2 := &EnquireLinkResp{}
+	assert.True(t, resp2.Decode(h, nil) == nil)
+	assert.Equal(t, el.SequenceNumber, resp2.SequenceNumber)
+	t.Logf("%s", resp2)
+}
+
+func TestUnbind(t *testing.T) {
+	ub := NewUnbind()
+	data := ub.Encode()
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	ub2 := &Unbind{}
+	assert.True(t, ub2.Decode(h, nil) == nil)
+	resp := ub2.ToResponse(0).(*UnbindResp)
+	assert.Equal(t, SMPP_UNBIND_RESP, resp.CommandId)
+	assert.Equal(t, ub.SequenceNumber, resp.SequenceNumber)
+}
+
+func TestGenericNack(t *testing.T) {
+	nack := NewGenericNack(123, ESME_RINVCMDID)
+	data := nack.Encode()
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	nack2 := &GenericNack{}
+	assert.True(t, nack2.Decode(h, nil) == nil)
+	assert.Equal(t, ESME_RINVCMDID, nack2.Status())
+	assert.Equal(t, uint32(123), nack2.SequenceNumber)
+	t.Logf("%s", nack2)
+}
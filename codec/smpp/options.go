@@ -0,0 +1,111 @@
+package smpp
+
+import (
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+type Option func(mtOps *MtOptions)
+
+func loadOptions(options ...Option) *MtOptions {
+	opts := &MtOptions{
+		RegisteredDelivery: uint8(0xf),
+		PriorityFlag:       uint8(0xf),
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+type MtOptions struct {
+	RegisteredDelivery   uint8
+	PriorityFlag         uint8
+	ServiceType          string
+	SourceAddr           string
+	ScheduleDeliveryTime string
+	ValidityPeriod       string
+}
+
+// MtRegisteredDelivery 状态报告标记
+// 0-不需要状态报告
+// 1-无论成功失败都需要状态报告
+// 2-仅失败时需要状态报告
+func MtRegisteredDelivery(r uint8) Option {
+	if r > 2 {
+		r = uint8(0xf)
+	}
+	return func(opts *MtOptions) {
+		opts.RegisteredDelivery = r
+	}
+}
+
+// MtPriorityFlag 优先级0-3从低到高
+func MtPriorityFlag(p uint8) Option {
+	if p > 3 {
+		p = uint8(0xf)
+	}
+	return func(opts *MtOptions) {
+		opts.PriorityFlag = p
+	}
+}
+
+// MtServiceType 业务类型，为空时使用SMSC默认值
+func MtServiceType(s string) Option {
+	return func(opts *MtOptions) {
+		opts.ServiceType = s
+	}
+}
+
+// MtSourceAddr 源地址，会拼接到配置文件的source-addr后面
+func MtSourceAddr(s string) Option {
+	return func(opts *MtOptions) {
+		opts.SourceAddr = s
+	}
+}
+
+// MtScheduleDeliveryTime 定时发送时间
+func MtScheduleDeliveryTime(t time.Time) Option {
+	return func(opts *MtOptions) {
+		opts.ScheduleDeliveryTime = comm.FormatTime(t)
+	}
+}
+
+// MtValidityPeriod 有效期截止时间
+func MtValidityPeriod(t time.Time) Option {
+	return func(opts *MtOptions) {
+		opts.ValidityPeriod = comm.FormatTime(t)
+	}
+}
+
+// 设置可选项
+func setOptions(sm *shortMessage, opts *MtOptions) {
+	sm.sourceAddr = Conf.GetString("source-addr") + opts.SourceAddr
+
+	if opts.ServiceType != "" {
+		sm.serviceType = opts.ServiceType
+	} else {
+		sm.serviceType = Conf.GetString("service-type")
+	}
+
+	if opts.RegisteredDelivery != uint8(0xf) {
+		sm.registeredDelivery = opts.RegisteredDelivery
+	} else {
+		sm.registeredDelivery = byte(Conf.GetInt("registered-delivery"))
+	}
+
+	if opts.PriorityFlag != uint8(0xf) {
+		sm.priorityFlag = opts.PriorityFlag
+	} else {
+		sm.priorityFlag = byte(Conf.GetInt("priority-flag"))
+	}
+
+	sm.scheduleDeliveryTime = opts.ScheduleDeliveryTime
+
+	if opts.ValidityPeriod != "" {
+		sm.validityPeriod = opts.ValidityPeriod
+	} else {
+		sm.validityPeriod = comm.FormatTime(time.Now().Add(Conf.GetDuration("default-valid-duration")))
+	}
+}
@@ -0,0 +1,104 @@
+package smpp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Receipt 状态报告的文本内容，格式如下：
+// id:IIIIIIIIII sub:SSS dlvrd:DDD submit date:YYMMDDhhmm done date:YYMMDDhhmm stat:DDDDDDD err:E text: . . .
+type Receipt struct {
+	id         string // 消息ID，即submit_sm_resp中的message_id
+	sub        string // 提交的短信条数，取缺省值001
+	dlvrd      string // 成功下发的短信条数
+	submitDate string // 短消息提交时间，格式YYMMDDhhmm
+	doneDate   string // 短消息下发完成时间，格式YYMMDDhhmm
+	stat       string // 短消息的最终状态
+	err        string // 错误码
+	text       string // 原短信内容的前20个字符
+	state      byte   // stat对应的message_state
+	errorCode  uint16 // err对应的数值
+}
+
+// NewReceipt 生成状态报告，状态由序列号决定
+func NewReceipt(msgId string, seq uint32) *Receipt {
+	rpt := &Receipt{id: msgId, sub: "001"}
+	rpt.submitDate = time.Now().Format("0601021504")
+	rpt.doneDate = time.Now().Add(time.Minute).Format("0601021504")
+	// 判断序号的后三位
+	switch seq % 1000 {
+	case 999:
+		rpt.state, rpt.errorCode = StateUndeliverable, 1
+	case 998:
+		rpt.state, rpt.errorCode = StateExpired, 2
+	case 997:
+		rpt.state, rpt.errorCode = StateRejected, 3
+	case 996:
+		rpt.state, rpt.errorCode = StateUnknown, 4
+	default:
+		rpt.state, rpt.errorCode = StateDelivered, 0
+	}
+	if rpt.state == StateDelivered {
+		rpt.dlvrd = "001"
+	} else {
+		rpt.dlvrd = "000"
+	}
+	rpt.stat = StateMap[rpt.state]
+	rpt.err = fmt.Sprintf("%03d", rpt.errorCode)
+	return rpt
+}
+
+// ParseReceipt 解析状态报告文本，无法识别的字段保持为空
+func ParseReceipt(s string) *Receipt {
+	rpt := &Receipt{}
+	fields := map[string]*string{
+		"id:": &rpt.id, "sub:": &rpt.sub, "dlvrd:": &rpt.dlvrd, "submit date:": &rpt.submitDate,
+		"done date:": &rpt.doneDate, "stat:": &rpt.stat, "err:": &rpt.err,
+	}
+	for key, val := range fields {
+		i := strings.Index(s, key)
+		if i < 0 {
+			continue
+		}
+		v := s[i+len(key):]
+		if j := strings.IndexByte(v, ' '); j >= 0 {
+			v = v[:j]
+		}
+		*val = v
+	}
+	if i := strings.Index(s, "text:"); i >= 0 {
+		rpt.text = s[i+len("text:"):]
+	}
+	for state, stat := range StateMap {
+		if stat == rpt.stat {
+			rpt.state = state
+			break
+		}
+	}
+	code, _ := strconv.ParseUint(rpt.err, 10, 16)
+	rpt.errorCode = uint16(code)
+	return rpt
+}
+
+func (r *Receipt) String() string {
+	return fmt.Sprintf("id:%s sub:%s dlvrd:%s submit date:%s done date:%s stat:%s err:%s text:%s",
+		r.id, r.sub, r.dlvrd, r.submitDate, r.doneDate, r.stat, r.err, r.text)
+}
+
+func (r *Receipt) Id() string {
+	return r.id
+}
+
+func (r *Receipt) Stat() string {
+	return r.stat
+}
+
+func (r *Receipt) Err() string {
+	return r.err
+}
+
+func (r *Receipt) State() byte {
+	return r.state
+}
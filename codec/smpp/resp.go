@@ -0,0 +1,48 @@
+package smpp
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SmResp submit_sm_resp、deliver_sm_resp 的消息体结构相同
+// deliver_sm_resp 的 message_id 不使用，固定为空
+type SmResp struct {
+	*MessageHeader        // 【16字节】消息头
+	messageId      string // 【最长65字节】SMSC分配的消息ID，command_status不为0时不返回消息体
+}
+
+func (r *SmResp) Encode() []byte {
+	if r.CommandStatus != ESME_ROK && r.CommandId == SMPP_SUBMIT_SM_RESP {
+		return r.MessageHeader.encodeWithBody(nil)
+	}
+	var buf bytes.Buffer
+	writeCStr(&buf, r.messageId, 65)
+	return r.MessageHeader.encodeWithBody(buf.Bytes())
+}
+
+func (r *SmResp) Decode(header *MessageHeader, frame []byte) (err error) {
+	// check
+	if header == nil || (header.CommandId != SMPP_SUBMIT_SM_RESP && header.CommandId != SMPP_DELIVER_SM_RESP) {
+		return ErrorPacket
+	}
+	r.MessageHeader = header
+	if len(frame) == 0 {
+		return nil
+	}
+	r.messageId, _, err = readCStr(frame, 0, 65)
+	return err
+}
+
+func (r *SmResp) String() string {
+	return fmt.Sprintf("{ header: %s, status: {%d: %s}, messageId: %s }",
+		r.MessageHeader, r.CommandStatus, StatusMap[r.CommandStatus], r.messageId)
+}
+
+func (r *SmResp) Status() uint32 {
+	return r.CommandStatus
+}
+
+func (r *SmResp) MessageId() string {
+	return r.messageId
+}
@@ -0,0 +1,219 @@
+package smpp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/aaronwong1989/gosms/comm"
+)
+
+// shortMessage submit_sm 与 deliver_sm 的消息体结构相同
+type shortMessage struct {
+	serviceType          string        // 【最长6字节】业务类型
+	sourceAddrTon        byte          // 【1字节】源地址的TON
+	sourceAddrNpi        byte          // 【1字节】源地址的NPI
+	sourceAddr           string        // 【最长21字节】源地址
+	destAddrTon          byte          // 【1字节】目的地址的TON
+	destAddrNpi          byte          // 【1字节】目的地址的NPI
+	destinationAddr      string        // 【最长21字节】目的地址
+	esmClass             byte          // 【1字节】消息模式及类型，0x40表示含UDH，0x04表示状态报告
+	protocolId           byte          // 【1字节】协议标识
+	priorityFlag         byte          // 【1字节】优先级0-3
+	scheduleDeliveryTime string        // 【1或17字节】定时发送时间，格式YYMMDDhhmmsstnnp
+	validityPeriod       string        // 【1或17字节】有效期，格式YYMMDDhhmmsstnnp
+	registeredDelivery   byte          // 【1字节】状态报告标记，0：不需要；1：需要；2：仅失败时需要
+	replaceIfPresentFlag byte          // 【1字节】替换标记
+	dataCoding           byte          // 【1字节】编码格式，0：SMSC默认字母表(GSM 7-bit，按septet压缩)；1：IA5(ASCII)；3：Latin1；8：UCS2
+	smDefaultMsgId       byte          // 【1字节】预定义消息ID
+	smLength             byte          // 【1字节】消息长度
+	msgBytes             []byte        // 【smLength字节】消息内容按照dataCoding编码后的数据
+	msgContent           string        // 解码后的消息内容
+	tlvList              *comm.TlvList // 【TLV】可选参数
+}
+
+func (sm *shortMessage) encode() []byte {
+	var buf bytes.Buffer
+	writeCStr(&buf, sm.serviceType, 6)
+	buf.WriteByte(sm.sourceAddrTon)
+	buf.WriteByte(sm.sourceAddrNpi)
+	writeCStr(&buf, sm.sourceAddr, 21)
+	buf.WriteByte(sm.destAddrTon)
+	buf.WriteByte(sm.destAddrNpi)
+	writeCStr(&buf, sm.destinationAddr, 21)
+	buf.WriteByte(sm.esmClass)
+	buf.WriteByte(sm.protocolId)
+	buf.WriteByte(sm.priorityFlag)
+	writeCStr(&buf, sm.scheduleDeliveryTime, 17)
+	writeCStr(&buf, sm.validityPeriod, 17)
+	buf.WriteByte(sm.registeredDelivery)
+	buf.WriteByte(sm.replaceIfPresentFlag)
+	buf.WriteByte(sm.dataCoding)
+	buf.WriteByte(sm.smDefaultMsgId)
+	buf.WriteByte(sm.smLength)
+	buf.Write(sm.msgBytes)
+	if sm.tlvList != nil {
+		_ = sm.tlvList.Write(&buf)
+	}
+	return buf.Bytes()
+}
+
+func (sm *shortMessage) decode(frame []byte) (err error) {
+	index := 0
+	if sm.serviceType, index, err = readCStr(frame, index, 6); err != nil {
+		return err
+	}
+	if sm.sourceAddrTon, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.sourceAddrNpi, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.sourceAddr, index, err = readCStr(frame, index, 21); err != nil {
+		return err
+	}
+	if sm.destAddrTon, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.destAddrNpi, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.destinationAddr, index, err = readCStr(frame, index, 21); err != nil {
+		return err
+	}
+	if sm.esmClass, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.protocolId, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.priorityFlag, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.scheduleDeliveryTime, index, err = readCStr(frame, index, 17); err != nil {
+		return err
+	}
+	if sm.validityPeriod, index, err = readCStr(frame, index, 17); err != nil {
+		return err
+	}
+	if sm.registeredDelivery, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.replaceIfPresentFlag, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.dataCoding, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.smDefaultMsgId, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if sm.smLength, index, err = readByte(frame, index); err != nil {
+		return err
+	}
+	if len(frame) < index+int(sm.smLength) {
+		return ErrorPacket
+	}
+	sm.msgBytes = frame[index : index+int(sm.smLength)]
+	index += int(sm.smLength)
+	if index < len(frame) {
+		if sm.tlvList, err = comm.Read(bytes.NewBuffer(frame[index:])); err != nil {
+			return err
+		}
+	}
+	// 消息内容为空时，尝试从message_payload中获取
+	if sm.smLength == 0 && sm.tlvList != nil {
+		if payload, err := sm.tlvList.Get(TagMessagePayload); err == nil {
+			sm.msgBytes = payload.Value()
+		}
+	}
+	coding := sm.dataCoding
+	if sm.esmClass&0x3C == 0x04 {
+		// 状态报告的内容为ASCII文本，部分SMSC的data_coding为0，不按GSM 7-bit解压
+		coding = 1
+	}
+	sm.msgContent = MsgContent(coding, sm.esmClass&0x40, sm.msgBytes)
+	return nil
+}
+
+func (sm *shortMessage) String() string {
+	bts := sm.msgBytes
+	if len(bts) > 6 {
+		bts = bts[:6]
+	}
+	return fmt.Sprintf("serviceType: %s, sourceAddr: %d/%d/%s, destinationAddr: %d/%d/%s, esmClass: %#x, "+
+		"protocolId: %d, priorityFlag: %d, scheduleDeliveryTime: %s, validityPeriod: %s, registeredDelivery: %d, "+
+		"replaceIfPresentFlag: %d, dataCoding: %d, smDefaultMsgId: %d, smLength: %d, msgBytes: %#x..., tlvList: %s",
+		sm.serviceType, sm.sourceAddrTon, sm.sourceAddrNpi, sm.sourceAddr, sm.destAddrTon, sm.destAddrNpi, sm.destinationAddr, sm.esmClass,
+		sm.protocolId, sm.priorityFlag, sm.scheduleDeliveryTime, sm.validityPeriod, sm.registeredDelivery,
+		sm.replaceIfPresentFlag, sm.dataCoding, sm.smDefaultMsgId, sm.smLength, bts, sm.tlvList)
+}
+
+func (sm *shortMessage) SourceAddr() string {
+	return sm.sourceAddr
+}
+
+func (sm *shortMessage) DestinationAddr() string {
+	return sm.destinationAddr
+}
+
+func (sm *shortMessage) RegisteredDelivery() byte {
+	return sm.registeredDelivery
+}
+
+func (sm *shortMessage) MessageContent() string {
+	return sm.msgContent
+}
+
+// MsgCoding 通过消息内容判断，设置编码格式。
+// 如果可用GSM 7-bit默认字母表(含扩展表)表示采用0：SMSC默认字母表
+// 否则采用8：UCS-2编码
+func MsgCoding(content string) byte {
+	if comm.IsGsm7(content) {
+		return 0
+	}
+	return 8
+}
+
+// MsgSlices 按编码格式对消息内容编码并拆分为长短信切片
+func MsgSlices(coding byte, content string) [][]byte {
+	if coding == 8 {
+		return comm.ToTPUDHISlices(comm.Ucs2Encode(content), 140)
+	}
+	// 默认字母表为GSM 7-bit，单条160个septet，长短信每片153个，是否压缩由 gsm7-packed 决定
+	septets, _ := comm.Gsm7Encode(content)
+	return comm.ToGsm7Slices(septets, gsm7Packed())
+}
+
+// gsm7Packed short_message中的GSM 7-bit是否按septet压缩，默认每个septet占一个字节
+func gsm7Packed() bool {
+	return Conf != nil && Conf.GetBool("gsm7-packed")
+}
+
+// MsgContent 按编码格式解码消息内容，udhi不为0时跳过消息头
+func MsgContent(coding byte, udhi byte, msgBytes []byte) string {
+	udhLen := 0
+	if udhi != 0 && len(msgBytes) > 0 && int(msgBytes[0]) < len(msgBytes) {
+		udhLen = int(msgBytes[0]) + 1
+	}
+	content := msgBytes[udhLen:]
+	switch coding {
+	case 8:
+		return comm.Ucs2Decode(content)
+	case 0:
+		if !gsm7Packed() {
+			return comm.Gsm7Decode(content)
+		}
+		// GSM 7-bit压缩时UDH之后有填充位，需从完整的用户数据解压
+		return comm.Gsm7Decode(comm.Gsm7UnpackUserData(msgBytes, udhLen))
+	case 3:
+		// Latin1的每个字节即为一个Unicode码点
+		rs := make([]rune, len(content))
+		for i, b := range content {
+			rs[i] = rune(b)
+		}
+		return string(rs)
+	default:
+		return strings.TrimRight(string(content), "\x00")
+	}
+}
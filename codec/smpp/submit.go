@@ -0,0 +1,82 @@
+package smpp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Submit struct {
+	*MessageHeader // 【16字节】消息头
+	shortMessage   // 消息体
+}
+
+func NewSubmit(phone string, content string, opts ...Option) (messages []*Submit) {
+	options := loadOptions(opts...)
+	header := &MessageHeader{CommandId: SMPP_SUBMIT_SM, SequenceNumber: uint32(Seq32.NextVal())}
+	mt := &Submit{MessageHeader: header}
+	setOptions(&mt.shortMessage, options)
+
+	mt.sourceAddrTon = byte(Conf.GetInt("source-addr-ton"))
+	mt.sourceAddrNpi = byte(Conf.GetInt("source-addr-npi"))
+	mt.destAddrTon = byte(Conf.GetInt("dest-addr-ton"))
+	mt.destAddrNpi = byte(Conf.GetInt("dest-addr-npi"))
+	mt.destinationAddr = phone
+
+	mt.msgContent = content
+	mt.dataCoding = MsgCoding(content)
+	slices := MsgSlices(mt.dataCoding, content)
+	if len(slices) == 1 {
+		mt.msgBytes = slices[0]
+		mt.smLength = byte(len(mt.msgBytes))
+		return []*Submit{mt}
+	}
+
+	// 长短信，short_message中含UDH
+	mt.esmClass |= 0x40
+	for i, msgBytes := range slices {
+		// 拷贝 mt
+		tmp := *mt
+		tmpHead := *tmp.MessageHeader
+		sub := &tmp
+		sub.MessageHeader = &tmpHead
+		if i != 0 {
+			sub.SequenceNumber = uint32(Seq32.NextVal())
+		}
+		sub.msgBytes = msgBytes
+		sub.smLength = byte(len(msgBytes))
+		messages = append(messages, sub)
+	}
+	return messages
+}
+
+func (s *Submit) Encode() []byte {
+	return s.MessageHeader.encodeWithBody(s.shortMessage.encode())
+}
+
+func (s *Submit) Decode(header *MessageHeader, frame []byte) error {
+	// check
+	if header == nil || header.CommandId != SMPP_SUBMIT_SM || uint32(len(frame)) < (header.CommandLength-HeadLength) {
+		return ErrorPacket
+	}
+	s.MessageHeader = header
+	return s.shortMessage.decode(frame)
+}
+
+// ToResponse 生成应答，成功时由SMSC分配message_id
+func (s *Submit) ToResponse(code uint32) interface{} {
+	header := &MessageHeader{CommandId: SMPP_SUBMIT_SM_RESP, CommandStatus: code, SequenceNumber: s.SequenceNumber}
+	resp := &SmResp{MessageHeader: header}
+	if code == ESME_ROK {
+		resp.messageId = strconv.FormatInt(Seq64.NextVal(), 16)
+	}
+	return resp
+}
+
+// ToDeliveryReceipt 生成该短信的状态报告
+func (s *Submit) ToDeliveryReceipt(msgId string) *Deliver {
+	return NewDeliveryReceipt(s, msgId)
+}
+
+func (s *Submit) String() string {
+	return fmt.Sprintf("{ header: %s, %s }", s.MessageHeader, &s.shortMessage)
+}
@@ -0,0 +1,128 @@
+package smpp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSubmit(t *testing.T) {
+	subs := NewSubmit("8617600001111", Poem, MtScheduleDeliveryTime(time.Now().Add(time.Minute)))
+	assert.True(t, len(subs) > 1)
+	for _, sub := range subs {
+		t.Logf("%s", sub)
+		assert.True(t, sub.smLength <= 140)
+		assert.Equal(t, byte(0x40), sub.esmClass&0x40)
+		assert.Equal(t, 16, len(sub.scheduleDeliveryTime))
+	}
+
+	subs = NewSubmit("8617600001111", "hello world", MtRegisteredDelivery(0), MtSourceAddr("01"))
+	assert.Equal(t, 1, len(subs))
+	assert.Equal(t, byte(0), subs[0].dataCoding)
+	assert.Equal(t, byte(0), subs[0].RegisteredDelivery())
+	assert.Equal(t, Conf.GetString("source-addr")+"01", subs[0].SourceAddr())
+}
+
+func TestSubmit_Decode(t *testing.T) {
+	decode(t, "8617600001111", Poem)
+	decode(t, "8617600001111", "hello world 世界，你好！")
+	decode(t, "8617600001111", "hello world")
+	// GSM 7-bit 扩展字符及长短信
+	decode(t, "8617600001111", "Price: 5€ [discount] @shop {ok}")
+	decode(t, "8617600001111", strings.Repeat("€uro ", 60))
+}
+
+func TestSubmit_Gsm7(t *testing.T) {
+	// 默认不压缩，每个septet占一个字节
+	subs := NewSubmit("8617600001111", strings.Repeat("a", 160))
+	assert.Equal(t, 1, len(subs))
+	assert.Equal(t, byte(0), subs[0].dataCoding)
+	assert.Equal(t, byte(160), subs[0].smLength)
+
+	// 6字节UDH + 153个septet
+	subs = NewSubmit("8617600001111", strings.Repeat("a", 161))
+	assert.Equal(t, 2, len(subs))
+	assert.Equal(t, byte(159), subs[0].smLength)
+
+	// @、$、_ 为默认字母表中的0x00、0x02、0x11
+	subs = NewSubmit("8617600001111", "@$_")
+	assert.Equal(t, []byte{0x00, 0x02, 0x11}, subs[0].msgBytes)
+}
+
+func TestSubmit_Gsm7Packed(t *testing.T) {
+	Conf.Set("gsm7-packed", true)
+	defer Conf.Set("gsm7-packed", false)
+
+	// 160个septet压缩为140字节
+	subs := NewSubmit("8617600001111", strings.Repeat("a", 160))
+	assert.Equal(t, 1, len(subs))
+	assert.Equal(t, byte(140), subs[0].smLength)
+
+	// 6字节UDH及填充位占7个septet，每片153个septet，共140字节
+	subs = NewSubmit("8617600001111", strings.Repeat("a", 161))
+	assert.Equal(t, 2, len(subs))
+	assert.Equal(t, byte(140), subs[0].smLength)
+
+	// @、$、_ 按septet压缩
+	subs = NewSubmit("8617600001111", "@$_")
+	assert.Equal(t, []byte{0x00, 0x41, 0x04}, subs[0].msgBytes)
+
+	decode(t, "8617600001111", "Price: 5€ [discount] @shop {ok}")
+	decode(t, "8617600001111", strings.Repeat("€uro ", 60))
+}
+
+func decode(t *testing.T, phone string, txt string) {
+	subs := NewSubmit(phone, txt)
+	content := ""
+	for _, sub := range subs {
+		data := sub.Encode()
+		assert.Equal(t, int(sub.CommandLength), len(data))
+
+		h := &MessageHeader{}
+		_ = h.Decode(data)
+		dec := &Submit{}
+		err := dec.Decode(h, data[HeadLength:])
+		assert.True(t, err == nil)
+		assert.Equal(t, phone, dec.DestinationAddr())
+		assert.Equal(t, data, dec.Encode())
+		content += dec.MessageContent()
+		t.Logf("%s", dec)
+
+		resp := dec.ToResponse(0).(*SmResp)
+		assert.Equal(t, sub.SequenceNumber, resp.SequenceNumber)
+		assert.Equal(t, SMPP_SUBMIT_SM_RESP, resp.CommandId)
+		assert.True(t, resp.MessageId() != "")
+
+		data = resp.Encode()
+		_ = h.Decode(data)
+		resp2 := &SmResp{}
+		assert.True(t, resp2.Decode(h, data[HeadLength:]) == nil)
+		assert.Equal(t, resp.MessageId(), resp2.MessageId())
+	}
+	assert.Equal(t, txt, content)
+}
+
+func TestSubmit_DecodeError(t *testing.T) {
+	sub := NewSubmit("8617600001111", "hello world")[0]
+	data := sub.Encode()
+	h := &MessageHeader{}
+	_ = h.Decode(data)
+	err := (&Submit{}).Decode(h, data[HeadLength:len(data)-5])
+	assert.Equal(t, ErrorPacket, err)
+}
+
+const Poem = "将进酒\n" +
+	"君不见黄河之水天上来，奔流到海不复回。\n" +
+	"君不见高堂明镜悲白发，朝如青丝暮成雪。\n" +
+	"人生得意须尽欢，莫使金樽空对月。\n" +
+	"天生我材必有用，千金散尽还复来。\n" +
+	"烹羊宰牛且为乐，会须一饮三百杯。\n" +
+	"岑夫子，丹丘生，将进酒，杯莫停。\n" +
+	"与君歌一曲，请君为我倾耳听。\n" +
+	"钟鼓馔玉不足贵，但愿长醉不愿醒。\n" +
+	"古来圣贤皆寂寞，惟有饮者留其名。\n" +
+	"陈王昔时宴平乐，斗酒十千恣欢谑。\n" +
+	"主人何为言少钱，径须沽取对君酌。\n" +
+	"五花马、千金裘，呼儿将出换美酒，与尔同销万古愁。"
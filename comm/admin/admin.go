@@ -0,0 +1,334 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+var log = logging.GetDefaultLogger()
+
+var ErrUnknownAccount = errors.New("unknown account")
+
+// Session 在线的SP连接
+type Session struct {
+	Account string    `json:"account"`
+	Remote  string    `json:"remote"`
+	Version string    `json:"version,omitempty"` // 登录时协商的协议版本
+	LoginAt time.Time `json:"loginAt"`
+	Submits uint64    `json:"submits"` // 收到的MT数
+	Acks    uint64    `json:"acks"`    // 收到的Deliver应答数
+}
+
+// Mo 注入的上行短信
+type Mo struct {
+	Account   string `json:"account"`   // 接收MO的SP账号，为空时取配置的默认账号
+	Src       string `json:"src"`       // 发送MO的用户号码
+	Dest      string `json:"dest"`      // CMPP为SP的接入号，为空时取配置的sms-display-no；SMGP为接入号后的扩展号
+	ServiceId string `json:"serviceId"` // 业务代码，为空时取配置的service-id，SMGP不使用
+	Content   string `json:"content"`
+	Format    string `json:"format"` // 编码格式，见 Formats，为空时CMPP按内容自动选择，SMGP取gbk
+}
+
+// Formats 编码格式名称对应的消息格式代码
+var Formats = map[string]uint8{
+	"ascii": 0,
+	"ucs2":  8,
+	"gbk":   15,
+}
+
+// MoRecord 注入的上行短信及SP的应答结果
+type MoRecord struct {
+	Mo
+	MsgId  string    `json:"msgId"`
+	Time   time.Time `json:"time"`
+	Acked  bool      `json:"acked"`  // 是否收到Deliver应答
+	Result uint32    `json:"result"` // Deliver应答的结果
+	AckAt  time.Time `json:"ackAt,omitempty"`
+}
+
+// Mt 收到的MT
+type Mt struct {
+	Time      time.Time `json:"time"`
+	Account   string    `json:"account"`
+	MsgId     string    `json:"msgId"`
+	Result    uint32    `json:"result"`
+	Dest      []string  `json:"dest"`
+	SrcId     string    `json:"srcId"`
+	ServiceId string    `json:"serviceId"`
+	Content   string    `json:"content"`
+}
+
+// Gateway 模拟网关需提供的管理功能
+type Gateway interface {
+	// Sessions 在线连接列表
+	Sessions() []Session
+	// Kick 断开指定远端地址的连接，连接不存在时返回false
+	Kick(remote string) bool
+	// InjectMo 向SP下发上行短信，SP不在线时待其登录后下发，返回Deliver的MsgId
+	InjectMo(mo *Mo) (string, error)
+	// Submits 最近收到的MT，按时间倒序
+	Submits(n int) []Mt
+	// Mos 最近注入的上行短信及应答结果，按时间倒序
+	Mos(n int) []MoRecord
+	// Online 账号是否有在线连接，account为空时取配置的默认账号
+	Online(account string) bool
+	// ReloadConfig 模拟参数修改后重新解析配置，校验失败时返回错误并保留原有配置
+	ReloadConfig() error
+}
+
+// 可在运行时修改的模拟参数
+var settings = map[string]bool{
+	"success-rate":       true,
+	"min-submit-resp-ms": true,
+	"max-submit-resp-ms": true,
+	"fix-report-resp-ms": true,
+}
+
+// Register 在http.DefaultServeMux上注册管理接口，与pprof共用监听端口
+//
+//	GET  /admin/sessions            在线连接
+//	POST /admin/sessions/kick       断开连接，参数remote为远端地址
+//	GET  /admin/settings            模拟参数
+//	PUT  /admin/settings            修改模拟参数，如 {"success-rate": 0.1}，不写回配置文件
+//	POST /admin/mo                  注入上行短信
+//	GET  /admin/mo                  最近注入的上行短信及应答结果，参数n为条数，默认20
+//	GET  /admin/submits             最近收到的MT，参数n为条数，默认20
+func Register(conf yml_config.YmlConfig, gw Gateway) {
+	http.HandleFunc("/admin/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJson(w, gw.Sessions())
+	})
+
+	http.HandleFunc("/admin/sessions/kick", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		remote := r.FormValue("remote")
+		if !gw.Kick(remote) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		log.Infof("[%-9s] session %s kicked", "Admin", remote)
+		writeJson(w, map[string]string{"remote": remote})
+	})
+
+	http.HandleFunc("/admin/settings", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			values := make(map[string]float64)
+			if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for key, value := range values {
+				if !settings[key] || value < 0 {
+					http.Error(w, "invalid setting "+key, http.StatusBadRequest)
+					return
+				}
+			}
+			previous := make(map[string]interface{}, len(values))
+			for key, value := range values {
+				previous[key] = setting(conf, key)
+				if key == "success-rate" {
+					conf.Set(key, value)
+				} else {
+					conf.Set(key, int(value))
+				}
+			}
+			if err := gw.ReloadConfig(); err != nil {
+				// 修改后的参数不合法(如最小耗时大于最大耗时)，恢复原值
+				for key, value := range previous {
+					conf.Set(key, value)
+				}
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for key, value := range values {
+				log.Infof("[%-9s] %s set to %v", "Admin", key, value)
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		current := make(map[string]interface{}, len(settings))
+		for key := range settings {
+			current[key] = setting(conf, key)
+		}
+		writeJson(w, current)
+	})
+
+	http.HandleFunc("/admin/mo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJson(w, gw.Mos(count(r)))
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mo := &Mo{}
+		if err := json.NewDecoder(r.Body).Decode(mo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if mo.Src == "" {
+			http.Error(w, "src is required", http.StatusBadRequest)
+			return
+		}
+		if _, ok := Formats[mo.Format]; mo.Format != "" && !ok {
+			http.Error(w, "invalid format "+mo.Format, http.StatusBadRequest)
+			return
+		}
+		msgId, err := gw.InjectMo(mo)
+		if err == ErrUnknownAccount {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infof("[%-9s] mo %s from %s injected", "Admin", msgId, mo.Src)
+		writeJson(w, map[string]string{"msgId": msgId})
+	})
+
+	http.HandleFunc("/admin/submits", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJson(w, gw.Submits(count(r)))
+	})
+}
+
+// 列表接口的条数参数n，默认20
+func count(r *http.Request) int {
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n <= 0 {
+		n = 20
+	}
+	return n
+}
+
+// 模拟参数的当前值，success-rate为小数，其余为整数
+func setting(conf yml_config.YmlConfig, key string) interface{} {
+	if key == "success-rate" {
+		return conf.GetFloat64(key)
+	}
+	return conf.GetInt(key)
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("[%-9s] write response error: %v", "Admin", err)
+	}
+}
+
+// Recent 保留最近收到的固定条数的MT
+type Recent struct {
+	lock  sync.Mutex
+	items []Mt
+	next  int
+	full  bool
+}
+
+func NewRecent(size int) *Recent {
+	if size <= 0 {
+		size = 100
+	}
+	return &Recent{items: make([]Mt, size)}
+}
+
+func (r *Recent) Add(mt Mt) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.items[r.next] = mt
+	r.next++
+	if r.next == len(r.items) {
+		r.next, r.full = 0, true
+	}
+}
+
+// List 最近的n条，按时间倒序
+func (r *Recent) List(n int) []Mt {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	size := r.next
+	if r.full {
+		size = len(r.items)
+	}
+	if n > size {
+		n = size
+	}
+	list := make([]Mt, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, r.items[(r.next-i+len(r.items))%len(r.items)])
+	}
+	return list
+}
+
+// MoLog 保留最近注入的固定条数的上行短信，收到应答时记录结果
+type MoLog struct {
+	lock  sync.Mutex
+	items []*MoRecord
+	index map[string]*MoRecord // msgId -> 记录
+	next  int
+}
+
+func NewMoLog(size int) *MoLog {
+	if size <= 0 {
+		size = 100
+	}
+	return &MoLog{items: make([]*MoRecord, size), index: make(map[string]*MoRecord)}
+}
+
+func (l *MoLog) Add(msgId string, mo *Mo) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if old := l.items[l.next]; old != nil {
+		delete(l.index, old.MsgId)
+	}
+	rec := &MoRecord{Mo: *mo, MsgId: msgId, Time: time.Now()}
+	l.items[l.next] = rec
+	l.index[msgId] = rec
+	l.next = (l.next + 1) % len(l.items)
+}
+
+// Ack 记录应答结果，msgId不是注入的上行短信(如状态报告)时返回false
+func (l *MoLog) Ack(msgId string, result uint32) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	rec, ok := l.index[msgId]
+	if !ok {
+		return false
+	}
+	rec.Acked, rec.Result, rec.AckAt = true, result, time.Now()
+	return true
+}
+
+// List 最近的n条，按时间倒序
+func (l *MoLog) List(n int) []MoRecord {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	list := make([]MoRecord, 0)
+	for i := 1; i <= len(l.items) && len(list) < n; i++ {
+		rec := l.items[(l.next-i+len(l.items))%len(l.items)]
+		if rec == nil {
+			break
+		}
+		list = append(list, *rec)
+	}
+	return list
+}
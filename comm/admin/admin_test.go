@@ -0,0 +1,186 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+type fakeGateway struct {
+	lock   sync.Mutex
+	kicked string
+	mo     *Mo
+	count  int
+	online bool
+	recent *Recent
+	mos    *MoLog
+	conf   yml_config.YmlConfig
+}
+
+func (g *fakeGateway) Sessions() []Session {
+	return []Session{{Account: "123456", Remote: "127.0.0.1:5000", LoginAt: time.Now(), Submits: 3}}
+}
+
+func (g *fakeGateway) Kick(remote string) bool {
+	g.kicked = remote
+	return remote == "127.0.0.1:5000"
+}
+
+func (g *fakeGateway) InjectMo(mo *Mo) (string, error) {
+	if mo.Account == "000000" {
+		return "", ErrUnknownAccount
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.mo = mo
+	g.count++
+	msgId := strconv.Itoa(g.count)
+	g.mos.Add(msgId, mo)
+	return msgId, nil
+}
+
+func (g *fakeGateway) Submits(n int) []Mt {
+	return g.recent.List(n)
+}
+
+func (g *fakeGateway) Mos(n int) []MoRecord {
+	return g.mos.List(n)
+}
+
+func (g *fakeGateway) Online(string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.online
+}
+
+func (g *fakeGateway) ReloadConfig() error {
+	if g.conf.GetInt("min-submit-resp-ms") > g.conf.GetInt("max-submit-resp-ms") {
+		return errors.New("min-submit-resp-ms greater than max-submit-resp-ms")
+	}
+	return nil
+}
+
+func newFakeGateway() *fakeGateway {
+	return &fakeGateway{recent: NewRecent(10), mos: NewMoLog(10)}
+}
+
+func TestRecent(t *testing.T) {
+	r := NewRecent(3)
+	assert.Empty(t, r.List(10))
+	for i := 1; i <= 5; i++ {
+		r.Add(Mt{MsgId: string(rune('0' + i))})
+	}
+	list := r.List(10)
+	assert.Equal(t, 3, len(list))
+	assert.Equal(t, "5", list[0].MsgId)
+	assert.Equal(t, "3", list[2].MsgId)
+	assert.Equal(t, "5", r.List(1)[0].MsgId)
+}
+
+func TestRegister(t *testing.T) {
+	conf := yml_config.CreateYamlFactory("cmpp.yaml")
+	gw := newFakeGateway()
+	gw.conf = conf
+	gw.recent.Add(Mt{MsgId: "100", Dest: []string{"13800001111"}})
+	Register(conf, gw)
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodGet, "/admin/sessions", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions []Session
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Equal(t, uint64(3), sessions[0].Submits)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/sessions/kick?remote=127.0.0.1:5000", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/sessions/kick?remote=127.0.0.1:5001", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, "/admin/sessions/kick", "").Code)
+
+	w = do(http.MethodPut, "/admin/settings", `{"success-rate": 0.25, "fix-report-resp-ms": 100}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0.25, conf.GetFloat64("success-rate"))
+	assert.Equal(t, 100, conf.GetInt("fix-report-resp-ms"))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/settings", `{"version": 48}`).Code)
+	// 校验失败时恢复原值
+	min := conf.GetInt("min-submit-resp-ms")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/settings", `{"min-submit-resp-ms": 1000}`).Code)
+	assert.Equal(t, min, conf.GetInt("min-submit-resp-ms"))
+	var settings map[string]float64
+	assert.Nil(t, json.Unmarshal(do(http.MethodGet, "/admin/settings", "").Body.Bytes(), &settings))
+	assert.Equal(t, 0.25, settings["success-rate"])
+
+	w = do(http.MethodPost, "/admin/mo", `{"src": "13800001111", "content": "TD"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "TD", gw.mo.Content)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/mo", `{"account": "000000", "src": "1"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/mo", `{"content": "TD"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/mo", `{"src": "1", "format": "utf8"}`).Code)
+	gw.mos.Ack("1", 9)
+	var mos []MoRecord
+	assert.Nil(t, json.Unmarshal(do(http.MethodGet, "/admin/mo", "").Body.Bytes(), &mos))
+	assert.Equal(t, 1, len(mos))
+	assert.True(t, mos[0].Acked)
+	assert.Equal(t, uint32(9), mos[0].Result)
+
+	var mts []Mt
+	assert.Nil(t, json.Unmarshal(do(http.MethodGet, "/admin/submits?n=5", "").Body.Bytes(), &mts))
+	assert.Equal(t, "100", mts[0].MsgId)
+}
+
+func TestMoLog(t *testing.T) {
+	l := NewMoLog(2)
+	assert.Empty(t, l.List(10))
+	l.Add("1", &Mo{Src: "a"})
+	l.Add("2", &Mo{Src: "b"})
+	assert.True(t, l.Ack("1", 0))
+	l.Add("3", &Mo{Src: "c"})
+	// 被淘汰的记录不再接受应答
+	assert.False(t, l.Ack("1", 0))
+	assert.True(t, l.Ack("3", 1))
+	list := l.List(10)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "3", list[0].MsgId)
+	assert.Equal(t, uint32(1), list[0].Result)
+	assert.False(t, list[1].Acked)
+}
+
+func TestGenerator(t *testing.T) {
+	gw := newFakeGateway()
+	gen := &Generator{Name: "td", Src: []string{"13800001111", "13800002222"}, Content: []string{"TD"},
+		Interval: 5 * time.Millisecond, Count: 3}
+	assert.Nil(t, gen.check())
+	done := make(chan struct{})
+	defer close(done)
+	go gen.run(gw, done)
+
+	// SP不在线时不注入
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, gw.Mos(10))
+
+	gw.lock.Lock()
+	gw.online = true
+	gw.lock.Unlock()
+	time.Sleep(60 * time.Millisecond)
+	mos := gw.Mos(10)
+	assert.Equal(t, 3, len(mos))
+	assert.Equal(t, "13800001111", mos[0].Src)
+	assert.Equal(t, "13800002222", mos[1].Src)
+
+	assert.NotNil(t, (&Generator{Name: "x", Content: []string{"TD"}, Interval: time.Second}).check())
+	assert.NotNil(t, (&Generator{Name: "x", Src: []string{"1"}, Content: []string{"TD"}}).check())
+	assert.NotNil(t, (&Generator{Name: "x", Src: []string{"1"}, Content: []string{"TD"}, Interval: time.Second, Format: "utf8"}).check())
+}
@@ -0,0 +1,126 @@
+package admin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+// Generator 按固定间隔向SP注入上行短信，SP不在线时跳过
+type Generator struct {
+	Name      string        `mapstructure:"name"`
+	Account   string        `mapstructure:"account"`    // 接收MO的SP账号，为空时取配置的默认账号
+	Src       []string      `mapstructure:"src"`        // 用户号码，多个时轮流使用
+	Dest      string        `mapstructure:"dest"`       // 见 Mo.Dest
+	ServiceId string        `mapstructure:"service-id"` // 见 Mo.ServiceId
+	Content   []string      `mapstructure:"content"`    // 短信内容，多个时轮流使用
+	Format    string        `mapstructure:"format"`     // 见 Mo.Format
+	Interval  time.Duration `mapstructure:"interval"`   // 注入间隔
+	Count     int           `mapstructure:"count"`      // 注入条数，0为不限
+}
+
+func (g *Generator) check() error {
+	if len(g.Src) == 0 {
+		return fmt.Errorf("%s: src is required", g.Name)
+	}
+	if len(g.Content) == 0 {
+		return fmt.Errorf("%s: content is required", g.Name)
+	}
+	if g.Interval <= 0 {
+		return fmt.Errorf("%s: interval must be positive", g.Name)
+	}
+	if _, ok := Formats[g.Format]; g.Format != "" && !ok {
+		return fmt.Errorf("%s: invalid format %s", g.Name, g.Format)
+	}
+	return nil
+}
+
+func (g *Generator) run(gw Gateway, done chan struct{}) {
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+	for sent := 0; g.Count == 0 || sent < g.Count; {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if !gw.Online(g.Account) {
+			continue
+		}
+		mo := &Mo{
+			Account:   g.Account,
+			Src:       g.Src[sent%len(g.Src)],
+			Dest:      g.Dest,
+			ServiceId: g.ServiceId,
+			Content:   g.Content[sent%len(g.Content)],
+			Format:    g.Format,
+		}
+		msgId, err := gw.InjectMo(mo)
+		if err != nil {
+			log.Errorf("[%-9s] %s inject mo error: %v", "Generator", g.Name, err)
+			return
+		}
+		sent++
+		log.Debugf("[%-9s] %s mo %s from %s injected", "Generator", g.Name, msgId, mo.Src)
+	}
+	log.Infof("[%-9s] %s finished, %d mo injected", "Generator", g.Name, g.Count)
+}
+
+// Generators 配置的mo-generators列表，配置变化时通过 Reload 重启
+type Generators struct {
+	lock sync.Mutex
+	gw   Gateway
+	done chan struct{}
+}
+
+// StartGenerators 加载并启动配置的上行短信生成器
+func StartGenerators(conf yml_config.YmlConfig, gw Gateway) (*Generators, error) {
+	g := &Generators{gw: gw}
+	if err := g.Reload(conf); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Reload 停止原有生成器并按配置重新启动，加载失败时保留原有生成器
+func (g *Generators) Reload(conf yml_config.YmlConfig) error {
+	var gens []*Generator
+	if err := conf.UnmarshalKey("mo-generators", &gens); err != nil {
+		return err
+	}
+	for i, gen := range gens {
+		if gen == nil {
+			return fmt.Errorf("mo-generators[%d]: empty generator", i)
+		}
+		if gen.Name == "" {
+			gen.Name = fmt.Sprintf("mo-generators[%d]", i)
+		}
+		if err := gen.check(); err != nil {
+			return err
+		}
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.done != nil {
+		close(g.done)
+	}
+	g.done = make(chan struct{})
+	for _, gen := range gens {
+		go gen.run(g.gw, g.done)
+	}
+	log.Infof("[%-9s] %d mo generators started", "Generator", len(gens))
+	return nil
+}
+
+// Stop 停止所有生成器
+func (g *Generators) Stop() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.done != nil {
+		close(g.done)
+		g.done = nil
+	}
+}
@@ -0,0 +1,277 @@
+// Package capture 按收发顺序记录网关的每一个报文，用于离线分析及重放客户问题。
+//
+// 文件格式(整数均为大端序)：
+//
+//	文件头: "GOSMSCAP"(8字节) | 格式版本(1字节) | 协议名称长度(1字节) | 协议名称，如cmpp、smgp
+//	记录:   时间(8字节，UnixNano) | 事件(1字节) | 连接标识长度(2字节) | 连接标识 | 报文长度(4字节) | 报文(含消息头)
+//
+// 连接标识为客户端地址，如 127.0.0.1:53412；连接建立、关闭事件的报文为空。
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+)
+
+var log = logging.GetDefaultLogger()
+
+const (
+	magic   = "GOSMSCAP"
+	version = 1
+	// 单个报文的最大长度，防止读取损坏的文件时分配过大的内存
+	maxFrameLen = 1 << 20
+)
+
+var ErrFormat = errors.New("not a gosms capture file")
+
+// Event 记录的事件类型
+type Event byte
+
+const (
+	In    Event = iota // 收到的报文
+	Out                // 发出的报文
+	Open               // 连接建立
+	Close              // 连接关闭
+)
+
+func (e Event) String() string {
+	switch e {
+	case In:
+		return "<<<"
+	case Out:
+		return ">>>"
+	case Open:
+		return "open"
+	case Close:
+		return "close"
+	}
+	return fmt.Sprintf("event(%d)", byte(e))
+}
+
+// Record 一条记录
+type Record struct {
+	Time  time.Time
+	Event Event
+	Conn  string // 连接标识
+	Frame []byte // 报文，含消息头
+}
+
+// Writer 写入抓包文件，方法可并发调用；在nil上调用时不做记录，便于未开启抓包时直接调用
+type Writer struct {
+	lock   sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	conns  sync.Map // gnet.Conn -> 连接标识，gnet.Conn的RemoteAddr仅能在事件循环中读取，故在连接建立时记录
+	done   chan struct{}
+}
+
+// Create 创建(覆盖)抓包文件，protocol为协议名称；写入经缓冲后每秒刷新一次
+func Create(path string, protocol string) (*Writer, error) {
+	if len(protocol) > 255 {
+		return nil, fmt.Errorf("protocol name too long: %s", protocol)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{file: file, writer: bufio.NewWriterSize(file, 64*1024), done: make(chan struct{})}
+	head := append([]byte(magic), version, byte(len(protocol)))
+	_, _ = w.writer.Write(append(head, protocol...))
+	if err = w.writer.Flush(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	go w.flushLoop()
+	log.Infof("[%-9s] capturing %s pdus to %s", "Capture", protocol, path)
+	return w, nil
+}
+
+func (w *Writer) flushLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.lock.Lock()
+			if err := w.writer.Flush(); err != nil {
+				log.Errorf("[%-9s] flush error: %v", "Capture", err)
+			}
+			w.lock.Unlock()
+		}
+	}
+}
+
+// Write 写入一条记录，conn为连接标识
+func (w *Writer) Write(event Event, conn string, frame []byte) {
+	if w == nil {
+		return
+	}
+	if len(conn) > 0xffff {
+		conn = conn[:0xffff]
+	}
+	head := make([]byte, 11+len(conn)+4)
+	binary.BigEndian.PutUint64(head, uint64(time.Now().UnixNano()))
+	head[8] = byte(event)
+	binary.BigEndian.PutUint16(head[9:], uint16(len(conn)))
+	copy(head[11:], conn)
+	binary.BigEndian.PutUint32(head[11+len(conn):], uint32(len(frame)))
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, _ = w.writer.Write(head)
+	_, _ = w.writer.Write(frame)
+}
+
+// Opened 连接建立，需在事件循环中调用
+func (w *Writer) Opened(c gnet.Conn) {
+	if w == nil {
+		return
+	}
+	id := c.RemoteAddr().String()
+	w.conns.Store(c, id)
+	w.Write(Open, id, nil)
+}
+
+// Closed 连接关闭，需在事件循环中调用
+func (w *Writer) Closed(c gnet.Conn) {
+	if w == nil {
+		return
+	}
+	if id, ok := w.conns.LoadAndDelete(c); ok {
+		w.Write(Close, id.(string), nil)
+	}
+}
+
+// In 收到报文
+func (w *Writer) In(c gnet.Conn, frame []byte) {
+	w.conn(In, c, frame)
+}
+
+// Out 发出报文，可在任意协程中调用
+func (w *Writer) Out(c gnet.Conn, frame []byte) {
+	w.conn(Out, c, frame)
+}
+
+func (w *Writer) conn(event Event, c gnet.Conn, frame []byte) {
+	if w == nil {
+		return
+	}
+	if id, ok := w.conns.Load(c); ok {
+		w.Write(event, id.(string), frame)
+	}
+}
+
+// Close 刷新缓冲并关闭文件
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	select {
+	case <-w.done:
+		return nil
+	default:
+		close(w.done)
+	}
+	_ = w.writer.Flush()
+	return w.file.Close()
+}
+
+// Reader 读取抓包文件
+type Reader struct {
+	reader   *bufio.Reader
+	protocol string
+}
+
+// NewReader 读取并校验文件头
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(br, head); err != nil || string(head[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	if head[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported capture version %d", head[len(magic)])
+	}
+	protocol := make([]byte, head[len(magic)+1])
+	if _, err := io.ReadFull(br, protocol); err != nil {
+		return nil, ErrFormat
+	}
+	return &Reader{reader: br, protocol: string(protocol)}, nil
+}
+
+// Protocol 抓包的协议名称
+func (r *Reader) Protocol() string {
+	return r.protocol
+}
+
+// Next 读取下一条记录，读完时返回io.EOF；进程异常退出时最后一条记录可能不完整，返回io.ErrUnexpectedEOF
+func (r *Reader) Next() (*Record, error) {
+	head := make([]byte, 11)
+	if _, err := io.ReadFull(r.reader, head); err != nil {
+		return nil, err
+	}
+	conn := make([]byte, binary.BigEndian.Uint16(head[9:]))
+	if _, err := io.ReadFull(r.reader, conn); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r.reader, size); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint32(size)
+	if n > maxFrameLen {
+		return nil, fmt.Errorf("frame too large: %d bytes", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r.reader, frame); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &Record{
+		Time:  time.Unix(0, int64(binary.BigEndian.Uint64(head))),
+		Event: Event(head[8]),
+		Conn:  string(conn),
+		Frame: frame,
+	}, nil
+}
+
+// ReadFile 读取整个抓包文件
+func ReadFile(path string) (protocol string, records []*Record, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	r, err := NewReader(file)
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return r.protocol, records, nil
+		} else if err != nil {
+			return r.protocol, records, err
+		}
+		records = append(records, rec)
+	}
+}
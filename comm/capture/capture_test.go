@@ -0,0 +1,55 @@
+package capture
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "cmpp.cap")
+	w, err := Create(path, "cmpp")
+	assert.NoError(t, err)
+	w.Write(Open, "127.0.0.1:5000", nil)
+	w.Write(In, "127.0.0.1:5000", []byte{0, 0, 0, 12, 0, 0, 0, 8, 0, 0, 0, 1})
+	w.Write(Out, "127.0.0.1:5000", []byte{0, 0, 0, 13, 0x80, 0, 0, 8, 0, 0, 0, 1, 0})
+	w.Write(Close, "127.0.0.1:5000", nil)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+
+	protocol, records, err := ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "cmpp", protocol)
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, []Event{Open, In, Out, Close},
+		[]Event{records[0].Event, records[1].Event, records[2].Event, records[3].Event})
+	assert.Equal(t, "127.0.0.1:5000", records[1].Conn)
+	assert.Equal(t, 13, len(records[2].Frame))
+	assert.Empty(t, records[3].Frame)
+	assert.False(t, records[1].Time.Before(records[0].Time))
+
+	// 进程异常退出时最后一条记录不完整
+	info, _ := os.Stat(path)
+	assert.NoError(t, os.Truncate(path, info.Size()-3))
+	_, records, err = ReadFile(path)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 3, len(records))
+}
+
+func TestCapture_nil(t *testing.T) {
+	var w *Writer
+	w.Write(In, "127.0.0.1:5000", []byte{1})
+	w.In(nil, []byte{1})
+	w.Out(nil, []byte{1})
+	assert.NoError(t, w.Close())
+}
+
+func TestNewReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"msgId":"1"}`), 0600))
+	_, _, err := ReadFile(path)
+	assert.Equal(t, ErrFormat, err)
+}
@@ -6,12 +6,12 @@ import (
 )
 
 // CycleSequence 生成可循环使用的序号
-// 构成为: 0 | datacenter 2 bit | worker 3 bit| sequence 26 bit
-// 最大支持32个节点，单节点2^26以内不会重复（67,108,864）
+// 构成为: datacenter 1 bit | worker 3 bit | 0 2 bit | sequence 26 bit
+// 最大支持16个节点，单节点2^26以内不会重复（67,108,864）
 type CycleSequence struct {
 	sync.Mutex       // 锁
-	datacenter int32 // 数据中心机房id, 取值范围范围：0-4
-	worker     int32 // 工作节点, 取值范围范围：0-8
+	datacenter int32 // 数据中心机房id, 取值范围范围：0-1
+	worker     int32 // 工作节点, 取值范围范围：0-7
 	sequence   int32 // 序列号 26bit
 }
 
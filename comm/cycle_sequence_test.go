@@ -2,10 +2,25 @@ package comm
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 var seq = NewCycleSequence(1, 1)
 
+func TestCycleSequence_NextVal(t *testing.T) {
+	// datacenter占最高位，不同的datacenter、worker生成的序号不重复
+	seen := map[uint32]bool{}
+	for d := int32(0); d <= 1; d++ {
+		for w := int32(0); w <= 7; w++ {
+			v := uint32(NewCycleSequence(d, w).NextVal())
+			assert.Equal(t, uint32(d)<<31|uint32(w)<<28|1, v)
+			assert.False(t, seen[v])
+			seen[v] = true
+		}
+	}
+}
+
 func BenchmarkCycleSequence_NextVal(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,183 @@
+package comm
+
+import (
+	"strings"
+	"time"
+)
+
+// GSM 03.38 默认字母表，下标即为septet的值，0x1B为扩展表的转义符
+var gsm7Basic = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+// GSM 03.38 扩展表，编码时需在前面加转义符0x1B，占两个septet
+var gsm7Ext = map[rune]byte{
+	'\f': 0x0A, '^': 0x14, '{': 0x28, '}': 0x29, '\\': 0x2F, '[': 0x3C, '~': 0x3D, ']': 0x3E, '|': 0x40, '€': 0x65,
+}
+
+const gsm7Esc = 0x1B
+
+var gsm7BasicIndex = make(map[rune]byte, 128)
+var gsm7ExtReverse = make(map[byte]rune, len(gsm7Ext))
+
+func init() {
+	for i, r := range gsm7Basic {
+		if i != gsm7Esc {
+			gsm7BasicIndex[r] = byte(i)
+		}
+	}
+	for r, b := range gsm7Ext {
+		gsm7ExtReverse[b] = r
+	}
+}
+
+// IsGsm7 内容是否可以全部使用GSM 7-bit默认字母表(含扩展表)表示
+func IsGsm7(s string) bool {
+	for _, r := range s {
+		if _, ok := gsm7BasicIndex[r]; ok {
+			continue
+		}
+		if _, ok := gsm7Ext[r]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Gsm7Encode 编码为septet序列(每个字节一个septet，未压缩)，含有无法表示的字符时返回false
+func Gsm7Encode(s string) ([]byte, bool) {
+	septets := make([]byte, 0, len(s))
+	for _, r := range s {
+		if b, ok := gsm7BasicIndex[r]; ok {
+			septets = append(septets, b)
+		} else if b, ok := gsm7Ext[r]; ok {
+			septets = append(septets, gsm7Esc, b)
+		} else {
+			return nil, false
+		}
+	}
+	return septets, true
+}
+
+// Gsm7Decode 解码septet序列(每个字节一个septet，未压缩)，无法识别的扩展字符按空格处理
+func Gsm7Decode(septets []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(septets); i++ {
+		b := septets[i] & 0x7f
+		if b == gsm7Esc && i+1 < len(septets) {
+			i++
+			if r, ok := gsm7ExtReverse[septets[i]&0x7f]; ok {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteRune(' ')
+			}
+			continue
+		}
+		if b == gsm7Esc {
+			continue
+		}
+		sb.WriteRune(gsm7Basic[b])
+	}
+	return sb.String()
+}
+
+// Gsm7Pack 将septet序列压缩为8位字节流，8个septet占7个字节。
+// 最后一个字节剩余7个空位时按GSM 03.38填充CR，避免接收方多解出一个@
+func Gsm7Pack(septets []byte) []byte {
+	packed := make([]byte, (len(septets)*7+7)/8)
+	for i, s := range septets {
+		bit := i * 7
+		idx, shift := bit/8, uint(bit%8)
+		packed[idx] |= (s & 0x7f) << shift
+		if shift > 1 {
+			packed[idx+1] |= (s & 0x7f) >> (8 - shift)
+		}
+	}
+	if len(septets)%8 == 7 {
+		packed[len(packed)-1] |= '\r' << 1
+	}
+	return packed
+}
+
+// Gsm7Unpack 将压缩的字节流还原为count个septet
+func Gsm7Unpack(packed []byte, count int) []byte {
+	if count > len(packed)*8/7 {
+		count = len(packed) * 8 / 7
+	}
+	septets := make([]byte, count)
+	for i := 0; i < count; i++ {
+		bit := i * 7
+		idx, shift := bit/8, uint(bit%8)
+		s := packed[idx] >> shift
+		if shift > 1 && idx+1 < len(packed) {
+			s |= packed[idx+1] << (8 - shift)
+		}
+		septets[i] = s & 0x7f
+	}
+	return septets
+}
+
+// Gsm7PackUserData 将UDH与septet序列组成短信的用户数据(UD)，septet压缩后从UDH之后的第一个septet边界开始(补齐填充位)，
+// udh为空时同 Gsm7Pack
+func Gsm7PackUserData(udh []byte, septets []byte) []byte {
+	if len(udh) == 0 {
+		return Gsm7Pack(septets)
+	}
+	// UDH及填充位按值为0的septet占位，压缩后再写入UDH
+	fill := (len(udh)*8 + 6) / 7
+	all := make([]byte, fill+len(septets))
+	copy(all[fill:], septets)
+	packed := Gsm7Pack(all)
+	copy(packed, udh)
+	return packed
+}
+
+// Gsm7UnpackUserData 还原 Gsm7PackUserData 压缩的用户数据，udhLen为UDH的字节数(含UDHL)，返回不含UDH的septet序列
+func Gsm7UnpackUserData(ud []byte, udhLen int) []byte {
+	septets := Gsm7Unpack(ud, len(ud)*8/7)
+	fill := (udhLen*8 + 6) / 7
+	if fill > len(septets) {
+		return nil
+	}
+	septets = septets[fill:]
+	// 恰好占满最后一个字节时，最后的CR为压缩时的填充
+	if len(ud)*8%7 == 0 && len(septets) > 0 && septets[len(septets)-1] == '\r' {
+		septets = septets[:len(septets)-1]
+	}
+	return septets
+}
+
+// ToGsm7Slices 将septet序列拆分为长短信切片，单条最长160个septet，拆分后每片最长153个septet，加6字节UDH，
+// 转义符不会与其后的扩展字符分开。packed为true时每片为按 Gsm7PackUserData 压缩的用户数据，
+// 否则每个septet占一个字节(多数SMSC的short_message按此格式)，UDH之后直接为septet序列
+func ToGsm7Slices(septets []byte, packed bool) (rt [][]byte) {
+	if len(septets) <= 160 {
+		if packed {
+			return [][]byte{Gsm7Pack(septets)}
+		}
+		return [][]byte{append([]byte(nil), septets...)}
+	}
+
+	bodyLen := 153
+	var bodies [][]byte
+	for start := 0; start < len(septets); {
+		end := start + bodyLen
+		if end >= len(septets) {
+			end = len(septets)
+		} else if septets[end-1] == gsm7Esc {
+			end--
+		}
+		bodies = append(bodies, septets[start:end])
+		start = end
+	}
+	// 分片消息组的标识，用于收集组装消息
+	groupId := byte(time.Now().UnixNano() & 0xff)
+	for i, body := range bodies {
+		udh := []byte{0x05, 0x00, 0x03, groupId, byte(len(bodies)), byte(i + 1)}
+		if packed {
+			rt = append(rt, Gsm7PackUserData(udh, body))
+		} else {
+			rt = append(rt, append(udh, body...))
+		}
+	}
+	return rt
+}
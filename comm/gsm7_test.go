@@ -0,0 +1,111 @@
+package comm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGsm7Encode(t *testing.T) {
+	assert.Equal(t, 128, len(gsm7Basic))
+
+	s := "Hello @World! Price: 5€ [ok] {x} ~|^\\ £¥èÄß"
+	assert.True(t, IsGsm7(s))
+	septets, ok := Gsm7Encode(s)
+	assert.True(t, ok)
+	// 扩展字符各占两个septet
+	assert.Equal(t, len([]rune(s))+9, len(septets))
+	assert.Equal(t, byte(0x00), septets[6])
+	assert.Equal(t, s, Gsm7Decode(septets))
+
+	assert.False(t, IsGsm7("你好"))
+	assert.False(t, IsGsm7("`"))
+	_, ok = Gsm7Encode("hello 世界")
+	assert.False(t, ok)
+}
+
+func TestGsm7Pack(t *testing.T) {
+	septets, _ := Gsm7Encode("hellohello")
+	packed := Gsm7Pack(septets)
+	// GSM 03.38 规范中的示例
+	assert.Equal(t, []byte{0xe8, 0x32, 0x9b, 0xfd, 0x46, 0x97, 0xd9, 0xec, 0x37}, packed)
+	assert.Equal(t, septets, Gsm7Unpack(packed, len(septets)))
+
+	septets, _ = Gsm7Encode(strings.Repeat("abc{}", 32))
+	assert.Equal(t, 224, len(septets))
+	packed = Gsm7Pack(septets)
+	assert.Equal(t, 196, len(packed))
+	assert.Equal(t, septets, Gsm7Unpack(packed, len(septets)))
+}
+
+func TestGsm7PackUserData(t *testing.T) {
+	// 7个septet恰好剩余7个空位，填充CR，解码时去除
+	septets, _ := Gsm7Encode("1234567")
+	packed := Gsm7Pack(septets)
+	assert.Equal(t, 7, len(packed))
+	assert.Equal(t, byte('\r'<<1), packed[6]&0xfe)
+	assert.Equal(t, septets, Gsm7UnpackUserData(packed, 0))
+	assert.Equal(t, "1234567", Gsm7Decode(Gsm7UnpackUserData(packed, 0)))
+
+	// 6字节UDH后补1个填充位，septet从第8个septet开始
+	udh := []byte{0x05, 0x00, 0x03, 0x01, 0x02, 0x01}
+	septets, _ = Gsm7Encode("hello")
+	ud := Gsm7PackUserData(udh, septets)
+	assert.Equal(t, udh, ud[:6])
+	assert.Equal(t, (7+5)*7/8+1, len(ud))
+	assert.Equal(t, septets, Gsm7UnpackUserData(ud, len(udh)))
+}
+
+func TestToGsm7Slices(t *testing.T) {
+	septets, _ := Gsm7Encode(strings.Repeat("a", 160))
+	slices := ToGsm7Slices(septets, true)
+	assert.Equal(t, 1, len(slices))
+	assert.Equal(t, 140, len(slices[0]))
+
+	s := strings.Repeat("a", 152) + "€" + strings.Repeat("b", 200)
+	septets, _ = Gsm7Encode(s)
+	slices = ToGsm7Slices(septets, true)
+	assert.Equal(t, 3, len(slices))
+
+	var all []byte
+	for i, slice := range slices {
+		// 压缩后每片不超过140字节
+		assert.True(t, len(slice) <= 140)
+		seg, ok := ParseUDH(slice)
+		assert.True(t, ok)
+		assert.Equal(t, byte(i+1), seg.Seq)
+		body := Gsm7UnpackUserData(slice, 6)
+		if i == 0 {
+			// 转义符不会留在分片末尾
+			assert.Equal(t, 152, len(body))
+		} else if i == 1 {
+			assert.Equal(t, byte(gsm7Esc), body[0])
+		}
+		all = append(all, body...)
+	}
+	assert.Equal(t, s, Gsm7Decode(all))
+}
+
+func TestToGsm7Slices_Unpacked(t *testing.T) {
+	septets, _ := Gsm7Encode(strings.Repeat("a", 160))
+	slices := ToGsm7Slices(septets, false)
+	assert.Equal(t, 1, len(slices))
+	assert.Equal(t, septets, slices[0])
+
+	s := strings.Repeat("a", 152) + "€" + strings.Repeat("b", 200)
+	septets, _ = Gsm7Encode(s)
+	slices = ToGsm7Slices(septets, false)
+	assert.Equal(t, 3, len(slices))
+
+	var all []byte
+	for i, slice := range slices {
+		// 未压缩时每片不超过 6字节UDH + 153个septet
+		assert.True(t, len(slice) <= 159)
+		seg, ok := ParseUDH(slice)
+		assert.True(t, ok)
+		assert.Equal(t, byte(i+1), seg.Seq)
+		all = append(all, slice[6:]...)
+	}
+	assert.Equal(t, s, Gsm7Decode(all))
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics 网关或客户端的Prometheus指标，指标名以gosms_开头，并带有protocol标签
+// 统计方法可在nil上调用，此时不做统计，便于客户端等可选使用指标的场景
+type Metrics struct {
+	registry        *prometheus.Registry
+	labels          prometheus.Labels
+	commands        map[uint32]string      // 协议的命令名称，如 cmpp.CommandMap
+	pdus            *prometheus.CounterVec // 按方向、命令统计的报文数
+	submits         *prometheus.CounterVec // 按结果码统计的MT数
+	reports         *prometheus.CounterVec // 按状态统计的状态报告数
+	connectFailures *prometheus.CounterVec // 按状态码统计的登录失败数
+	reportLatency   prometheus.Histogram   // 收到MT至发出状态报告的耗时
+}
+
+// New protocol为协议名称，commands为命令ID对应的名称
+func New(protocol string, commands map[uint32]string) *Metrics {
+	labels := prometheus.Labels{"protocol": protocol}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		labels:   labels,
+		commands: commands,
+		pdus: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gosms", Name: "pdus_total", Help: "PDUs sent or received by command.", ConstLabels: labels,
+		}, []string{"direction", "command"}),
+		submits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gosms", Name: "submit_results_total", Help: "Submit responses by result code.", ConstLabels: labels,
+		}, []string{"result"}),
+		reports: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gosms", Name: "reports_total", Help: "Status reports by stat.", ConstLabels: labels,
+		}, []string{"stat"}),
+		connectFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gosms", Name: "connect_failures_total", Help: "Failed logins by status.", ConstLabels: labels,
+		}, []string{"status"}),
+		reportLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "gosms", Name: "report_latency_seconds", Help: "Latency from submit to status report.", ConstLabels: labels,
+			Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 3600},
+		}),
+	}
+	m.registry.MustRegister(m.pdus, m.submits, m.reports, m.connectFailures, m.reportLatency,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// Gauge 注册采集时取值的指标，如接收窗口占用、协程池的工作数
+func (m *Metrics) Gauge(name string, help string, f func() float64) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gosms", Name: name, Help: help, ConstLabels: m.labels,
+	}, f))
+}
+
+// Handler /metrics 的处理器
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Register 在http.DefaultServeMux上注册 /metrics，与pprof共用监听端口
+func (m *Metrics) Register() {
+	http.Handle("/metrics", m.Handler())
+}
+
+// In 收到报文
+func (m *Metrics) In(command uint32) {
+	if m == nil {
+		return
+	}
+	m.pdus.WithLabelValues("in", m.command(command)).Inc()
+}
+
+// Out 发出报文，frame为编码后的完整报文，命令ID取报文头的第5至8字节
+func (m *Metrics) Out(frame []byte) {
+	if m == nil || len(frame) < 8 {
+		return
+	}
+	m.pdus.WithLabelValues("out", m.command(binary.BigEndian.Uint32(frame[4:8]))).Inc()
+}
+
+// SubmitResult MT的应答结果
+func (m *Metrics) SubmitResult(result uint32) {
+	if m == nil {
+		return
+	}
+	m.submits.WithLabelValues(strconv.FormatUint(uint64(result), 10)).Inc()
+}
+
+// Report 产生状态报告，latency为收到MT至发出状态报告的耗时，小于0时不统计耗时
+func (m *Metrics) Report(stat string, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.reports.WithLabelValues(stat).Inc()
+	if latency >= 0 {
+		m.reportLatency.Observe(latency.Seconds())
+	}
+}
+
+// ConnectFailure 登录失败
+func (m *Metrics) ConnectFailure(status uint32) {
+	if m == nil {
+		return
+	}
+	m.connectFailures.WithLabelValues(strconv.FormatUint(uint64(status), 10)).Inc()
+}
+
+// 未知的命令ID统一记为unknown，避免对端发送任意的Command_Id导致标签无限增长
+func (m *Metrics) command(id uint32) string {
+	if name, ok := m.commands[id]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New("cmpp", map[uint32]string{0x00000004: "CMPP_SUBMIT", 0x80000004: "CMPP_SUBMIT_RESP"})
+	m.Gauge("receive_window_used", "Messages being processed in the receive window.", func() float64 { return 3 })
+	m.In(0x00000004)
+	m.In(0x00000099)
+	m.In(0x12345678)
+	m.Out([]byte{0, 0, 0, 12, 0x80, 0, 0, 4, 0, 0, 0, 1})
+	m.Out([]byte{0, 0})
+	m.SubmitResult(0)
+	m.SubmitResult(13)
+	m.Report("DELIVRD", 200*time.Millisecond)
+	m.Report("UNDELIV", -1)
+	m.ConnectFailure(3)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+	text := string(body)
+	for _, line := range []string{
+		`gosms_pdus_total{command="CMPP_SUBMIT",direction="in",protocol="cmpp"} 1`,
+		`gosms_pdus_total{command="unknown",direction="in",protocol="cmpp"} 2`,
+		`gosms_pdus_total{command="CMPP_SUBMIT_RESP",direction="out",protocol="cmpp"} 1`,
+		`gosms_submit_results_total{protocol="cmpp",result="13"} 1`,
+		`gosms_reports_total{protocol="cmpp",stat="UNDELIV"} 1`,
+		`gosms_connect_failures_total{protocol="cmpp",status="3"} 1`,
+		`gosms_report_latency_seconds_count{protocol="cmpp"} 1`,
+		`gosms_receive_window_used{protocol="cmpp"} 3`,
+	} {
+		assert.True(t, strings.Contains(text, line), line)
+	}
+}
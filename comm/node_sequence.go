@@ -0,0 +1,36 @@
+package comm
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NodeSequence 联通SGIP序列号生成器，序列号由三部分组成，共12字节
+// 第一部分：命令源节点的编号 4 字节
+// 第二部分：时间，格式为 MMDDHHMMSS（月日时分秒）4 字节
+// 第三部分：序列号，从 0 开始，顺序累加，步长为 1 循环使用 4 字节
+type NodeSequence struct {
+	sync.Mutex        // 锁
+	node       uint32 // 节点编号
+	sequence   uint32 // 序列号
+}
+
+// NewNodeSequence node 为命令源节点的编号
+func NewNodeSequence(node uint32) *NodeSequence {
+	return &NodeSequence{node: node}
+}
+
+func (s *NodeSequence) NextVal() [3]uint32 {
+	s.Lock()
+	s.sequence++
+	seq := s.sequence
+	s.Unlock()
+	ts, _ := strconv.ParseUint(time.Now().Format("0102150405"), 10, 32)
+	return [3]uint32{s.node, uint32(ts), seq}
+}
+
+func (s *NodeSequence) String() string {
+	return fmt.Sprintf("%d:%d", s.node, s.sequence)
+}
@@ -0,0 +1,25 @@
+package comm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var nodeSeq = NewNodeSequence(3020012345)
+
+func TestNodeSequence_NextVal(t *testing.T) {
+	s1 := nodeSeq.NextVal()
+	s2 := nodeSeq.NextVal()
+	t.Logf("s1: %v, s2: %v", s1, s2)
+	assert.Equal(t, uint32(3020012345), s1[0])
+	assert.Equal(t, s1[2]+1, s2[2])
+	assert.True(t, s1[1] > 101000000)
+}
+
+func BenchmarkNodeSequence_NextVal(b *testing.B) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nodeSeq.NextVal()
+	}
+}
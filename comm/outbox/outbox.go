@@ -0,0 +1,229 @@
+package outbox
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+)
+
+var log = logging.GetDefaultLogger()
+
+// Outbox 按SP账号排队待发送的状态报告
+// 报告发送给该账号任一在线连接，未收到应答时按间隔重发，超过最大次数后放弃(由消息存储在SP重新登录后补发)；
+// 账号没有在线连接时等待登录，等待超过全部重发所需的时长后同样放弃
+type Outbox struct {
+	lock     sync.Mutex
+	sessions map[string][]gnet.Conn // account -> 在线连接
+	next     map[string]int         // account -> 轮询发送的连接下标
+	queues   map[string]*list.List  // account -> 待应答的报告，按入队顺序
+	items    map[string]*list.Element
+	interval time.Duration
+	maxRetry int
+	ttl      time.Duration // 没有在线连接时报告的最长等待时间
+	done     chan struct{}
+	onSend   func(c gnet.Conn, data []byte) // 每次发送报告时调用，如统计发出的报文、记录抓包
+}
+
+// Encoder 按接收的连接编码报文，如按连接协商的版本编码，同一账号不同版本的连接可共用一个队列
+type Encoder func(c gnet.Conn) []byte
+
+// Bytes 与接收连接无关的报文
+func Bytes(data []byte) Encoder {
+	return func(gnet.Conn) []byte {
+		return data
+	}
+}
+
+type item struct {
+	account  string
+	key      string // 应答中可以取得的标识，如状态报告Deliver的MsgId
+	encode   Encoder
+	conn     gnet.Conn // 最近一次发送使用的连接
+	queuedAt time.Time
+	sentAt   time.Time
+	tries    int
+}
+
+// New interval为未收到应答时的重发间隔，maxRetry为最大重发次数
+func New(interval time.Duration, maxRetry int) *Outbox {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &Outbox{
+		sessions: make(map[string][]gnet.Conn),
+		next:     make(map[string]int),
+		queues:   make(map[string]*list.List),
+		items:    make(map[string]*list.Element),
+		interval: interval,
+		maxRetry: maxRetry,
+		ttl:      interval * time.Duration(maxRetry+1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 开启重发任务
+func (o *Outbox) Start() {
+	go func() {
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-o.done:
+				return
+			case <-ticker.C:
+				o.retry()
+			}
+		}
+	}()
+}
+
+func (o *Outbox) Stop() {
+	close(o.done)
+}
+
+// OnSend 设置发送报告时的回调，需在 Start 前调用
+func (o *Outbox) OnSend(f func(c gnet.Conn, data []byte)) {
+	o.onSend = f
+}
+
+// Bind SP登录成功，发送该账号尚未发出的报告
+func (o *Outbox) Bind(account string, c gnet.Conn) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.sessions[account] = append(o.sessions[account], c)
+	if q, ok := o.queues[account]; ok {
+		for e := q.Front(); e != nil; e = e.Next() {
+			if it := e.Value.(*item); it.conn == nil {
+				o.send(it)
+			}
+		}
+	}
+}
+
+// Unbind 连接关闭，通过该连接发出但未应答的报告改由其他在线连接重发
+func (o *Outbox) Unbind(c gnet.Conn) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for account, conns := range o.sessions {
+		for i, con := range conns {
+			if con != c {
+				continue
+			}
+			conns = append(conns[:i:i], conns[i+1:]...)
+			if len(conns) == 0 {
+				delete(o.sessions, account)
+			} else {
+				o.sessions[account] = conns
+			}
+			if q, ok := o.queues[account]; ok {
+				for e := q.Front(); e != nil; e = e.Next() {
+					if it := e.Value.(*item); it.conn == c {
+						it.conn = nil
+						o.send(it)
+					}
+				}
+			}
+			return
+		}
+	}
+}
+
+// Push 报告入队并立即尝试发送，key已在队列中时忽略；发送时调用encode按接收的连接编码
+func (o *Outbox) Push(account string, key string, encode Encoder) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if _, ok := o.items[key]; ok {
+		return
+	}
+	q, ok := o.queues[account]
+	if !ok {
+		q = list.New()
+		o.queues[account] = q
+	}
+	it := &item{account: account, key: key, encode: encode, queuedAt: time.Now()}
+	o.items[key] = q.PushBack(it)
+	o.send(it)
+}
+
+// Ack 收到应答，报告出队
+func (o *Outbox) Ack(key string) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	e, ok := o.items[key]
+	if !ok {
+		return false
+	}
+	o.remove(e)
+	return true
+}
+
+// Pending 账号待应答的报告数量
+func (o *Outbox) Pending(account string) int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if q, ok := o.queues[account]; ok {
+		return q.Len()
+	}
+	return 0
+}
+
+func (o *Outbox) remove(e *list.Element) {
+	it := e.Value.(*item)
+	delete(o.items, it.key)
+	q := o.queues[it.account]
+	q.Remove(e)
+	if q.Len() == 0 {
+		delete(o.queues, it.account)
+	}
+}
+
+// send 轮询选择账号的在线连接发送，没有在线连接时等待SP登录，调用方需持有锁
+func (o *Outbox) send(it *item) {
+	conns := o.sessions[it.account]
+	if len(conns) == 0 {
+		it.conn = nil
+		return
+	}
+	idx := o.next[it.account] % len(conns)
+	o.next[it.account] = idx + 1
+	c := conns[idx]
+	it.conn, it.sentAt = c, time.Now()
+	it.tries++
+	data := it.encode(c)
+	if o.onSend != nil {
+		o.onSend(c, data)
+	}
+	err := c.AsyncWrite(data, nil)
+	if err != nil {
+		log.Errorf("[%-9s] send %s to %s error: %v", "Outbox", it.key, it.account, err)
+	}
+}
+
+func (o *Outbox) retry() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	now := time.Now()
+	for _, q := range o.queues {
+		for e := q.Front(); e != nil; {
+			next := e.Next()
+			it := e.Value.(*item)
+			if it.conn == nil && now.Sub(it.queuedAt) >= o.ttl {
+				log.Warnf("[%-9s] %s to %s not sent in %v without an online session, give up", "Outbox", it.key, it.account, o.ttl)
+				o.remove(e)
+			} else if it.conn != nil && now.Sub(it.sentAt) >= o.interval {
+				if it.tries > o.maxRetry {
+					log.Warnf("[%-9s] %s to %s not acknowledged after %d tries, give up", "Outbox", it.key, it.account, it.tries)
+					o.remove(e)
+				} else {
+					log.Infof("[%-9s] %s to %s not acknowledged, resend", "Outbox", it.key, it.account)
+					o.send(it)
+				}
+			}
+			e = next
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConn struct {
+	gnet.Conn
+	lock   sync.Mutex
+	writes []string
+}
+
+func (c *fakeConn) AsyncWrite(buf []byte, _ gnet.AsyncCallback) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writes = append(c.writes, string(buf))
+	return nil
+}
+
+func (c *fakeConn) written() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string(nil), c.writes...)
+}
+
+func (c *fakeConn) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.writes)
+}
+
+func TestOutbox(t *testing.T) {
+	o := New(time.Hour, 1)
+	c1, c2 := &fakeConn{}, &fakeConn{}
+
+	// 没有在线连接时排队，登录后发送
+	o.Push("sp", "1", Bytes([]byte("r1")))
+	assert.Equal(t, 1, o.Pending("sp"))
+	o.Bind("sp", c1)
+	assert.Equal(t, []string{"r1"}, c1.writes)
+
+	// 重复入队被忽略
+	o.Push("sp", "1", Bytes([]byte("r1")))
+	assert.Equal(t, 1, c1.count())
+
+	// 多个连接轮询发送
+	o.Bind("sp", c2)
+	o.Push("sp", "2", Bytes([]byte("r2")))
+	o.Push("sp", "3", Bytes([]byte("r3")))
+	assert.Equal(t, 2, c1.count())
+	assert.Equal(t, 1, c2.count())
+	assert.Equal(t, 3, o.Pending("sp"))
+
+	assert.True(t, o.Ack("2"))
+	assert.False(t, o.Ack("2"))
+	assert.Equal(t, 2, o.Pending("sp"))
+
+	// 连接关闭后未应答的报告改由其他连接重发
+	assert.Equal(t, []string{"r1", "r3"}, c1.writes)
+	o.Unbind(c1)
+	assert.Equal(t, []string{"r2", "r1", "r3"}, c2.writes)
+	o.Unbind(c2)
+	o.Push("sp", "4", Bytes([]byte("r4")))
+	assert.Equal(t, 3, c2.count())
+	c3 := &fakeConn{}
+	o.Bind("sp", c3)
+	assert.ElementsMatch(t, []string{"r1", "r3", "r4"}, c3.writes)
+	assert.Equal(t, 0, o.Pending("other"))
+}
+
+func TestOutbox_Retry(t *testing.T) {
+	o := New(20*time.Millisecond, 1)
+	o.Start()
+	defer o.Stop()
+	c := &fakeConn{}
+	o.Bind("sp", c)
+	o.Push("sp", "1", Bytes([]byte("r1")))
+	o.Push("sp", "2", Bytes([]byte("r2")))
+	o.Ack("2")
+
+	// 首次发送加一次重发，之后放弃
+	time.Sleep(120 * time.Millisecond)
+	assert.Equal(t, []string{"r1", "r2", "r1"}, c.written())
+	assert.Equal(t, 0, o.Pending("sp"))
+}
+
+func TestOutbox_Expire(t *testing.T) {
+	o := New(20*time.Millisecond, 1)
+	o.Start()
+	defer o.Stop()
+	// 没有在线连接的报告等待超过全部重发所需的时长后放弃
+	o.Push("sp", "1", Bytes([]byte("r1")))
+	time.Sleep(20 * time.Millisecond)
+	o.Push("sp", "2", Bytes([]byte("r2")))
+	assert.Equal(t, 2, o.Pending("sp"))
+	time.Sleep(60 * time.Millisecond)
+	assert.LessOrEqual(t, o.Pending("sp"), 1)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, 0, o.Pending("sp"))
+}
+
+func TestOutbox_Encoder(t *testing.T) {
+	o := New(time.Hour, 1)
+	c1, c2 := &fakeConn{}, &fakeConn{}
+	o.Bind("sp", c1)
+	o.Bind("sp", c2)
+	// 按接收的连接编码
+	encode := func(c gnet.Conn) []byte {
+		if c == c1 {
+			return []byte("v2")
+		}
+		return []byte("v3")
+	}
+	o.Push("sp", "1", encode)
+	o.Push("sp", "2", encode)
+	assert.Equal(t, []string{"v2"}, c1.written())
+	assert.Equal(t, []string{"v3"}, c2.written())
+	// 连接关闭后改由其他连接按其版本重发
+	o.Unbind(c1)
+	assert.Equal(t, []string{"v3", "v3"}, c2.written())
+}
@@ -0,0 +1,133 @@
+package comm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Segment 长短信分片，由消息内容头部的UDH解析得到
+type Segment struct {
+	Ref   uint16 // 分片消息组的标识，8位参考号时取值 [0,255]
+	Total byte   // 分片总数
+	Seq   byte   // 分片序号，从1开始
+	Body  []byte // 去掉UDH后的分片内容
+}
+
+// ParseUDH 解析消息内容头部的UDH，支持8位参考号(05 00 03)及16位参考号(06 08 04)，
+// UDH中包含其他信息单元时会跳过，未找到长短信信息单元时返回false
+func ParseUDH(msg []byte) (*Segment, bool) {
+	if len(msg) < 1 {
+		return nil, false
+	}
+	udhl := int(msg[0])
+	if udhl+1 > len(msg) {
+		return nil, false
+	}
+	udh := msg[1 : udhl+1]
+	for i := 0; i+2 <= len(udh); {
+		iei, iel := udh[i], int(udh[i+1])
+		ie := udh[i+2:]
+		if iel > len(ie) {
+			return nil, false
+		}
+		ie = ie[:iel]
+		switch {
+		case iei == 0x00 && iel == 3:
+			return &Segment{Ref: uint16(ie[0]), Total: ie[1], Seq: ie[2], Body: msg[udhl+1:]}, true
+		case iei == 0x08 && iel == 4:
+			return &Segment{Ref: uint16(ie[0])<<8 | uint16(ie[1]), Total: ie[2], Seq: ie[3], Body: msg[udhl+1:]}, true
+		}
+		i += 2 + iel
+	}
+	return nil, false
+}
+
+// Reassembler 长短信组装器，按 (源号码, 目的号码, 参考号, 分片总数) 收集分片，
+// 支持分片乱序、重复到达，超过 timeout 仍未收齐的分片组将被丢弃
+type Reassembler struct {
+	timeout time.Duration
+	lock    sync.Mutex
+	groups  map[string]*segmentGroup
+}
+
+type segmentGroup struct {
+	parts    [][]byte // 下标为分片序号-1
+	received int      // 已收到的分片数
+	firstAt  time.Time
+}
+
+func NewReassembler(timeout time.Duration) *Reassembler {
+	return &Reassembler{timeout: timeout, groups: make(map[string]*segmentGroup)}
+}
+
+// Add 添加一条消息内容(含UDH)，返回组装后的完整内容(不含UDH)。
+// 非长短信直接返回原内容；分片未收齐时返回false
+func (r *Reassembler) Add(src, dest string, msg []byte) ([]byte, bool) {
+	seg, ok := ParseUDH(msg)
+	if !ok {
+		return msg, true
+	}
+	if seg.Total <= 1 {
+		return seg.Body, true
+	}
+	if seg.Seq < 1 || seg.Seq > seg.Total {
+		log.Warnf("[%-9s] invalid segment %d/%d from %s to %s", "Reassemble", seg.Seq, seg.Total, src, dest)
+		return nil, false
+	}
+
+	key := fmt.Sprintf("%s|%s|%d|%d", src, dest, seg.Ref, seg.Total)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire()
+
+	g := r.groups[key]
+	if g == nil {
+		g = &segmentGroup{parts: make([][]byte, seg.Total), firstAt: time.Now()}
+		r.groups[key] = g
+	}
+	if g.parts[seg.Seq-1] != nil {
+		// 重复的分片
+		return nil, false
+	}
+	// 拷贝一份，避免引用报文缓冲区
+	body := make([]byte, len(seg.Body))
+	copy(body, seg.Body)
+	g.parts[seg.Seq-1] = body
+	g.received++
+	if g.received < len(g.parts) {
+		return nil, false
+	}
+
+	delete(r.groups, key)
+	size := 0
+	for _, p := range g.parts {
+		size += len(p)
+	}
+	data := make([]byte, 0, size)
+	for _, p := range g.parts {
+		data = append(data, p...)
+	}
+	return data, true
+}
+
+// Pending 返回未收齐的分片组数量
+func (r *Reassembler) Pending() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire()
+	return len(r.groups)
+}
+
+// 丢弃超时的分片组，调用方需持有锁
+func (r *Reassembler) expire() {
+	if r.timeout <= 0 {
+		return
+	}
+	for key, g := range r.groups {
+		if time.Since(g.firstAt) > r.timeout {
+			log.Warnf("[%-9s] drop incomplete message %s, received %d/%d", "Reassemble", key, g.received, len(g.parts))
+			delete(r.groups, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package comm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUDH(t *testing.T) {
+	seg, ok := ParseUDH([]byte{0x05, 0x00, 0x03, 0x1f, 0x03, 0x02, 'a', 'b'})
+	assert.True(t, ok)
+	assert.Equal(t, uint16(0x1f), seg.Ref)
+	assert.Equal(t, byte(3), seg.Total)
+	assert.Equal(t, byte(2), seg.Seq)
+	assert.Equal(t, []byte("ab"), seg.Body)
+
+	seg, ok = ParseUDH([]byte{0x06, 0x08, 0x04, 0x12, 0x34, 0x02, 0x01, 'c'})
+	assert.True(t, ok)
+	assert.Equal(t, uint16(0x1234), seg.Ref)
+	assert.Equal(t, byte(2), seg.Total)
+	assert.Equal(t, byte(1), seg.Seq)
+	assert.Equal(t, []byte("c"), seg.Body)
+
+	// 前面带有其他信息单元
+	seg, ok = ParseUDH([]byte{0x08, 0x0a, 0x01, 0xff, 0x00, 0x03, 0x01, 0x02, 0x02, 'd'})
+	assert.True(t, ok)
+	assert.Equal(t, byte(2), seg.Seq)
+	assert.Equal(t, []byte("d"), seg.Body)
+
+	_, ok = ParseUDH([]byte{0x05, 0x00, 0x03})
+	assert.False(t, ok)
+	_, ok = ParseUDH([]byte("hello"))
+	assert.False(t, ok)
+}
+
+func TestReassembler_Add(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 40)
+	slices := ToTPUDHISlices(content, 140)
+	assert.Equal(t, 3, len(slices))
+
+	r := NewReassembler(time.Minute)
+	// 乱序且重复
+	order := []int{2, 0, 2, 1}
+	var data []byte
+	var ok bool
+	for i, idx := range order {
+		data, ok = r.Add("13800001111", "10690", slices[idx])
+		if i < len(order)-1 {
+			assert.False(t, ok)
+		}
+	}
+	assert.True(t, ok)
+	assert.Equal(t, content, data)
+	assert.Equal(t, 0, r.Pending())
+
+	// 不同号码的分片不会混在一起
+	_, ok = r.Add("13800001111", "10690", slices[0])
+	assert.False(t, ok)
+	_, ok = r.Add("13800002222", "10690", slices[1])
+	assert.False(t, ok)
+	assert.Equal(t, 2, r.Pending())
+
+	// 非长短信原样返回
+	data, ok = r.Add("13800001111", "10690", []byte("hello"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("hello"), data)
+}
+
+func TestReassembler_Timeout(t *testing.T) {
+	slices := ToTPUDHISlices(bytes.Repeat([]byte("x"), 200), 140)
+	r := NewReassembler(50 * time.Millisecond)
+	_, ok := r.Add("13800001111", "10690", slices[0])
+	assert.False(t, ok)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, r.Pending())
+	_, ok = r.Add("13800001111", "10690", slices[1])
+	assert.False(t, ok)
+}
@@ -0,0 +1,129 @@
+package scenario
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+var log = logging.GetDefaultLogger()
+
+// Rule 场景规则，匹配条件均为空时匹配所有MT，多个条件需同时满足
+type Rule struct {
+	Name string `mapstructure:"name"`
+
+	// 匹配条件
+	DestPrefix string `mapstructure:"dest-prefix"` // 接收号码前缀，任一接收号码满足即可
+	DestSuffix string `mapstructure:"dest-suffix"` // 接收号码后缀，任一接收号码满足即可
+	Content    string `mapstructure:"content"`     // 短信内容，正则表达式
+	ServiceId  string `mapstructure:"service-id"`  // 业务代码
+	SrcId      string `mapstructure:"src-id"`      // 源号码前缀
+
+	// 处理结果，未配置的项按模拟网关的运行参数处理
+	Result      *uint32       `mapstructure:"result"`       // SubmitResp的结果
+	Stat        string        `mapstructure:"stat"`         // 状态报告的stat，如 UNDELIV
+	Err         string        `mapstructure:"err"`          // 状态报告的err，仅SMGP，未配置stat时stat取错误码对应的状态
+	SubmitDelay time.Duration `mapstructure:"submit-delay"` // SubmitResp的延迟
+	ReportDelay time.Duration `mapstructure:"report-delay"` // 状态报告的延迟
+	NoReport    bool          `mapstructure:"no-report"`    // 不产生状态报告
+
+	re *regexp.Regexp
+}
+
+// Message 用于匹配规则的MT信息
+type Message struct {
+	Dest      []string
+	Content   string
+	ServiceId string
+	SrcId     string
+}
+
+func (r *Rule) compile() error {
+	if r.Content == "" {
+		return nil
+	}
+	re, err := regexp.Compile(r.Content)
+	if err != nil {
+		return err
+	}
+	r.re = re
+	return nil
+}
+
+func (r *Rule) match(msg *Message) bool {
+	if r.ServiceId != "" && r.ServiceId != msg.ServiceId {
+		return false
+	}
+	if r.SrcId != "" && !strings.HasPrefix(msg.SrcId, r.SrcId) {
+		return false
+	}
+	if r.re != nil && !r.re.MatchString(msg.Content) {
+		return false
+	}
+	if r.DestPrefix == "" && r.DestSuffix == "" {
+		return true
+	}
+	for _, dest := range msg.Dest {
+		if strings.HasPrefix(dest, r.DestPrefix) && strings.HasSuffix(dest, r.DestSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Engine 按配置顺序匹配场景规则，第一条匹配的规则生效
+type Engine struct {
+	lock  sync.RWMutex
+	rules []*Rule
+}
+
+// Load 从配置的scenarios列表加载场景规则
+func Load(conf yml_config.YmlConfig) (*Engine, error) {
+	e := &Engine{}
+	if err := e.Reload(conf); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload 重新加载场景规则，加载失败时保留原有规则
+func (e *Engine) Reload(conf yml_config.YmlConfig) error {
+	var rules []*Rule
+	if err := conf.UnmarshalKey("scenarios", &rules); err != nil {
+		return err
+	}
+	for i, r := range rules {
+		if r == nil {
+			return fmt.Errorf("scenarios[%d]: empty rule", i)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("scenarios[%d]", i)
+		}
+		if err := r.compile(); err != nil {
+			return fmt.Errorf("%s: %v", r.Name, err)
+		}
+	}
+
+	e.lock.Lock()
+	e.rules = rules
+	e.lock.Unlock()
+	log.Infof("[%-9s] %d scenario rules loaded", "Scenario", len(rules))
+	return nil
+}
+
+// Match 返回第一条匹配的规则，没有匹配的规则时返回nil
+func (e *Engine) Match(msg *Message) *Rule {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for _, r := range e.rules {
+		if r.match(msg) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package scenario
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine_Match(t *testing.T) {
+	result := uint32(13)
+	e := &Engine{rules: []*Rule{
+		{Name: "undeliv", DestSuffix: "0001", Stat: "UNDELIV"},
+		{Name: "reject", DestPrefix: "139", ServiceId: "svc", Result: &result},
+		{Name: "content", SrcId: "95566", Content: "^验证码"},
+	}}
+	for _, r := range e.rules {
+		assert.Nil(t, r.compile())
+	}
+
+	match := func(msg *Message) string {
+		if r := e.Match(msg); r != nil {
+			return r.Name
+		}
+		return ""
+	}
+	assert.Equal(t, "undeliv", match(&Message{Dest: []string{"13800000002", "13800000001"}}))
+	assert.Equal(t, "undeliv", match(&Message{Dest: []string{"13900000001"}, ServiceId: "svc"}))
+	assert.Equal(t, "reject", match(&Message{Dest: []string{"13900000002"}, ServiceId: "svc"}))
+	assert.Equal(t, "", match(&Message{Dest: []string{"13900000002"}, ServiceId: "other"}))
+	assert.Equal(t, "content", match(&Message{Dest: []string{"13800000002"}, SrcId: "9556601", Content: "验证码1234"}))
+	assert.Equal(t, "", match(&Message{Dest: []string{"13800000002"}, SrcId: "9556601", Content: "您的验证码1234"}))
+	assert.Equal(t, "", match(&Message{Dest: []string{"13800000002"}, SrcId: "10086", Content: "验证码1234"}))
+
+	assert.NotNil(t, (&Rule{Content: "("}).compile())
+}
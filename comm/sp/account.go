@@ -0,0 +1,256 @@
+package sp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+var log = logging.GetDefaultLogger()
+
+var (
+	ErrRateLimit  = errors.New("submit rate limit exceeded")
+	ErrDailyLimit = errors.New("daily submit limit exceeded")
+)
+
+// Account SP登录账号
+type Account struct {
+	Id            string   `mapstructure:"id"`              // 登录账号，CMPP为Source_Addr，SMGP为ClientID
+	Secret        string   `mapstructure:"secret"`          // 登录密码，即shared secret
+	AllowedIps    []string `mapstructure:"allowed-ips"`     // 允许接入的IP或网段(CIDR)，为空时不限制
+	MaxConns      int      `mapstructure:"max-conns"`       // 最大连接数，0表示不限制(仍受全局max-cons限制)
+	ServiceIds    []string `mapstructure:"service-ids"`     // 允许使用的业务代码，为空时不限制
+	SrcIdPrefixes []string `mapstructure:"src-id-prefixes"` // 允许使用的源号码前缀，为空时不限制
+	Version       int      `mapstructure:"version"`         // 协议版本，0表示使用默认值，含义见各协议的配置文件
+	RateLimit     int      `mapstructure:"rate-limit"`      // 每秒最多提交的MT数，0表示不限制
+	DailyLimit    int      `mapstructure:"daily-limit"`     // 每天最多提交的MT数，0表示不限制
+	nets          []*net.IPNet
+}
+
+// parseIps 解析allowed-ips，单个IP按/32(IPv6为/128)处理
+func (a *Account) parseIps() error {
+	a.nets = a.nets[:0]
+	for _, s := range a.AllowedIps {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return fmt.Errorf("invalid ip %s", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			a.nets = append(a.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return err
+		}
+		a.nets = append(a.nets, ipNet)
+	}
+	return nil
+}
+
+// AllowIp 是否允许从该IP接入
+func (a *Account) AllowIp(ip net.IP) bool {
+	if len(a.AllowedIps) == 0 {
+		return true
+	}
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowServiceId 是否允许使用该业务代码
+func (a *Account) AllowServiceId(serviceId string) bool {
+	if len(a.ServiceIds) == 0 {
+		return true
+	}
+	for _, s := range a.ServiceIds {
+		if s == serviceId {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowSrcId 是否允许使用该源号码
+func (a *Account) AllowSrcId(srcId string) bool {
+	if len(a.SrcIdPrefixes) == 0 {
+		return true
+	}
+	for _, p := range a.SrcIdPrefixes {
+		if strings.HasPrefix(srcId, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry SP账号注册表
+type Registry struct {
+	lock     sync.RWMutex
+	accounts map[string]*Account
+	buckets  map[string]*bucket // account -> 流量控制状态，重新加载账号时保留
+	denied   map[string]uint64  // account -> 因IP不在白名单中被拒绝的登录次数
+}
+
+// bucket 按令牌桶控制每秒提交数，并记录当天的提交数(进程重启后重新计数)
+type bucket struct {
+	tokens float64
+	last   time.Time
+	day    string
+	count  int
+}
+
+// Load 从配置的accounts列表加载SP账号
+// 兼容原有的单账号配置：idKey(如source-addr、client-id)与shared-secret配置的账号未在列表中时一并加入
+func Load(conf yml_config.YmlConfig, idKey string) (*Registry, error) {
+	r := &Registry{buckets: make(map[string]*bucket), denied: make(map[string]uint64)}
+	if err := r.Reload(conf, idKey); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新加载SP账号，加载失败时保留原有账号
+func (r *Registry) Reload(conf yml_config.YmlConfig, idKey string) error {
+	var list []*Account
+	if err := conf.UnmarshalKey("accounts", &list); err != nil {
+		return err
+	}
+	accounts := make(map[string]*Account, len(list)+1)
+	for i, a := range list {
+		if a == nil || a.Id == "" {
+			return fmt.Errorf("accounts[%d]: id is empty", i)
+		}
+		if _, ok := accounts[a.Id]; ok {
+			return fmt.Errorf("accounts[%d]: duplicate id %s", i, a.Id)
+		}
+		if err := a.parseIps(); err != nil {
+			return fmt.Errorf("accounts[%d]: %v", i, err)
+		}
+		accounts[a.Id] = a
+	}
+	if legacy := Default(conf, idKey); legacy.Id != "" {
+		if _, ok := accounts[legacy.Id]; !ok {
+			accounts[legacy.Id] = legacy
+		}
+	}
+
+	r.lock.Lock()
+	r.accounts = accounts
+	for id := range r.buckets {
+		if _, ok := accounts[id]; !ok {
+			delete(r.buckets, id)
+		}
+	}
+	r.lock.Unlock()
+	log.Infof("[%-9s] %d accounts loaded", "Account", len(accounts))
+	return nil
+}
+
+// Default 原有单账号配置对应的账号
+func Default(conf yml_config.YmlConfig, idKey string) *Account {
+	return &Account{Id: conf.GetString(idKey), Secret: conf.GetString("shared-secret")}
+}
+
+// Get 按登录账号查询
+func (r *Registry) Get(id string) (*Account, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	a, ok := r.accounts[id]
+	return a, ok
+}
+
+// Len 账号数量
+func (r *Registry) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.accounts)
+}
+
+// Take 账号提交一条MT，超过每秒或每天的提交数限制时返回ErrRateLimit或ErrDailyLimit
+func (r *Registry) Take(id string) error {
+	return r.take(id, time.Now())
+}
+
+func (r *Registry) take(id string, now time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	a, ok := r.accounts[id]
+	if !ok || (a.RateLimit <= 0 && a.DailyLimit <= 0) {
+		return nil
+	}
+	b, ok := r.buckets[id]
+	if !ok {
+		b = &bucket{tokens: float64(a.RateLimit), last: now}
+		r.buckets[id] = b
+	}
+
+	day := now.Format("20060102")
+	if b.day != day {
+		b.day, b.count = day, 0
+	}
+	if a.DailyLimit > 0 && b.count >= a.DailyLimit {
+		return ErrDailyLimit
+	}
+	if a.RateLimit > 0 {
+		// 按时间补充令牌，桶容量为每秒提交数
+		b.tokens += now.Sub(b.last).Seconds() * float64(a.RateLimit)
+		if b.tokens > float64(a.RateLimit) {
+			b.tokens = float64(a.RateLimit)
+		}
+		b.last = now
+		if b.tokens < 1 {
+			return ErrRateLimit
+		}
+		b.tokens--
+	}
+	b.count++
+	return nil
+}
+
+// AllowAddr 账号是否允许从该地址接入，拒绝时计数；未知账号由登录认证处理，此处不做限制
+func (r *Registry) AllowAddr(id string, addr net.Addr) bool {
+	var ip net.IP
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		ip = v.IP
+	default:
+		if addr != nil {
+			host, _, _ := net.SplitHostPort(addr.String())
+			ip = net.ParseIP(host)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	a, ok := r.accounts[id]
+	if !ok || a.AllowIp(ip) {
+		return true
+	}
+	r.denied[id]++
+	return false
+}
+
+// Denied 各账号因IP不在白名单中被拒绝的登录次数
+func (r *Registry) Denied() map[string]uint64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	denied := make(map[string]uint64, len(r.denied))
+	for id, n := range r.denied {
+		denied[id] = n
+	}
+	return denied
+}
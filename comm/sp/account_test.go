@@ -0,0 +1,93 @@
+package sp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaronwong1989/gosms/comm/yml_config"
+)
+
+func TestLoad(t *testing.T) {
+	conf := yml_config.CreateYamlFactory("cmpp.yaml")
+	r, err := Load(conf, "source-addr")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, r.Len())
+
+	// 原有单账号配置
+	a, ok := r.Get(conf.GetString("source-addr"))
+	assert.True(t, ok)
+	assert.Equal(t, conf.GetString("shared-secret"), a.Secret)
+	assert.True(t, a.AllowServiceId("anything"))
+	assert.True(t, a.AllowSrcId("10086"))
+
+	a, ok = r.Get("654321")
+	assert.True(t, ok)
+	assert.Equal(t, "another secret", a.Secret)
+	assert.Equal(t, 2, a.MaxConns)
+	assert.Equal(t, 0, a.Version)
+
+	_, ok = r.Get("000000")
+	assert.False(t, ok)
+}
+
+func TestAccount_Allow(t *testing.T) {
+	a := &Account{Id: "1", ServiceIds: []string{"svc1", "svc2"}, SrcIdPrefixes: []string{"95566", "10690"}}
+	assert.True(t, a.AllowServiceId("svc2"))
+	assert.False(t, a.AllowServiceId("svc"))
+	assert.True(t, a.AllowSrcId("9556601"))
+	assert.True(t, a.AllowSrcId("10690"))
+	assert.False(t, a.AllowSrcId("9556"))
+}
+
+func TestRegistry_Take(t *testing.T) {
+	r := &Registry{buckets: make(map[string]*bucket), denied: make(map[string]uint64)}
+	r.accounts = map[string]*Account{
+		"1": {Id: "1", RateLimit: 2, DailyLimit: 5},
+		"2": {Id: "2"},
+	}
+	now := time.Date(2022, 7, 1, 23, 59, 58, 0, time.Local)
+	assert.Nil(t, r.take("1", now))
+	assert.Nil(t, r.take("1", now))
+	assert.Equal(t, ErrRateLimit, r.take("1", now))
+	// 半秒补充1个令牌
+	now = now.Add(500 * time.Millisecond)
+	assert.Nil(t, r.take("1", now))
+	assert.Equal(t, ErrRateLimit, r.take("1", now))
+	now = now.Add(time.Second)
+	assert.Nil(t, r.take("1", now))
+	assert.Nil(t, r.take("1", now))
+	assert.Equal(t, ErrDailyLimit, r.take("1", now.Add(time.Millisecond)))
+	// 第二天重新计数
+	now = now.Add(time.Second)
+	assert.Nil(t, r.take("1", now))
+
+	// 未配置限制的账号与未知账号
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, r.take("2", now))
+		assert.Nil(t, r.take("3", now))
+	}
+}
+
+func TestRegistry_AllowAddr(t *testing.T) {
+	r := &Registry{buckets: make(map[string]*bucket), denied: make(map[string]uint64)}
+	a := &Account{Id: "1", AllowedIps: []string{"127.0.0.1", "10.1.0.0/16", "::1"}}
+	assert.Nil(t, a.parseIps())
+	r.accounts = map[string]*Account{"1": a, "2": {Id: "2"}}
+
+	assert.True(t, r.AllowAddr("1", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}))
+	assert.True(t, r.AllowAddr("1", &net.TCPAddr{IP: net.ParseIP("10.1.200.3"), Port: 9000}))
+	assert.True(t, r.AllowAddr("1", &net.TCPAddr{IP: net.ParseIP("::1"), Port: 9000}))
+	assert.False(t, r.AllowAddr("1", &net.TCPAddr{IP: net.ParseIP("10.2.0.1"), Port: 9000}))
+	assert.False(t, r.AllowAddr("1", &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: 9000}))
+	assert.True(t, r.AllowAddr("2", &net.TCPAddr{IP: net.ParseIP("10.2.0.1"), Port: 9000}))
+	assert.True(t, r.AllowAddr("3", &net.TCPAddr{IP: net.ParseIP("10.2.0.1"), Port: 9000}))
+	assert.Equal(t, map[string]uint64{"1": 2}, r.Denied())
+
+	a = &Account{Id: "4", AllowedIps: []string{"10.1.0.0/33"}}
+	assert.NotNil(t, a.parseIps())
+	a = &Account{Id: "4", AllowedIps: []string{"localhost"}}
+	assert.NotNil(t, a.parseIps())
+}
@@ -0,0 +1,456 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aaronwong1989/gosms/comm/logging"
+)
+
+var log = logging.GetDefaultLogger()
+
+// Record 模拟网关收到的一条MT及其处理结果
+type Record struct {
+	MsgId    string    `json:"msgId"`              // 网关生成的MsgId
+	Account  string    `json:"account"`            // 提交MT的SP登录账号
+	Version  uint8     `json:"version,omitempty"`  // 提交MT的连接协商的协议版本，0表示未记录
+	Submit   []byte    `json:"submit"`             // Submit报文，含消息头
+	Result   uint32    `json:"result"`             // SubmitResp中的结果
+	SubmitAt time.Time `json:"submitAt"`           // 收到MT的时间
+	ReportId string    `json:"reportId,omitempty"` // 状态报告Deliver的MsgId，用于匹配SP的DeliverResp
+	Report   []byte    `json:"report,omitempty"`   // 状态报告Deliver报文，含消息头
+	ReportAt time.Time `json:"reportAt,omitempty"` // 产生状态报告的时间
+	Acked    bool      `json:"acked,omitempty"`    // SP是否已应答状态报告
+	Dropped  bool      `json:"dropped,omitempty"`  // 不会再产生状态报告，如模拟报告丢失或短信已被删除
+}
+
+// Pending 提交成功但尚未产生状态报告
+func (r *Record) Pending() bool {
+	return r.Result == 0 && r.Report == nil && !r.Dropped
+}
+
+// Finished 处理已结束：提交失败、状态报告已被应答或不会再产生状态报告
+func (r *Record) Finished() bool {
+	return r.Result != 0 || r.Acked || r.Dropped
+}
+
+// Unacked 已产生状态报告但SP尚未应答
+func (r *Record) Unacked() bool {
+	return r.Report != nil && !r.Acked
+}
+
+// Store 消息存储，记录MT、SubmitResp结果及状态报告
+type Store interface {
+	// SaveSubmit 保存收到的MT及其应答结果
+	SaveSubmit(rec *Record) error
+	// SaveReport 保存MT对应的状态报告
+	SaveReport(msgId string, reportId string, report []byte) error
+	// Ack SP已应答状态报告，reportId为状态报告Deliver的MsgId
+	Ack(reportId string) error
+	// Drop MT不会再产生状态报告
+	Drop(msgId string) error
+	// Get 按MsgId查询，返回记录的副本
+	Get(msgId string) (*Record, bool)
+	// Range 遍历所有记录的副本，f返回false时停止
+	Range(f func(rec *Record) bool)
+	// RangeUnfinished 遍历账号处理未结束的记录的副本，f返回false时停止
+	RangeUnfinished(account string, f func(rec *Record) bool)
+	Close() error
+}
+
+// 定期清理的最大间隔，保留时长更短时按保留时长清理
+const sweepInterval = time.Minute
+
+type memStore struct {
+	lock       sync.RWMutex
+	records    map[string]*Record
+	reports    map[string]string              // reportId -> msgId
+	unfinished map[string]map[string]struct{} // account -> 处理未结束的MsgId，SP登录时补发无需遍历全部记录
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewMemoryStore 仅保存在内存中的存储，进程重启后丢失
+// retention大于0时，定期丢弃早于该时长且处理已结束的记录
+func NewMemoryStore(retention time.Duration) Store {
+	m := newMemStore()
+	m.startSweeper(retention, func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		m.purge(retention)
+	})
+	return m
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		records:    make(map[string]*Record),
+		reports:    make(map[string]string),
+		unfinished: make(map[string]map[string]struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// put 保存记录并更新索引，调用方需持有锁
+func (m *memStore) put(rec *Record) {
+	m.records[rec.MsgId] = rec
+	if rec.ReportId != "" {
+		m.reports[rec.ReportId] = rec.MsgId
+	}
+	ids := m.unfinished[rec.Account]
+	if rec.Finished() {
+		delete(ids, rec.MsgId)
+		if len(ids) == 0 {
+			delete(m.unfinished, rec.Account)
+		}
+	} else {
+		if ids == nil {
+			ids = make(map[string]struct{})
+			m.unfinished[rec.Account] = ids
+		}
+		ids[rec.MsgId] = struct{}{}
+	}
+}
+
+// purge 丢弃早于保留时长且处理已结束的记录，返回丢弃的数量，调用方需持有锁
+func (m *memStore) purge(retention time.Duration) int {
+	if retention <= 0 {
+		return 0
+	}
+	n := 0
+	for msgId, rec := range m.records {
+		if rec.Finished() && time.Since(rec.SubmitAt) > retention {
+			delete(m.records, msgId)
+			delete(m.reports, rec.ReportId)
+			n++
+		}
+	}
+	return n
+}
+
+// startSweeper retention大于0时开启定期清理，Close时停止
+func (m *memStore) startSweeper(retention time.Duration, sweep func()) {
+	if retention <= 0 {
+		return
+	}
+	interval := sweepInterval
+	if retention < interval {
+		interval = retention
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				sweep()
+			}
+		}
+	}()
+}
+
+func (m *memStore) SaveSubmit(rec *Record) error {
+	m.saveSubmit(rec)
+	return nil
+}
+
+func (m *memStore) SaveReport(msgId string, reportId string, report []byte) error {
+	m.saveReport(msgId, reportId, report)
+	return nil
+}
+
+func (m *memStore) Ack(reportId string) error {
+	m.ack(reportId)
+	return nil
+}
+
+func (m *memStore) Drop(msgId string) error {
+	m.drop(msgId)
+	return nil
+}
+
+// 以下方法返回修改后的记录，未修改时返回nil
+
+func (m *memStore) saveSubmit(rec *Record) *Record {
+	cp := *rec
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if old, ok := m.records[cp.MsgId]; ok && old.Account != cp.Account {
+		// 同一MsgId改由其他账号提交，移出原账号的索引
+		delete(m.unfinished[old.Account], cp.MsgId)
+	}
+	m.put(&cp)
+	return &cp
+}
+
+func (m *memStore) saveReport(msgId string, reportId string, report []byte) *Record {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rec, ok := m.records[msgId]
+	if !ok {
+		return nil
+	}
+	cp := *rec
+	cp.ReportId, cp.Report, cp.ReportAt, cp.Acked = reportId, report, time.Now(), false
+	m.put(&cp)
+	return &cp
+}
+
+func (m *memStore) ack(reportId string) *Record {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rec, ok := m.records[m.reports[reportId]]
+	if !ok || rec.Acked {
+		return nil
+	}
+	cp := *rec
+	cp.Acked = true
+	m.put(&cp)
+	return &cp
+}
+
+func (m *memStore) drop(msgId string) *Record {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rec, ok := m.records[msgId]
+	if !ok || rec.Dropped {
+		return nil
+	}
+	cp := *rec
+	cp.Dropped = true
+	m.put(&cp)
+	return &cp
+}
+
+func (m *memStore) Get(msgId string) (*Record, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	rec, ok := m.records[msgId]
+	if !ok {
+		return nil, false
+	}
+	cp := *rec
+	return &cp, true
+}
+
+func (m *memStore) Range(f func(rec *Record) bool) {
+	m.lock.RLock()
+	list := make([]Record, 0, len(m.records))
+	for _, rec := range m.records {
+		list = append(list, *rec)
+	}
+	m.lock.RUnlock()
+	for i := range list {
+		if !f(&list[i]) {
+			return
+		}
+	}
+}
+
+func (m *memStore) RangeUnfinished(account string, f func(rec *Record) bool) {
+	m.lock.RLock()
+	ids := m.unfinished[account]
+	list := make([]Record, 0, len(ids))
+	for msgId := range ids {
+		list = append(list, *m.records[msgId])
+	}
+	m.lock.RUnlock()
+	for i := range list {
+		if !f(&list[i]) {
+			return
+		}
+	}
+}
+
+func (m *memStore) Close() error {
+	m.stop()
+	return nil
+}
+
+// stop 停止定期清理
+func (m *memStore) stop() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+// 日志文件的行数超过记录数的2倍加上该值时，运行中压缩日志文件
+const compactSlack = 1024
+
+// fileStore 基于追加写日志文件的存储，每次变更追加一行记录的完整JSON，加载时以最后一行为准
+type fileStore struct {
+	*memStore
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	lines  int // 日志文件的行数
+	wLock  sync.Mutex
+}
+
+// Open 打开(或创建)基于文件的存储，打开时加载已有记录并压缩日志文件
+// retention大于0时，打开时及运行中定期丢弃早于该时长且处理已结束的记录，日志文件随之压缩
+func Open(path string, retention time.Duration) (Store, error) {
+	fs := &fileStore{memStore: newMemStore(), path: path}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	fs.purge(retention)
+	if err := fs.compact(); err != nil {
+		return nil, err
+	}
+	if err := fs.openLog(); err != nil {
+		return nil, err
+	}
+	fs.startSweeper(retention, func() {
+		fs.sweep(retention)
+	})
+	log.Infof("[%-9s] message store %s opened, %d records loaded", "Store", path, len(fs.records))
+	return fs, nil
+}
+
+func (fs *fileStore) openLog() error {
+	file, err := os.OpenFile(fs.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fs.file = file
+	fs.writer = bufio.NewWriter(file)
+	return nil
+}
+
+// sweep 丢弃超过保留时长的记录，日志文件中的冗余行过多时压缩日志文件
+func (fs *fileStore) sweep(retention time.Duration) {
+	fs.wLock.Lock()
+	defer fs.wLock.Unlock()
+	fs.lock.Lock()
+	n := fs.purge(retention)
+	fs.lock.Unlock()
+	if n == 0 && fs.lines <= 2*len(fs.records)+compactSlack {
+		return
+	}
+	_ = fs.writer.Flush()
+	_ = fs.file.Close()
+	if err := fs.compact(); err != nil {
+		log.Errorf("[%-9s] compact message store %s error: %v", "Store", fs.path, err)
+	}
+	if err := fs.openLog(); err != nil {
+		log.Errorf("[%-9s] reopen message store %s error: %v", "Store", fs.path, err)
+	}
+	log.Debugf("[%-9s] message store %s swept, %d records purged, %d records kept", "Store", fs.path, n, fs.lines)
+}
+
+func (fs *fileStore) load() error {
+	file, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		rec := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			// 进程异常退出时最后一行可能不完整，忽略
+			log.Warnf("[%-9s] skip broken record in %s: %v", "Store", fs.path, err)
+			continue
+		}
+		fs.put(rec)
+	}
+	return scanner.Err()
+}
+
+// compact 重写日志文件，每条记录仅保留一行，运行中调用时需持有wLock
+func (fs *fileStore) compact() error {
+	if dir := filepath.Dir(fs.path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	tmp := fs.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	fs.lock.RLock()
+	lines := len(fs.records)
+	for _, rec := range fs.records {
+		if err = encoder.Encode(rec); err != nil {
+			break
+		}
+	}
+	fs.lock.RUnlock()
+	if err == nil {
+		err = writer.Flush()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, fs.path); err == nil {
+		fs.lines = lines
+	}
+	return err
+}
+
+// append 追加记录到日志文件，调用方需持有wLock，保证日志顺序与修改顺序一致
+func (fs *fileStore) append(rec *Record) error {
+	if rec == nil {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, _ = fs.writer.Write(data)
+	_ = fs.writer.WriteByte('\n')
+	fs.lines++
+	return fs.writer.Flush()
+}
+
+func (fs *fileStore) SaveSubmit(rec *Record) error {
+	fs.wLock.Lock()
+	defer fs.wLock.Unlock()
+	return fs.append(fs.saveSubmit(rec))
+}
+
+func (fs *fileStore) SaveReport(msgId string, reportId string, report []byte) error {
+	fs.wLock.Lock()
+	defer fs.wLock.Unlock()
+	return fs.append(fs.saveReport(msgId, reportId, report))
+}
+
+func (fs *fileStore) Ack(reportId string) error {
+	fs.wLock.Lock()
+	defer fs.wLock.Unlock()
+	return fs.append(fs.ack(reportId))
+}
+
+func (fs *fileStore) Drop(msgId string) error {
+	fs.wLock.Lock()
+	defer fs.wLock.Unlock()
+	return fs.append(fs.drop(msgId))
+}
+
+func (fs *fileStore) Close() error {
+	fs.stop()
+	fs.wLock.Lock()
+	defer fs.wLock.Unlock()
+	_ = fs.writer.Flush()
+	return fs.file.Close()
+}
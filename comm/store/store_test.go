@@ -0,0 +1,164 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(0))
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "test.store")
+	st, err := Open(path, time.Hour)
+	assert.Nil(t, err)
+	testStore(t, st)
+	assert.Nil(t, st.Close())
+
+	// 重新打开后恢复最后的状态
+	st, err = Open(path, time.Hour)
+	assert.Nil(t, err)
+	rec, ok := st.Get("1")
+	assert.True(t, ok)
+	assert.True(t, rec.Acked)
+	assert.Equal(t, []byte{0x01, 0x02}, rec.Submit)
+	rec, _ = st.Get("2")
+	assert.True(t, rec.Unacked())
+	rec, _ = st.Get("3")
+	assert.True(t, rec.Pending())
+	// 压缩后每条记录一行
+	assert.Equal(t, 5, lines(t, path))
+	rec, _ = st.Get("8")
+	assert.True(t, rec.Finished())
+	assert.False(t, rec.Pending())
+
+	// 追加不完整的行，模拟进程异常退出
+	_ = st.SaveSubmit(&Record{MsgId: "5", SubmitAt: time.Now().Add(-2 * time.Hour)})
+	_ = st.SaveSubmit(&Record{MsgId: "6", Result: 13, SubmitAt: time.Now().Add(-2 * time.Hour)})
+	assert.Nil(t, st.Close())
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = f.WriteString(`{"msgId":"7","acc`)
+	_ = f.Close()
+
+	st, err = Open(path, time.Hour)
+	assert.Nil(t, err)
+	_, ok = st.Get("5")
+	assert.True(t, ok)
+	// 超过保留时长且已结束的记录被丢弃
+	_, ok = st.Get("6")
+	assert.False(t, ok)
+	_, ok = st.Get("7")
+	assert.False(t, ok)
+	assert.Nil(t, st.Close())
+}
+
+func testStore(t *testing.T, st Store) {
+	for i, id := range []string{"1", "2", "3"} {
+		err := st.SaveSubmit(&Record{MsgId: id, Account: "sp", Submit: []byte{0x01, byte(i + 2)}, SubmitAt: time.Now()})
+		assert.Nil(t, err)
+	}
+	_ = st.SaveSubmit(&Record{MsgId: "4", Account: "sp", Result: 13, SubmitAt: time.Now()})
+	_ = st.SaveSubmit(&Record{MsgId: "1", Account: "sp", Submit: []byte{0x01, 0x02}, SubmitAt: time.Now()})
+
+	assert.Nil(t, st.SaveReport("1", "r1", []byte{0x03}))
+	assert.Nil(t, st.SaveReport("2", "r2", []byte{0x04}))
+	assert.Nil(t, st.SaveReport("x", "rx", []byte{0x05}))
+	assert.Nil(t, st.Ack("r1"))
+	assert.Nil(t, st.Ack("ry"))
+	assert.Nil(t, st.SaveSubmit(&Record{MsgId: "8", SubmitAt: time.Now()}))
+	assert.Nil(t, st.Drop("8"))
+	assert.Nil(t, st.Drop("y"))
+
+	rec, ok := st.Get("1")
+	assert.True(t, ok)
+	assert.True(t, rec.Acked)
+	assert.False(t, rec.Unacked())
+	// 返回的是副本
+	rec.Acked = false
+	rec, _ = st.Get("1")
+	assert.True(t, rec.Acked)
+
+	pending, unacked, total := 0, 0, 0
+	st.Range(func(rec *Record) bool {
+		total++
+		if rec.Pending() {
+			pending++
+		}
+		if rec.Unacked() {
+			unacked++
+		}
+		return true
+	})
+	assert.Equal(t, 5, total)
+	assert.Equal(t, 1, pending)
+	assert.Equal(t, 1, unacked)
+	_, ok = st.Get("x")
+	assert.False(t, ok)
+
+	// 账号处理未结束的记录：未应答的状态报告及尚未产生状态报告的MT
+	var unfinished []string
+	st.RangeUnfinished("sp", func(rec *Record) bool {
+		unfinished = append(unfinished, rec.MsgId)
+		return true
+	})
+	assert.ElementsMatch(t, []string{"2", "3"}, unfinished)
+}
+
+func TestStore_Sweep(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	path := filepath.Join(t.TempDir(), "test.store")
+	st, err := Open(path, time.Hour)
+	assert.Nil(t, err)
+	fs := st.(*fileStore)
+	_ = st.SaveSubmit(&Record{MsgId: "1", Account: "sp", Result: 13, SubmitAt: old})
+	_ = st.SaveSubmit(&Record{MsgId: "2", Account: "sp", SubmitAt: old})
+	_ = st.SaveSubmit(&Record{MsgId: "3", Account: "sp", SubmitAt: time.Now()})
+	_ = st.Drop("3")
+	assert.Equal(t, 4, lines(t, path))
+
+	// 运行中丢弃超过保留时长且已结束的记录，并压缩日志文件
+	fs.sweep(time.Hour)
+	_, ok := st.Get("1")
+	assert.False(t, ok)
+	_, ok = st.Get("2")
+	assert.True(t, ok)
+	assert.Equal(t, 2, lines(t, path))
+
+	// 压缩后继续追加
+	assert.Nil(t, st.SaveReport("2", "r2", []byte{0x01}))
+	assert.Equal(t, 3, lines(t, path))
+	assert.Nil(t, st.Close())
+	st, err = Open(path, time.Hour)
+	assert.Nil(t, err)
+	rec, _ := st.Get("2")
+	assert.True(t, rec.Unacked())
+	assert.Nil(t, st.Close())
+
+	// 仅保存在内存中的存储同样清理
+	m := newMemStore()
+	_ = m.SaveSubmit(&Record{MsgId: "1", Account: "sp", Result: 13, SubmitAt: old})
+	_ = m.SaveSubmit(&Record{MsgId: "2", Account: "sp", SubmitAt: old})
+	assert.Equal(t, 1, m.purge(time.Hour))
+	assert.Equal(t, 0, m.purge(0))
+	_, ok = m.Get("1")
+	assert.False(t, ok)
+	_, ok = m.Get("2")
+	assert.True(t, ok)
+}
+
+func lines(t *testing.T, path string) int {
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	n := 0
+	for _, b := range data {
+		if b == '\n' {
+			n++
+		}
+	}
+	return n
+}
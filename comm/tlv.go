@@ -240,6 +240,15 @@ func (tl *TlvList) AddObject(obj TLV) {
 	tl.objects.PushBack(obj)
 }
 
+// Objects returns the TLV objects in the TLVList, in order.
+func (tl *TlvList) Objects() []TLV {
+	objs := make([]TLV, 0, tl.objects.Len())
+	for e := tl.objects.Front(); e != nil; e = e.Next() {
+		objs = append(objs, e.Value.(TLV))
+	}
+	return objs
+}
+
 // Write writes out the TLVList to an io.Writer.
 func (tl *TlvList) Write(w io.Writer) error {
 	for e := tl.objects.Front(); e != nil; e = e.Next() {
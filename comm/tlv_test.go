@@ -93,6 +93,20 @@ func TestTLVListAdd(t *testing.T) {
 	}
 }
 
+func TestTLVListObjects(t *testing.T) {
+	tlvl := NewTlvList()
+	if len(tlvl.Objects()) != 0 {
+		FailWithError(t, "TestTLVListObjects", fmt.Errorf("list should be empty"))
+	}
+	tlvl.Add(TypeTest2, []byte("baz quux"))
+	tlvl.Add(TypeTest1, []byte("foo bar"))
+
+	tlvs := tlvl.Objects()
+	if len(tlvs) != 2 || tlvs[0].Type() != TypeTest2 || tlvs[1].Type() != TypeTest1 {
+		FailWithError(t, "TestTLVListObjects", errNoMatch)
+	}
+}
+
 func TestTLVListRemove(t *testing.T) {
 	tlvl := NewTlvList()
 	tlvl.Add(TypeTest1, []byte("foo bar"))
@@ -2,6 +2,7 @@ package comm
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -42,44 +43,103 @@ func CopyByte(dest []byte, src byte, index int) int {
 	return index
 }
 
-func FormatTime(time time.Time) string {
-	s := time.Format("060102150405")
-	return s + "032+"
+// FormatTime 格式化为SMPP3.3协议的绝对时间 YYMMDDhhmmsstnnp，nn为时区与UTC相差的刻钟数
+func FormatTime(t time.Time) string {
+	_, offset := t.Zone()
+	p := '+'
+	if offset < 0 {
+		p, offset = '-', -offset
+	}
+	return fmt.Sprintf("%s0%02d%c", t.Format("060102150405"), offset/900, p)
+}
+
+// ParseTime 解析SMPP3.3协议格式的时间 YYMMDDhhmmsstnnp
+// p为'+'或'-'时为绝对时间，nn为与UTC相差的刻钟数；p为'R'时为相对now的时间；
+// 仅有YYMMDDhhmmss时按本地时间处理。空串或格式错误时返回false
+func ParseTime(s string, now time.Time) (time.Time, bool) {
+	if len(s) != 12 && len(s) != 16 {
+		return time.Time{}, false
+	}
+	var v [6]int
+	for i := range v {
+		n, err := strconv.Atoi(s[i*2 : i*2+2])
+		if err != nil {
+			return time.Time{}, false
+		}
+		v[i] = n
+	}
+	if len(s) == 12 {
+		return toTime(v, time.Local)
+	}
+
+	switch s[15] {
+	case 'R':
+		t := now.AddDate(v[0], v[1], v[2])
+		return t.Add(time.Duration(v[3])*time.Hour + time.Duration(v[4])*time.Minute + time.Duration(v[5])*time.Second), true
+	case '+', '-':
+		nn, err := strconv.Atoi(s[13:15])
+		if err != nil {
+			return time.Time{}, false
+		}
+		offset := nn * 15 * 60
+		if s[15] == '-' {
+			offset = -offset
+		}
+		return toTime(v, time.FixedZone("", offset))
+	default:
+		return time.Time{}, false
+	}
+}
+
+func toTime(v [6]int, loc *time.Location) (time.Time, bool) {
+	if v[1] < 1 || v[1] > 12 || v[2] < 1 || v[2] > 31 || v[3] > 23 || v[4] > 59 || v[5] > 59 {
+		return time.Time{}, false
+	}
+	return time.Date(2000+v[0], time.Month(v[1]), v[2], v[3], v[4], v[5], 0, loc), true
+}
+
+// DeliverDelay 根据定时发送时间和有效期计算距离产生状态报告的时长
+// 定时发送时间未到则等待至定时时间；若有效期先于下发时间到达，则等待至有效期截止并返回expired为true
+func DeliverDelay(atTime string, validTime string) (delay time.Duration, expired bool) {
+	now := time.Now()
+	deliverAt := now
+	if at, ok := ParseTime(atTime, now); ok && at.After(now) {
+		deliverAt = at
+	}
+	if vt, ok := ParseTime(validTime, now); ok && vt.Before(deliverAt) {
+		delay = vt.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return deliverAt.Sub(now), false
 }
 
 // ToTPUDHISlices 拆分为长短信切片
 // 纯ASCII内容的拆分 pkgLen = 160
 // 含中文内容的拆分   pkgLen = 140
 func ToTPUDHISlices(content []byte, pkgLen int) (rt [][]byte) {
-	if len(content) < pkgLen {
+	if len(content) <= pkgLen {
 		return [][]byte{content}
 	}
 
 	headLen := 6
 	bodyLen := pkgLen - headLen
-	parts := len(content) / bodyLen
-	tailLen := len(content) % bodyLen
-	if tailLen != 0 {
-		parts++
-	}
+	parts := (len(content) + bodyLen - 1) / bodyLen
 	// 分片消息组的标识，用于收集组装消息
 	groupId := byte(time.Now().UnixNano() & 0xff)
-	var part []byte
 	for i := 0; i < parts; i++ {
-		if i != parts-1 {
-			part = make([]byte, pkgLen)
-		} else {
+		end := bodyLen * (i + 1)
+		if end > len(content) {
 			// 最后一片
-			part = make([]byte, 6+tailLen)
+			end = len(content)
 		}
+		part := make([]byte, headLen+end-bodyLen*i)
 		part[0], part[1], part[2] = 0x05, 0x00, 0x03
 		part[3] = groupId
 		part[4], part[5] = byte(parts), byte(i+1)
-		if i != parts-1 {
-			copy(part[6:pkgLen], content[bodyLen*i:bodyLen*(i+1)])
-		} else {
-			copy(part[6:], content[0:tailLen])
-		}
+		copy(part[headLen:], content[bodyLen*i:end])
 		rt = append(rt, part)
 	}
 	return rt
@@ -103,6 +163,37 @@ func TakeBytes(c gnet.Conn, bytes int) []byte {
 	return frame
 }
 
+// MaxFrameLength 报文的最大长度，超过时视为不合法的报文
+const MaxFrameLength = 10240
+
+// FrameReady 缓冲区中是否已有一个完整报文，报文头的前4字节为报文总长度(CMPP、SMGP、SGIP、SMPP相同)
+// 长度不合法(过短或超过 MaxFrameLength)时返回true，由调用方解码报文头时关闭连接，不等待报文体
+func FrameReady(c gnet.Conn) bool {
+	head, err := c.Peek(4)
+	if err != nil || len(head) < 4 {
+		return false
+	}
+	length := int(binary.BigEndian.Uint32(head))
+	return length < 12 || length > MaxFrameLength || c.InboundBuffered() >= length
+}
+
+// PeekFrame 查看缓冲区中的一个完整报文但不消费，不足一个完整报文或长度不合法时返回nil
+func PeekFrame(c gnet.Conn) []byte {
+	head, err := c.Peek(4)
+	if err != nil || len(head) < 4 {
+		return nil
+	}
+	length := int(binary.BigEndian.Uint32(head))
+	if length < 12 {
+		return nil
+	}
+	frame, err := c.Peek(length)
+	if err != nil || len(frame) < length {
+		return nil
+	}
+	return frame
+}
+
 // Ucs2Encode Encode to UCS2.
 func Ucs2Encode(s string) []byte {
 	e := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
@@ -1,8 +1,12 @@
 package comm
 
 import (
+	"encoding/binary"
+	"io"
 	"testing"
+	"time"
 
+	"github.com/panjf2000/gnet/v2"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/unicode"
@@ -29,3 +33,81 @@ func TestUcs2Encode(t *testing.T) {
 func TestDiceCheck(t *testing.T) {
 	assert.True(t, DiceCheck(0.99))
 }
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "220501200000032+", FormatTime(now.In(time.FixedZone("", 8*3600))))
+	assert.Equal(t, "220501070000020-", FormatTime(now.In(time.FixedZone("", -5*3600))))
+	tm, ok := ParseTime(FormatTime(now.In(time.FixedZone("", 8*3600))), now)
+	assert.True(t, ok)
+	assert.True(t, now.Equal(tm))
+
+	tm, ok = ParseTime("220501120000000-", now)
+	assert.True(t, ok)
+	assert.True(t, now.Equal(tm))
+
+	tm, ok = ParseTime("000001023000000R", now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(26*time.Hour+30*time.Minute), tm)
+
+	tm, ok = ParseTime("220501200000", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Local, tm.Location())
+
+	for _, s := range []string{"", "2205011200", "221301120000032+", "220501120000032X", "22050112000a032+"} {
+		_, ok = ParseTime(s, now)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestDeliverDelay(t *testing.T) {
+	delay, expired := DeliverDelay("", "")
+	assert.Equal(t, time.Duration(0), delay)
+	assert.False(t, expired)
+
+	delay, expired = DeliverDelay("000000000010000R", "000000010000000R")
+	assert.True(t, delay > 9*time.Second && delay <= 10*time.Second)
+	assert.False(t, expired)
+
+	delay, expired = DeliverDelay("000000010000000R", "000000000010000R")
+	assert.True(t, delay > 9*time.Second && delay <= 10*time.Second)
+	assert.True(t, expired)
+
+	delay, expired = DeliverDelay("", FormatTime(time.Now().Add(-time.Minute)))
+	assert.Equal(t, time.Duration(0), delay)
+	assert.True(t, expired)
+}
+
+// bufConn 只实现读取缓冲区相关方法的连接
+type bufConn struct {
+	gnet.Conn
+	buf []byte
+}
+
+func (c *bufConn) Peek(n int) ([]byte, error) {
+	if n > len(c.buf) {
+		return c.buf, io.ErrShortBuffer
+	}
+	return c.buf[:n], nil
+}
+
+func (c *bufConn) InboundBuffered() int {
+	return len(c.buf)
+}
+
+func TestFrameReady(t *testing.T) {
+	frame := func(length uint32, buffered int) *bufConn {
+		buf := make([]byte, buffered)
+		binary.BigEndian.PutUint32(buf, length)
+		return &bufConn{buf: buf}
+	}
+	assert.False(t, FrameReady(&bufConn{buf: []byte{0, 0}}))
+	assert.False(t, FrameReady(frame(24, 20)))
+	assert.True(t, FrameReady(frame(24, 24)))
+	assert.True(t, FrameReady(frame(24, 30)))
+	// 长度不合法时不等待报文体，由调用方关闭连接
+	assert.True(t, FrameReady(frame(8, 8)))
+	assert.True(t, FrameReady(frame(MaxFrameLength+1, 12)))
+	assert.True(t, FrameReady(frame(0xFFFFFFFF, 12)))
+}
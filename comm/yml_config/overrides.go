@@ -0,0 +1,196 @@
+package yml_config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Overrides 用命令行参数及环境变量覆盖配置文件中的配置项，便于容器部署。
+// 为配置结构体的每个配置项注册同名的命令行参数，并增加 --config 指定配置文件；
+// 命令行未指定的参数(含 --port 等非配置项的参数)取环境变量 <prefix>_<参数名>，参数名大写且-替换为_。
+// 取值优先级由高到低：命令行参数、环境变量、配置文件、参数的默认值
+type Overrides struct {
+	fs     *flag.FlagSet
+	prefix string               // 环境变量前缀，如 GOSMS_CMPP
+	name   string               // 默认的配置文件名，位于 <BasePath>/config 目录
+	path   string               // --config 指定的配置文件路径
+	keys   map[string]*keyValue // 配置项 -> 命令行参数的值
+	notes  []string             // --help 输出的补充说明
+}
+
+// NewOverrides 为 cfg(使用 mapstructure 标签的配置结构体指针)的各配置项在 fs 中注册命令行参数
+func NewOverrides(fs *flag.FlagSet, prefix string, name string, cfg interface{}) *Overrides {
+	o := &Overrides{fs: fs, prefix: prefix, name: name, keys: make(map[string]*keyValue)}
+	fs.StringVar(&o.path, "config", "", fmt.Sprintf("配置文件路径，默认为 %s/config/%s", BasePath(), name))
+	t := reflect.TypeOf(cfg).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		kv := &keyValue{kind: typeName(t.Field(i).Type)}
+		if kv.kind == "int" || kv.kind == "uint" || kv.kind == "float" {
+			kv.bits = t.Field(i).Type.Bits()
+		}
+		o.keys[key] = kv
+		if kv.kind == "bool" {
+			fs.Var(kv, key, "覆盖配置文件中的同名配置项，类型为 bool")
+		} else {
+			fs.Var(kv, key, "覆盖配置文件中的同名配置项，类型为 `"+kv.kind+"`")
+		}
+	}
+	fs.Usage = o.Usage
+	return o
+}
+
+// EnvName 参数对应的环境变量名
+func (o *Overrides) EnvName(name string) string {
+	return o.prefix + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Parse 解析命令行参数，命令行未指定的参数取对应的环境变量
+func (o *Overrides) Parse(args []string) error {
+	if err := o.fs.Parse(args); err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	o.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var err error
+	o.fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		if v, ok := os.LookupEnv(o.EnvName(f.Name)); ok {
+			if e := o.fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("%s: %v", o.EnvName(f.Name), e)
+			}
+		}
+	})
+	return err
+}
+
+// Load 读取配置文件，并以 Set 覆盖命令行参数或环境变量指定的配置项，配置文件重新加载后仍然有效
+func (o *Overrides) Load() YmlConfig {
+	var conf YmlConfig
+	if o.path == "" {
+		conf = CreateYamlFactory(o.name)
+	} else {
+		conf = CreateYamlFileFactory(o.path)
+	}
+	for key, kv := range o.keys {
+		if kv.set {
+			conf.Set(key, kv.value)
+		}
+	}
+	return conf
+}
+
+// Usage 输出各参数及取值的优先级，作为 --help 的输出
+func (o *Overrides) Usage() {
+	w := o.fs.Output()
+	_, _ = fmt.Fprintf(w, "Usage of %s:\n", o.fs.Name())
+	_, _ = fmt.Fprintf(w, "取值优先级(由高到低)：\n")
+	_, _ = fmt.Fprintf(w, "  1. 命令行参数，如 --success-rate=1\n")
+	_, _ = fmt.Fprintf(w, "  2. 环境变量，参数名大写、-替换为_并加前缀 %s_，如 %s=1、%s=9000\n",
+		o.prefix, o.EnvName("success-rate"), o.EnvName("port"))
+	_, _ = fmt.Fprintf(w, "  3. 配置文件，由 --config 或 %s 指定，默认为 %s/config/%s\n", o.EnvName("config"), BasePath(), o.name)
+	_, _ = fmt.Fprintf(w, "  4. 参数的默认值\n")
+	for _, note := range o.notes {
+		_, _ = fmt.Fprintln(w, note)
+	}
+	o.fs.PrintDefaults()
+}
+
+// AddNote 增加 --help 输出的补充说明，如网关特有的配置修改方式
+func (o *Overrides) AddNote(note string) {
+	o.notes = append(o.notes, note)
+}
+
+// CreateYamlFileFactory 读取指定路径的yaml配置文件，与 CreateYamlFactory 相同，文件变化时自动重新加载
+func CreateYamlFileFactory(path string) YmlConfig {
+	yamlConfig := viper.New()
+	yamlConfig.SetConfigFile(path)
+	yamlConfig.SetConfigType("yaml")
+	if err := yamlConfig.ReadInConfig(); err != nil {
+		log.Fatalf("配置文件 %s 初始化失败：%v", path, err)
+	}
+
+	conf := &ymlLoader{
+		viper:  yamlConfig,
+		mu:     new(sync.Mutex),
+		prefix: newPrefix(),
+	}
+	conf.ConfigFileChangeListen()
+	return conf
+}
+
+// 配置项的命令行参数，记录校验通过的字符串，由配置解析时转换为配置项的类型
+type keyValue struct {
+	kind  string
+	bits  int // 数值类型的位数，用于校验取值范围
+	value string
+	set   bool
+}
+
+func (kv *keyValue) String() string {
+	if kv == nil {
+		return ""
+	}
+	return kv.value
+}
+
+// Set 按配置项的类型校验取值，避免不合法的取值在配置解析时才报错或被忽略
+func (kv *keyValue) Set(s string) error {
+	var err error
+	switch kv.kind {
+	case "bool":
+		_, err = strconv.ParseBool(s)
+	case "int":
+		_, err = strconv.ParseInt(s, 0, kv.bits)
+	case "uint":
+		_, err = strconv.ParseUint(s, 0, kv.bits)
+	case "float":
+		_, err = strconv.ParseFloat(s, kv.bits)
+	case "duration":
+		_, err = time.ParseDuration(s)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q", kv.kind, s)
+	}
+	kv.value = s
+	kv.set = true
+	return nil
+}
+
+// IsBoolFlag 布尔类型的配置项可省略取值，如 --auth-check
+func (kv *keyValue) IsBoolFlag() bool {
+	return kv.kind == "bool"
+}
+
+func typeName(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return "duration"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	default:
+		return t.Kind().String()
+	}
+}
@@ -0,0 +1,78 @@
+package yml_config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfig struct {
+	SharedSecret string        `mapstructure:"shared-secret"`
+	AuthCheck    bool          `mapstructure:"auth-check"`
+	MaxCons      int           `mapstructure:"max-cons"`
+	SuccessRate  float64       `mapstructure:"success-rate"`
+	Duration     time.Duration `mapstructure:"active-test-duration"`
+}
+
+func TestOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	content := "shared-secret: file\nauth-check: false\nmax-cons: 10\nsuccess-rate: 0.5\nactive-test-duration: 60s\n"
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+
+	t.Setenv("GOSMS_TEST_SHARED_SECRET", "env")
+	t.Setenv("GOSMS_TEST_MAX_CONS", "20")
+	t.Setenv("GOSMS_TEST_CONFIG", path)
+	t.Setenv("GOSMS_TEST_PORT", "9001")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	port := fs.Int("port", 9000, "")
+	o := NewOverrides(fs, "GOSMS_TEST", "test.yaml", &testConfig{})
+	// 命令行参数优先于环境变量，环境变量优先于配置文件
+	assert.Nil(t, o.Parse([]string{"--max-cons", "30", "--auth-check"}))
+	assert.Equal(t, 9001, *port)
+
+	conf := o.Load()
+	c := &testConfig{}
+	assert.Nil(t, conf.Unmarshal(c))
+	assert.Equal(t, testConfig{SharedSecret: "env", AuthCheck: true, MaxCons: 30, SuccessRate: 0.5, Duration: time.Minute}, *c)
+	assert.Equal(t, 30, conf.GetInt("max-cons"))
+	assert.True(t, conf.GetBool("auth-check"))
+
+	// 环境变量取值不合法
+	t.Setenv("GOSMS_TEST_PORT", "abc")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Int("port", 9000, "")
+	err := NewOverrides(fs, "GOSMS_TEST", "test.yaml", &testConfig{}).Parse(nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "GOSMS_TEST_PORT")
+	}
+
+	// 配置项的取值按类型校验
+	t.Setenv("GOSMS_TEST_PORT", "9001")
+	for env, value := range map[string]string{
+		"GOSMS_TEST_MAX_CONS":             "abc",
+		"GOSMS_TEST_AUTH_CHECK":           "yes",
+		"GOSMS_TEST_SUCCESS_RATE":         "high",
+		"GOSMS_TEST_ACTIVE_TEST_DURATION": "60",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			err := NewOverrides(fs, "GOSMS_TEST", "test.yaml", &testConfig{}).Parse(nil)
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), env)
+			}
+		})
+	}
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	assert.NotNil(t, NewOverrides(fs, "GOSMS_TEST", "test.yaml", &testConfig{}).Parse([]string{"--max-cons=1.5"}))
+}
@@ -2,8 +2,10 @@ package yml_config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -25,8 +27,16 @@ var containerFactory = container.CreateContainersFactory()
 
 const ConfigKeyPrefix = "_config_key_prefix_"
 
+// 每个配置实例的缓存键使用不同的前缀，避免同一进程中多个配置(如cmpp.yaml与smgp.yaml)的同名配置项互相覆盖
+var loaderSeq int64
+
+func newPrefix() string {
+	return ConfigKeyPrefix + strconv.FormatInt(atomic.AddInt64(&loaderSeq, 1), 10) + "_"
+}
+
 type YmlConfig interface {
 	ConfigFileChangeListen()
+	OnChange(f func())
 	Clone(fileName string) YmlConfig
 	Get(keyName string) interface{}
 	GetString(keyName string) string
@@ -37,6 +47,10 @@ type YmlConfig interface {
 	GetFloat64(keyName string) float64
 	GetDuration(keyName string) time.Duration
 	GetStringSlice(keyName string) []string
+	UnmarshalKey(keyName string, rawVal interface{}) error
+	Unmarshal(rawVal interface{}) error
+	Set(keyName string, value interface{})
+	Revision() uint64
 }
 
 func init() {
@@ -64,36 +78,68 @@ func CreateYamlFactory(fileName ...string) YmlConfig {
 	}
 
 	conf := &ymlLoader{
-		viper: yamlConfig,
-		mu:    new(sync.Mutex),
+		viper:  yamlConfig,
+		mu:     new(sync.Mutex),
+		prefix: newPrefix(),
 	}
 	conf.ConfigFileChangeListen()
 
 	return conf
 }
 
+// CreateMemoryFactory 创建不读取配置文件的配置，仅包含给定的配置项，用于无需配置文件的命令行工具
+func CreateMemoryFactory(values map[string]interface{}) YmlConfig {
+	v := viper.New()
+	for key, value := range values {
+		v.Set(key, value)
+	}
+	return &ymlLoader{
+		viper:  v,
+		mu:     new(sync.Mutex),
+		prefix: newPrefix(),
+	}
+}
+
 type ymlLoader struct {
-	viper *viper.Viper
-	mu    *sync.Mutex
+	revision  uint64 // 配置的修订号，放在首位保证64位原子操作的对齐
+	viper     *viper.Viper
+	mu        *sync.Mutex
+	listeners []func() // 配置文件变化后的回调
+	prefix    string   // 缓存键的前缀
 }
 
 // ConfigFileChangeListen 监听文件变化
 func (y *ymlLoader) ConfigFileChangeListen() {
 	y.viper.OnConfigChange(func(changeEvent fsnotify.Event) {
 		if time.Now().Sub(lastChangeTime).Seconds() >= 1 {
-			if changeEvent.Op.String() == "WRITE" {
+			// 部分编辑器以新文件替换的方式保存，此时为CREATE事件
+			if changeEvent.Op&(fsnotify.Write|fsnotify.Create) != 0 {
 				y.clearCache()
+				atomic.AddUint64(&y.revision, 1)
 				lastChangeTime = time.Now()
 				log.Infof("[%-9s] config file changed, reload!", "Config")
+				y.mu.Lock()
+				listeners := y.listeners
+				y.mu.Unlock()
+				for _, f := range listeners {
+					f()
+				}
 			}
 		}
 	})
 	y.viper.WatchConfig()
 }
 
+// OnChange 注册配置文件变化后的回调，用于需要重新加载的配置，如SP账号
+func (y *ymlLoader) OnChange(f func()) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.listeners = append(y.listeners, f)
+}
+
 // keyIsCache 判断相关键是否已经缓存
 func (y *ymlLoader) keyIsCache(keyName string) bool {
-	if _, exists := containerFactory.KeyIsExists(ConfigKeyPrefix + keyName); exists {
+	if _, exists := containerFactory.KeyIsExists(y.prefix + keyName); exists {
 		return true
 	} else {
 		return false
@@ -105,20 +151,20 @@ func (y *ymlLoader) cache(keyName string, value interface{}) bool {
 	// 避免瞬间缓存键、值时，程序提示键名已经被注册的日志输出
 	y.mu.Lock()
 	defer y.mu.Unlock()
-	if _, exists := containerFactory.KeyIsExists(ConfigKeyPrefix + keyName); exists {
+	if _, exists := containerFactory.KeyIsExists(y.prefix + keyName); exists {
 		return true
 	}
-	return containerFactory.Set(ConfigKeyPrefix+keyName, value)
+	return containerFactory.Set(y.prefix+keyName, value)
 }
 
 // 通过键获取缓存的值
 func (y *ymlLoader) getValueFromCache(keyName string) interface{} {
-	return containerFactory.Get(ConfigKeyPrefix + keyName)
+	return containerFactory.Get(y.prefix + keyName)
 }
 
 // 清空已经缓存的配置项信息
 func (y *ymlLoader) clearCache() {
-	containerFactory.FuzzyDelete(ConfigKeyPrefix)
+	containerFactory.FuzzyDelete(y.prefix)
 }
 
 // Clone 允许 clone 一个相同功能的结构体
@@ -127,6 +173,7 @@ func (y *ymlLoader) Clone(fileName string) YmlConfig {
 	var ymlC = *y
 	var ymlConfViper = *(y.viper)
 	(&ymlC).viper = &ymlConfViper
+	(&ymlC).prefix = newPrefix()
 
 	(&ymlC).viper.SetConfigName(fileName)
 	if err := (&ymlC).viper.ReadInConfig(); err != nil {
@@ -235,6 +282,30 @@ func (y *ymlLoader) GetStringSlice(keyName string) []string {
 	}
 }
 
+// UnmarshalKey 将配置项解析到结构体，结构体字段使用 mapstructure 标签，结果不做缓存
+func (y *ymlLoader) UnmarshalKey(keyName string, rawVal interface{}) error {
+	return y.viper.UnmarshalKey(keyName, rawVal)
+}
+
+// Unmarshal 将全部配置项解析到结构体，包含 Set 修改的配置项，结果不做缓存
+func (y *ymlLoader) Unmarshal(rawVal interface{}) error {
+	return y.viper.Unmarshal(rawVal)
+}
+
+// Set 运行时修改配置项，优先于配置文件中的值，不写回配置文件
+func (y *ymlLoader) Set(keyName string, value interface{}) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.viper.Set(keyName, value)
+	containerFactory.Delete(y.prefix + keyName)
+	atomic.AddUint64(&y.revision, 1)
+}
+
+// Revision 配置的修订号，配置文件重新加载或 Set 修改配置项后递增，用于判断缓存的解析结果是否过期
+func (y *ymlLoader) Revision() uint64 {
+	return atomic.LoadUint64(&y.revision)
+}
+
 var basePath string
 
 func BasePath() string {